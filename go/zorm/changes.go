@@ -0,0 +1,142 @@
+package zorm
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// Change is a field of a model whose value differs from its value when the
+// model was last loaded or saved.
+type Change struct {
+	Field string
+	From  any
+	To    any
+}
+
+// Tracker records the field values of a model as it is loaded or saved, so
+// that Put only writes the fields that changed since. Models opt in to
+// tracking by embedding it:
+//
+//	type User struct {
+//		zorm.Tracker
+//
+//		ID   string
+//		Name string
+//	}
+//
+// Models that don't embed a Tracker are never tracked, and Put writes all of
+// their fields.
+type Tracker struct {
+	// snapshot is replaced rather than modified, so that copies of a model
+	// never see each other's later snapshots
+	snapshot map[string]any
+}
+
+func (t *Tracker) tracker() *Tracker {
+	return t
+}
+
+type trackable interface {
+	tracker() *Tracker
+}
+
+var trackerType = reflect.TypeFor[Tracker]()
+
+// trackerOf returns the tracker embedded in a model, a pointer to a struct, or
+// nil when it has none.
+func trackerOf(model any) (*Tracker, reflect.Value) {
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil, reflect.Value{}
+	}
+	t, ok := model.(trackable)
+	if !ok {
+		return nil, reflect.Value{}
+	}
+	return t.tracker(), v.Elem()
+}
+
+// Track records the current values of the named fields of a model, a pointer
+// to a struct embedding a Tracker, as its clean state. Fields tracked earlier
+// keep their recorded values. Repository implementations call Track as models
+// are loaded, so that Put only writes what changed.
+func Track(model any, fields []string) {
+	t, v := trackerOf(model)
+	if t == nil {
+		return
+	}
+
+	snapshot := maps.Clone(t.snapshot)
+	if snapshot == nil {
+		snapshot = make(map[string]any, len(fields))
+	}
+	for _, f := range fields {
+		field := v.FieldByName(f)
+		if field.IsValid() && field.Type() != trackerType {
+			snapshot[f] = snapshotValue(field)
+		}
+	}
+	t.snapshot = snapshot
+}
+
+// Changes returns the tracked fields of a model whose values changed since it
+// was last loaded or saved, sorted by field name. The second result reports
+// whether the model is tracked at all; models that were never loaded, or that
+// don't embed a Tracker, are not.
+func Changes(model any) ([]Change, bool) {
+	t, v := trackerOf(model)
+	if t == nil || t.snapshot == nil {
+		return nil, false
+	}
+
+	var result []Change
+	for _, f := range slices.Sorted(maps.Keys(t.snapshot)) {
+		current := v.FieldByName(f).Interface()
+		if !reflect.DeepEqual(t.snapshot[f], current) {
+			result = append(result, Change{Field: f, From: t.snapshot[f], To: current})
+		}
+	}
+
+	return result, true
+}
+
+// Changed reports whether a field of a model may have changed since it was
+// last loaded or saved. Fields of untracked models, and fields that were not
+// loaded, are assumed changed.
+func Changed(model any, field string) bool {
+	t, v := trackerOf(model)
+	if t == nil {
+		return true
+	}
+
+	old, ok := t.snapshot[field]
+	if !ok {
+		return true
+	}
+
+	return !reflect.DeepEqual(old, v.FieldByName(field).Interface())
+}
+
+// snapshotValue copies a field value so that later changes made through
+// pointers or slices the model holds are still detected.
+func snapshotValue(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v.Interface()
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(v.Elem())
+		return c.Interface()
+	case reflect.Slice:
+		if v.IsNil() {
+			return v.Interface()
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(c, v)
+		return c.Interface()
+	default:
+		return v.Interface()
+	}
+}
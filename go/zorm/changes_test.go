@@ -0,0 +1,102 @@
+package zorm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type trackedModel struct {
+	Tracker
+
+	ID    string
+	Name  string
+	Seen  *time.Time
+	Tags  []string
+	Extra string
+}
+
+func TestChanges(t *testing.T) {
+	seen := time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC)
+	m := &trackedModel{ID: "1", Name: "a", Seen: &seen, Tags: []string{"x"}}
+
+	if _, tracked := Changes(m); tracked {
+		t.Fatalf("Changes() tracked before Track")
+	}
+	if !Changed(m, "Name") {
+		t.Errorf("Changed() = false for untracked model")
+	}
+
+	Track(m, []string{"ID", "Name", "Seen", "Tags"})
+
+	changes, tracked := Changes(m)
+	if !tracked || len(changes) != 0 {
+		t.Fatalf("Changes() = %v, %v, want no changes", changes, tracked)
+	}
+
+	// Changes through pointers and slices are detected
+	m.Name = "b"
+	*m.Seen = seen.Add(time.Hour)
+	m.Tags[0] = "y"
+	m.Extra = "untracked"
+
+	changes, _ = Changes(m)
+	var fields []string
+	for _, c := range changes {
+		fields = append(fields, c.Field)
+	}
+	if want := []string{"Name", "Seen", "Tags"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("Changes() fields = %v, want %v", fields, want)
+	}
+	if changes[0].From != "a" || changes[0].To != "b" {
+		t.Errorf("Changes()[0] = %+v, want a to b", changes[0])
+	}
+
+	if Changed(m, "ID") {
+		t.Errorf("Changed(ID) = true, want false")
+	}
+	if !Changed(m, "Extra") {
+		t.Errorf("Changed(Extra) = false for untracked field")
+	}
+
+	// Tracking again makes the tracked fields clean
+	Track(m, []string{"Name", "Seen", "Tags"})
+	if changes, _ := Changes(m); len(changes) != 0 {
+		t.Errorf("Changes() after Track = %v, want none", changes)
+	}
+}
+
+func TestChangesRequiresTracker(t *testing.T) {
+	type untrackedModel struct {
+		ID string
+	}
+
+	m := &untrackedModel{ID: "1"}
+	Track(m, []string{"ID"})
+
+	if _, tracked := Changes(m); tracked {
+		t.Errorf("Changes() tracked a model without a Tracker")
+	}
+	if !Changed(m, "ID") {
+		t.Errorf("Changed() = false for a model without a Tracker")
+	}
+}
+
+func TestChangesOfCopies(t *testing.T) {
+	m := &trackedModel{ID: "1", Name: "a"}
+	Track(m, []string{"Name"})
+
+	c := *m
+	c.Name = "b"
+	Track(&c, []string{"Name", "Extra"})
+
+	if changes, _ := Changes(&c); len(changes) != 0 {
+		t.Errorf("Changes() of copy = %v, want none", changes)
+	}
+	if !Changed(m, "Extra") {
+		t.Errorf("Changed(Extra) = false, tracking a copy changed the original")
+	}
+	if Changed(m, "Name") {
+		t.Errorf("Changed(Name) = true, want false")
+	}
+}
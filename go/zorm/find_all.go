@@ -3,15 +3,34 @@ package zorm
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/milagre/zote/go/zelement"
+	"github.com/milagre/zote/go/zelement/zsort"
+	"github.com/milagre/zote/go/zreflect"
 )
 
+// FindAll iterates over every model matching opts in pages of pageSize,
+// calling cb for each. Pages are fetched by cursor when opts.Sort only
+// references non-nullable fields of the model, so rows inserted or deleted
+// while iterating do not cause others to be skipped or repeated. Otherwise, or
+// when the repository doesn't support cursors, pages are fetched by offset.
 func FindAll[T any](ctx context.Context, repo Repository, pageSize int, opts FindOptions, cb func(*T) error) error {
 	list := make([]*T, 0, pageSize)
 	opts.Offset = 0
+	opts.After = ""
+	opts.Next = nil
 	page := 0
 
+	var next Cursor
+	if cursorSortable(reflect.TypeFor[T](), opts.Sort) {
+		opts.Next = &next
+	}
+
 	for {
 		list = list[0:0]
+		next = ""
 		err := Find[T](ctx, repo, &list, opts)
 		if err != nil {
 			return fmt.Errorf("finding all on page %d: %w", page, err)
@@ -28,7 +47,39 @@ func FindAll[T any](ctx context.Context, repo Repository, pageSize int, opts Fin
 			return nil
 		}
 
-		opts.Offset += pageSize
+		switch {
+		case opts.Next == nil:
+			opts.Offset += pageSize
+		case next != "":
+			opts.After = next
+		case opts.After == "":
+			// A full first page without a cursor means the repository ignores
+			// Next, so continue by offset
+			opts.Next = nil
+			opts.Offset += pageSize
+		default:
+			return nil
+		}
+
 		page += 1
 	}
 }
+
+// cursorSortable reports whether finds of modelType sorted by sorts may be
+// paginated by cursor, which requires sorting on non-nullable fields of the
+// model itself.
+func cursorSortable(modelType reflect.Type, sorts []zsort.Sort) bool {
+	for _, s := range sorts {
+		f, ok := s.Element.(zelement.Field)
+		if !ok || strings.Contains(f.Name, ".") {
+			return false
+		}
+
+		structField, ok := modelType.FieldByName(f.Name)
+		if !ok || zreflect.IsNullable(structField.Type) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,44 @@
+package zorm
+
+import (
+	"context"
+)
+
+// Models may implement any of the hook interfaces below to run logic around
+// repository operations. Hooks receive the Queryer performing the operation,
+// so any queries they make run in the same transaction. A hook returning an
+// error aborts the operation with that error. Hooks also run for related
+// models written, deleted or loaded through Include.Relations.
+
+// BeforePutHook is called before a model is inserted or updated, and may
+// validate the model or default its fields.
+type BeforePutHook interface {
+	BeforePut(ctx context.Context, q Queryer) error
+}
+
+// AfterPutHook is called once a model has been written.
+type AfterPutHook interface {
+	AfterPut(ctx context.Context, q Queryer) error
+}
+
+// BeforeDeleteHook is called before a model is deleted, once it has been
+// loaded.
+type BeforeDeleteHook interface {
+	BeforeDelete(ctx context.Context, q Queryer) error
+}
+
+// AfterDeleteHook is called once a model has been deleted.
+type AfterDeleteHook interface {
+	AfterDelete(ctx context.Context, q Queryer) error
+}
+
+// AfterLoadHook is called on each model read by Find, Get or Iterate.
+//
+// Iterate calls it as each model is read, while the query's rows are still
+// open on the connection. Within a transaction, an AfterLoad hook of a model
+// that may be iterated must not query through q: the transaction's single
+// connection is busy reading rows, so the query blocks or fails depending on
+// the driver. Find and Get finish reading rows before calling hooks.
+type AfterLoadHook interface {
+	AfterLoad(ctx context.Context, q Queryer) error
+}
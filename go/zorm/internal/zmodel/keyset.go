@@ -0,0 +1,167 @@
+package zmodel
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/milagre/zote/go/zelement"
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zelement/zelem"
+	"github.com/milagre/zote/go/zelement/zsort"
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zreflect"
+)
+
+// Keyset describes the ordered sort keys used to paginate a find by cursor.
+// The keys are the requested sorts followed by any primary key fields not
+// already sorted on, which guarantees a total ordering of the results.
+type Keyset struct {
+	fields     []string
+	directions []zsort.Direction
+	types      []reflect.Type
+}
+
+// cursorData is the decoded form of a zorm.Cursor.
+type cursorData struct {
+	Fields []string          `json:"f"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// NewKeyset returns the keyset paginating finds of structType sorted by
+// sorts, with the given primary key fields.
+func NewKeyset(structType reflect.Type, pkFields []string, sorts []zsort.Sort) (*Keyset, error) {
+	ks := &Keyset{}
+	for _, s := range sorts {
+		f, ok := s.Element.(zelement.Field)
+		if !ok || strings.Contains(f.Name, ".") {
+			return nil, fmt.Errorf("cursor pagination requires sorting on fields of the model, got %v", s.Element)
+		}
+		if err := ks.add(structType, f.Name, s.Direction); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range pkFields {
+		if !slices.Contains(ks.fields, f) {
+			if err := ks.add(structType, f, zsort.Asc); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return ks, nil
+}
+
+func (k *Keyset) add(structType reflect.Type, field string, dir zsort.Direction) error {
+	structField, ok := structType.FieldByName(field)
+	if !ok {
+		return fmt.Errorf("cursor field %s not found on %s", field, structType)
+	}
+
+	// Comparisons with NULL match nothing, so rows would be skipped seeking
+	// past a NULL value
+	if zreflect.IsNullable(structField.Type) {
+		return fmt.Errorf("cursor pagination cannot sort on nullable field %s", field)
+	}
+
+	k.fields = append(k.fields, field)
+	k.directions = append(k.directions, dir)
+	k.types = append(k.types, structField.Type)
+
+	return nil
+}
+
+// Sorts returns the sorts ordering results by the keyset.
+func (k *Keyset) Sorts() []zsort.Sort {
+	result := make([]zsort.Sort, 0, len(k.fields))
+	for i, f := range k.fields {
+		result = append(result, zsort.Sort{
+			Element:   zelem.Field(f),
+			Direction: k.directions[i],
+		})
+	}
+	return result
+}
+
+// Seek builds the predicate selecting rows strictly after the position
+// encoded in the cursor, expanded as:
+//
+//	(a > ?) OR (a = ? AND b > ?) OR (a = ? AND b = ? AND c > ?) ...
+func (k *Keyset) Seek(after zorm.Cursor) (zclause.Clause, error) {
+	values, err := k.decode(after)
+	if err != nil {
+		return nil, err
+	}
+
+	options := make([]zclause.Clause, 0, len(k.fields))
+	for i, f := range k.fields {
+		terms := make([]zclause.Clause, 0, i+1)
+		for j := 0; j < i; j++ {
+			terms = append(terms, zelem.Eq(zelem.Field(k.fields[j]), zelem.Value(values[j])))
+		}
+
+		if k.directions[i] == zsort.Desc {
+			terms = append(terms, zelem.Lt(zelem.Field(f), zelem.Value(values[i])))
+		} else {
+			terms = append(terms, zelem.Gt(zelem.Field(f), zelem.Value(values[i])))
+		}
+
+		options = append(options, zelem.And(terms...))
+	}
+
+	return zelem.Or(options...), nil
+}
+
+// Cursor renders the cursor identifying the position of the given model.
+func (k *Keyset) Cursor(objPtr reflect.Value) (zorm.Cursor, error) {
+	data := cursorData{
+		Fields: k.fields,
+		Values: make([]json.RawMessage, 0, len(k.fields)),
+	}
+
+	for _, f := range k.fields {
+		v, err := json.Marshal(objPtr.Elem().FieldByName(f).Interface())
+		if err != nil {
+			return "", fmt.Errorf("encoding cursor field %s: %w", f, err)
+		}
+		data.Values = append(data.Values, v)
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("encoding cursor: %w", err)
+	}
+
+	return zorm.Cursor(base64.RawURLEncoding.EncodeToString(raw)), nil
+}
+
+func (k *Keyset) decode(c zorm.Cursor) ([]any, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(string(c))
+	if err != nil {
+		return nil, fmt.Errorf("decoding cursor: %w", err)
+	}
+
+	var data cursorData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, fmt.Errorf("decoding cursor: %w", err)
+	}
+
+	if !slices.Equal(data.Fields, k.fields) || len(data.Values) != len(k.fields) {
+		return nil, fmt.Errorf("cursor for %v does not match sort keys %v", data.Fields, k.fields)
+	}
+
+	values := make([]any, 0, len(k.fields))
+	for i, t := range k.types {
+		v := reflect.New(t)
+		if err := json.Unmarshal(data.Values[i], v.Interface()); err != nil {
+			return nil, fmt.Errorf("decoding cursor field %s: %w", k.fields[i], err)
+		}
+		values = append(values, v.Elem().Interface())
+	}
+
+	return values, nil
+}
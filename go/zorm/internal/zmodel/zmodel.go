@@ -0,0 +1,109 @@
+// Package zmodel holds the reflection over models that zorm repository
+// implementations share: hooks, cursors, versions, timestamps and changes.
+package zmodel
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/ztime"
+)
+
+// RunHooks calls hook on each model implementing the hook interface H.
+func RunHooks[H any](models []reflect.Value, hook func(H) error) error {
+	for _, m := range models {
+		if m.Kind() == reflect.Ptr && m.IsNil() {
+			continue
+		}
+		h, ok := m.Interface().(H)
+		if !ok {
+			continue
+		}
+		if err := hook(h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitVersion starts a version field of a model about to be inserted at 1
+// when it is unset.
+func InitVersion(field reflect.Value) {
+	if !field.IsZero() {
+		return
+	}
+
+	if field.CanInt() {
+		field.SetInt(1)
+	} else if field.CanUint() {
+		field.SetUint(1)
+	}
+}
+
+// BumpVersion increments a version field after a successful update.
+func BumpVersion(field reflect.Value) {
+	if field.CanInt() {
+		field.SetInt(field.Int() + 1)
+	} else if field.CanUint() {
+		field.SetUint(field.Uint() + 1)
+	}
+}
+
+// StampTimes sets the created fields of a model that are unset, and its
+// updated fields, to now.
+func StampTimes(objPtr reflect.Value, now time.Time, created, updated []string) error {
+	for _, f := range created {
+		field := objPtr.Elem().FieldByName(f)
+		if !field.IsZero() {
+			continue
+		}
+		if err := SetTime(field, now); err != nil {
+			return fmt.Errorf("stamping %s: %w", f, err)
+		}
+	}
+
+	for _, f := range updated {
+		if err := SetTime(objPtr.Elem().FieldByName(f), now); err != nil {
+			return fmt.Errorf("stamping %s: %w", f, err)
+		}
+	}
+
+	return nil
+}
+
+// SetTime sets a time.Time or ztime.Date field, or a pointer to either, to t.
+func SetTime(field reflect.Value, t time.Time) error {
+	var val any
+	switch field.Type() {
+	case reflect.TypeFor[time.Time](), reflect.TypeFor[*time.Time]():
+		val = t
+	case reflect.TypeFor[ztime.Date](), reflect.TypeFor[*ztime.Date]():
+		val = ztime.NewDate(t)
+	default:
+		return fmt.Errorf("unsupported time field type %s", field.Type())
+	}
+
+	v := reflect.ValueOf(val)
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		v = ptr
+	}
+	field.Set(v)
+
+	return nil
+}
+
+// ChangedFields returns the fields of a model that may have changed since it
+// was loaded. It is empty when the model is clean.
+func ChangedFields(objPtr reflect.Value, fields []string) []string {
+	var result []string
+	for _, f := range fields {
+		if zorm.Changed(objPtr.Interface(), f) {
+			result = append(result, f)
+		}
+	}
+	return result
+}
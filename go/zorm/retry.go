@@ -0,0 +1,66 @@
+package zorm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/milagre/zote/go/zsql"
+	"github.com/milagre/zote/go/zstats"
+)
+
+// RetryChecker is implemented by repositories that can tell which errors
+// abort a transaction that may succeed when run again from the start, such as
+// deadlocks and serialization failures.
+type RetryChecker interface {
+	IsRetryableError(error) bool
+}
+
+// RetryOptions configures how BeginWithRetry retries transactions, backing
+// off between attempts like zsql.BeginWithRetry does.
+type RetryOptions = zsql.RetryOptions
+
+// BeginWithRetry runs cb in a transaction begun on repo, committing it when
+// cb succeeds and rolling it back when cb fails. When the repository is a
+// RetryChecker reporting the failure retryable, cb is run again in a new
+// transaction, so it must be safe to run more than once. Each retry is
+// counted in the "orm.transaction.retry" stat, and transactions failing after
+// every attempt in "orm.transaction.retries_exhausted".
+//
+// Transactions nested in another aren't retried, as the errors that abort them
+// abort the outer transaction; retry the outer transaction instead.
+func BeginWithRetry(ctx context.Context, repo Beginner, opts RetryOptions, cb func(context.Context, Transaction) error) error {
+	checker, ok := repo.(RetryChecker)
+	if _, nested := repo.(Transaction); nested || !ok {
+		return transact(ctx, repo, cb)
+	}
+
+	stats := zstats.FromContext(ctx).WithPrefix("orm.transaction")
+
+	return zsql.Retry(ctx, opts, stats, checker.IsRetryableError, func() error {
+		return transact(ctx, repo, cb)
+	})
+}
+
+func transact(ctx context.Context, repo Beginner, cb func(context.Context, Transaction) error) error {
+	tx, err := repo.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+
+	err = cb(ctx, tx)
+	if err != nil {
+		e := tx.Rollback()
+		if e != nil {
+			return fmt.Errorf("rolling back transaction after error: %s: %w", e, err)
+		}
+
+		return fmt.Errorf("transaction rolled back: %w", err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
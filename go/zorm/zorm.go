@@ -15,6 +15,11 @@
 //		Sort:  []zsort.Sort{{Field: "Created", Desc: true}},
 //	})
 //
+//	// Stream every match without loading them all at once
+//	for user, err := range zorm.Iterate[User](ctx, repo, zorm.FindOptions{}) {
+//		...
+//	}
+//
 //	// Get by primary key
 //	user := &User{ID: 123}
 //	zorm.Get(ctx, repo, []*User{user}, zorm.GetOptions{})
@@ -25,6 +30,14 @@
 //	// Delete
 //	zorm.Delete(ctx, repo, []*User{user}, zorm.DeleteOptions{})
 //
+//	// Count, check existence or aggregate without loading records
+//	n, _ := zorm.Count[User](ctx, repo, zelem.Eq(zelem.Field("Active"), zelem.Value(true)))
+//	var totals []struct{ AccountID string; Users int }
+//	zorm.Aggregate[User](ctx, repo, &totals, zorm.AggregateOptions{
+//		GroupBy:    []string{"AccountID"},
+//		Aggregates: []zorm.Aggregation{{Func: zorm.AggregateCount, As: "Users"}},
+//	})
+//
 // # Transactions
 //
 // Repositories provide transaction support:
@@ -33,12 +46,22 @@
 //	zorm.Put(ctx, tx, []*User{{Name: "Bob"}}, zorm.PutOptions{})
 //	tx.Commit() // or tx.Rollback()
 //
+// Transactions that also implement Beginner, such as zormsql's, begin nested
+// transactions, letting code that runs its own unit of work compose with a
+// caller's transaction:
+//
+//	if b, ok := q.(zorm.Beginner); ok {
+//		tx, _ := b.Begin(ctx)
+//		...
+//	}
+//
 // See zormsql for the SQL-based implementation with mapping configuration.
 package zorm
 
 import (
 	"context"
 	"fmt"
+	"iter"
 
 	"github.com/milagre/zote/go/zelement/zclause"
 	"github.com/milagre/zote/go/zelement/zsort"
@@ -47,13 +70,25 @@ import (
 var (
 	ErrNotFound = fmt.Errorf("not found")
 	ErrConflict = fmt.Errorf("conflict")
+
+	// ErrNoKey is returned by Get for models that have neither their primary
+	// key nor any unique key populated, so can't identify a stored model.
+	ErrNoKey = fmt.Errorf("no populated key")
 )
 
 type Queryer interface {
 	Find(ctx context.Context, ptrToListOfPtrs any, opts FindOptions) error
+	Iterate(ctx context.Context, model any, opts FindOptions) iter.Seq2[any, error]
 	Get(ctx context.Context, listOfPtrs any, opts GetOptions) error
 	Put(ctx context.Context, listOfPtrs any, opts PutOptions) error
 	Delete(ctx context.Context, listOfPtrs any, opts DeleteOptions) error
+
+	Count(ctx context.Context, model any, where zclause.Clause) (int, error)
+	Exists(ctx context.Context, model any, where zclause.Clause) (bool, error)
+	Aggregate(ctx context.Context, model any, ptrToListOfResults any, opts AggregateOptions) error
+
+	DeleteWhere(ctx context.Context, model any, where zclause.Clause, opts DeleteWhereOptions) (int, error)
+	UpdateWhere(ctx context.Context, model any, where zclause.Clause, set map[string]any) (int, error)
 }
 
 type Beginner interface {
@@ -75,11 +110,57 @@ type Repository interface {
 type PutOptions struct {
 	Include    Include
 	GetOptions GetOptions
+
+	// OnConflict, when its Action is not ConflictError, writes each model with
+	// a single atomic upsert statement instead of probing for an existing row.
+	// It applies to the models being put, not their related models.
+	OnConflict OnConflict
+}
+
+type ConflictAction int
+
+const (
+	// ConflictError updates models found by their populated key, inserts the
+	// rest and reports ErrConflict if an insert collides with another row.
+	ConflictError ConflictAction = iota
+
+	// ConflictIgnore leaves conflicting rows unchanged.
+	ConflictIgnore
+
+	// ConflictUpdate overwrites OnConflict.Fields of conflicting rows.
+	ConflictUpdate
+)
+
+type OnConflict struct {
+	Action ConflictAction
+
+	// Key names the fields of the unique key that detects a conflict, and
+	// must be populated on every model. Defaults to the primary key; set it
+	// to detect conflicts on another unique key. MySQL detects conflicts on
+	// any unique key regardless.
+	Key []string
+
+	// Fields to overwrite for ConflictUpdate, defaulting to all updatable
+	// fields outside of Key.
+	Fields Fields
 }
 
 type DeleteOptions struct {
-	// Include    Include // Not yet implemented
+	// Include.Relations names related models to delete along with each model,
+	// recursively. Only related models matching a relation's Where are
+	// deleted. Include.Fields is ignored.
+	Include    Include
 	GetOptions GetOptions
+
+	// HardDelete removes rows of models that are soft deleted by default,
+	// including rows that were already soft deleted.
+	HardDelete bool
+}
+
+type DeleteWhereOptions struct {
+	// HardDelete removes rows of models that are soft deleted by default,
+	// including rows that were already soft deleted.
+	HardDelete bool
 }
 
 type FindOptions struct {
@@ -87,10 +168,62 @@ type FindOptions struct {
 	Sort    []zsort.Sort
 	Where   zclause.Clause
 	Offset  int
+
+	// After continues a keyset paginated find from the position identified by
+	// a cursor previously received through Next. It cannot be combined with
+	// Offset, and Sort must match the find that produced the cursor.
+	After Cursor
+
+	// Next, when non-nil, enables keyset pagination and receives the cursor
+	// for the page following the results, or an empty cursor once the results
+	// are exhausted. Sort may only reference fields of the model; the primary
+	// key is appended as a tiebreaker.
+	Next *Cursor
+
+	// IncludeDeleted finds soft deleted models and related models, which are
+	// otherwise excluded.
+	IncludeDeleted bool
+}
+
+// Cursor is an opaque position within a sorted result set, used for keyset
+// pagination. See FindOptions.After and FindOptions.Next.
+type Cursor string
+
+// AggregateOptions describes a grouped aggregate query. Results are read into
+// a slice of structs, struct pointers or map[string]any. Struct results receive
+// each GroupBy value in the field named by the path with its dots removed (e.g.
+// "Account.Company" is read into AccountCompany) and each aggregate in the
+// field named by its As; map results are keyed by the path and As verbatim.
+type AggregateOptions struct {
+	Where      zclause.Clause
+	GroupBy    []string
+	Aggregates []Aggregation
+}
+
+type AggregateFunc string
+
+const (
+	AggregateCount AggregateFunc = "count"
+	AggregateSum   AggregateFunc = "sum"
+	AggregateAvg   AggregateFunc = "avg"
+	AggregateMin   AggregateFunc = "min"
+	AggregateMax   AggregateFunc = "max"
+)
+
+// Aggregation applies Func to Field, which may be a dot-delimited relation
+// path. AggregateCount with an empty Field counts rows.
+type Aggregation struct {
+	Func  AggregateFunc
+	Field string
+	As    string
 }
 
 type GetOptions struct {
 	Include Include
+
+	// IncludeDeleted gets soft deleted models and related models, which are
+	// otherwise reported as not found.
+	IncludeDeleted bool
 }
 
 type Include struct {
@@ -194,9 +327,30 @@ func Find[T any](ctx context.Context, repo Queryer, list *[]*T, opts FindOptions
 	return repo.Find(ctx, list, opts)
 }
 
+// Iterate streams the models matching opts from a single query, in constant
+// memory, with relations populated. Offset and Next are not supported; use
+// After to resume from a cursor. The query holds its connection until the
+// loop ends, so within a transaction the loop body and AfterLoad hooks must
+// not use the transaction. Iteration stops after the first error.
+func Iterate[T any](ctx context.Context, repo Queryer, opts FindOptions) iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		for model, err := range repo.Iterate(ctx, (*T)(nil), opts) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(model.(*T), nil) {
+				return
+			}
+		}
+	}
+}
+
 // Put saves the provided models, creating new records or updating existing ones as appropriate.
 // After the operation, models are refreshed with any generated values.
-// Use Include.Relations to cascade saves to related models.
+// Use Include.Relations to cascade saves to related models. Models embedding a
+// Tracker that were loaded by the repository only write the fields changed
+// since, and aren't written at all when unchanged; see Changes.
 func Put[T any](ctx context.Context, repo Queryer, list []*T, opts PutOptions) error {
 	return repo.Put(ctx, list, opts)
 }
@@ -206,10 +360,35 @@ func Delete[T any](ctx context.Context, repo Queryer, list []*T, opts DeleteOpti
 	return repo.Delete(ctx, list, opts)
 }
 
-/*
+// Count returns the number of models matching the where clause, which may be nil.
+func Count[T any](ctx context.Context, repo Queryer, where zclause.Clause) (int, error) {
+	return repo.Count(ctx, (*T)(nil), where)
+}
 
-func DeleteWhere[T any](ctx context.Context, list []T, clause zclause.Clause, opts DeleteOptions) (int, error) {
-	return deleteWhere(ctx, source, list, clause, opts)
+// Exists reports whether any model matches the where clause, which may be nil.
+func Exists[T any](ctx context.Context, repo Queryer, where zclause.Clause) (bool, error) {
+	return repo.Exists(ctx, (*T)(nil), where)
 }
 
-*/
+// Aggregate computes grouped aggregates over the models of type T, reading
+// one result per group into results. See AggregateOptions.
+func Aggregate[T any, R any](ctx context.Context, repo Queryer, results *[]R, opts AggregateOptions) error {
+	return repo.Aggregate(ctx, (*T)(nil), results, opts)
+}
+
+// DeleteWhere removes every model of type T matching the where clause in a
+// single statement and returns the number of rows deleted. Unlike Delete, no
+// models are loaded, so relations are left untouched. Models that are soft
+// deleted by default are soft deleted, unless opts.HardDelete is set. The
+// where clause is required.
+func DeleteWhere[T any](ctx context.Context, repo Queryer, where zclause.Clause, opts DeleteWhereOptions) (int, error) {
+	return repo.DeleteWhere(ctx, (*T)(nil), where, opts)
+}
+
+// UpdateWhere assigns the field values in set to every model of type T
+// matching the where clause in a single statement and returns the number of
+// rows updated. Values may be zelement elements, such as zelem.MethodNow(), to
+// assign computed values. The where clause is required.
+func UpdateWhere[T any](ctx context.Context, repo Queryer, where zclause.Clause, set map[string]any) (int, error) {
+	return repo.UpdateWhere(ctx, (*T)(nil), where, set)
+}
@@ -0,0 +1,174 @@
+package zormcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/milagre/zote/go/zelement"
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zelement/zmethod"
+	"github.com/milagre/zote/go/zelement/zsort"
+	"github.com/milagre/zote/go/zorm"
+)
+
+var (
+	_ zclause.Visitor  = &canon{}
+	_ zelement.Visitor = &canon{}
+)
+
+// canon renders find options canonically, so that finds with equal options
+// share a cache key. Values are rendered with their type, so that equal
+// looking values of different types don't.
+type canon struct {
+	b   strings.Builder
+	err error
+}
+
+func (c *canon) printf(format string, args ...any) {
+	fmt.Fprintf(&c.b, format, args...)
+}
+
+func (c *canon) findOptions(opts zorm.FindOptions) {
+	c.include(opts.Include)
+	c.printf("where=")
+	c.clause(opts.Where)
+	c.printf(";sort=")
+	c.sorts(opts.Sort)
+	c.printf(";offset=%d;after=%q;deleted=%t;", opts.Offset, opts.After, opts.IncludeDeleted)
+}
+
+func (c *canon) include(include zorm.Include) {
+	c.printf("fields=%q;relations={", []string(include.Fields))
+	for _, name := range slices.Sorted(maps.Keys(include.Relations)) {
+		rel := include.Relations[name]
+		c.printf("%q:{", name)
+		c.include(rel.Include)
+		c.printf("where=")
+		c.clause(rel.Where)
+		c.printf(";sort=")
+		c.sorts(rel.Sort)
+		c.printf("}")
+	}
+	c.printf("};")
+}
+
+func (c *canon) clause(clause zclause.Clause) {
+	if clause == nil {
+		c.printf("nil")
+		return
+	}
+	if err := clause.Accept(c); err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *canon) elem(e zelement.Element) {
+	if e == nil {
+		c.printf("nil")
+		return
+	}
+	if err := e.Accept(c); err != nil && c.err == nil {
+		c.err = err
+	}
+}
+
+func (c *canon) sorts(sorts []zsort.Sort) {
+	for _, s := range sorts {
+		c.printf("(%d,", s.Direction)
+		c.elem(s.Element)
+		c.printf(")")
+	}
+}
+
+func (c *canon) binary(op string, left zelement.Element, right zelement.Element) error {
+	c.printf("%s(", op)
+	c.elem(left)
+	c.printf(",")
+	c.elem(right)
+	c.printf(")")
+	return nil
+}
+
+func (c *canon) node(op string, clauses []zclause.Clause) error {
+	c.printf("%s(", op)
+	for _, clause := range clauses {
+		c.clause(clause)
+		c.printf(",")
+	}
+	c.printf(")")
+	return nil
+}
+
+func (c *canon) VisitEq(eq zclause.Eq) error    { return c.binary("eq", eq.Left, eq.Right) }
+func (c *canon) VisitNeq(neq zclause.Neq) error { return c.binary("neq", neq.Left, neq.Right) }
+func (c *canon) VisitGt(gt zclause.Gt) error    { return c.binary("gt", gt.Left, gt.Right) }
+func (c *canon) VisitGte(gte zclause.Gte) error { return c.binary("gte", gte.Left, gte.Right) }
+func (c *canon) VisitLt(lt zclause.Lt) error    { return c.binary("lt", lt.Left, lt.Right) }
+func (c *canon) VisitLte(lte zclause.Lte) error { return c.binary("lte", lte.Left, lte.Right) }
+func (c *canon) VisitAnd(and zclause.And) error { return c.node("and", and.Clauses) }
+func (c *canon) VisitOr(or zclause.Or) error    { return c.node("or", or.Clauses) }
+
+func (c *canon) VisitNot(not zclause.Not) error {
+	c.printf("not(")
+	c.clause(not.Clause)
+	c.printf(")")
+	return nil
+}
+
+func (c *canon) VisitTruthy(t zclause.Truthy) error {
+	c.printf("truthy(")
+	c.elem(t.Elem)
+	c.printf(")")
+	return nil
+}
+
+func (c *canon) VisitIn(in zclause.In) error {
+	c.printf("in(")
+	for _, e := range in.Left {
+		c.elem(e)
+		c.printf(",")
+	}
+	c.printf(";")
+	for _, row := range in.Right {
+		c.printf("(")
+		for _, e := range row {
+			c.elem(e)
+			c.printf(",")
+		}
+		c.printf(")")
+	}
+	c.printf(")")
+	return nil
+}
+
+func (c *canon) VisitValue(e zelement.Value) error {
+	data, err := json.Marshal(e.Value)
+	if err != nil {
+		return fmt.Errorf("rendering value %v: %w", e.Value, err)
+	}
+	c.printf("value(%T:%s)", e.Value, data)
+	return nil
+}
+
+func (c *canon) VisitField(e zelement.Field) error {
+	c.printf("field(%q)", e.Name)
+	return nil
+}
+
+func (c *canon) VisitMethod(e zelement.Method) error {
+	// The results of finds relative to the current time change as it passes
+	if zmethod.Method(e.Name) == zmethod.Now {
+		return fmt.Errorf("finds using %s are not cached", e.Name)
+	}
+
+	c.printf("method(%q", e.Name)
+	for _, p := range e.Params {
+		c.printf(",")
+		c.elem(p)
+	}
+	c.printf(")")
+	return nil
+}
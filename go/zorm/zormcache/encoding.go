@@ -0,0 +1,143 @@
+package zormcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/milagre/zote/go/zorm"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	trackerType       = reflect.TypeFor[zorm.Tracker]()
+)
+
+// fields returns the names of the fields of a model type, a struct, that are
+// cached: its exported fields other than its zorm.Tracker.
+func fields(t reflect.Type) []string {
+	result := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.IsExported() && f.Type != trackerType {
+			result = append(result, f.Name)
+		}
+	}
+	return result
+}
+
+// encodedModel is how a model is cached.
+type encodedModel struct {
+	Fields map[string]json.RawMessage `json:"fields"`
+
+	// Tracked names the fields that were tracked as loaded, see zorm.Track
+	Tracked []string `json:"tracked,omitempty"`
+}
+
+// isModel reports whether values of t are related models to be encoded field
+// by field, rather than values encoded as JSON, such as *time.Time.
+func isModel(t reflect.Type) bool {
+	return t.Kind() == reflect.Ptr &&
+		t.Elem().Kind() == reflect.Struct &&
+		!t.Implements(jsonMarshalerType)
+}
+
+// encode encodes a model, a list of models, or a field value of a model.
+// Models are encoded with their fields by name, regardless of their json tags,
+// so that they're cached whole, along with the fields the decorated
+// repository tracked as it loaded them.
+func encode(v reflect.Value) (json.RawMessage, error) {
+	switch {
+	case isModel(v.Type()):
+		if v.IsNil() {
+			return json.RawMessage("null"), nil
+		}
+
+		obj := encodedModel{Fields: map[string]json.RawMessage{}}
+		for _, f := range fields(v.Type().Elem()) {
+			data, err := encode(v.Elem().FieldByName(f))
+			if err != nil {
+				return nil, fmt.Errorf("encoding field %s: %w", f, err)
+			}
+			obj.Fields[f] = data
+
+			// Fields of a model just loaded are unchanged if they're tracked
+			if !zorm.Changed(v.Interface(), f) {
+				obj.Tracked = append(obj.Tracked, f)
+			}
+		}
+		return json.Marshal(obj)
+
+	case v.Kind() == reflect.Slice && isModel(v.Type().Elem()):
+		if v.IsNil() {
+			return json.RawMessage("null"), nil
+		}
+
+		list := make([]json.RawMessage, v.Len())
+		for i := range list {
+			data, err := encode(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("encoding index %d: %w", i, err)
+			}
+			list[i] = data
+		}
+		return json.Marshal(list)
+
+	default:
+		return json.Marshal(v.Interface())
+	}
+}
+
+// decode decodes what encode encoded from a value of v's type into v.
+func decode(data []byte, v reflect.Value) error {
+	switch {
+	case isModel(v.Type()):
+		if bytes.Equal(data, []byte("null")) {
+			v.SetZero()
+			return nil
+		}
+
+		var obj encodedModel
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+
+		model := reflect.New(v.Type().Elem())
+		for _, f := range fields(v.Type().Elem()) {
+			if field, ok := obj.Fields[f]; ok {
+				if err := decode(field, model.Elem().FieldByName(f)); err != nil {
+					return fmt.Errorf("decoding field %s: %w", f, err)
+				}
+			}
+		}
+		if len(obj.Tracked) > 0 {
+			zorm.Track(model.Interface(), obj.Tracked)
+		}
+		v.Set(model)
+		return nil
+
+	case v.Kind() == reflect.Slice && isModel(v.Type().Elem()):
+		if bytes.Equal(data, []byte("null")) {
+			v.SetZero()
+			return nil
+		}
+
+		var list []json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil {
+			return err
+		}
+
+		models := reflect.MakeSlice(v.Type(), len(list), len(list))
+		for i, item := range list {
+			if err := decode(item, models.Index(i)); err != nil {
+				return fmt.Errorf("decoding index %d: %w", i, err)
+			}
+		}
+		v.Set(models)
+		return nil
+
+	default:
+		return json.Unmarshal(data, v.Addr().Interface())
+	}
+}
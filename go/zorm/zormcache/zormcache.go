@@ -0,0 +1,651 @@
+// Package zormcache caches the models of a zorm.Repository in a zcache.Cache.
+//
+// Model types are registered with the fields of their primary key. Gets of
+// registered models by primary key, without options, are served through
+// zcache.ReadThrough, and with Options.Finds set, so are the results of Finds
+// outside of transactions:
+//
+//	repo := zormcache.New(sqlRepo, cache, zormcache.Options{Finds: true})
+//	repo.Cache(&User{}, "ID")
+//
+// Puts and Deletes made through the repository clear the cached models they
+// write, and the cached Finds of every model type they write, once they've
+// been committed. Cached Finds are keyed by their options and by a generation
+// of each model type they read, which writes replace. Writes made other than
+// through the repository, and related models deleted by Put as orphans, are
+// only seen once cached entries expire.
+//
+// Models are cached field by field, along with the related models loaded into
+// them, by the names of their fields; their json tags, if any, don't affect
+// what's cached. Models served from the cache are tracked as the decorated
+// repository tracked them when it loaded them, see zorm.Tracker.
+//
+// Like ReadThrough, failures of the cache never fail a call; they're logged as
+// warnings, and the call is served by the decorated repository.
+package zormcache
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/milagre/zote/go/zcache"
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zlog"
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zreflect"
+	"github.com/milagre/zote/go/zwarn"
+)
+
+var (
+	_ zorm.Repository  = &Repository{}
+	_ zorm.Transaction = &Transaction{}
+	_ zorm.Beginner    = &Transaction{}
+)
+
+// Options configures a caching repository.
+type Options struct {
+	// Namespace holds every cache entry of the repository, defaulting to
+	// "zorm".
+	Namespace string
+
+	// Expiration is how long models and finds stay cached, defaulting to 5
+	// minutes.
+	Expiration time.Duration
+
+	// Finds enables caching the results of Find.
+	Finds bool
+}
+
+type config struct {
+	cache zcache.Cache
+	opts  Options
+
+	mu          sync.RWMutex
+	primaryKeys map[reflect.Type][]string
+}
+
+// Repository decorates a zorm.Repository, caching its models.
+type Repository struct {
+	*queryer
+	repo zorm.Repository
+}
+
+// Transaction reads from and writes to the decorated transaction, bypassing
+// the cache so that it sees its own writes, and clears what it wrote from the
+// cache once committed.
+type Transaction struct {
+	*queryer
+	tx zorm.Transaction
+
+	// ctx is the context the transaction began with, which cache failures
+	// on commit are logged with
+	ctx context.Context
+
+	// parent collects what the transaction this one is nested in wrote,
+	// which this one's writes join once committed; nil when not nested
+	parent *invalidation
+}
+
+type queryer struct {
+	cfg   *config
+	inner zorm.Queryer
+
+	// pending collects what a transaction wrote, to be cleared from the cache
+	// once committed; nil outside of transactions
+	pending *invalidation
+}
+
+func New(repo zorm.Repository, cache zcache.Cache, opts Options) *Repository {
+	if opts.Namespace == "" {
+		opts.Namespace = "zorm"
+	}
+	if opts.Expiration <= 0 {
+		opts.Expiration = 5 * time.Minute
+	}
+
+	return &Repository{
+		queryer: &queryer{
+			cfg: &config{
+				cache:       cache,
+				opts:        opts,
+				primaryKeys: map[reflect.Type][]string{},
+			},
+			inner: repo,
+		},
+		repo: repo,
+	}
+}
+
+// Cache registers a model type, given as a pointer to a struct, to be cached
+// by the fields of its primary key. It panics if a field doesn't exist.
+func (r *Repository) Cache(model any, primaryKey ...string) {
+	t := reflect.TypeOf(model)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("Caching requires a pointer to a struct, got %T", model))
+	}
+	if len(primaryKey) == 0 {
+		panic(fmt.Sprintf("Caching %s requires its primary key fields", t))
+	}
+	for _, f := range primaryKey {
+		if _, ok := t.Elem().FieldByName(f); !ok {
+			panic(fmt.Sprintf("Primary key field %s not found on %s", f, t))
+		}
+	}
+
+	r.cfg.mu.Lock()
+	defer r.cfg.mu.Unlock()
+
+	if _, ok := r.cfg.primaryKeys[t]; ok {
+		panic(fmt.Sprintf("Duplicate caching of type %s", t))
+	}
+	r.cfg.primaryKeys[t] = primaryKey
+}
+
+func (r *Repository) Begin(ctx context.Context) (zorm.Transaction, error) {
+	tx, err := r.repo.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transaction{
+		queryer: &queryer{
+			cfg:     r.cfg,
+			inner:   tx,
+			pending: &invalidation{},
+		},
+		tx:  tx,
+		ctx: ctx,
+	}, nil
+}
+
+// IsRetryableError reports whether the decorated repository considers err to
+// have aborted a transaction that may succeed when run again, see
+// zorm.BeginWithRetry.
+func (r *Repository) IsRetryableError(err error) bool {
+	checker, ok := r.repo.(zorm.RetryChecker)
+	return ok && checker.IsRetryableError(err)
+}
+
+// Begin begins a transaction nested in this one, when the decorated
+// transaction supports nesting; see zorm.Beginner. What it writes is cleared
+// from the cache once the outermost transaction commits.
+func (t *Transaction) Begin(ctx context.Context) (zorm.Transaction, error) {
+	beginner, ok := t.tx.(zorm.Beginner)
+	if !ok {
+		return nil, fmt.Errorf("nested transactions unsupported by %T", t.tx)
+	}
+
+	tx, err := beginner.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transaction{
+		queryer: &queryer{
+			cfg:     t.cfg,
+			inner:   tx,
+			pending: &invalidation{},
+		},
+		tx:     tx,
+		ctx:    ctx,
+		parent: t.pending,
+	}, nil
+}
+
+func (t *Transaction) Commit() error {
+	if err := t.tx.Commit(); err != nil {
+		return err
+	}
+
+	if t.parent != nil {
+		t.parent.merge(*t.pending)
+		*t.pending = invalidation{}
+		return nil
+	}
+
+	t.cfg.clear(t.ctx, *t.pending)
+	*t.pending = invalidation{}
+
+	return nil
+}
+
+func (t *Transaction) Rollback() error {
+	*t.pending = invalidation{}
+	return t.tx.Rollback()
+}
+
+// invalidation is what a write makes stale: the cached models it wrote, and
+// the cached finds of the model types it wrote.
+type invalidation struct {
+	keys  []string
+	types []reflect.Type
+}
+
+func (i *invalidation) merge(o invalidation) {
+	i.keys = append(i.keys, o.keys...)
+	i.types = append(i.types, o.types...)
+}
+
+// invalidate clears what a write made stale from the cache, or leaves it to be
+// cleared on commit within a transaction.
+func (q *queryer) invalidate(ctx context.Context, inv invalidation) {
+	if q.pending != nil {
+		q.pending.merge(inv)
+		return
+	}
+	q.cfg.clear(ctx, inv)
+}
+
+func (c *config) clear(ctx context.Context, inv invalidation) {
+	keys := inv.keys
+	seen := map[reflect.Type]bool{}
+	for _, t := range inv.types {
+		if !seen[t] {
+			seen[t] = true
+			keys = append(keys, generationKey(t))
+		}
+	}
+
+	for _, key := range keys {
+		clearCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		err := c.cache.Clear(clearCtx, c.opts.Namespace, key)
+		cancel()
+		if err != nil {
+			warn(ctx, zwarn.Warnf("clearing cached %s: %v", key, err))
+		}
+	}
+}
+
+func warn(ctx context.Context, w zwarn.Warning) {
+	// ReadThrough returns an empty list of warnings along with errors
+	if ws, ok := w.(zwarn.Warnings); ok && len(ws) == 0 {
+		return
+	}
+	zlog.FromContext(ctx).Warn(w.Warning())
+}
+
+// primaryKey returns the primary key fields of a registered model pointer
+// type.
+func (c *config) primaryKey(t reflect.Type) ([]string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pk, ok := c.primaryKeys[t]
+	return pk, ok
+}
+
+// modelKey returns the cache key of a model, or false when its type isn't
+// registered or its primary key isn't populated.
+func (c *config) modelKey(obj reflect.Value) (string, bool) {
+	pk, ok := c.primaryKey(obj.Type())
+	if !ok || obj.IsNil() {
+		return "", false
+	}
+
+	values := make([]any, 0, len(pk))
+	for _, f := range pk {
+		v := obj.Elem().FieldByName(f)
+		if v.IsZero() {
+			return "", false
+		}
+		values = append(values, v.Interface())
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", false
+	}
+
+	return "model:" + zreflect.TypeID(obj.Type()) + ":" + string(data), true
+}
+
+func generationKey(t reflect.Type) string {
+	return "generation:" + zreflect.TypeID(t)
+}
+
+// generation returns the current generation of a model type's cached finds,
+// starting a new one when there's none.
+func (c *config) generation(ctx context.Context, t reflect.Type) (string, zwarn.Warning, error) {
+	return zcache.ReadThrough(
+		ctx,
+		c.cache,
+		c.opts.Namespace,
+		generationKey(t),
+		c.opts.Expiration,
+		func(ctx context.Context) (string, error) {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				return "", err
+			}
+			return hex.EncodeToString(b), nil
+		},
+		func(s string) ([]byte, error) { return []byte(s), nil },
+		func(data []byte) (string, error) { return string(data), nil },
+	)
+}
+
+// listOf returns a list of model pointers, or a pointer to one, along with
+// its element type.
+func listOf(list any) (reflect.Value, reflect.Type, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Ptr || v.Type().Elem().Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, nil, fmt.Errorf("list of pointers to structs required, got %T", list)
+	}
+	return v, v.Type().Elem(), nil
+}
+
+func (q *queryer) Get(ctx context.Context, listOfPtrs any, opts zorm.GetOptions) error {
+	list, modelType, err := listOf(listOfPtrs)
+	if err != nil {
+		return fmt.Errorf("invalid argument to get: %w", err)
+	}
+
+	// Only whole models are cached, and only committed ones
+	if q.pending != nil || !opts.Include.IsEmpty() || opts.IncludeDeleted {
+		return q.inner.Get(ctx, listOfPtrs, opts)
+	}
+
+	keys := make([]string, list.Len())
+	for i := range keys {
+		key, ok := q.cfg.modelKey(list.Index(i))
+		if !ok {
+			return q.inner.Get(ctx, listOfPtrs, opts)
+		}
+		keys[i] = key
+	}
+
+	pk, _ := q.cfg.primaryKey(modelType)
+
+	for i, key := range keys {
+		obj := list.Index(i)
+
+		loaded, w, err := zcache.ReadThrough(
+			ctx,
+			q.cfg.cache,
+			q.cfg.opts.Namespace,
+			key,
+			q.cfg.opts.Expiration,
+			func(ctx context.Context) (reflect.Value, error) {
+				one := reflect.New(modelType.Elem())
+				for _, f := range pk {
+					one.Elem().FieldByName(f).Set(obj.Elem().FieldByName(f))
+				}
+
+				ones := reflect.MakeSlice(list.Type(), 1, 1)
+				ones.Index(0).Set(one)
+				if err := q.inner.Get(ctx, ones.Interface(), opts); err != nil {
+					return reflect.Value{}, err
+				}
+				return one, nil
+			},
+			func(v reflect.Value) ([]byte, error) {
+				return encode(v)
+			},
+			func(data []byte) (reflect.Value, error) {
+				v := reflect.New(modelType).Elem()
+				return v, decode(data, v)
+			},
+		)
+		if w != nil {
+			warn(ctx, w)
+		}
+		if err != nil {
+			return fmt.Errorf("object at index %d: %w", i, err)
+		}
+
+		obj.Elem().Set(loaded.Elem())
+	}
+
+	return nil
+}
+
+func (q *queryer) Find(ctx context.Context, ptrToListOfPtrs any, opts zorm.FindOptions) error {
+	list, modelType, err := listOf(ptrToListOfPtrs)
+	if err != nil {
+		return fmt.Errorf("invalid argument to find: %w", err)
+	}
+
+	// Finds returning a cursor aren't cached, as the cursor isn't
+	if q.pending != nil || !q.cfg.opts.Finds || opts.Next != nil {
+		return q.inner.Find(ctx, ptrToListOfPtrs, opts)
+	}
+
+	key, ok := q.findKey(ctx, modelType, list.Cap(), opts)
+	if !ok {
+		return q.inner.Find(ctx, ptrToListOfPtrs, opts)
+	}
+
+	limit := list.Cap()
+	results, w, err := zcache.ReadThrough(
+		ctx,
+		q.cfg.cache,
+		q.cfg.opts.Namespace,
+		key,
+		q.cfg.opts.Expiration,
+		func(ctx context.Context) (reflect.Value, error) {
+			found := reflect.New(list.Type())
+			found.Elem().Set(reflect.MakeSlice(list.Type(), 0, limit))
+			if err := q.inner.Find(ctx, found.Interface(), opts); err != nil {
+				return reflect.Value{}, err
+			}
+			return found.Elem(), nil
+		},
+		func(v reflect.Value) ([]byte, error) {
+			return encode(v)
+		},
+		func(data []byte) (reflect.Value, error) {
+			v := reflect.New(list.Type()).Elem()
+			return v, decode(data, v)
+		},
+	)
+	if w != nil {
+		warn(ctx, w)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Like the decorated repository, the results replace the list's contents
+	// within its capacity
+	list.Set(list.Slice(0, 0))
+	for i := 0; i < results.Len() && i < limit; i++ {
+		list.Set(reflect.Append(list, results.Index(i)))
+	}
+
+	return nil
+}
+
+// findKey returns the cache key of a find, from its options and the
+// generation of each model type it reads, or false when the find can't be
+// cached.
+func (q *queryer) findKey(ctx context.Context, modelType reflect.Type, limit int, opts zorm.FindOptions) (string, bool) {
+	c := &canon{}
+	c.printf("limit=%d;", limit)
+	c.findOptions(opts)
+	if c.err != nil {
+		return "", false
+	}
+
+	for _, t := range readTypes(modelType, opts.Include) {
+		gen, w, err := q.cfg.generation(ctx, t)
+		if w != nil {
+			warn(ctx, w)
+		}
+		if err != nil {
+			warn(ctx, zwarn.Warnf("reading generation of %s: %v", t, err))
+			return "", false
+		}
+		c.printf("generation(%s)=%s;", zreflect.TypeID(t), gen)
+	}
+
+	sum := sha256.Sum256([]byte(c.b.String()))
+	return "find:" + zreflect.TypeID(modelType) + ":" + hex.EncodeToString(sum[:]), true
+}
+
+// readTypes returns the model type along with the types of the related models
+// included with it.
+func readTypes(t reflect.Type, include zorm.Include) []reflect.Type {
+	result := []reflect.Type{t}
+	for name, rel := range include.Relations {
+		f, ok := t.Elem().FieldByName(name)
+		if !ok {
+			continue
+		}
+		relType := f.Type
+		if relType.Kind() == reflect.Slice {
+			relType = relType.Elem()
+		}
+		if relType.Kind() == reflect.Ptr && relType.Elem().Kind() == reflect.Struct {
+			result = append(result, readTypes(relType, rel.Include)...)
+		}
+	}
+	return result
+}
+
+func (q *queryer) Iterate(ctx context.Context, model any, opts zorm.FindOptions) iter.Seq2[any, error] {
+	return q.inner.Iterate(ctx, model, opts)
+}
+
+func (q *queryer) Count(ctx context.Context, model any, where zclause.Clause) (int, error) {
+	return q.inner.Count(ctx, model, where)
+}
+
+func (q *queryer) Exists(ctx context.Context, model any, where zclause.Clause) (bool, error) {
+	return q.inner.Exists(ctx, model, where)
+}
+
+func (q *queryer) Aggregate(ctx context.Context, model any, ptrToListOfResults any, opts zorm.AggregateOptions) error {
+	return q.inner.Aggregate(ctx, model, ptrToListOfResults, opts)
+}
+
+// written returns what writing models, and the related models written with
+// them, makes stale.
+func (q *queryer) written(list reflect.Value, relations zorm.Relations) invalidation {
+	inv := invalidation{types: []reflect.Type{list.Type().Elem()}}
+
+	for i := 0; i < list.Len(); i++ {
+		if key, ok := q.cfg.modelKey(list.Index(i)); ok {
+			inv.keys = append(inv.keys, key)
+		}
+	}
+
+	for name, rel := range relations {
+		f, ok := list.Type().Elem().Elem().FieldByName(name)
+		if !ok {
+			continue
+		}
+
+		relType := f.Type
+		if relType.Kind() == reflect.Slice {
+			relType = relType.Elem()
+		}
+		if relType.Kind() != reflect.Ptr || relType.Elem().Kind() != reflect.Struct {
+			continue
+		}
+
+		related := reflect.MakeSlice(reflect.SliceOf(relType), 0, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			if list.Index(i).IsNil() {
+				continue
+			}
+			v := list.Index(i).Elem().FieldByName(name)
+			if v.Kind() == reflect.Slice {
+				for j := 0; j < v.Len(); j++ {
+					if !v.Index(j).IsNil() {
+						related = reflect.Append(related, v.Index(j))
+					}
+				}
+			} else if !v.IsNil() {
+				related = reflect.Append(related, v)
+			}
+		}
+
+		// Links to the related models may change even when none are given
+		inv.merge(q.written(related, rel.Include.Relations))
+	}
+
+	return inv
+}
+
+func (q *queryer) Put(ctx context.Context, listOfPtrs any, opts zorm.PutOptions) error {
+	list, _, err := listOf(listOfPtrs)
+	if err != nil {
+		return fmt.Errorf("invalid argument to put: %w", err)
+	}
+
+	// Models are keyed once put, as their generated keys are then populated,
+	// and invalidated even when the put fails partway through
+	err = q.inner.Put(ctx, listOfPtrs, opts)
+	q.invalidate(ctx, q.written(list, opts.Include.Relations))
+	return err
+}
+
+func (q *queryer) Delete(ctx context.Context, listOfPtrs any, opts zorm.DeleteOptions) error {
+	list, _, err := listOf(listOfPtrs)
+	if err != nil {
+		return fmt.Errorf("invalid argument to delete: %w", err)
+	}
+
+	err = q.inner.Delete(ctx, listOfPtrs, opts)
+	q.invalidate(ctx, q.written(list, opts.Include.Relations))
+	return err
+}
+
+// matching returns what writing the models matching a clause makes stale,
+// reading the keys of the models before they're written.
+func (q *queryer) matching(ctx context.Context, model any, where zclause.Clause) (invalidation, error) {
+	t := reflect.TypeOf(model)
+	inv := invalidation{types: []reflect.Type{t}}
+
+	pk, ok := q.cfg.primaryKey(t)
+	if !ok || where == nil {
+		return inv, nil
+	}
+
+	for obj, err := range q.inner.Iterate(ctx, model, zorm.FindOptions{
+		Include: zorm.Include{Fields: zorm.Fields(pk)},
+		Where:   where,
+	}) {
+		if err != nil {
+			return invalidation{}, fmt.Errorf("finding models to uncache: %w", err)
+		}
+		if key, ok := q.cfg.modelKey(reflect.ValueOf(obj)); ok {
+			inv.keys = append(inv.keys, key)
+		}
+	}
+
+	return inv, nil
+}
+
+func (q *queryer) DeleteWhere(ctx context.Context, model any, where zclause.Clause, opts zorm.DeleteWhereOptions) (int, error) {
+	inv, err := q.matching(ctx, model, where)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := q.inner.DeleteWhere(ctx, model, where, opts)
+	q.invalidate(ctx, inv)
+	return count, err
+}
+
+func (q *queryer) UpdateWhere(ctx context.Context, model any, where zclause.Clause, set map[string]any) (int, error) {
+	inv, err := q.matching(ctx, model, where)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := q.inner.UpdateWhere(ctx, model, where, set)
+	q.invalidate(ctx, inv)
+	return count, err
+}
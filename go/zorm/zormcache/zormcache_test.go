@@ -0,0 +1,330 @@
+package zormcache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milagre/zote/go/zelement/zelem"
+	"github.com/milagre/zote/go/zlog"
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/zormcache"
+	"github.com/milagre/zote/go/zorm/zormmem"
+	"github.com/milagre/zote/go/zorm/zormmem/zormmemtest"
+	"github.com/milagre/zote/go/zorm/zormtest"
+)
+
+// memoryCache is a zcache.Cache kept in a map, which fails every call while
+// broken is set
+type memoryCache struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+	broken  bool
+}
+
+func (c *memoryCache) Set(ctx context.Context, namespace string, key string, expiration time.Duration, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.broken {
+		return errors.New("cache unavailable")
+	}
+	c.entries[namespace+":"+key] = value
+	return nil
+}
+
+func (c *memoryCache) Get(ctx context.Context, namespace string, key string) (<-chan []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan []byte, 1)
+	defer close(ch)
+	if c.broken {
+		return ch, errors.New("cache unavailable")
+	}
+	if data, ok := c.entries[namespace+":"+key]; ok {
+		ch <- data
+	}
+	return ch, nil
+}
+
+func (c *memoryCache) Clear(ctx context.Context, namespace string, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.broken {
+		return errors.New("cache unavailable")
+	}
+	delete(c.entries, namespace+":"+key)
+	return nil
+}
+
+// newRepository caches every zormtest model of inner by its ID, and finds.
+func newRepository(inner zorm.Repository, cache *memoryCache) *zormcache.Repository {
+	repo := zormcache.New(inner, cache, zormcache.Options{Finds: true})
+	repo.Cache(&zormtest.Account{}, "ID")
+	repo.Cache(&zormtest.User{}, "ID")
+	repo.Cache(&zormtest.UserAuth{}, "ID")
+	repo.Cache(&zormtest.UserAddress{}, "ID")
+	repo.Cache(&zormtest.UserGroup{}, "ID")
+	return repo
+}
+
+func setup(t *testing.T, cb func(context.Context, zorm.Repository)) {
+	t.Helper()
+
+	setupCache(t, func(ctx context.Context, r zorm.Repository, inner zorm.Repository, cache *memoryCache) {
+		cb(ctx, r)
+	})
+}
+
+// setupCache is setup, also giving cb the repository the cache decorates, to
+// write to behind the cache's back, and the cache.
+func setupCache(t *testing.T, cb func(ctx context.Context, r zorm.Repository, inner zorm.Repository, cache *memoryCache)) {
+	t.Helper()
+
+	ctx := zlog.Context(context.Background(), zlog.New(zlog.LevelError))
+	inner := zormmemtest.NewRepository()
+	zormmemtest.Populate(t, ctx, inner)
+
+	cache := &memoryCache{entries: map[string][]byte{}}
+	cb(ctx, newRepository(inner, cache), inner, cache)
+}
+
+func TestORM(t *testing.T) {
+	zormtest.RunFindTests(t, setup)
+	zormtest.RunGetTests(t, setup)
+	zormtest.RunPutTests(t, setup)
+	zormtest.RunDeleteTests(t, setup)
+	zormtest.RunAggregateTests(t, setup)
+}
+
+// rename renames Acme, through q
+func rename(t *testing.T, ctx context.Context, q zorm.Queryer, company string) {
+	t.Helper()
+	_, err := zorm.UpdateWhere[zormtest.Account](ctx, q, zelem.Eq(zelem.Field("ID"), zelem.Value("1")), map[string]any{
+		"Company": company,
+	})
+	require.NoError(t, err)
+}
+
+// company gets the name of Acme through q
+func company(t *testing.T, ctx context.Context, q zorm.Queryer) string {
+	t.Helper()
+	account := &zormtest.Account{ID: "1"}
+	require.NoError(t, zorm.Get(ctx, q, []*zormtest.Account{account}, zorm.GetOptions{}))
+	return account.Company
+}
+
+func find[T any](t *testing.T, ctx context.Context, q zorm.Queryer, opts zorm.FindOptions) []*T {
+	t.Helper()
+	list := make([]*T, 0, 10)
+	require.NoError(t, zorm.Find(ctx, q, &list, opts))
+	return list
+}
+
+func TestGet(t *testing.T) {
+	t.Run("ServesCachedModels", func(t *testing.T) {
+		setupCache(t, func(ctx context.Context, r zorm.Repository, inner zorm.Repository, cache *memoryCache) {
+			assert.Equal(t, "Acme, Inc.", company(t, ctx, r))
+			rename(t, ctx, inner, "Acme Corp")
+			assert.Equal(t, "Acme, Inc.", company(t, ctx, r), "served from the cache")
+
+			account := &zormtest.Account{ID: "1"}
+			require.NoError(t, zorm.Get(ctx, r, []*zormtest.Account{account}, zorm.GetOptions{
+				Include: zorm.Include{Relations: zorm.Relations{"Users": {}}},
+			}))
+			assert.Equal(t, "Acme Corp", account.Company, "gets with options are not cached")
+			assert.Len(t, account.Users, 1)
+		})
+	})
+
+	t.Run("CachesFieldsHiddenFromJSON", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			for range 2 {
+				auth := &zormtest.UserAuth{ID: "1"}
+				require.NoError(t, zorm.Get(ctx, r, []*zormtest.UserAuth{auth}, zorm.GetOptions{}))
+				assert.Equal(t, "P@ssw0rd!", auth.Data)
+			}
+
+			opts := zorm.FindOptions{
+				Where:   zelem.Eq(zelem.Field("FirstName"), zelem.Value("Daffy")),
+				Include: zorm.Include{Relations: zorm.Relations{"Auths": {}}},
+			}
+			for range 2 {
+				users := find[zormtest.User](t, ctx, r, opts)
+				require.Len(t, users, 1)
+				require.Len(t, users[0].Auths, 2)
+				for _, auth := range users[0].Auths {
+					assert.NotEmpty(t, auth.Data, "related models are cached whole")
+				}
+			}
+		})
+	})
+
+	t.Run("PutInvalidates", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			assert.Equal(t, "Acme, Inc.", company(t, ctx, r))
+			require.NoError(t, zorm.Put(ctx, r, []*zormtest.Account{{ID: "1", Company: "Acme Corp"}}, zorm.PutOptions{}))
+			assert.Equal(t, "Acme Corp", company(t, ctx, r))
+		})
+	})
+
+	t.Run("DeleteInvalidates", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			assert.Equal(t, "Acme, Inc.", company(t, ctx, r))
+			require.NoError(t, zorm.Delete(ctx, r, []*zormtest.Account{{ID: "1"}}, zorm.DeleteOptions{}))
+
+			err := zorm.Get(ctx, r, []*zormtest.Account{{ID: "1"}}, zorm.GetOptions{})
+			assert.ErrorIs(t, err, zorm.ErrNotFound)
+		})
+	})
+
+	t.Run("UpdateWhereInvalidates", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			assert.Equal(t, "Acme, Inc.", company(t, ctx, r))
+			rename(t, ctx, r, "Acme Corp")
+			assert.Equal(t, "Acme Corp", company(t, ctx, r))
+		})
+	})
+
+	t.Run("CacheFailuresAreNotErrors", func(t *testing.T) {
+		setupCache(t, func(ctx context.Context, r zorm.Repository, inner zorm.Repository, cache *memoryCache) {
+			cache.broken = true
+
+			assert.Equal(t, "Acme, Inc.", company(t, ctx, r))
+			require.NoError(t, zorm.Put(ctx, r, []*zormtest.Account{{ID: "1", Company: "Acme Corp"}}, zorm.PutOptions{}))
+			assert.Equal(t, "Acme Corp", company(t, ctx, r))
+		})
+	})
+}
+
+func TestFind(t *testing.T) {
+	named := func(company string) zorm.FindOptions {
+		return zorm.FindOptions{Where: zelem.Eq(zelem.Field("Company"), zelem.Value(company))}
+	}
+
+	t.Run("ServesCachedFinds", func(t *testing.T) {
+		setupCache(t, func(ctx context.Context, r zorm.Repository, inner zorm.Repository, cache *memoryCache) {
+			assert.Len(t, find[zormtest.Account](t, ctx, r, named("Acme, Inc.")), 1)
+			rename(t, ctx, inner, "Acme Corp")
+			assert.Len(t, find[zormtest.Account](t, ctx, r, named("Acme, Inc.")), 1, "served from the cache")
+			assert.Len(t, find[zormtest.Account](t, ctx, r, named("Acme Corp")), 1, "finds are cached by their options")
+		})
+	})
+
+	t.Run("WritesInvalidate", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			daffy := zorm.FindOptions{Where: zelem.Eq(zelem.Field("FirstName"), zelem.Value("Daffy"))}
+
+			assert.Len(t, find[zormtest.User](t, ctx, r, daffy), 1)
+			require.NoError(t, zorm.Put(ctx, r, []*zormtest.User{{AccountID: "2", FirstName: "Daffy"}}, zorm.PutOptions{}))
+			assert.Len(t, find[zormtest.User](t, ctx, r, daffy), 2)
+		})
+	})
+
+	t.Run("RelatedWritesInvalidate", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			opts := named("Acme, Inc.")
+			opts.Include = zorm.Include{Relations: zorm.Relations{"Users": {}}}
+
+			accounts := find[zormtest.Account](t, ctx, r, opts)
+			require.Len(t, accounts, 1)
+			assert.Len(t, accounts[0].Users, 1)
+
+			require.NoError(t, zorm.Put(ctx, r, []*zormtest.User{{AccountID: "1", FirstName: "Bugs"}}, zorm.PutOptions{}))
+
+			accounts = find[zormtest.Account](t, ctx, r, opts)
+			require.Len(t, accounts, 1)
+			assert.Len(t, accounts[0].Users, 2)
+		})
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	t.Run("InvalidatesOnCommit", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			assert.Equal(t, "Acme, Inc.", company(t, ctx, r))
+
+			tx, err := r.Begin(ctx)
+			require.NoError(t, err)
+			rename(t, ctx, tx, "Acme Corp")
+
+			assert.Equal(t, "Acme Corp", company(t, ctx, tx), "transactions read their own writes")
+			assert.Equal(t, "Acme, Inc.", company(t, ctx, r), "uncommitted writes are not visible")
+
+			require.NoError(t, tx.Commit())
+			assert.Equal(t, "Acme Corp", company(t, ctx, r))
+		})
+	})
+
+	t.Run("RollbackKeepsCache", func(t *testing.T) {
+		setupCache(t, func(ctx context.Context, r zorm.Repository, inner zorm.Repository, cache *memoryCache) {
+			assert.Equal(t, "Acme, Inc.", company(t, ctx, r))
+
+			tx, err := r.Begin(ctx)
+			require.NoError(t, err)
+			rename(t, ctx, tx, "Acme Corp")
+			require.NoError(t, tx.Rollback())
+
+			rename(t, ctx, inner, "Acme Industries")
+			assert.Equal(t, "Acme, Inc.", company(t, ctx, r), "rolled back writes don't invalidate")
+		})
+	})
+}
+
+// nestingRepository begins transactions that begin nested transactions,
+// which zormmem doesn't. Nested transactions write straight to the
+// transaction they're nested in.
+type nestingRepository struct {
+	*zormmem.Repository
+}
+
+func (r nestingRepository) Begin(ctx context.Context) (zorm.Transaction, error) {
+	tx, err := r.Repository.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return nestingTransaction{tx}, nil
+}
+
+type nestingTransaction struct {
+	zorm.Transaction
+}
+
+func (t nestingTransaction) Begin(ctx context.Context) (zorm.Transaction, error) {
+	return nestedTransaction{t.Transaction}, nil
+}
+
+type nestedTransaction struct {
+	zorm.Transaction
+}
+
+func (nestedTransaction) Commit() error   { return nil }
+func (nestedTransaction) Rollback() error { return nil }
+
+func TestNestedTransaction(t *testing.T) {
+	ctx := zlog.Context(context.Background(), zlog.New(zlog.LevelError))
+	inner := zormmemtest.NewRepository()
+	zormmemtest.Populate(t, ctx, inner)
+
+	repo := newRepository(nestingRepository{inner}, &memoryCache{entries: map[string][]byte{}})
+
+	assert.Equal(t, "Acme, Inc.", company(t, ctx, repo))
+
+	tx, err := repo.Begin(ctx)
+	require.NoError(t, err)
+
+	nested, err := tx.(zorm.Beginner).Begin(ctx)
+	require.NoError(t, err)
+	rename(t, ctx, nested, "Acme Corp")
+	require.NoError(t, nested.Commit())
+
+	assert.Equal(t, "Acme, Inc.", company(t, ctx, repo), "nested commits leave invalidating to the outer transaction")
+
+	require.NoError(t, tx.Commit())
+	assert.Equal(t, "Acme Corp", company(t, ctx, repo), "the outer commit invalidates what the nested transaction wrote")
+}
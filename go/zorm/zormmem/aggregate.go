@@ -0,0 +1,295 @@
+package zormmem
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zelement/zelem"
+	"github.com/milagre/zote/go/zorm"
+)
+
+func (q *queryer) count(ctx context.Context, model any, where zclause.Clause) (int, error) {
+	m, err := q.modelFor(model)
+	if err != nil {
+		return 0, fmt.Errorf("invalid argument to count: %w", err)
+	}
+
+	st, err := q.view()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := q.filter(st, m, where, false)
+	if err != nil {
+		return 0, fmt.Errorf("filtering for count: %w", err)
+	}
+
+	return len(rows), nil
+}
+
+// accumulator computes an aggregate over the values of a group.
+type accumulator struct {
+	fn    zorm.AggregateFunc
+	count int64
+	isum  int64
+	sum   float64
+	float bool
+	best  any
+}
+
+func (a *accumulator) add(v any) {
+	if v == nil {
+		return
+	}
+	a.count++
+
+	switch a.fn {
+	case zorm.AggregateSum, zorm.AggregateAvg:
+		switch n := v.(type) {
+		case int64:
+			a.isum += n
+			a.sum += float64(n)
+		case float64:
+			a.sum += n
+			a.float = true
+		default:
+			// Other values are coerced as SQL would, counting as 0 when they
+			// aren't numeric
+			f, _ := strconv.ParseFloat(text(v), 64)
+			a.sum += f
+			a.float = true
+		}
+
+	case zorm.AggregateMin, zorm.AggregateMax:
+		c := order(v, a.best)
+		if a.best == nil || (a.fn == zorm.AggregateMin && c < 0) || (a.fn == zorm.AggregateMax && c > 0) {
+			a.best = v
+		}
+	}
+}
+
+func (a *accumulator) result() any {
+	switch a.fn {
+	case zorm.AggregateCount:
+		return a.count
+	case zorm.AggregateSum:
+		if a.count == 0 {
+			return nil
+		}
+		if a.float {
+			return a.sum
+		}
+		return a.isum
+	case zorm.AggregateAvg:
+		if a.count == 0 {
+			return nil
+		}
+		return a.sum / float64(a.count)
+	default:
+		return a.best
+	}
+}
+
+// aggregateGroup is the group values and accumulators of a result row.
+type aggregateGroup struct {
+	values []any
+	accs   []*accumulator
+}
+
+func validateAggregation(a zorm.Aggregation) error {
+	if a.As == "" {
+		return fmt.Errorf("aggregate %s of %q requires a result name", a.Func, a.Field)
+	}
+
+	switch a.Func {
+	case zorm.AggregateCount, zorm.AggregateSum, zorm.AggregateAvg, zorm.AggregateMin, zorm.AggregateMax:
+	default:
+		return fmt.Errorf("unsupported aggregate function %q", a.Func)
+	}
+
+	if a.Field == "" && a.Func != zorm.AggregateCount {
+		return fmt.Errorf("aggregate %s requires a field", a.Func)
+	}
+
+	return nil
+}
+
+// aggregate groups the models matching the where clause, joined to the
+// related rows of the grouped and aggregated relation paths as a LEFT JOIN
+// would, and computes each aggregation over the joined rows of each group.
+func (q *queryer) aggregate(ctx context.Context, model any, ptrToListOfResults any, opts zorm.AggregateOptions) error {
+	m, err := q.modelFor(model)
+	if err != nil {
+		return fmt.Errorf("invalid argument to aggregate: %w", err)
+	}
+
+	resultList := reflect.ValueOf(ptrToListOfResults)
+	if resultList.Kind() != reflect.Ptr || resultList.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("invalid argument to aggregate: results must be a pointer to a slice, got %T", ptrToListOfResults)
+	}
+	resultList = resultList.Elem()
+
+	if len(opts.Aggregates) == 0 {
+		return fmt.Errorf("aggregate requires at least one aggregation")
+	}
+
+	paths := slices.Clone(opts.GroupBy)
+	for _, a := range opts.Aggregates {
+		if err := validateAggregation(a); err != nil {
+			return fmt.Errorf("building aggregate: %w", err)
+		}
+		if a.Field != "" {
+			paths = append(paths, a.Field)
+		}
+	}
+	for _, p := range paths {
+		if _, _, err := q.resolveField(m, p); err != nil {
+			return fmt.Errorf("resolving aggregate field %s: %w", p, err)
+		}
+	}
+
+	st, err := q.view()
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.filter(st, m, opts.Where, false)
+	if err != nil {
+		return fmt.Errorf("filtering for aggregate: %w", err)
+	}
+
+	newGroup := func(values []any) *aggregateGroup {
+		g := &aggregateGroup{values: values}
+		for _, a := range opts.Aggregates {
+			g.accs = append(g.accs, &accumulator{fn: a.Func})
+		}
+		return g
+	}
+
+	var groups []*aggregateGroup
+	if len(opts.GroupBy) == 0 {
+		groups = append(groups, newGroup(nil))
+	}
+
+	for _, r := range rows {
+		bindings, err := q.bindings(st, m, r, relationPaths(paths), false)
+		if err != nil {
+			return fmt.Errorf("joining relations for aggregate: %w", err)
+		}
+
+		for _, b := range bindings {
+			v := &matcher{q: q, model: m, binding: b}
+
+			values := make([]any, 0, len(opts.GroupBy))
+			for _, g := range opts.GroupBy {
+				value, err := v.eval(zelem.Field(g))
+				if err != nil {
+					return fmt.Errorf("visiting group by field %s: %w", g, err)
+				}
+				values = append(values, value)
+			}
+
+			idx := slices.IndexFunc(groups, func(g *aggregateGroup) bool {
+				return slices.EqualFunc(g.values, values, func(a, b any) bool { return order(a, b) == 0 })
+			})
+			if idx < 0 {
+				groups = append(groups, newGroup(values))
+				idx = len(groups) - 1
+			}
+
+			for i, a := range opts.Aggregates {
+				if a.Field == "" {
+					groups[idx].accs[i].add(true)
+					continue
+				}
+				value, err := v.eval(zelem.Field(a.Field))
+				if err != nil {
+					return fmt.Errorf("visiting aggregate field %s: %w", a.Field, err)
+				}
+				groups[idx].accs[i].add(value)
+			}
+		}
+	}
+
+	slices.SortStableFunc(groups, func(a, b *aggregateGroup) int {
+		for i := range a.values {
+			if c := order(a.values[i], b.values[i]); c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+
+	for _, g := range groups {
+		result, err := aggregateResult(resultList.Type().Elem(), opts, g)
+		if err != nil {
+			return fmt.Errorf("reading aggregate result: %w", err)
+		}
+		resultList.Set(reflect.Append(resultList, result))
+	}
+
+	return nil
+}
+
+// aggregateResult renders a group into a new value of resultType, which must
+// be a struct, a pointer to a struct or a map[string]any.
+func aggregateResult(resultType reflect.Type, opts zorm.AggregateOptions, g *aggregateGroup) (reflect.Value, error) {
+	names := make([]string, 0, len(g.values)+len(g.accs))
+	fields := make([]string, 0, cap(names))
+	values := make([]any, 0, cap(names))
+	for i, p := range opts.GroupBy {
+		names = append(names, p)
+		fields = append(fields, strings.ReplaceAll(p, ".", ""))
+		values = append(values, g.values[i])
+	}
+	for i, a := range opts.Aggregates {
+		names = append(names, a.As)
+		fields = append(fields, a.As)
+		values = append(values, g.accs[i].result())
+	}
+
+	if resultType.Kind() == reflect.Map {
+		if resultType.Key().Kind() != reflect.String || resultType.Elem().Kind() != reflect.Interface {
+			return reflect.Value{}, fmt.Errorf("unsupported result type %s", resultType)
+		}
+
+		result := reflect.MakeMapWithSize(resultType, len(names))
+		for i, name := range names {
+			rv := reflect.Zero(resultType.Elem())
+			if values[i] != nil {
+				rv = reflect.ValueOf(values[i])
+			}
+			result.SetMapIndex(reflect.ValueOf(name), rv)
+		}
+		return result, nil
+	}
+
+	structType := resultType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("unsupported result type %s", resultType)
+	}
+
+	obj := reflect.New(structType)
+	for i, f := range fields {
+		field := obj.Elem().FieldByName(f)
+		if !field.IsValid() {
+			return reflect.Value{}, fmt.Errorf("result type %s has no field %s", structType, f)
+		}
+		if err := assign(field, values[i]); err != nil {
+			return reflect.Value{}, fmt.Errorf("reading %s: %w", names[i], err)
+		}
+	}
+
+	if resultType.Kind() == reflect.Ptr {
+		return obj, nil
+	}
+	return obj.Elem(), nil
+}
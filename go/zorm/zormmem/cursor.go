@@ -0,0 +1,12 @@
+package zormmem
+
+import (
+	"github.com/milagre/zote/go/zelement/zsort"
+	"github.com/milagre/zote/go/zorm/internal/zmodel"
+)
+
+// newKeyset returns the keyset paginating finds of the model by cursor,
+// encoded as zormsql encodes it so that cursors behave the same.
+func newKeyset(m *model, sorts []zsort.Sort) (*zmodel.Keyset, error) {
+	return zmodel.NewKeyset(m.structType, m.pkFields, sorts)
+}
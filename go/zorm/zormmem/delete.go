@@ -0,0 +1,292 @@
+package zormmem
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+
+	"github.com/milagre/zote/go/zelement"
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zorm"
+)
+
+func (q *queryer) delete(ctx context.Context, listOfPtrs any, opts zorm.DeleteOptions) error {
+	targetVal, modelPtrType, err := validateListOfPtr(listOfPtrs)
+	if err != nil {
+		return fmt.Errorf("invalid argument to delete: %w", err)
+	}
+
+	if targetVal.Len() == 0 {
+		return nil
+	}
+
+	m, err := q.model(modelPtrType)
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	// Load the related models that are being deleted along with these
+	getOpts := opts.GetOptions
+	if len(opts.Include.Relations) > 0 {
+		relations := zorm.Relations{}
+		maps.Copy(relations, getOpts.Include.Relations)
+		maps.Copy(relations, opts.Include.Relations)
+		getOpts.Include.Relations = relations
+	}
+
+	// Hard deletes also purge rows that were already soft deleted
+	if opts.HardDelete {
+		getOpts.IncludeDeleted = true
+	}
+
+	models := make([]reflect.Value, targetVal.Len())
+	for i := 0; i < targetVal.Len(); i++ {
+		models[i] = targetVal.Index(i)
+	}
+
+	return q.write(func(q *queryer) error {
+		if err := q.get(ctx, listOfPtrs, getOpts); err != nil {
+			return fmt.Errorf("error in get before delete: %w", err)
+		}
+
+		count, err := q.deleteWithRelations(ctx, m, models, opts.Include.Relations, opts.HardDelete)
+		if err != nil {
+			return fmt.Errorf("deleting models: %w", err)
+		}
+
+		if count != targetVal.Len() {
+			return fmt.Errorf("expected %d rows affected, but only got %d: %w", targetVal.Len(), count, zorm.ErrNotFound)
+		}
+
+		return nil
+	})
+}
+
+// deleteWithRelations deletes models along with the loaded related models
+// named in relations, in the order zormsql.Repository deletes them: related
+// models holding a foreign key to these first, and related models these hold
+// a foreign key to last. Returns the number of models (not related models)
+// deleted.
+func (q *queryer) deleteWithRelations(ctx context.Context, m *model, models []reflect.Value, relations zorm.Relations, hard bool) (int, error) {
+	if len(models) == 0 {
+		return 0, nil
+	}
+
+	beforeRelations, afterRelations, err := q.categorize(m, relations)
+	if err != nil {
+		return 0, fmt.Errorf("categorizing relations for delete: %w", err)
+	}
+
+	if err := q.beforeDelete(ctx, models); err != nil {
+		return 0, err
+	}
+
+	for _, rel := range afterRelations {
+		if err := q.deleteRelated(ctx, models, rel, relations[rel.Field], hard); err != nil {
+			return 0, fmt.Errorf("deleting relation %s: %w", rel.Field, err)
+		}
+	}
+
+	count, err := q.deleteRows(m, models, hard)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, rel := range beforeRelations {
+		if err := q.deleteRelated(ctx, models, rel, relations[rel.Field], hard); err != nil {
+			return 0, fmt.Errorf("deleting relation %s: %w", rel.Field, err)
+		}
+	}
+
+	if err := q.afterDelete(ctx, models); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// deleteRelated deletes the distinct models loaded into the relation field of
+// each parent. Many-to-many relations only have their join table rows
+// deleted.
+func (q *queryer) deleteRelated(ctx context.Context, parents []reflect.Value, rel relation, relOpts zorm.Relation, hard bool) error {
+	if rel.Through != nil {
+		columns := throughColumns(rel)
+		for _, parent := range parents {
+			for _, related := range relatedValues(parent, rel) {
+				q.tx.remove(rel.Through.Table, linkKey(columns, rel.link(parent, related)))
+			}
+		}
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var related []reflect.Value
+	for _, parent := range parents {
+		for _, v := range relatedValues(parent, rel) {
+			key := rel.model.key(rel.model.row(v, rel.model.pkFields))
+			if !seen[key] {
+				seen[key] = true
+				related = append(related, v)
+			}
+		}
+	}
+
+	_, err := q.deleteWithRelations(ctx, rel.model, related, relOpts.Include.Relations, hard)
+	return err
+}
+
+// deleteRows deletes the rows of models, soft deleting them when the model
+// supports it unless hard is set. Returns the number of rows deleted.
+func (q *queryer) deleteRows(m *model, models []reflect.Value, hard bool) (int, error) {
+	now := q.now()
+
+	count := 0
+	seen := map[string]bool{}
+	for _, obj := range models {
+		key := m.key(m.row(obj, m.pkFields))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		r := q.tx.get(m.Table, key)
+		if r == nil {
+			continue
+		}
+
+		if m.SoftDelete == "" || hard {
+			q.tx.remove(m.Table, key)
+			count++
+			continue
+		}
+
+		if m.deleted(r) {
+			continue
+		}
+		deleted := maps.Clone(r)
+		deleted[m.SoftDelete] = now
+		q.tx.put(m.Table, key, deleted, false)
+		count++
+	}
+
+	return count, nil
+}
+
+func (q *queryer) deleteWhere(ctx context.Context, model any, where zclause.Clause, opts zorm.DeleteWhereOptions) (int, error) {
+	m, err := q.modelFor(model)
+	if err != nil {
+		return 0, fmt.Errorf("invalid argument to delete where: %w", err)
+	}
+
+	if where == nil {
+		return 0, fmt.Errorf("delete where requires a where clause")
+	}
+
+	count := 0
+	err = q.write(func(q *queryer) error {
+		rows, err := q.filter(q.tx, m, where, opts.HardDelete)
+		if err != nil {
+			return fmt.Errorf("filtering for delete where: %w", err)
+		}
+
+		now := q.now()
+		for _, r := range rows {
+			if m.SoftDelete == "" || opts.HardDelete {
+				q.tx.remove(m.Table, m.key(r))
+			} else {
+				deleted := maps.Clone(r)
+				deleted[m.SoftDelete] = now
+				q.tx.put(m.Table, m.key(r), deleted, false)
+			}
+		}
+		count = len(rows)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (q *queryer) updateWhere(ctx context.Context, model any, where zclause.Clause, set map[string]any) (int, error) {
+	m, err := q.modelFor(model)
+	if err != nil {
+		return 0, fmt.Errorf("invalid argument to update where: %w", err)
+	}
+
+	if where == nil {
+		return 0, fmt.Errorf("update where requires a where clause")
+	}
+
+	if len(set) == 0 {
+		return 0, fmt.Errorf("update where requires at least one field to set")
+	}
+
+	fields := sortedKeys(set)
+	for _, f := range fields {
+		c, ok := m.byField[f]
+		if !ok {
+			return 0, fmt.Errorf("update where field %s is not mapped", f)
+		}
+		if c.NoUpdate {
+			return 0, fmt.Errorf("update where field %s is not updatable", f)
+		}
+	}
+
+	count := 0
+	err = q.write(func(q *queryer) error {
+		rows, err := q.filter(q.tx, m, where, false)
+		if err != nil {
+			return fmt.Errorf("filtering for update where: %w", err)
+		}
+
+		now := q.now()
+		for _, r := range rows {
+			// Every value is computed from the row as it was before the update
+			v := &matcher{q: q, model: m, binding: binding{"": r}}
+
+			updated := maps.Clone(r)
+			for _, f := range fields {
+				c := m.byField[f]
+				if elem, ok := set[f].(zelement.Element); ok {
+					value, err := v.eval(elem)
+					if err != nil {
+						return fmt.Errorf("visiting update where value for %s: %w", f, err)
+					}
+					updated[c.Name] = m.stored(c, value)
+				} else {
+					updated[c.Name] = m.stored(c, set[f])
+				}
+			}
+
+			// Rows changed in bulk move to a new version so that models read
+			// beforehand can't overwrite the change
+			if version, ok := m.versionColumn(); ok && !slices.Contains(fields, version.Field) {
+				current, _ := r[version.Name].(int64)
+				updated[version.Name] = current + 1
+			}
+
+			for _, c := range m.Columns {
+				if c.AutoUpdateTime && !slices.Contains(fields, c.Field) {
+					updated[c.Name] = now
+				}
+			}
+
+			if err := q.save(m, r, updated); err != nil {
+				return fmt.Errorf("executing update where: %w", err)
+			}
+		}
+		count = len(rows)
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
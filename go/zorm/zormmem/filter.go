@@ -0,0 +1,477 @@
+package zormmem
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/milagre/zote/go/zelement"
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zelement/zmethod"
+)
+
+var (
+	_ zclause.Visitor  = &matcher{}
+	_ zelement.Visitor = &matcher{}
+)
+
+// binding holds the row of the model a clause is evaluated against, under the
+// empty path, and a row of each relation the clause reaches, under its
+// relation path. Relations without a related row are bound to nil, as a LEFT
+// JOIN would.
+type binding map[string]row
+
+// matcher evaluates clauses and elements against a binding.
+type matcher struct {
+	q       *queryer
+	model   *model
+	binding binding
+
+	// used during visits
+	result bool
+	value  any
+}
+
+func (v *matcher) match(c zclause.Clause) (bool, error) {
+	v.result = false
+	if err := c.Accept(v); err != nil {
+		return false, err
+	}
+	return v.result, nil
+}
+
+func (v *matcher) eval(e zelement.Element) (any, error) {
+	v.value = nil
+	if err := e.Accept(v); err != nil {
+		return nil, err
+	}
+	return v.value, nil
+}
+
+func (v *matcher) operands(c zclause.BinaryLeaf) (any, any, error) {
+	left, err := v.eval(c.Left)
+	if err != nil {
+		return nil, nil, fmt.Errorf("visiting left: %w", err)
+	}
+	right, err := v.eval(c.Right)
+	if err != nil {
+		return nil, nil, fmt.Errorf("visiting right: %w", err)
+	}
+	return left, right, nil
+}
+
+// compareWith sets the result to whether the operands compare as accepted
+// does. Comparisons involving nil are false, as they are in SQL.
+func (v *matcher) compareWith(c zclause.BinaryLeaf, accepted func(int) bool) error {
+	left, right, err := v.operands(c)
+	if err != nil {
+		return err
+	}
+	r, ok := compare(left, right)
+	v.result = ok && accepted(r)
+	return nil
+}
+
+// VisitEq compares null safely, so that nil equals nil.
+func (v *matcher) VisitEq(c zclause.Eq) error {
+	left, right, err := v.operands(zclause.BinaryLeaf(c))
+	if err != nil {
+		return err
+	}
+	v.result = (left == nil && right == nil) || equal(left, right)
+	return nil
+}
+
+func (v *matcher) VisitNeq(c zclause.Neq) error {
+	if err := v.VisitEq(zclause.Eq(c)); err != nil {
+		return err
+	}
+	v.result = !v.result
+	return nil
+}
+
+func (v *matcher) VisitGt(c zclause.Gt) error {
+	return v.compareWith(zclause.BinaryLeaf(c), func(r int) bool { return r > 0 })
+}
+
+func (v *matcher) VisitGte(c zclause.Gte) error {
+	return v.compareWith(zclause.BinaryLeaf(c), func(r int) bool { return r >= 0 })
+}
+
+func (v *matcher) VisitLt(c zclause.Lt) error {
+	return v.compareWith(zclause.BinaryLeaf(c), func(r int) bool { return r < 0 })
+}
+
+func (v *matcher) VisitLte(c zclause.Lte) error {
+	return v.compareWith(zclause.BinaryLeaf(c), func(r int) bool { return r <= 0 })
+}
+
+func (v *matcher) VisitNot(c zclause.Not) error {
+	result, err := v.match(c.Clause)
+	if err != nil {
+		return fmt.Errorf("visiting not clause: %w", err)
+	}
+	v.result = !result
+	return nil
+}
+
+func (v *matcher) VisitAnd(c zclause.And) error {
+	for _, child := range c.Clauses {
+		result, err := v.match(child)
+		if err != nil {
+			return fmt.Errorf("visiting and clause: %w", err)
+		}
+		if !result {
+			v.result = false
+			return nil
+		}
+	}
+	v.result = true
+	return nil
+}
+
+func (v *matcher) VisitOr(c zclause.Or) error {
+	for _, child := range c.Clauses {
+		result, err := v.match(child)
+		if err != nil {
+			return fmt.Errorf("visiting or clause: %w", err)
+		}
+		if result {
+			v.result = true
+			return nil
+		}
+	}
+	v.result = false
+	return nil
+}
+
+func (v *matcher) VisitIn(c zclause.In) error {
+	left := make([]any, 0, len(c.Left))
+	for _, e := range c.Left {
+		value, err := v.eval(e)
+		if err != nil {
+			return fmt.Errorf("visiting in clause: %w", err)
+		}
+		left = append(left, value)
+	}
+
+	for _, tuple := range c.Right {
+		if len(tuple) != len(left) {
+			return fmt.Errorf("in clause tuple has %d elements, expected %d", len(tuple), len(left))
+		}
+
+		matched := true
+		for i, e := range tuple {
+			value, err := v.eval(e)
+			if err != nil {
+				return fmt.Errorf("visiting in clause: %w", err)
+			}
+			if !equal(left[i], value) {
+				matched = false
+			}
+		}
+		if matched {
+			v.result = true
+			return nil
+		}
+	}
+
+	v.result = false
+	return nil
+}
+
+func (v *matcher) VisitTruthy(c zclause.Truthy) error {
+	value, err := v.eval(c.Elem)
+	if err != nil {
+		return fmt.Errorf("visiting truthy clause: %w", err)
+	}
+	v.result = truthy(value)
+	return nil
+}
+
+func (v *matcher) VisitValue(e zelement.Value) error {
+	v.value = normalize(e.Value)
+	return nil
+}
+
+func (v *matcher) VisitField(e zelement.Field) error {
+	path, column, err := v.q.resolveField(v.model, e.Name)
+	if err != nil {
+		return fmt.Errorf("visiting field: %w", err)
+	}
+
+	r, ok := v.binding[path]
+	if !ok {
+		return fmt.Errorf("visiting field: relation %s not joined", path)
+	}
+
+	v.value = r[column]
+	return nil
+}
+
+func (v *matcher) VisitMethod(e zelement.Method) error {
+	params := make([]any, 0, len(e.Params))
+	for i, p := range e.Params {
+		value, err := v.eval(p)
+		if err != nil {
+			return fmt.Errorf("visiting element in method '%s' at param %d: %w", e.Name, i, err)
+		}
+		params = append(params, value)
+	}
+
+	arity := func(n int) error {
+		if len(params) != n {
+			return fmt.Errorf("method '%s' requires %d arguments, got %d", e.Name, n, len(params))
+		}
+		return nil
+	}
+
+	switch zmethod.Method(e.Name) {
+	case zmethod.Contains:
+		if err := arity(2); err != nil {
+			return err
+		}
+		v.value = params[0] != nil && params[1] != nil && strings.Contains(text(params[0]), text(params[1]))
+
+	case zmethod.Match:
+		// Full text matching is approximated by requiring every search term
+		if err := arity(2); err != nil {
+			return err
+		}
+		subject := strings.ToLower(text(params[0]))
+		terms := strings.Fields(strings.ToLower(text(params[1])))
+		v.value = params[0] != nil && len(terms) > 0 && !slices.ContainsFunc(terms, func(t string) bool {
+			return !strings.Contains(subject, t)
+		})
+
+	case zmethod.Now:
+		if err := arity(0); err != nil {
+			return err
+		}
+		v.value = v.q.now()
+
+	case zmethod.RegexpReplace:
+		if err := arity(3); err != nil {
+			return err
+		}
+		if params[0] == nil {
+			v.value = nil
+			return nil
+		}
+		re, err := regexp.Compile(text(params[1]))
+		if err != nil {
+			return fmt.Errorf("method '%s' pattern: %w", e.Name, err)
+		}
+		v.value = re.ReplaceAllString(text(params[0]), text(params[2]))
+
+	default:
+		return fmt.Errorf("unknown method: %s", e.Name)
+	}
+
+	return nil
+}
+
+// resolveField returns the relation path of a possibly dot-delimited field
+// path and the column it names.
+func (q *queryer) resolveField(m *model, fieldPath string) (string, string, error) {
+	path, field := splitPath(fieldPath)
+
+	target, err := q.pathModel(m, path)
+	if err != nil {
+		return "", "", err
+	}
+
+	c, ok := target.byField[field]
+	if !ok {
+		return "", "", fmt.Errorf("field %s is not mapped for %s", field, target.structType)
+	}
+
+	return path, c.Name, nil
+}
+
+// pathModel returns the model reached by following a dot-delimited relation
+// path from m.
+func (q *queryer) pathModel(m *model, path string) (*model, error) {
+	if path == "" {
+		return m, nil
+	}
+	for _, name := range strings.Split(path, ".") {
+		rel, err := q.relation(m, name)
+		if err != nil {
+			return nil, err
+		}
+		m = rel.model
+	}
+	return m, nil
+}
+
+// splitPath splits a dot-delimited path into its parent path and last name.
+func splitPath(p string) (string, string) {
+	idx := strings.LastIndex(p, ".")
+	if idx < 0 {
+		return "", p
+	}
+	return p[:idx], p[idx+1:]
+}
+
+// relationPaths returns the relation paths the field paths reach, each
+// preceded by its parent.
+func relationPaths(fieldPaths []string) []string {
+	var result []string
+	for _, p := range fieldPaths {
+		parts := strings.Split(p, ".")
+		for i := 1; i < len(parts); i++ {
+			rp := strings.Join(parts[:i], ".")
+			if !slices.Contains(result, rp) {
+				result = append(result, rp)
+			}
+		}
+	}
+	return result
+}
+
+// bindings joins the rows of each relation path to r, as a query LEFT JOINing
+// them would, returning a binding per combination of related rows. Soft
+// deleted related rows are left out unless includeDeleted.
+func (q *queryer) bindings(st *state, m *model, r row, paths []string, includeDeleted bool) ([]binding, error) {
+	result := []binding{{"": r}}
+
+	for _, p := range paths {
+		parentPath, name := splitPath(p)
+		parent, err := q.pathModel(m, parentPath)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := q.relation(parent, name)
+		if err != nil {
+			return nil, err
+		}
+
+		next := make([]binding, 0, len(result))
+		for _, b := range result {
+			var related []row
+			if pr := b[parentPath]; pr != nil {
+				related = q.related(st, rel, pr, includeDeleted)
+			}
+
+			if len(related) == 0 {
+				nb := maps.Clone(b)
+				nb[p] = nil
+				next = append(next, nb)
+				continue
+			}
+
+			for _, rr := range related {
+				nb := maps.Clone(b)
+				nb[p] = rr
+				next = append(next, nb)
+			}
+		}
+		result = next
+	}
+
+	return result, nil
+}
+
+// matches reports whether a row of the model matches the clause for any
+// combination of the related rows it reaches. Soft deleted rows never match
+// unless includeDeleted.
+func (q *queryer) matches(st *state, m *model, r row, where zclause.Clause, includeDeleted bool) (bool, error) {
+	if !includeDeleted && m.deleted(r) {
+		return false, nil
+	}
+	if where == nil {
+		return true, nil
+	}
+
+	bindings, err := q.bindings(st, m, r, relationPaths(fieldPaths(where)), includeDeleted)
+	if err != nil {
+		return false, fmt.Errorf("joining relations: %w", err)
+	}
+
+	for _, b := range bindings {
+		v := &matcher{q: q, model: m, binding: b}
+		ok, err := v.match(where)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// filter returns the rows of the model matching the clause, ordered by
+// primary key.
+func (q *queryer) filter(st *state, m *model, where zclause.Clause, includeDeleted bool) ([]row, error) {
+	var result []row
+	for _, r := range st.list(m.Table, m.compare) {
+		ok, err := q.matches(st, m, r, where, includeDeleted)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+// related returns the rows related to r through rel, ordered by primary key.
+func (q *queryer) related(st *state, rel relation, r row, includeDeleted bool) []row {
+	var result []row
+
+	if rel.Through == nil {
+		for _, rr := range st.list(rel.model.Table, rel.model.compare) {
+			if !includeDeleted && rel.model.deleted(rr) {
+				continue
+			}
+			if joins(r, rr, rel.Columns) {
+				result = append(result, rr)
+			}
+		}
+		return result
+	}
+
+	var links []row
+	for _, link := range st.list(rel.Through.Table, compareKeys(throughColumns(rel))) {
+		if joins(r, link, rel.Columns) {
+			links = append(links, link)
+		}
+	}
+	if len(links) == 0 {
+		return nil
+	}
+
+	for _, rr := range st.list(rel.model.Table, rel.model.compare) {
+		if !includeDeleted && rel.model.deleted(rr) {
+			continue
+		}
+		if slices.ContainsFunc(links, func(link row) bool { return joins(link, rr, rel.Through.Columns) }) {
+			result = append(result, rr)
+		}
+	}
+	return result
+}
+
+// joins reports whether each left column of a equals its right column of b.
+func joins(a, b row, columns map[string]string) bool {
+	for left, right := range columns {
+		if !equal(a[left], b[right]) {
+			return false
+		}
+	}
+	return true
+}
+
+// throughColumns returns the columns of a relation's join table.
+func throughColumns(rel relation) []string {
+	result := slices.Collect(maps.Values(rel.Columns))
+	result = append(result, slices.Collect(maps.Keys(rel.Through.Columns))...)
+	slices.Sort(result)
+	return result
+}
@@ -0,0 +1,444 @@
+package zormmem
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zelement/zelem"
+	"github.com/milagre/zote/go/zelement/zsort"
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/internal/zmodel"
+)
+
+func (q *queryer) find(ctx context.Context, ptrToListOfPtrs any, opts zorm.FindOptions) error {
+	targetList, modelPtrType, err := validatePtrToListOfPtr(ptrToListOfPtrs)
+	if err != nil {
+		return fmt.Errorf("invalid argument to find: %w", err)
+	}
+
+	m, err := q.model(modelPtrType)
+	if err != nil {
+		return fmt.Errorf("find: %w", err)
+	}
+
+	var ks *zmodel.Keyset
+	if opts.After != "" || opts.Next != nil {
+		if opts.Offset != 0 {
+			return fmt.Errorf("find cannot combine cursor pagination with an offset")
+		}
+
+		ks, err = newKeyset(m, opts.Sort)
+		if err != nil {
+			return fmt.Errorf("preparing cursor pagination for find: %w", err)
+		}
+	}
+
+	st, err := q.view()
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.selectRows(st, m, opts, ks)
+	if err != nil {
+		return fmt.Errorf("selecting rows for find: %w", err)
+	}
+
+	// Like a LIMIT, the capacity of the target bounds the results
+	rows = rows[min(opts.Offset, len(rows)):]
+	rows = rows[:min(targetList.Cap(), len(rows))]
+
+	targetList.Set(targetList.Slice(0, 0))
+	for _, r := range rows {
+		obj, err := q.load(ctx, st, m, r, opts.Include, opts.IncludeDeleted)
+		if err != nil {
+			return fmt.Errorf("find read error: %w", err)
+		}
+		targetList.Set(reflect.Append(targetList, obj))
+	}
+
+	if opts.Next != nil {
+		*opts.Next = ""
+		if n := targetList.Len(); n > 0 && n == targetList.Cap() {
+			*opts.Next, err = ks.Cursor(targetList.Index(n - 1))
+			if err != nil {
+				return fmt.Errorf("building next cursor for find: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// iterate yields the models matching opts, stopping early when yield returns
+// false. Models are loaded as they are yielded.
+func (q *queryer) iterate(ctx context.Context, model any, opts zorm.FindOptions, yield func(any) bool) error {
+	m, err := q.modelFor(model)
+	if err != nil {
+		return fmt.Errorf("invalid argument to iterate: %w", err)
+	}
+
+	if opts.Offset != 0 || opts.Next != nil {
+		return fmt.Errorf("iterate does not support offset or next cursor")
+	}
+
+	var ks *zmodel.Keyset
+	if opts.After != "" {
+		ks, err = newKeyset(m, opts.Sort)
+		if err != nil {
+			return fmt.Errorf("preparing cursor for iterate: %w", err)
+		}
+	}
+
+	st, err := q.view()
+	if err != nil {
+		return err
+	}
+
+	rows, err := q.selectRows(st, m, opts, ks)
+	if err != nil {
+		return fmt.Errorf("selecting rows for iterate: %w", err)
+	}
+
+	for _, r := range rows {
+		obj, err := q.load(ctx, st, m, r, opts.Include, opts.IncludeDeleted)
+		if err != nil {
+			return fmt.Errorf("iterate read error: %w", err)
+		}
+		if !yield(obj.Interface()) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// selectRows returns the rows of the model matching opts, in order.
+func (q *queryer) selectRows(st *state, m *model, opts zorm.FindOptions, ks *zmodel.Keyset) ([]row, error) {
+	where := opts.Where
+	sorts := opts.Sort
+	if ks != nil {
+		sorts = ks.Sorts()
+		if opts.After != "" {
+			seek, err := ks.Seek(opts.After)
+			if err != nil {
+				return nil, err
+			}
+			where = andClause(where, seek)
+		}
+	}
+
+	rows, err := q.filter(st, m, where, opts.IncludeDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.sortRows(st, m, rows, sorts, opts.IncludeDeleted); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+func andClause(a, b zclause.Clause) zclause.Clause {
+	if a == nil {
+		return b
+	}
+	return zelem.And(a, b)
+}
+
+// sortRows sorts rows of the model, which should be ordered by primary key so
+// that it breaks ties. Sorts on to-many relation paths order each row by the
+// lowest related value when ascending and the highest when descending.
+func (q *queryer) sortRows(st *state, m *model, rows []row, sorts []zsort.Sort, includeDeleted bool) error {
+	if len(sorts) == 0 || len(rows) < 2 {
+		return nil
+	}
+
+	type keyed struct {
+		row  row
+		keys []any
+	}
+	items := make([]keyed, 0, len(rows))
+	for _, r := range rows {
+		keys := make([]any, 0, len(sorts))
+		for _, s := range sorts {
+			k, err := q.sortKey(st, m, r, s, includeDeleted)
+			if err != nil {
+				return fmt.Errorf("sorting: %w", err)
+			}
+			keys = append(keys, k)
+		}
+		items = append(items, keyed{row: r, keys: keys})
+	}
+
+	slices.SortStableFunc(items, func(a, b keyed) int {
+		for i, s := range sorts {
+			c := order(a.keys[i], b.keys[i])
+			if s.Direction == zsort.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return 0
+	})
+
+	for i, item := range items {
+		rows[i] = item.row
+	}
+
+	return nil
+}
+
+func (q *queryer) sortKey(st *state, m *model, r row, s zsort.Sort, includeDeleted bool) (any, error) {
+	bindings, err := q.bindings(st, m, r, relationPaths(elementPaths(s.Element)), includeDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	var result any
+	for _, b := range bindings {
+		v := &matcher{q: q, model: m, binding: b}
+		value, err := v.eval(s.Element)
+		if err != nil {
+			return nil, err
+		}
+		if value == nil {
+			continue
+		}
+
+		c := order(value, result)
+		if result == nil || (s.Direction == zsort.Asc && c < 0) || (s.Direction == zsort.Desc && c > 0) {
+			result = value
+		}
+	}
+
+	return result, nil
+}
+
+// load reads a row into a new model with the included fields and relations,
+// then runs its AfterLoad hook and tracks the fields it was loaded with.
+func (q *queryer) load(ctx context.Context, st *state, m *model, r row, include zorm.Include, includeDeleted bool) (reflect.Value, error) {
+	obj := reflect.New(m.structType)
+
+	fields := m.loadFields(include.Fields)
+	if err := m.load(obj, r, fields); err != nil {
+		return reflect.Value{}, err
+	}
+
+	for _, name := range sortedKeys(include.Relations) {
+		relOpts := include.Relations[name]
+
+		rel, err := q.relation(m, name)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		var related []row
+		for _, rr := range q.related(st, rel, r, includeDeleted) {
+			ok, err := q.matches(st, rel.model, rr, relOpts.Where, includeDeleted)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("filtering relation %s: %w", name, err)
+			}
+			if ok {
+				related = append(related, rr)
+			}
+		}
+
+		if err := q.sortRows(st, rel.model, related, relOpts.Sort, includeDeleted); err != nil {
+			return reflect.Value{}, fmt.Errorf("relation %s: %w", name, err)
+		}
+
+		field := obj.Elem().FieldByName(name)
+		for _, rr := range related {
+			child, err := q.load(ctx, st, rel.model, rr, relOpts.Include, includeDeleted)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("relation %s: %w", name, err)
+			}
+			if !rel.toMany {
+				field.Set(child)
+				break
+			}
+			field.Set(reflect.Append(field, child))
+		}
+	}
+
+	err := zmodel.RunHooks([]reflect.Value{obj}, func(h zorm.AfterLoadHook) error { return h.AfterLoad(ctx, q) })
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("after load hook: %w", err)
+	}
+
+	zorm.Track(obj.Interface(), fields)
+
+	return obj, nil
+}
+
+func (q *queryer) get(ctx context.Context, listOfPtrs any, opts zorm.GetOptions) error {
+	targetVal, modelPtrType, err := validateListOfPtr(listOfPtrs)
+	if err != nil {
+		return fmt.Errorf("invalid argument to get: %w", err)
+	}
+
+	if targetVal.Len() == 0 {
+		return nil
+	}
+
+	m, err := q.model(modelPtrType)
+	if err != nil {
+		return fmt.Errorf("get: %w", err)
+	}
+
+	st, err := q.view()
+	if err != nil {
+		return err
+	}
+
+	include := opts.Include
+	found := 0
+	for i := 0; i < targetVal.Len(); i++ {
+		objPtr := targetVal.Index(i)
+
+		key, ok := m.lookupKey(objPtr)
+		if !ok {
+			return fmt.Errorf("object at index %d: %w", i, zorm.ErrNoKey)
+		}
+
+		r := q.lookup(st, m, key, opts.IncludeDeleted)
+		if r == nil {
+			continue
+		}
+		found++
+
+		if len(opts.Include.Fields) > 0 {
+			include.Fields = append(zorm.Fields{}, opts.Include.Fields...)
+			include.Fields.Add(key.fields...)
+		}
+
+		loaded, err := q.load(ctx, st, m, r, include, opts.IncludeDeleted)
+		if err != nil {
+			return fmt.Errorf("loading model for get: %w", err)
+		}
+
+		// If specific fields were requested, only copy those fields and the
+		// relations, otherwise replace the entire object
+		loadedFields := m.loadFields(include.Fields)
+		if len(include.Fields) > 0 {
+			for _, f := range append(slices.Clone(loadedFields), sortedKeys(include.Relations)...) {
+				objPtr.Elem().FieldByName(f).Set(loaded.Elem().FieldByName(f))
+			}
+		} else {
+			objPtr.Elem().Set(loaded.Elem())
+		}
+		zorm.Track(objPtr.Interface(), loadedFields)
+	}
+
+	if found != targetVal.Len() {
+		return fmt.Errorf("expected %d rows found, but only got %d: %w", targetVal.Len(), found, zorm.ErrNotFound)
+	}
+
+	return nil
+}
+
+// lookupKey is a key of a model, identifying a single row.
+type lookupKey struct {
+	columns   []string
+	fields    []string
+	values    []any
+	canInsert bool
+}
+
+// lookupKey returns the first populated key of a model, checking the
+// primary key and then each unique key in order.
+func (m *model) lookupKey(obj reflect.Value) (lookupKey, bool) {
+	keys := append([][]string{m.PrimaryKey}, m.UniqueKeys...)
+	for _, columns := range keys {
+		key := lookupKey{columns: columns, canInsert: true}
+		for _, c := range columns {
+			col := m.byName[c]
+			key.fields = append(key.fields, col.Field)
+			key.values = append(key.values, m.value(obj, col.Field))
+			key.canInsert = key.canInsert && !col.NoInsert
+		}
+		if m.hasValues(obj, key.fields) {
+			return key, true
+		}
+	}
+	return lookupKey{}, false
+}
+
+func (m *model) hasValues(obj reflect.Value, fields []string) bool {
+	for _, f := range fields {
+		if obj.Elem().FieldByName(f).IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the row identified by a key, or nil.
+func (q *queryer) lookup(st *state, m *model, key lookupKey, includeDeleted bool) row {
+	// Rows are stored by primary key, but values given in another type than
+	// stored still need comparing
+	if slices.Equal(key.columns, m.PrimaryKey) {
+		if r := st.get(m.Table, rowKey(key.values)); r != nil {
+			if !includeDeleted && m.deleted(r) {
+				return nil
+			}
+			return r
+		}
+	}
+
+	for _, r := range st.list(m.Table, m.compare) {
+		if !includeDeleted && m.deleted(r) {
+			continue
+		}
+		if slices.EqualFunc(key.columns, key.values, func(c string, v any) bool { return equal(r[c], v) }) {
+			return r
+		}
+	}
+	return nil
+}
+
+func validateListOfPtr(listOfPtrs any) (reflect.Value, reflect.Type, error) {
+	if listOfPtrs == nil {
+		return reflect.Value{}, nil, fmt.Errorf("list of pointers required: nil provided")
+	}
+
+	targetList := reflect.ValueOf(listOfPtrs)
+	if targetList.Type().Kind() != reflect.Slice {
+		return reflect.Value{}, nil, fmt.Errorf("list of pointers required: non-list provided")
+	}
+
+	modelPtrType := targetList.Type().Elem()
+	if modelPtrType.Kind() != reflect.Ptr {
+		return reflect.Value{}, nil, fmt.Errorf("list of pointers required: list of non-pointer types provided")
+	}
+
+	return targetList, modelPtrType, nil
+}
+
+func validatePtrToListOfPtr(ptrToListOfPtrs any) (reflect.Value, reflect.Type, error) {
+	if ptrToListOfPtrs == nil {
+		return reflect.Value{}, nil, fmt.Errorf("pointer to list of pointers required: nil provided")
+	}
+
+	targetVal := reflect.ValueOf(ptrToListOfPtrs)
+	if targetVal.Type().Kind() != reflect.Ptr {
+		return reflect.Value{}, nil, fmt.Errorf("pointer to list of pointers required: non-pointer provided")
+	}
+
+	if targetVal.Type().Elem().Kind() != reflect.Slice {
+		return reflect.Value{}, nil, fmt.Errorf("pointer to list of pointers required: non-list provided")
+	}
+
+	modelPtrType := targetVal.Type().Elem().Elem()
+	if modelPtrType.Kind() != reflect.Ptr {
+		return reflect.Value{}, nil, fmt.Errorf("pointer to list of pointers required: list of non-pointer types provided")
+	}
+
+	return targetVal.Elem(), modelPtrType, nil
+}
@@ -0,0 +1,42 @@
+package zormmem
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/internal/zmodel"
+)
+
+func (q *queryer) beforePut(ctx context.Context, models []reflect.Value) error {
+	err := zmodel.RunHooks(models, func(h zorm.BeforePutHook) error { return h.BeforePut(ctx, q) })
+	if err != nil {
+		return fmt.Errorf("before put hook: %w", err)
+	}
+	return nil
+}
+
+func (q *queryer) afterPut(ctx context.Context, models []reflect.Value) error {
+	err := zmodel.RunHooks(models, func(h zorm.AfterPutHook) error { return h.AfterPut(ctx, q) })
+	if err != nil {
+		return fmt.Errorf("after put hook: %w", err)
+	}
+	return nil
+}
+
+func (q *queryer) beforeDelete(ctx context.Context, models []reflect.Value) error {
+	err := zmodel.RunHooks(models, func(h zorm.BeforeDeleteHook) error { return h.BeforeDelete(ctx, q) })
+	if err != nil {
+		return fmt.Errorf("before delete hook: %w", err)
+	}
+	return nil
+}
+
+func (q *queryer) afterDelete(ctx context.Context, models []reflect.Value) error {
+	err := zmodel.RunHooks(models, func(h zorm.AfterDeleteHook) error { return h.AfterDelete(ctx, q) })
+	if err != nil {
+		return fmt.Errorf("after delete hook: %w", err)
+	}
+	return nil
+}
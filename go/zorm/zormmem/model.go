@@ -0,0 +1,383 @@
+package zormmem
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/internal/zmodel"
+	"github.com/milagre/zote/go/zorm/zormsql"
+	"github.com/milagre/zote/go/zreflect"
+	"github.com/milagre/zote/go/zsql"
+	"github.com/milagre/zote/go/ztime"
+)
+
+// model is a mapping along with the lookups the repository needs from it.
+type model struct {
+	zormsql.Mapping
+
+	structType reflect.Type
+	pkFields   []string
+	byField    map[string]zormsql.Column
+	byName     map[string]zormsql.Column
+}
+
+func newModel(m zormsql.Mapping) *model {
+	result := &model{
+		Mapping:    m,
+		structType: reflect.TypeOf(m.PtrType).Elem(),
+		byField:    map[string]zormsql.Column{},
+		byName:     map[string]zormsql.Column{},
+	}
+	for _, c := range m.Columns {
+		result.byField[c.Field] = c
+		result.byName[c.Name] = c
+	}
+	for _, c := range m.PrimaryKey {
+		result.pkFields = append(result.pkFields, result.byName[c].Field)
+	}
+	return result
+}
+
+func (q *queryer) model(ptrType reflect.Type) (*model, error) {
+	typeID := zreflect.TypeID(ptrType)
+	m, ok := q.cfg.models[typeID]
+	if !ok {
+		return nil, fmt.Errorf("mapping unavailable for type %s", typeID)
+	}
+	return m, nil
+}
+
+// modelFor returns the model of a nil or non-nil model pointer.
+func (q *queryer) modelFor(model any) (*model, error) {
+	t := reflect.TypeOf(model)
+	if t == nil || t.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("model pointer required, got %T", model)
+	}
+	return q.model(t)
+}
+
+// relation is a relation of a model along with the model it belongs to and
+// its related model.
+type relation struct {
+	zormsql.Relation
+
+	parent  *model
+	model   *model
+	toMany  bool
+	fkLocal bool
+}
+
+func (q *queryer) relation(m *model, field string) (relation, error) {
+	idx := slices.IndexFunc(m.Relations, func(r zormsql.Relation) bool { return r.Field == field })
+	if idx < 0 {
+		return relation{}, fmt.Errorf("relation %s not found in mapping for %s", field, m.structType)
+	}
+	rel := relation{Relation: m.Relations[idx], parent: m}
+
+	structField, _ := m.structType.FieldByName(field)
+	relatedType := structField.Type
+	if relatedType.Kind() == reflect.Slice {
+		rel.toMany = true
+		relatedType = relatedType.Elem()
+	}
+
+	related, err := q.model(relatedType)
+	if err != nil {
+		return relation{}, fmt.Errorf("relation %s: %w", field, err)
+	}
+	rel.model = related
+
+	// The foreign key is on this model unless the relation joins on its
+	// primary key, or through a join table
+	if rel.Through == nil {
+		for local := range rel.Columns {
+			if !slices.Contains(m.PrimaryKey, local) || len(rel.Columns) != len(m.PrimaryKey) {
+				rel.fkLocal = true
+			}
+		}
+	}
+
+	return rel, nil
+}
+
+// categorize splits relations into those whose models must be written before
+// the models holding them, because those hold the foreign key, and the rest.
+func (q *queryer) categorize(m *model, relations zorm.Relations) (before, after []relation, err error) {
+	for _, name := range sortedKeys(relations) {
+		rel, err := q.relation(m, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rel.fkLocal {
+			before = append(before, rel)
+		} else {
+			after = append(after, rel)
+		}
+	}
+	return before, after, nil
+}
+
+// allFields returns the fields of every mapped column.
+func (m *model) allFields() []string {
+	result := make([]string, 0, len(m.Columns))
+	for _, c := range m.Columns {
+		result = append(result, c.Field)
+	}
+	return result
+}
+
+// loadFields returns the fields loaded for the requested fields, which always
+// include the primary key.
+func (m *model) loadFields(requested zorm.Fields) []string {
+	result := slices.Clone(m.pkFields)
+	for _, f := range requested.Resolve(m.allFields()) {
+		if _, ok := m.byField[f]; ok && !slices.Contains(result, f) {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// insertFields returns the requested fields written by an insert, always
+// including AutoCreateTime columns.
+func (m *model) insertFields(requested zorm.Fields) []string {
+	insertable := func(c zormsql.Column) bool {
+		return !c.NoInsert || c.AutoCreateTime
+	}
+	return m.resolveFields(requested, insertable, func(c zormsql.Column) bool { return c.AutoCreateTime })
+}
+
+// updateFields returns the requested fields written by an update, always
+// including AutoUpdateTime columns.
+func (m *model) updateFields(requested zorm.Fields) []string {
+	updatable := func(c zormsql.Column) bool {
+		return (!c.NoUpdate || c.AutoUpdateTime) && !c.AutoCreateTime
+	}
+	return m.resolveFields(requested, updatable, func(c zormsql.Column) bool { return c.AutoUpdateTime })
+}
+
+func (m *model) resolveFields(requested zorm.Fields, allowed, always func(zormsql.Column) bool) []string {
+	var all []string
+	for _, c := range m.Columns {
+		if allowed(c) {
+			all = append(all, c.Field)
+		}
+	}
+
+	resolved := slices.Clone(requested.Resolve(all))
+	for _, c := range m.Columns {
+		if always(c) && !slices.Contains(resolved, c.Field) {
+			resolved = append(resolved, c.Field)
+		}
+	}
+
+	var result []string
+	for _, f := range resolved {
+		if c, ok := m.byField[f]; ok && allowed(c) && !slices.Contains(result, f) {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// changedFields returns the requested updatable fields of a model that may
+// have changed since it was loaded, leaving out the columns the repository
+// maintains itself. It is empty when the model is clean.
+func (m *model) changedFields(obj reflect.Value, requested zorm.Fields) []string {
+	fields := slices.DeleteFunc(m.updateFields(requested), func(f string) bool {
+		return m.byField[f].AutoUpdateTime || m.byField[f].Version
+	})
+	return zmodel.ChangedFields(obj, fields)
+}
+
+func (m *model) versionColumn() (zormsql.Column, bool) {
+	for _, c := range m.Columns {
+		if c.Version {
+			return c, true
+		}
+	}
+	return zormsql.Column{}, false
+}
+
+// initVersion starts the version of a model about to be inserted at 1 when
+// it is unset.
+func (m *model) initVersion(obj reflect.Value) {
+	if vc, ok := m.versionColumn(); ok {
+		zmodel.InitVersion(obj.Elem().FieldByName(vc.Field))
+	}
+}
+
+// bumpVersion increments the version of a model after a successful update.
+func (m *model) bumpVersion(obj reflect.Value) {
+	if vc, ok := m.versionColumn(); ok {
+		zmodel.BumpVersion(obj.Elem().FieldByName(vc.Field))
+	}
+}
+
+// stampTimes sets the model's AutoCreateTime columns that are unset when
+// created, and its AutoUpdateTime columns when updated, to now.
+func (m *model) stampTimes(obj reflect.Value, now time.Time, created, updated bool) error {
+	var createdFields, updatedFields []string
+	for _, c := range m.Columns {
+		if created && c.AutoCreateTime {
+			createdFields = append(createdFields, c.Field)
+		}
+		if updated && c.AutoUpdateTime {
+			updatedFields = append(updatedFields, c.Field)
+		}
+	}
+	return zmodel.StampTimes(obj, now, createdFields, updatedFields)
+}
+
+// generatesKey reports whether the model's primary key is generated on
+// insert, as an auto incrementing integer.
+func (m *model) generatesKey() bool {
+	return len(m.PrimaryKey) == 1 && m.byName[m.PrimaryKey[0]].NoInsert
+}
+
+// isTime reports whether a column stores times, which non-nullable columns
+// not written on insert default to the current time for.
+func (m *model) isTime(c zormsql.Column) bool {
+	f, _ := m.structType.FieldByName(c.Field)
+	switch f.Type {
+	case reflect.TypeFor[time.Time](), reflect.TypeFor[ztime.Date]():
+		return true
+	}
+	return c.Type == zsql.ColumnTypeTime && f.Type.Kind() != reflect.Ptr
+}
+
+// stored converts a field value into the value stored for the column.
+func (m *model) stored(c zormsql.Column, v any) any {
+	v = normalize(v)
+	if s, ok := v.(string); ok && c.Type == zsql.ColumnTypeInteger {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	}
+	return v
+}
+
+// value returns the stored value of a model's field.
+func (m *model) value(obj reflect.Value, field string) any {
+	return m.stored(m.byField[field], obj.Elem().FieldByName(field).Interface())
+}
+
+// row renders the named fields of a model into a row.
+func (m *model) row(obj reflect.Value, fields []string) row {
+	result := row{}
+	for _, f := range fields {
+		result[m.byField[f].Name] = m.value(obj, f)
+	}
+	return result
+}
+
+// key renders the primary key of a row.
+func (m *model) key(r row) string {
+	values := make([]any, 0, len(m.PrimaryKey))
+	for _, c := range m.PrimaryKey {
+		values = append(values, r[c])
+	}
+	return rowKey(values)
+}
+
+// compare orders rows of the model by primary key.
+func (m *model) compare(a, b row) int {
+	for _, c := range m.PrimaryKey {
+		if r := order(a[c], b[c]); r != 0 {
+			return r
+		}
+	}
+	return 0
+}
+
+func (m *model) deleted(r row) bool {
+	return m.SoftDelete != "" && r[m.SoftDelete] != nil
+}
+
+// load reads the named fields of a row into a model.
+func (m *model) load(obj reflect.Value, r row, fields []string) error {
+	for _, f := range fields {
+		if err := assign(obj.Elem().FieldByName(f), r[m.byField[f].Name]); err != nil {
+			return fmt.Errorf("loading field %s: %w", f, err)
+		}
+	}
+	return nil
+}
+
+// assign sets a field from a stored value, converting between the types
+// values are stored as and the field's type.
+func assign(field reflect.Value, v any) error {
+	if v == nil {
+		field.SetZero()
+		return nil
+	}
+
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if err := assign(elem.Elem(), v); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	if scanner, ok := field.Addr().Interface().(sql.Scanner); ok {
+		return scanner.Scan(v)
+	}
+
+	src := reflect.ValueOf(v)
+	if src.Kind() == reflect.String && field.Kind() != reflect.String {
+		s := src.String()
+		switch {
+		case field.CanInt():
+			i, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("converting %q to %s: %w", s, field.Type(), err)
+			}
+			field.SetInt(i)
+			return nil
+		case field.CanUint():
+			u, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("converting %q to %s: %w", s, field.Type(), err)
+			}
+			field.SetUint(u)
+			return nil
+		case field.CanFloat():
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return fmt.Errorf("converting %q to %s: %w", s, field.Type(), err)
+			}
+			field.SetFloat(f)
+			return nil
+		case field.Kind() == reflect.Bool:
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return fmt.Errorf("converting %q to %s: %w", s, field.Type(), err)
+			}
+			field.SetBool(b)
+			return nil
+		}
+	}
+
+	if field.Kind() == reflect.String && src.Kind() != reflect.String {
+		field.SetString(fmt.Sprint(v))
+		return nil
+	}
+
+	if src.Type().AssignableTo(field.Type()) {
+		field.Set(src)
+		return nil
+	}
+	if src.Type().ConvertibleTo(field.Type()) {
+		field.Set(src.Convert(field.Type()))
+		return nil
+	}
+
+	return fmt.Errorf("cannot assign %T to %s", v, field.Type())
+}
@@ -0,0 +1,93 @@
+package zormmem
+
+import (
+	"github.com/milagre/zote/go/zelement"
+	"github.com/milagre/zote/go/zelement/zclause"
+)
+
+var (
+	_ zelement.Visitor = &pathExtractor{}
+	_ zclause.Visitor  = &pathExtractor{}
+)
+
+// pathExtractor collects the field paths of a clause or element.
+type pathExtractor struct {
+	paths []string
+}
+
+func fieldPaths(clause zclause.Clause) []string {
+	e := &pathExtractor{}
+	clause.Accept(e)
+	return e.paths
+}
+
+func elementPaths(elems ...zelement.Element) []string {
+	e := &pathExtractor{}
+	for _, el := range elems {
+		el.Accept(e)
+	}
+	return e.paths
+}
+
+func (e *pathExtractor) binary(c zclause.BinaryLeaf) error {
+	c.Left.Accept(e)
+	c.Right.Accept(e)
+	return nil
+}
+
+func (e *pathExtractor) VisitEq(c zclause.Eq) error   { return e.binary(zclause.BinaryLeaf(c)) }
+func (e *pathExtractor) VisitNeq(c zclause.Neq) error { return e.binary(zclause.BinaryLeaf(c)) }
+func (e *pathExtractor) VisitGt(c zclause.Gt) error   { return e.binary(zclause.BinaryLeaf(c)) }
+func (e *pathExtractor) VisitGte(c zclause.Gte) error { return e.binary(zclause.BinaryLeaf(c)) }
+func (e *pathExtractor) VisitLt(c zclause.Lt) error   { return e.binary(zclause.BinaryLeaf(c)) }
+func (e *pathExtractor) VisitLte(c zclause.Lte) error { return e.binary(zclause.BinaryLeaf(c)) }
+
+func (e *pathExtractor) VisitNot(c zclause.Not) error {
+	return c.Clause.Accept(e)
+}
+
+func (e *pathExtractor) VisitAnd(c zclause.And) error {
+	for _, child := range c.Clauses {
+		child.Accept(e)
+	}
+	return nil
+}
+
+func (e *pathExtractor) VisitOr(c zclause.Or) error {
+	for _, child := range c.Clauses {
+		child.Accept(e)
+	}
+	return nil
+}
+
+func (e *pathExtractor) VisitIn(c zclause.In) error {
+	for _, l := range c.Left {
+		l.Accept(e)
+	}
+	for _, tuple := range c.Right {
+		for _, r := range tuple {
+			r.Accept(e)
+		}
+	}
+	return nil
+}
+
+func (e *pathExtractor) VisitTruthy(c zclause.Truthy) error {
+	return c.Elem.Accept(e)
+}
+
+func (e *pathExtractor) VisitValue(v zelement.Value) error {
+	return nil
+}
+
+func (e *pathExtractor) VisitField(f zelement.Field) error {
+	e.paths = append(e.paths, f.Name)
+	return nil
+}
+
+func (e *pathExtractor) VisitMethod(m zelement.Method) error {
+	for _, p := range m.Params {
+		p.Accept(e)
+	}
+	return nil
+}
@@ -0,0 +1,616 @@
+package zormmem
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/milagre/zote/go/zorm"
+)
+
+// put saves the provided models, and the related models included, as
+// zormsql.Repository does: related models holding the foreign key to these
+// are put after them, and those these hold a foreign key to before them.
+func (q *queryer) put(ctx context.Context, listOfPtrs any, opts zorm.PutOptions) error {
+	targetVal, modelPtrType, err := validateListOfPtr(listOfPtrs)
+	if err != nil {
+		return fmt.Errorf("invalid argument to put: %w", err)
+	}
+
+	if targetVal.Len() == 0 {
+		return nil
+	}
+
+	m, err := q.model(modelPtrType)
+	if err != nil {
+		return fmt.Errorf("put: %w", err)
+	}
+
+	beforeRelations, afterRelations, err := q.categorize(m, opts.Include.Relations)
+	if err != nil {
+		return fmt.Errorf("categorizing relations: %w", err)
+	}
+
+	models := make([]reflect.Value, targetVal.Len())
+	for i := 0; i < targetVal.Len(); i++ {
+		models[i] = targetVal.Index(i)
+	}
+
+	return q.write(func(q *queryer) error {
+		if err := q.beforePut(ctx, models); err != nil {
+			return err
+		}
+
+		for _, rel := range beforeRelations {
+			if err := q.putRelated(ctx, models, rel, opts.Include.Relations[rel.Field]); err != nil {
+				return fmt.Errorf("putting before-relation %s: %w", rel.Field, err)
+			}
+		}
+
+		if opts.OnConflict.Action != zorm.ConflictError {
+			err = q.upsertModels(m, models, opts.Include.Fields, opts.OnConflict)
+		} else {
+			err = q.putModels(m, models, opts.Include.Fields)
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, rel := range afterRelations {
+			if err := q.putRelated(ctx, models, rel, opts.Include.Relations[rel.Field]); err != nil {
+				return fmt.Errorf("putting after-relation %s: %w", rel.Field, err)
+			}
+		}
+
+		// Default GetOptions.Include to PutOptions.Include if not specified
+		getOpts := opts.GetOptions
+		if getOpts.Include.IsEmpty() {
+			getOpts.Include = opts.Include
+		}
+
+		if err := q.get(ctx, listOfPtrs, getOpts); err != nil {
+			return fmt.Errorf("error in get after put: %w", err)
+		}
+
+		return q.afterPut(ctx, models)
+	})
+}
+
+// putModels saves models of a single model type. Models whose populated
+// lookup key matches an existing row update it, and the rest are inserted.
+func (q *queryer) putModels(m *model, models []reflect.Value, fields zorm.Fields) error {
+	now := q.now()
+
+	for _, obj := range models {
+		key, hasKey := m.lookupKey(obj)
+		if hasKey {
+			if existing := q.lookup(q.tx, m, key, false); existing != nil {
+				// Models identified by a unique key learn their primary key
+				// here, so relations put afterward can reference them
+				for _, f := range m.pkFields {
+					if field := obj.Elem().FieldByName(f); field.IsZero() {
+						if err := assign(field, existing[m.byField[f].Name]); err != nil {
+							return fmt.Errorf("reading primary key: %w", err)
+						}
+					}
+				}
+
+				if err := q.update(m, obj, existing, fields, now); err != nil {
+					return fmt.Errorf("performing update: %w", err)
+				}
+				continue
+			}
+
+			if !key.canInsert {
+				return fmt.Errorf("no rows affected for update and key columns are not insertable: %w", zorm.ErrNotFound)
+			}
+		}
+
+		m.initVersion(obj)
+		if err := m.stampTimes(obj, now, true, false); err != nil {
+			return err
+		}
+
+		if err := q.insert(m, obj, m.insertFields(fields), now); err != nil {
+			return fmt.Errorf("performing insert: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// insert stores a new row from the given fields of a model. Columns not
+// written take the defaults zormsql's DDL declares: versions start at 1,
+// non-nullable time columns at the current time, and a primary key that
+// isn't inserted is generated.
+func (q *queryer) insert(m *model, obj reflect.Value, fields []string, now time.Time) error {
+	r := row{}
+	for _, c := range m.Columns {
+		switch {
+		case slices.Contains(fields, c.Field):
+			r[c.Name] = m.value(obj, c.Field)
+		case c.Version:
+			r[c.Name] = int64(1)
+		case c.NoInsert && m.isTime(c):
+			r[c.Name] = now
+		default:
+			r[c.Name] = nil
+		}
+	}
+
+	if m.generatesKey() {
+		id := q.store.nextID(q.tx, m.Table)
+		r[m.PrimaryKey[0]] = id
+		if err := assign(obj.Elem().FieldByName(m.pkFields[0]), id); err != nil {
+			return fmt.Errorf("setting generated primary key: %w", err)
+		}
+	}
+
+	for _, c := range m.PrimaryKey {
+		if r[c] == nil {
+			return fmt.Errorf("primary key column %s of %s is not set", c, m.Table)
+		}
+	}
+
+	return q.save(m, nil, r)
+}
+
+// update writes the fields of a loaded model that changed since it was
+// loaded onto its existing row, checking and moving its version forward.
+func (q *queryer) update(m *model, obj reflect.Value, existing row, fields zorm.Fields, now time.Time) error {
+	changed := m.changedFields(obj, fields)
+	if len(changed) == 0 {
+		return nil
+	}
+
+	if err := m.stampTimes(obj, now, false, true); err != nil {
+		return err
+	}
+
+	version, versioned := m.versionColumn()
+
+	updated := maps.Clone(existing)
+	for _, f := range m.updateFields(changed) {
+		if versioned && f == version.Field {
+			continue
+		}
+		updated[m.byField[f].Name] = m.value(obj, f)
+	}
+
+	if versioned {
+		current := obj.Elem().FieldByName(version.Field).Interface()
+		if !equal(existing[version.Name], m.value(obj, version.Field)) {
+			return fmt.Errorf("row is no longer at version %v: %w", current, zorm.ErrConflict)
+		}
+		v, _ := existing[version.Name].(int64)
+		updated[version.Name] = v + 1
+		m.bumpVersion(obj)
+	}
+
+	return q.save(m, existing, updated)
+}
+
+// save stores r in place of existing, or as a new row when existing is nil,
+// reporting zorm.ErrConflict if it collides with another row.
+func (q *queryer) save(m *model, existing row, r row) error {
+	key := m.key(r)
+
+	if existing == nil {
+		if q.tx.get(m.Table, key) != nil {
+			return fmt.Errorf("primary key %s%s already exists: %w", m.Table, key, zorm.ErrConflict)
+		}
+	} else if oldKey := m.key(existing); oldKey != key {
+		if q.tx.get(m.Table, key) != nil {
+			return fmt.Errorf("primary key %s%s already exists: %w", m.Table, key, zorm.ErrConflict)
+		}
+		q.tx.remove(m.Table, oldKey)
+		existing = nil
+	}
+
+	if err := checkUniqueKeys(q.tx, m, key, r); err != nil {
+		return err
+	}
+
+	q.tx.put(m.Table, key, r, existing == nil)
+
+	return nil
+}
+
+// upsertModels writes each model atomically, resolving a conflict on the
+// OnConflict key by leaving or updating the existing row, then reads back the
+// primary keys of the rows written.
+func (q *queryer) upsertModels(m *model, models []reflect.Value, fields zorm.Fields, onConflict zorm.OnConflict) error {
+	keyFields := onConflict.Key
+	if len(keyFields) == 0 {
+		keyFields = m.pkFields
+	}
+
+	keyColumns := make([]string, 0, len(keyFields))
+	for _, f := range keyFields {
+		c, ok := m.byField[f]
+		if !ok {
+			return fmt.Errorf("mapping conflict key: field %s is not mapped", f)
+		}
+		keyColumns = append(keyColumns, c.Name)
+	}
+
+	for i, obj := range models {
+		if !m.hasValues(obj, keyFields) {
+			return fmt.Errorf("conflict key %v is not populated for object at index %d", keyFields, i)
+		}
+	}
+
+	now := q.now()
+	for _, obj := range models {
+		m.initVersion(obj)
+		if err := m.stampTimes(obj, now, true, true); err != nil {
+			return err
+		}
+	}
+
+	// The proposed row carries the conflict key even when it's generated on
+	// insert, such as the primary key
+	insertFields := m.insertFields(fields)
+	for _, f := range keyFields {
+		if !slices.Contains(insertFields, f) {
+			insertFields = append(insertFields, f)
+		}
+	}
+	for _, c := range m.Columns {
+		if c.AutoUpdateTime && !slices.Contains(insertFields, c.Field) {
+			insertFields = append(insertFields, c.Field)
+		}
+	}
+
+	// Only values present in the proposed row can be copied onto a conflicting
+	// one. Upserts are unconditional, but still move the version of rows they
+	// update forward.
+	version, versioned := m.versionColumn()
+	var updateFields []string
+	if onConflict.Action == zorm.ConflictUpdate {
+		for _, f := range m.updateFields(onConflict.Fields) {
+			if slices.Contains(keyFields, f) || !slices.Contains(insertFields, f) || f == version.Field {
+				continue
+			}
+			updateFields = append(updateFields, f)
+		}
+	}
+
+	for _, obj := range models {
+		key := lookupKey{columns: keyColumns, fields: keyFields}
+		for _, f := range keyFields {
+			key.values = append(key.values, m.value(obj, f))
+		}
+
+		existing := q.lookup(q.tx, m, key, true)
+		if existing == nil {
+			if err := q.insert(m, obj, insertFields, now); err != nil {
+				return fmt.Errorf("executing upsert: %w", err)
+			}
+			continue
+		}
+
+		if len(updateFields) > 0 {
+			updated := maps.Clone(existing)
+			for _, f := range updateFields {
+				updated[m.byField[f].Name] = m.value(obj, f)
+			}
+			if versioned {
+				v, _ := existing[version.Name].(int64)
+				updated[version.Name] = v + 1
+			}
+			if err := q.save(m, existing, updated); err != nil {
+				return fmt.Errorf("executing upsert: %w", err)
+			}
+		}
+
+		for _, f := range m.pkFields {
+			if err := assign(obj.Elem().FieldByName(f), existing[m.byField[f].Name]); err != nil {
+				return fmt.Errorf("reading primary key after upsert: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// putRelated puts the related models for a relation field of each parent
+// together, copying foreign keys between them.
+func (q *queryer) putRelated(ctx context.Context, parents []reflect.Value, rel relation, relOpts zorm.Relation) error {
+	if rel.Through != nil {
+		return q.putThrough(ctx, parents, rel, relOpts)
+	}
+
+	type pair struct {
+		parent  reflect.Value
+		related reflect.Value
+	}
+	var pairs []pair
+	var relatedModels []reflect.Value
+	seen := map[uintptr]bool{}
+
+	for _, parent := range parents {
+		parentRelated := relatedValues(parent, rel)
+
+		// The related models of a to-many relation replace those stored
+		if rel.toMany {
+			if err := q.deleteOrphans(ctx, parent, rel, relOpts, parentRelated); err != nil {
+				return fmt.Errorf("deleting orphaned related models: %w", err)
+			}
+		}
+
+		for _, related := range parentRelated {
+			if err := rel.copyKeys(parent, related); err != nil {
+				return fmt.Errorf("copying FK values: %w", err)
+			}
+
+			pairs = append(pairs, pair{parent: parent, related: related})
+
+			// A related model shared between parents is only put once
+			if !seen[related.Pointer()] {
+				seen[related.Pointer()] = true
+				relatedModels = append(relatedModels, related)
+			}
+		}
+	}
+
+	if len(relatedModels) == 0 {
+		return nil
+	}
+
+	if err := q.beforePut(ctx, relatedModels); err != nil {
+		return err
+	}
+
+	if err := q.putModels(rel.model, relatedModels, relOpts.Include.Fields); err != nil {
+		return fmt.Errorf("putting related models: %w", err)
+	}
+
+	if err := q.afterPut(ctx, relatedModels); err != nil {
+		return err
+	}
+
+	// Copy back any generated keys
+	for _, p := range pairs {
+		if err := rel.copyKeys(p.parent, p.related); err != nil {
+			return fmt.Errorf("copying FK values after put: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// relatedValues returns the non-nil models in a parent's relation field.
+func relatedValues(parent reflect.Value, rel relation) []reflect.Value {
+	fieldVal := parent.Elem().FieldByName(rel.Field)
+
+	var result []reflect.Value
+	if fieldVal.Kind() == reflect.Slice {
+		for i := 0; i < fieldVal.Len(); i++ {
+			if !fieldVal.Index(i).IsNil() {
+				result = append(result, fieldVal.Index(i))
+			}
+		}
+	} else if !fieldVal.IsNil() {
+		result = append(result, fieldVal)
+	}
+	return result
+}
+
+// copyKeys copies the join column values of a relation from the model
+// holding the referenced key to the model holding the foreign key, when the
+// former has them and the latter doesn't.
+func (rel relation) copyKeys(parent, related reflect.Value) error {
+	for local, remote := range rel.Columns {
+		localField := rel.parent.byName[local].Field
+		remoteField := rel.model.byName[remote].Field
+
+		from, to := related, parent
+		fromField, toField := remoteField, localField
+		fromModel := rel.model
+		if !rel.fkLocal {
+			from, to = parent, related
+			fromField, toField = localField, remoteField
+			fromModel = rel.parent
+		}
+
+		if from.Elem().FieldByName(fromField).IsZero() || !to.Elem().FieldByName(toField).IsZero() {
+			continue
+		}
+		if err := assign(to.Elem().FieldByName(toField), fromModel.value(from, fromField)); err != nil {
+			return fmt.Errorf("copying %s to %s: %w", fromField, toField, err)
+		}
+	}
+	return nil
+}
+
+// parentRow renders the values of a parent's relation join columns.
+func (rel relation) parentRow(parent reflect.Value) row {
+	r := row{}
+	for local := range rel.Columns {
+		r[local] = rel.parent.value(parent, rel.parent.byName[local].Field)
+	}
+	return r
+}
+
+// deleteOrphans deletes the related models of a parent, matching the
+// relation's Where, that are not among the provided models.
+func (q *queryer) deleteOrphans(ctx context.Context, parent reflect.Value, rel relation, relOpts zorm.Relation, provided []reflect.Value) error {
+	var existing []row
+	for _, rr := range q.related(q.tx, rel, rel.parentRow(parent), false) {
+		ok, err := q.matches(q.tx, rel.model, rr, relOpts.Where, false)
+		if err != nil {
+			return fmt.Errorf("filtering related models: %w", err)
+		}
+		if ok {
+			existing = append(existing, rr)
+		}
+	}
+
+	if len(existing) == 0 {
+		return nil
+	}
+
+	providedKeys := map[string]bool{}
+	for _, obj := range provided {
+		if err := rel.copyKeys(parent, obj); err != nil {
+			return fmt.Errorf("copying FK values for PK extraction: %w", err)
+		}
+		if rel.model.hasValues(obj, rel.model.pkFields) {
+			providedKeys[rel.model.key(rel.model.row(obj, rel.model.pkFields))] = true
+		}
+	}
+
+	var orphans []reflect.Value
+	for _, rr := range existing {
+		if providedKeys[rel.model.key(rr)] {
+			continue
+		}
+		obj, err := q.load(ctx, q.tx, rel.model, rr, zorm.Include{}, false)
+		if err != nil {
+			return fmt.Errorf("loading orphaned model: %w", err)
+		}
+		orphans = append(orphans, obj)
+	}
+
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	if err := q.beforeDelete(ctx, orphans); err != nil {
+		return err
+	}
+
+	if _, err := q.deleteRows(rel.model, orphans, false); err != nil {
+		return fmt.Errorf("deleting orphaned models: %w", err)
+	}
+
+	return q.afterDelete(ctx, orphans)
+}
+
+// putThrough puts the related models of a many-to-many relation, then
+// inserts and deletes join table rows so each parent is related to exactly
+// the models provided. Join table rows of related models excluded by the
+// relation's Where, or soft deleted, are left untouched.
+func (q *queryer) putThrough(ctx context.Context, parents []reflect.Value, rel relation, relOpts zorm.Relation) error {
+	type pair struct {
+		parent  reflect.Value
+		related reflect.Value
+	}
+	var pairs []pair
+	var relatedModels []reflect.Value
+	var syncedParents []reflect.Value
+	seen := map[uintptr]bool{}
+
+	for _, parent := range parents {
+		// A nil slice leaves the parent's memberships alone
+		fieldVal := parent.Elem().FieldByName(rel.Field)
+		if fieldVal.Kind() == reflect.Slice && fieldVal.IsNil() {
+			continue
+		}
+		syncedParents = append(syncedParents, parent)
+
+		for _, related := range relatedValues(parent, rel) {
+			pairs = append(pairs, pair{parent: parent, related: related})
+
+			if !seen[related.Pointer()] {
+				seen[related.Pointer()] = true
+				relatedModels = append(relatedModels, related)
+			}
+		}
+	}
+
+	if len(relatedModels) > 0 {
+		if err := q.beforePut(ctx, relatedModels); err != nil {
+			return err
+		}
+		if err := q.putModels(rel.model, relatedModels, relOpts.Include.Fields); err != nil {
+			return fmt.Errorf("putting related models: %w", err)
+		}
+		if err := q.afterPut(ctx, relatedModels); err != nil {
+			return err
+		}
+	}
+
+	columns := throughColumns(rel)
+	for _, parent := range syncedParents {
+		existing, err := q.throughLinks(rel, relOpts, rel.parentRow(parent))
+		if err != nil {
+			return fmt.Errorf("finding join table rows: %w", err)
+		}
+
+		wanted := map[string]row{}
+		for _, p := range pairs {
+			if p.parent == parent {
+				link := rel.link(p.parent, p.related)
+				wanted[linkKey(columns, link)] = link
+			}
+		}
+
+		for key := range existing {
+			if _, ok := wanted[key]; !ok {
+				q.tx.remove(rel.Through.Table, key)
+			}
+		}
+		for _, key := range sortedKeys(wanted) {
+			if _, ok := existing[key]; !ok && q.tx.get(rel.Through.Table, key) == nil {
+				q.tx.put(rel.Through.Table, key, wanted[key], true)
+			}
+		}
+	}
+
+	return nil
+}
+
+// throughLinks returns the join table rows relating a parent to related
+// models that aren't soft deleted and match the relation's Where, by key.
+func (q *queryer) throughLinks(rel relation, relOpts zorm.Relation, parent row) (map[string]row, error) {
+	columns := throughColumns(rel)
+
+	result := map[string]row{}
+	for _, link := range q.tx.list(rel.Through.Table, compareKeys(columns)) {
+		if !joins(parent, link, rel.Columns) {
+			continue
+		}
+
+		for _, rr := range q.tx.list(rel.model.Table, rel.model.compare) {
+			if rel.model.deleted(rr) || !joins(link, rr, rel.Through.Columns) {
+				continue
+			}
+			ok, err := q.matches(q.tx, rel.model, rr, relOpts.Where, false)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				result[linkKey(columns, link)] = link
+				break
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// link renders the join table row relating parent to related.
+func (rel relation) link(parent, related reflect.Value) row {
+	r := row{}
+	for local, joinCol := range rel.Columns {
+		r[joinCol] = rel.parent.value(parent, rel.parent.byName[local].Field)
+	}
+	for joinCol, remote := range rel.Through.Columns {
+		r[joinCol] = rel.model.value(related, rel.model.byName[remote].Field)
+	}
+	return r
+}
+
+// linkKey renders the key of a join table row, made of all its columns.
+func linkKey(columns []string, link row) string {
+	values := make([]any, 0, len(columns))
+	for _, c := range columns {
+		values = append(values, link[c])
+	}
+	return rowKey(values)
+}
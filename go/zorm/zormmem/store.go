@@ -0,0 +1,229 @@
+package zormmem
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/milagre/zote/go/zorm"
+)
+
+var errTxDone = fmt.Errorf("transaction has already been committed or rolled back")
+
+// row holds the stored values of a table row by column name. Rows are never
+// modified once stored; writes store a new row in their place.
+type row map[string]any
+
+// table holds the rows of a table by the key rendered from their primary key.
+type table map[string]row
+
+// store holds the committed tables. The tables map and the tables in it are
+// replaced rather than modified, so states may keep reading them unlocked.
+type store struct {
+	mu      sync.Mutex
+	tables  map[string]table
+	version int
+	seqs    map[string]int64
+}
+
+func newStore() *store {
+	return &store{
+		tables: map[string]table{},
+		seqs:   map[string]int64{},
+	}
+}
+
+// change is a single write made by a state, replayed onto the store when it
+// commits. A nil row deletes the row at key.
+type change struct {
+	table  string
+	key    string
+	row    row
+	insert bool
+}
+
+// state is a private view of the store's tables taken when a transaction
+// began, along with the changes the transaction made to them since.
+type state struct {
+	base    int
+	tables  map[string]table
+	owned   map[string]bool
+	journal []change
+	sorted  map[string][]row
+	done    bool
+}
+
+// snapshot returns a read only state of the committed tables.
+func (s *store) snapshot() *state {
+	return s.begin()
+}
+
+func (s *store) begin() *state {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &state{
+		base:   s.version,
+		tables: maps.Clone(s.tables),
+		owned:  map[string]bool{},
+		sorted: map[string][]row{},
+	}
+}
+
+// nextID allocates a generated primary key for a row of the table, skipping
+// keys already taken in st. Like a database sequence, keys allocated by
+// transactions that roll back are not reused.
+func (s *store) nextID(st *state, tbl string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		s.seqs[tbl]++
+		id := s.seqs[tbl]
+		if _, taken := st.tables[tbl][rowKey([]any{id})]; !taken {
+			return id
+		}
+	}
+}
+
+// commit publishes the changes of st. When nothing was committed since st
+// began they are published as they are, and otherwise they are replayed onto
+// the committed tables, failing with zorm.ErrConflict if a row inserted by st
+// now collides with another.
+func (s *store) commit(cfg *config, st *state) error {
+	if len(st.journal) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st.base == s.version {
+		s.tables = st.tables
+		s.version++
+		return nil
+	}
+
+	replay := &state{
+		tables: maps.Clone(s.tables),
+		owned:  map[string]bool{},
+		sorted: map[string][]row{},
+	}
+	for _, c := range st.journal {
+		_, exists := replay.tables[c.table][c.key]
+		switch {
+		case c.row == nil:
+			if exists {
+				replay.remove(c.table, c.key)
+			}
+		case c.insert && exists:
+			return fmt.Errorf("row %s%s was inserted concurrently: %w", c.table, c.key, zorm.ErrConflict)
+		case !c.insert && !exists:
+			// The row was deleted concurrently, which wins
+		default:
+			if m, ok := cfg.tables[c.table]; ok {
+				if err := checkUniqueKeys(replay, m, c.key, c.row); err != nil {
+					return err
+				}
+			}
+			replay.put(c.table, c.key, c.row, c.insert)
+		}
+	}
+
+	s.tables = replay.tables
+	s.version++
+
+	return nil
+}
+
+// own makes the state's copy of a table writable.
+func (st *state) own(tbl string) table {
+	if !st.owned[tbl] {
+		st.tables[tbl] = maps.Clone(st.tables[tbl])
+		if st.tables[tbl] == nil {
+			st.tables[tbl] = table{}
+		}
+		st.owned[tbl] = true
+	}
+	delete(st.sorted, tbl)
+	return st.tables[tbl]
+}
+
+func (st *state) put(tbl string, key string, r row, insert bool) {
+	st.own(tbl)[key] = r
+	st.journal = append(st.journal, change{table: tbl, key: key, row: r, insert: insert})
+}
+
+func (st *state) remove(tbl string, key string) {
+	delete(st.own(tbl), key)
+	st.journal = append(st.journal, change{table: tbl, key: key})
+}
+
+func (st *state) get(tbl string, key string) row {
+	return st.tables[tbl][key]
+}
+
+// list returns the rows of a table ordered by compare, caching the result
+// until the table is next written.
+func (st *state) list(tbl string, compare func(a, b row) int) []row {
+	if rows, ok := st.sorted[tbl]; ok {
+		return rows
+	}
+
+	rows := slices.Collect(maps.Values(st.tables[tbl]))
+	slices.SortFunc(rows, compare)
+	st.sorted[tbl] = rows
+
+	return rows
+}
+
+// rowKey renders the values of a key into a comparable string.
+func rowKey(values []any) string {
+	b, err := json.Marshal(values)
+	if err != nil {
+		panic(fmt.Errorf("rendering row key: %w", err))
+	}
+	return string(b)
+}
+
+// checkUniqueKeys reports zorm.ErrConflict when r, to be stored at key, has
+// the same values for any unique key as another row of the model's table.
+// Keys with any nil value never conflict. Soft deleted rows still hold their
+// keys, as they would in a database.
+func checkUniqueKeys(st *state, m *model, key string, r row) error {
+	for _, uk := range m.UniqueKeys {
+		values := make([]any, 0, len(uk))
+		for _, c := range uk {
+			values = append(values, r[c])
+		}
+		if slices.Contains(values, nil) {
+			continue
+		}
+
+		for otherKey, other := range st.tables[m.Table] {
+			if otherKey == key {
+				continue
+			}
+			if slices.EqualFunc(uk, values, func(c string, v any) bool { return equal(other[c], v) }) {
+				return fmt.Errorf("unique key %s(%v) already holds %v: %w", m.Table, uk, values, zorm.ErrConflict)
+			}
+		}
+	}
+	return nil
+}
+
+// compareKeys orders rows of tables without a model, such as join tables, by
+// their key.
+func compareKeys(columns []string) func(a, b row) int {
+	return func(a, b row) int {
+		for _, c := range columns {
+			if r := cmp.Compare(fmt.Sprint(a[c]), fmt.Sprint(b[c])); r != 0 {
+				return r
+			}
+		}
+		return 0
+	}
+}
@@ -0,0 +1,236 @@
+package zormmem
+
+import (
+	"cmp"
+	"database/sql/driver"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// normalize converts a value into the form values are stored and compared
+// in: nil, int64, float64, bool, string, time.Time or any other value a
+// driver.Valuer produces. Pointers are dereferenced, and named types are
+// reduced to their kind.
+func normalize(v any) any {
+	if v == nil {
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return nil
+	}
+
+	if valuer, ok := v.(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		if err == nil {
+			if dv == nil {
+				return nil
+			}
+			rv = reflect.ValueOf(dv)
+			v = dv
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Ptr:
+		return normalize(rv.Elem().Interface())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if u := rv.Uint(); u <= math.MaxInt64 {
+			return int64(u)
+		}
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.String:
+		return rv.String()
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes())
+		}
+	}
+
+	return v
+}
+
+// compare compares two normalized values as a database would, converting
+// numeric strings to compare with numbers. It reports false when either is
+// nil or they can't be compared.
+func compare(a, b any) (int, bool) {
+	if a == nil || b == nil {
+		return 0, false
+	}
+
+	switch x := a.(type) {
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return cmp.Compare(x, y), true
+		case float64:
+			return cmp.Compare(float64(x), y), true
+		case bool:
+			return cmp.Compare(x, boolInt(y)), true
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(y), 64); err == nil {
+				return cmp.Compare(float64(x), f), true
+			}
+		}
+	case float64:
+		switch y := b.(type) {
+		case int64:
+			return cmp.Compare(x, float64(y)), true
+		case float64:
+			return cmp.Compare(x, y), true
+		case bool:
+			return cmp.Compare(x, float64(boolInt(y))), true
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(y), 64); err == nil {
+				return cmp.Compare(x, f), true
+			}
+		}
+	case bool:
+		switch y := b.(type) {
+		case bool:
+			return cmp.Compare(boolInt(x), boolInt(y)), true
+		case string:
+			if p, err := strconv.ParseBool(y); err == nil {
+				return cmp.Compare(boolInt(x), boolInt(p)), true
+			}
+		default:
+			c, ok := compare(b, a)
+			return -c, ok
+		}
+	case string:
+		switch y := b.(type) {
+		case string:
+			return strings.Compare(x, y), true
+		case time.Time:
+			if t, ok := parseTime(x); ok {
+				return t.Compare(y), true
+			}
+		default:
+			c, ok := compare(b, a)
+			return -c, ok
+		}
+	case time.Time:
+		switch y := b.(type) {
+		case time.Time:
+			return x.Compare(y), true
+		case string:
+			if t, ok := parseTime(y); ok {
+				return x.Compare(t), true
+			}
+		}
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return 0, true
+	}
+	return 0, false
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func parseTime(s string) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, time.DateTime, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// equal reports whether two values are equal and not nil, as comparing them
+// with = in SQL would.
+func equal(a, b any) bool {
+	c, ok := compare(a, b)
+	return ok && c == 0
+}
+
+// order orders any two values for sorting, placing nil first and values that
+// can't be compared by type and then by their rendering.
+func order(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	if c, ok := compare(a, b); ok {
+		return c
+	}
+
+	if c := cmp.Compare(typeRank(a), typeRank(b)); c != 0 {
+		return c
+	}
+	return cmp.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// typeRank orders values of different types as SQLite does: numbers before
+// text, before anything else.
+func typeRank(v any) int {
+	switch v.(type) {
+	case bool, int64, float64:
+		return 0
+	case string:
+		return 1
+	case time.Time:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// truthy reports whether a value is true as a condition: nil, false, zero
+// and text that doesn't read as a non-zero number are not.
+func truthy(v any) bool {
+	switch x := normalize(v).(type) {
+	case nil:
+		return false
+	case bool:
+		return x
+	case int64:
+		return x != 0
+	case float64:
+		return x != 0
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return err == nil && f != 0
+	default:
+		return true
+	}
+}
+
+// text renders a value as text for string methods.
+func text(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+func sortedKeys[M ~map[string]V, V any](m M) []string {
+	return slices.Sorted(maps.Keys(m))
+}
@@ -0,0 +1,262 @@
+// Package zormmem implements zorm.Repository in memory, for tests and
+// prototypes that shouldn't need a database. Models are described by the same
+// zormsql.Mapping used to store them in SQL, and behave as they would in a
+// zormsql.Repository: clauses, sorts, relations, soft deletes, versions,
+// time stamps, unique keys and hooks all follow its semantics.
+//
+// Writes outside of a transaction are atomic. Transactions work on a private
+// copy of the data, published on commit; a commit fails with zorm.ErrConflict
+// when a row it inserts collides with one committed by another transaction
+// since it began.
+package zormmem
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"reflect"
+	"runtime/debug"
+	"time"
+
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/zormsql"
+	"github.com/milagre/zote/go/zreflect"
+)
+
+var (
+	_ zorm.Repository  = &Repository{}
+	_ zorm.Transaction = &Transaction{}
+)
+
+type config struct {
+	name   string
+	models map[string]*model
+	tables map[string]*model
+	clock  func() time.Time
+}
+
+// Repository
+type Repository struct {
+	*queryer
+}
+
+type Transaction struct {
+	*queryer
+}
+
+type queryer struct {
+	cfg   *config
+	store *store
+
+	// tx holds the uncommitted state of a transaction, and is nil outside of
+	// one
+	tx *state
+}
+
+func NewRepository(name string) *Repository {
+	return &Repository{
+		queryer: &queryer{
+			cfg: &config{
+				name:   name,
+				models: map[string]*model{},
+				tables: map[string]*model{},
+			},
+			store: newStore(),
+		},
+	}
+}
+
+// AddMapping registers how a model is stored, given either a
+// zormsql.Mapping or a pointer to a struct to build one from with
+// zormsql.MappingFromStruct. It panics if the mapping is invalid or its model
+// or table is already mapped.
+func (r *Repository) AddMapping(mappingOrModel any) {
+	m, ok := mappingOrModel.(zormsql.Mapping)
+	if !ok {
+		var err error
+		m, err = zormsql.MappingFromStruct(mappingOrModel)
+		if err != nil {
+			panic(err.Error())
+		}
+	} else if err := m.Validate(); err != nil {
+		panic(fmt.Sprintf("Invalid mapping for type %T: %v", m.PtrType, err))
+	}
+
+	key := zreflect.TypeID(reflect.TypeOf(m.PtrType))
+	if _, ok := r.cfg.models[key]; ok {
+		panic(fmt.Sprintf("Duplicate mapping for type %s", key))
+	}
+	if _, ok := r.cfg.tables[m.Table]; ok {
+		panic(fmt.Sprintf("Duplicate mapping for table %s", m.Table))
+	}
+
+	model := newModel(m)
+	r.cfg.models[key] = model
+	r.cfg.tables[m.Table] = model
+}
+
+// SetClock sets the clock used to stamp AutoCreateTime, AutoUpdateTime and
+// soft delete columns, and to evaluate the now method, which defaults to
+// time.Now.
+func (r *Repository) SetClock(now func() time.Time) {
+	r.cfg.clock = now
+}
+
+func (q *queryer) now() time.Time {
+	if q.cfg.clock != nil {
+		return q.cfg.clock().UTC()
+	}
+	return time.Now().UTC()
+}
+
+func (r *Repository) Begin(ctx context.Context) (zorm.Transaction, error) {
+	return &Transaction{
+		queryer: &queryer{
+			cfg:   r.cfg,
+			store: r.store,
+			tx:    r.store.begin(),
+		},
+	}, nil
+}
+
+func (t *Transaction) Commit() error {
+	if t.tx.done {
+		return fmt.Errorf("committing transaction: %w", errTxDone)
+	}
+	t.tx.done = true
+
+	err := t.store.commit(t.cfg, t.tx)
+	if err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (t *Transaction) Rollback() error {
+	if t.tx.done {
+		return fmt.Errorf("rolling back transaction: %w", errTxDone)
+	}
+	t.tx.done = true
+
+	return nil
+}
+
+// view returns the state reads should see: the transaction's own, or the
+// data committed so far.
+func (q *queryer) view() (*state, error) {
+	if q.tx == nil {
+		return q.store.snapshot(), nil
+	}
+	if q.tx.done {
+		return nil, errTxDone
+	}
+	return q.tx, nil
+}
+
+// write runs fn with a queryer whose tx state receives its writes. Outside of
+// a transaction, the writes are committed once fn succeeds and discarded
+// otherwise.
+func (q *queryer) write(fn func(q *queryer) error) error {
+	if q.tx != nil {
+		if q.tx.done {
+			return errTxDone
+		}
+		return fn(q)
+	}
+
+	st := q.store.begin()
+	if err := fn(&queryer{cfg: q.cfg, store: q.store, tx: st}); err != nil {
+		return err
+	}
+	return q.store.commit(q.cfg, st)
+}
+
+// recoverError reports a panic raised during op through err.
+func recoverError(op string, err *error) {
+	if e := recover(); e != nil {
+		if er, ok := e.(error); ok {
+			*err = fmt.Errorf("panic in %s: %w - %s", op, er, string(debug.Stack()))
+		} else {
+			*err = fmt.Errorf("panic in %s: %v - %s", op, e, string(debug.Stack()))
+		}
+	}
+}
+
+func (q *queryer) Find(ctx context.Context, ptrToListOfPtrs any, opts zorm.FindOptions) (err error) {
+	defer recoverError("find", &err)
+	return q.find(ctx, ptrToListOfPtrs, opts)
+}
+
+func (q *queryer) Iterate(ctx context.Context, model any, opts zorm.FindOptions) iter.Seq2[any, error] {
+	return func(yield func(any, error) bool) {
+		// Panics raised by the loop body are not ours to recover
+		yielding := false
+		defer func() {
+			if e := recover(); e != nil {
+				if yielding {
+					panic(e)
+				}
+				if er, ok := e.(error); ok {
+					yield(nil, fmt.Errorf("panic in iterate: %w - %s", er, string(debug.Stack())))
+				} else {
+					yield(nil, fmt.Errorf("panic in iterate: %v - %s", e, string(debug.Stack())))
+				}
+			}
+		}()
+
+		err := q.iterate(ctx, model, opts, func(obj any) bool {
+			yielding = true
+			defer func() { yielding = false }()
+			return yield(obj, nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+func (q *queryer) Get(ctx context.Context, listOfPtrs any, opts zorm.GetOptions) (err error) {
+	defer recoverError("get", &err)
+	return q.get(ctx, listOfPtrs, opts)
+}
+
+func (q *queryer) Put(ctx context.Context, listOfPtrs any, opts zorm.PutOptions) (err error) {
+	defer recoverError("put", &err)
+	return q.put(ctx, listOfPtrs, opts)
+}
+
+func (q *queryer) Delete(ctx context.Context, listOfPtrs any, opts zorm.DeleteOptions) (err error) {
+	defer recoverError("delete", &err)
+	return q.delete(ctx, listOfPtrs, opts)
+}
+
+func (q *queryer) Count(ctx context.Context, model any, where zclause.Clause) (count int, err error) {
+	defer recoverError("count", &err)
+	return q.count(ctx, model, where)
+}
+
+func (q *queryer) Exists(ctx context.Context, model any, where zclause.Clause) (exists bool, err error) {
+	defer recoverError("exists", &err)
+	count, err := q.count(ctx, model, where)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (q *queryer) Aggregate(ctx context.Context, model any, ptrToListOfResults any, opts zorm.AggregateOptions) (err error) {
+	defer recoverError("aggregate", &err)
+	return q.aggregate(ctx, model, ptrToListOfResults, opts)
+}
+
+func (q *queryer) DeleteWhere(ctx context.Context, model any, where zclause.Clause, opts zorm.DeleteWhereOptions) (count int, err error) {
+	defer recoverError("delete where", &err)
+	return q.deleteWhere(ctx, model, where, opts)
+}
+
+func (q *queryer) UpdateWhere(ctx context.Context, model any, where zclause.Clause, set map[string]any) (count int, err error) {
+	defer recoverError("update where", &err)
+	return q.updateWhere(ctx, model, where, set)
+}
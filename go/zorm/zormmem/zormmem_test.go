@@ -0,0 +1,127 @@
+package zormmem_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milagre/zote/go/zelement/zelem"
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/zormmem/zormmemtest"
+	"github.com/milagre/zote/go/zorm/zormtest"
+)
+
+func setup(t *testing.T, cb func(context.Context, zorm.Repository)) {
+	t.Helper()
+
+	ctx := context.Background()
+	repo := zormmemtest.NewRepository()
+	zormmemtest.Populate(t, ctx, repo)
+
+	cb(ctx, repo)
+}
+
+func TestORM(t *testing.T) {
+	zormtest.RunFindTests(t, setup)
+	zormtest.RunGetTests(t, setup)
+	zormtest.RunPutTests(t, setup)
+	zormtest.RunDeleteTests(t, setup)
+	zormtest.RunAggregateTests(t, setup)
+}
+
+func TestTransaction(t *testing.T) {
+	findAccount := func(t *testing.T, ctx context.Context, q zorm.Queryer, company string) *zormtest.Account {
+		t.Helper()
+		accounts := make([]*zormtest.Account, 0, 1)
+		err := zorm.Find(ctx, q, &accounts, zorm.FindOptions{
+			Where: zelem.Eq(zelem.Field("Company"), zelem.Value(company)),
+		})
+		require.NoError(t, err)
+		if len(accounts) == 0 {
+			return nil
+		}
+		return accounts[0]
+	}
+
+	t.Run("RollbackDiscardsWrites", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			tx, err := r.Begin(ctx)
+			require.NoError(t, err)
+
+			err = zorm.Put(ctx, tx, []*zormtest.Account{{Company: "Initech"}}, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			assert.NotNil(t, findAccount(t, ctx, tx, "Initech"))
+			assert.Nil(t, findAccount(t, ctx, r, "Initech"), "uncommitted writes are not visible outside the transaction")
+
+			require.NoError(t, tx.Rollback())
+			assert.Nil(t, findAccount(t, ctx, r, "Initech"))
+
+			assert.Error(t, tx.Commit())
+		})
+	})
+
+	t.Run("CommitPublishesWrites", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			tx, err := r.Begin(ctx)
+			require.NoError(t, err)
+
+			err = zorm.Put(ctx, tx, []*zormtest.Account{{Company: "Initech"}}, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			count, err := zorm.DeleteWhere[zormtest.Account](ctx, tx, zelem.Eq(zelem.Field("Company"), zelem.Value("Dunder Mifflin")), zorm.DeleteWhereOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, 1, count)
+
+			require.NoError(t, tx.Commit())
+
+			assert.NotNil(t, findAccount(t, ctx, r, "Initech"))
+			assert.Nil(t, findAccount(t, ctx, r, "Dunder Mifflin"))
+		})
+	})
+
+	t.Run("TransactionsAreIsolated", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			tx, err := r.Begin(ctx)
+			require.NoError(t, err)
+			defer tx.Rollback()
+
+			err = zorm.Put(ctx, r, []*zormtest.Account{{Company: "Initech"}}, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			assert.Nil(t, findAccount(t, ctx, tx, "Initech"), "writes committed after the transaction began are not visible to it")
+		})
+	})
+
+	t.Run("ConcurrentInsertConflicts", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			tx, err := r.Begin(ctx)
+			require.NoError(t, err)
+
+			err = zorm.Put(ctx, tx, []*zormtest.Account{{Company: "Initech"}}, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			err = zorm.Put(ctx, r, []*zormtest.Account{{Company: "Initech"}}, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			assert.ErrorIs(t, tx.Commit(), zorm.ErrConflict)
+		})
+	})
+}
+
+func TestUniqueKeyConflict(t *testing.T) {
+	setup(t, func(ctx context.Context, r zorm.Repository) {
+		accounts := make([]*zormtest.Account, 0, 1)
+		err := zorm.Find(ctx, r, &accounts, zorm.FindOptions{
+			Where: zelem.Eq(zelem.Field("Company"), zelem.Value("Dunder Mifflin")),
+		})
+		require.NoError(t, err)
+		require.Len(t, accounts, 1)
+
+		accounts[0].Company = "Acme, Inc."
+		err = zorm.Put(ctx, r, accounts, zorm.PutOptions{})
+		assert.ErrorIs(t, err, zorm.ErrConflict)
+	})
+}
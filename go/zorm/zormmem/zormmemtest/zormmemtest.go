@@ -0,0 +1,80 @@
+package zormmemtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/zormmem"
+	"github.com/milagre/zote/go/zorm/zormtest"
+)
+
+// NewRepository returns an empty repository mapping the zormtest models.
+func NewRepository() *zormmem.Repository {
+	repo := zormmem.NewRepository("test")
+	repo.AddMapping(AccountMapping)
+	repo.AddMapping(UserMapping)
+	repo.AddMapping(UserAuthMapping)
+	repo.AddMapping(UserAddressMapping)
+	repo.AddMapping(&zormtest.UserGroup{})
+	return repo
+}
+
+// Populate writes the data the zormsqlite3 tests populate their database
+// with through a repository mapping the zormtest models.
+func Populate(t *testing.T, ctx context.Context, repo zorm.Repository) {
+	t.Helper()
+
+	acme := &zormtest.Account{Company: "Acme", ContactEmail: "contact@acme.example"}
+	dunder := &zormtest.Account{Company: "Dunder Mifflin", ContactEmail: "contact@dundermifflin.example"}
+	explorers := &zormtest.Account{Company: "Explorers, LLC", ContactEmail: "dora@explorers.test"}
+	require.NoError(t, zorm.Put(ctx, repo, []*zormtest.Account{acme, dunder, explorers}, zorm.PutOptions{}))
+
+	acme.Company = "Acme, Inc."
+	require.NoError(t, zorm.Put(ctx, repo, []*zormtest.Account{acme}, zorm.PutOptions{}))
+
+	admins := &zormtest.UserGroup{Name: "Admins"}
+	staff := &zormtest.UserGroup{Name: "Staff"}
+	require.NoError(t, zorm.Put(ctx, repo, []*zormtest.UserGroup{admins, staff}, zorm.PutOptions{}))
+
+	daffy := &zormtest.User{
+		AccountID: acme.ID,
+		Address:   &zormtest.UserAddress{Street: "123 Loony Lane", City: "Acmeton", State: "RI"},
+		Auths: []*zormtest.UserAuth{
+			{Provider: "password", Data: "P@ssw0rd!"},
+			{Provider: "oauth2", Data: `{"token":"1234"}`},
+		},
+		Groups:    []*zormtest.UserGroup{admins, staff},
+		FirstName: "Daffy",
+	}
+	dwight := &zormtest.User{
+		AccountID: dunder.ID,
+		Address:   &zormtest.UserAddress{Street: "1725 Slough Avenue", City: "Scranton", State: "PA"},
+		Auths: []*zormtest.UserAuth{
+			{Provider: "password", Data: "t0tally_S3CURE!"},
+			{Provider: "passkey", Data: `{"secret":"5678"}`},
+		},
+		Groups:    []*zormtest.UserGroup{staff},
+		FirstName: "Dwight",
+	}
+	dora := &zormtest.User{
+		AccountID: explorers.ID,
+		Auths: []*zormtest.UserAuth{
+			{Provider: "password", Data: "r3voked"},
+		},
+		FirstName: "Dora",
+	}
+	require.NoError(t, zorm.Put(ctx, repo, []*zormtest.User{daffy, dwight, dora}, zorm.PutOptions{
+		Include: zorm.Include{
+			Relations: zorm.Relations{
+				"Address": {},
+				"Auths":   {},
+				"Groups":  {},
+			},
+		},
+	}))
+
+	require.NoError(t, zorm.Delete(ctx, repo, dora.Auths, zorm.DeleteOptions{}))
+}
@@ -0,0 +1,303 @@
+package zormsql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"4d63.com/collapsewhitespace"
+
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zelement/zelem"
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zsql"
+)
+
+func (r *queryer) count(ctx context.Context, model any, where zclause.Clause) (int, error) {
+	mapping, err := r.mappingForModel(model)
+	if err != nil {
+		return 0, fmt.Errorf("invalid argument to count: %w", err)
+	}
+
+	driver := r.conn.Driver()
+	tbl := table{name: mapping.Table, alias: "target"}
+
+	f, err := buildFilter(r, mapping, tbl, where)
+	if err != nil {
+		return 0, fmt.Errorf("building filter for count: %w", err)
+	}
+
+	// Joins to many-relations can repeat a row, so count distinct keys
+	query := collapsewhitespace.String(fmt.Sprintf(
+		"SELECT COUNT(*) FROM (SELECT DISTINCT %s %s) AS %s",
+		primaryKeySQL(driver, mapping, tbl),
+		f.from(driver),
+		driver.EscapeTable("counted"),
+	))
+
+	var result int
+	_, err = zsql.Query(ctx, r.conn, func(scan zsql.ScanFunc) error {
+		return scan(&result)
+	}, query, f.values)
+	if err != nil {
+		return 0, fmt.Errorf("executing count query: %w", err)
+	}
+
+	return result, nil
+}
+
+func (r *queryer) exists(ctx context.Context, model any, where zclause.Clause) (bool, error) {
+	mapping, err := r.mappingForModel(model)
+	if err != nil {
+		return false, fmt.Errorf("invalid argument to exists: %w", err)
+	}
+
+	driver := r.conn.Driver()
+	tbl := table{name: mapping.Table, alias: "target"}
+
+	f, err := buildFilter(r, mapping, tbl, where)
+	if err != nil {
+		return false, fmt.Errorf("building filter for exists: %w", err)
+	}
+
+	query := collapsewhitespace.String(fmt.Sprintf("SELECT 1 %s LIMIT 1", f.from(driver)))
+
+	found, err := zsql.Query(ctx, r.conn, func(scan zsql.ScanFunc) error {
+		var one int
+		return scan(&one)
+	}, query, f.values)
+	if err != nil {
+		return false, fmt.Errorf("executing exists query: %w", err)
+	}
+
+	return found, nil
+}
+
+// aggregateOutput is a single column of an aggregate query result.
+type aggregateOutput struct {
+	name  string // map key
+	field string // struct field
+}
+
+func aggregateExpr(ev *elemVisitor, a zorm.Aggregation) (string, error) {
+	if a.As == "" {
+		return "", fmt.Errorf("aggregate %s of %q requires a result name", a.Func, a.Field)
+	}
+
+	switch a.Func {
+	case zorm.AggregateCount, zorm.AggregateSum, zorm.AggregateAvg, zorm.AggregateMin, zorm.AggregateMax:
+	default:
+		return "", fmt.Errorf("unsupported aggregate function %q", a.Func)
+	}
+
+	fn := strings.ToUpper(string(a.Func))
+
+	if a.Field == "" {
+		if a.Func != zorm.AggregateCount {
+			return "", fmt.Errorf("aggregate %s requires a field", a.Func)
+		}
+		return fn + "(*)", nil
+	}
+
+	col, _, err := ev.Visit(zelem.Field(a.Field))
+	if err != nil {
+		return "", fmt.Errorf("visiting aggregate field %s: %w", a.Field, err)
+	}
+
+	return fmt.Sprintf("%s(%s)", fn, col), nil
+}
+
+func (r *queryer) aggregate(ctx context.Context, model any, ptrToListOfResults any, opts zorm.AggregateOptions) error {
+	mapping, err := r.mappingForModel(model)
+	if err != nil {
+		return fmt.Errorf("invalid argument to aggregate: %w", err)
+	}
+
+	resultList := reflect.ValueOf(ptrToListOfResults)
+	if resultList.Kind() != reflect.Ptr || resultList.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("invalid argument to aggregate: results must be a pointer to a slice, got %T", ptrToListOfResults)
+	}
+	resultList = resultList.Elem()
+
+	if len(opts.Aggregates) == 0 {
+		return fmt.Errorf("aggregate requires at least one aggregation")
+	}
+
+	driver := r.conn.Driver()
+	tbl := table{name: mapping.Table, alias: "target"}
+
+	// Joins for grouped and aggregated relation paths
+	paths := append([]string{}, opts.GroupBy...)
+	for _, a := range opts.Aggregates {
+		if a.Field != "" {
+			paths = append(paths, a.Field)
+		}
+	}
+	joins, err := buildInnerJoinsForFieldPaths(r, mapping, tbl, paths, false)
+	if err != nil {
+		return fmt.Errorf("building joins for aggregate: %w", err)
+	}
+
+	ev := &elemVisitor{
+		driver:  driver,
+		table:   tbl,
+		mapping: mapping,
+		cfg:     r.cfg,
+	}
+
+	outputs := make([]aggregateOutput, 0, len(opts.GroupBy)+len(opts.Aggregates))
+	selects := make([]string, 0, len(outputs))
+	groups := make([]string, 0, len(opts.GroupBy))
+
+	for _, g := range opts.GroupBy {
+		col, _, err := ev.Visit(zelem.Field(g))
+		if err != nil {
+			return fmt.Errorf("visiting group by field %s: %w", g, err)
+		}
+		groups = append(groups, col)
+		selects = append(selects, col)
+		outputs = append(outputs, aggregateOutput{name: g, field: strings.ReplaceAll(g, ".", "")})
+	}
+
+	for _, a := range opts.Aggregates {
+		expr, err := aggregateExpr(ev, a)
+		if err != nil {
+			return fmt.Errorf("building aggregate: %w", err)
+		}
+		selects = append(selects, expr)
+		outputs = append(outputs, aggregateOutput{name: a.As, field: a.As})
+	}
+
+	// Where clauses on relation paths are applied through a keyed subquery so
+	// that joined rows they introduce don't skew the aggregates.
+	var where string
+	var whereValues []interface{}
+	if opts.Where != nil && slices.ContainsFunc(extractFieldPaths(opts.Where), func(p string) bool { return !isSimpleField(p) }) {
+		matched := table{name: mapping.Table, alias: "matched"}
+		f, err := buildFilter(r, mapping, matched, opts.Where)
+		if err != nil {
+			return fmt.Errorf("building filter for aggregate: %w", err)
+		}
+		where = fmt.Sprintf(
+			"WHERE (%s) IN (SELECT %s %s)",
+			primaryKeySQL(driver, mapping, tbl),
+			primaryKeySQL(driver, mapping, matched),
+			f.from(driver),
+		)
+		whereValues = f.values
+	} else {
+		f, err := buildFilter(r, mapping, tbl, opts.Where)
+		if err != nil {
+			return fmt.Errorf("building filter for aggregate: %w", err)
+		}
+		if f.where != "" {
+			where = "WHERE " + f.where
+		}
+		whereValues = f.values
+	}
+
+	var groupBy string
+	if len(groups) > 0 {
+		groupBy = "GROUP BY " + strings.Join(groups, ", ") + " ORDER BY " + strings.Join(groups, ", ")
+	}
+
+	query := collapsewhitespace.String(fmt.Sprintf(
+		"SELECT %s FROM %s AS %s %s %s %s",
+		strings.Join(selects, ", "),
+		driver.EscapeTable(tbl.name),
+		driver.EscapeTable(tbl.alias),
+		innerJoinsSQL(driver, joins),
+		where,
+		groupBy,
+	))
+
+	rows, err := r.conn.Query(ctx, query, whereValues...)
+	if err != nil {
+		return fmt.Errorf("executing aggregate query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		result, err := scanAggregateResult(rows.Scan, resultList.Type().Elem(), outputs)
+		if err != nil {
+			return fmt.Errorf("reading aggregate result: %w", err)
+		}
+		resultList.Set(reflect.Append(resultList, result))
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("aggregate rows error: %w", err)
+	}
+
+	return nil
+}
+
+// scanAggregateResult reads the current row into a new value of resultType,
+// which must be a struct, a pointer to a struct or a map[string]any.
+func scanAggregateResult(scan zsql.ScanFunc, resultType reflect.Type, outputs []aggregateOutput) (reflect.Value, error) {
+	if resultType.Kind() == reflect.Map {
+		if resultType.Key().Kind() != reflect.String || resultType.Elem().Kind() != reflect.Interface {
+			return reflect.Value{}, fmt.Errorf("unsupported result type %s", resultType)
+		}
+
+		targets := make([]interface{}, len(outputs))
+		for i := range targets {
+			targets[i] = new(interface{})
+		}
+		if err := scan(targets...); err != nil {
+			return reflect.Value{}, fmt.Errorf("scanning: %w", err)
+		}
+
+		result := reflect.MakeMapWithSize(resultType, len(outputs))
+		for i, o := range outputs {
+			v := *(targets[i].(*interface{}))
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			var rv reflect.Value
+			if v == nil {
+				rv = reflect.Zero(resultType.Elem())
+			} else {
+				rv = reflect.ValueOf(v)
+			}
+			result.SetMapIndex(reflect.ValueOf(o.name), rv)
+		}
+		return result, nil
+	}
+
+	structType := resultType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("unsupported result type %s", resultType)
+	}
+
+	obj := reflect.New(structType)
+	fields := make([]reflect.Value, len(outputs))
+	targets := make([]interface{}, len(outputs))
+	for i, o := range outputs {
+		fields[i] = obj.Elem().FieldByName(o.field)
+		if !fields[i].IsValid() {
+			return reflect.Value{}, fmt.Errorf("result type %s has no field %s", structType, o.field)
+		}
+		targets[i] = createNullableScanTarget(fields[i].Type())
+	}
+
+	if err := scan(targets...); err != nil {
+		return reflect.Value{}, fmt.Errorf("scanning: %w", err)
+	}
+
+	for i, f := range fields {
+		if v, ok := convertNullableValue(targets[i], f.Type()); ok {
+			f.Set(v)
+		}
+	}
+
+	if resultType.Kind() == reflect.Ptr {
+		return obj, nil
+	}
+	return obj.Elem(), nil
+}
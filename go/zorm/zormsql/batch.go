@@ -0,0 +1,552 @@
+package zormsql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/milagre/zote/go/zelement"
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zelement/zelem"
+	"github.com/milagre/zote/go/zfunc"
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zreflect"
+	"github.com/milagre/zote/go/zsql"
+)
+
+// chunkSize returns how many rows binding paramsPerRow placeholders each fit
+// in a single statement for the driver.
+func chunkSize(driver zsql.Driver, paramsPerRow int) int {
+	if paramsPerRow <= 0 {
+		return 1
+	}
+	return max(1, driver.MaxParameters()/paramsPerRow)
+}
+
+// putModels saves models of a single mapping. Models whose populated lookup
+// key matches an existing row are updated, and the rest are inserted, using
+// as few statements as the driver's parameter limit allows.
+func (r *queryer) putModels(ctx context.Context, mapping Mapping, primaryKeyFields []string, models []reflect.Value, fields zorm.Fields) error {
+	type keyGroup struct {
+		keyFields []string
+		canInsert bool
+		models    []reflect.Value
+		keys      []lookupKey
+	}
+	groups := map[string]*keyGroup{}
+	groupOrder := []string{}
+
+	var inserts []reflect.Value
+	for _, val := range models {
+		key, hasKey, err := mapping.findPopulatedLookupKey(val)
+		if err != nil {
+			return fmt.Errorf("finding lookup key: %w", err)
+		}
+
+		if !hasKey {
+			inserts = append(inserts, val)
+			continue
+		}
+
+		group, ok := groups[key.GroupKey]
+		if !ok {
+			group = &keyGroup{
+				keyFields: key.FieldNames,
+				canInsert: key.CanInsert,
+			}
+			groups[key.GroupKey] = group
+			groupOrder = append(groupOrder, key.GroupKey)
+		}
+		group.models = append(group.models, val)
+		group.keys = append(group.keys, key)
+	}
+
+	for _, gk := range groupOrder {
+		group := groups[gk]
+
+		existing, err := r.findExisting(ctx, mapping, group.keyFields, group.keys)
+		if err != nil {
+			return fmt.Errorf("finding existing rows: %w", err)
+		}
+
+		var updates []reflect.Value
+		for i, val := range group.models {
+			found, ok := existing[group.keys[i].ValuesKey]
+			if !ok {
+				if !group.canInsert {
+					return fmt.Errorf("no rows affected for update and key columns are not insertable: %w", zorm.ErrNotFound)
+				}
+				inserts = append(inserts, val)
+				continue
+			}
+
+			// Models identified by a unique key learn their primary key here,
+			// so relations put afterward can reference them
+			for _, f := range primaryKeyFields {
+				if field := val.Elem().FieldByName(f); field.IsZero() {
+					field.Set(found.Elem().FieldByName(f))
+				}
+			}
+			updates = append(updates, val)
+		}
+
+		if err := r.updateBatch(ctx, mapping, group.keyFields, updates, fields); err != nil {
+			return fmt.Errorf("performing update: %w", err)
+		}
+	}
+
+	for _, val := range inserts {
+		mapping.initVersion(val)
+	}
+
+	if err := r.insertBatch(ctx, mapping, primaryKeyFields, inserts, fields); err != nil {
+		if r.conn.Driver().IsConflictError(err) {
+			err = zorm.ErrConflict
+		}
+		return fmt.Errorf("performing insert: %w", err)
+	}
+
+	return nil
+}
+
+// findExisting finds the rows matching the given lookup keys, returning them
+// indexed by their lookup key's ValuesKey.
+func (r *queryer) findExisting(ctx context.Context, mapping Mapping, keyFields []string, keys []lookupKey) (map[string]reflect.Value, error) {
+	result := make(map[string]reflect.Value, len(keys))
+
+	for chunk := range slices.Chunk(keys, chunkSize(r.conn.Driver(), len(keyFields))) {
+		where := zclause.In{
+			Left: zfunc.Map(keyFields, func(f string) zelement.Element { return zelem.Field(f) }),
+			Right: zfunc.Map(chunk, func(k lookupKey) []zelement.Element {
+				return zfunc.Map(k.Values, func(v any) zelement.Element { return zelem.Value(v) })
+			}),
+		}
+
+		findTarget := zreflect.MakeAddressableSliceOf(reflect.TypeOf(mapping.PtrType), 0, len(chunk))
+		err := r.probe(ctx, findTarget.Addr().Interface(), zorm.FindOptions{
+			Include: zorm.Include{Fields: keyFields},
+			Where:   where,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("executing find for existing rows: %w", err)
+		}
+
+		for i := 0; i < findTarget.Len(); i++ {
+			found := findTarget.Index(i)
+			key, err := newLookupKey(nil, keyFields, extractFields(keyFields, found), false)
+			if err != nil {
+				return nil, fmt.Errorf("creating lookup key for existing row: %w", err)
+			}
+			result[key.ValuesKey] = found
+		}
+	}
+
+	return result, nil
+}
+
+// insertSQL renders a multi-row INSERT of the given fields of each model.
+func insertSQL(driver zsql.Driver, mapping Mapping, columns []column, insertFields []string, models []reflect.Value) (string, []interface{}) {
+	row := "(" + strings.Join(zfunc.MakeSlice("?", len(columns)), ",") + ")"
+
+	query := fmt.Sprintf(
+		`
+		INSERT INTO
+		%s
+		(%s)
+		VALUES
+		%s
+		`,
+		driver.EscapeTable(mapping.Table),
+		strings.Join(zfunc.Map(columns, func(c column) string { return c.escaped(driver) }), ","),
+		strings.Join(zfunc.MakeSlice(row, len(models)), ","),
+	)
+
+	values := make([]interface{}, 0, len(models)*len(insertFields))
+	for _, val := range models {
+		values = append(values, extractFields(insertFields, val)...)
+	}
+
+	return query, values
+}
+
+// insertBatch inserts models with multi-row INSERT statements, reading any
+// generated primary keys back into the models.
+func (r *queryer) insertBatch(ctx context.Context, mapping Mapping, primaryKeyFields []string, models []reflect.Value, fields zorm.Fields) error {
+	if len(models) == 0 {
+		return nil
+	}
+
+	now := r.now()
+	for _, val := range models {
+		if err := mapping.stampTimes(val, now, true, false); err != nil {
+			return err
+		}
+	}
+
+	driver := r.conn.Driver()
+	insertFields, columns := mapping.insertFields(fields)
+
+	// Generated keys are read back through RETURNING, whose rows come back in
+	// no particular order, so they're matched to their models on a unique key
+	// the models are inserted with. Otherwise they can only be read back one
+	// row at a time.
+	generatesKeys := !mapping.keyColumnsCanInsert(mapping.PrimaryKey) ||
+		slices.ContainsFunc(models, func(v reflect.Value) bool { return !mapping.hasValues(v, primaryKeyFields) })
+	var matchColumns, matchFields []string
+	if generatesKeys {
+		ok := false
+		if driver.SupportsReturning() {
+			matchColumns, matchFields, ok = mapping.insertedUniqueKey(insertFields, models)
+		}
+		if !ok {
+			for _, val := range models {
+				if err := r.insert(ctx, mapping, primaryKeyFields, val, fields); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	for chunk := range slices.Chunk(models, chunkSize(driver, len(columns))) {
+		query, values := insertSQL(driver, mapping, columns, insertFields, chunk)
+
+		if !generatesKeys {
+			if _, _, err := zsql.Exec(ctx, r.conn, query, values); err != nil {
+				return fmt.Errorf("executing insert: %w", err)
+			}
+			continue
+		}
+
+		if err := r.insertMatchingKeys(ctx, mapping, primaryKeyFields, matchColumns, matchFields, chunk, query, values); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertMatchingKeys executes a multi-row insert of models, reading the
+// generated primary keys back through RETURNING into the models holding the
+// returned values of a unique key.
+func (r *queryer) insertMatchingKeys(ctx context.Context, mapping Mapping, primaryKeyFields []string, matchColumns []string, matchFields []string, models []reflect.Value, query string, values []any) error {
+	driver := r.conn.Driver()
+
+	// keyOf renders a model's values of the unique key, dereferencing any
+	// pointers among them
+	keyOf := func(val reflect.Value) string {
+		values := make([]any, len(matchFields))
+		for i, f := range matchFields {
+			v := reflect.Indirect(val.Elem().FieldByName(f))
+			if v.IsValid() {
+				values[i] = v.Interface()
+			}
+		}
+		return fmt.Sprint(values)
+	}
+
+	byKey := make(map[string]reflect.Value, len(models))
+	for _, val := range models {
+		byKey[keyOf(val)] = val
+	}
+
+	query += "RETURNING " + strings.Join(zfunc.Map(append(slices.Clone(mapping.PrimaryKey), matchColumns...), driver.EscapeColumn), ",")
+
+	matched := 0
+	_, err := zsql.Query(ctx, r.conn, func(scan zsql.ScanFunc) error {
+		row := reflect.New(models[0].Elem().Type())
+		targets := zfunc.Map(append(slices.Clone(primaryKeyFields), matchFields...), func(f string) any {
+			return row.Elem().FieldByName(f).Addr().Interface()
+		})
+		if err := scan(targets...); err != nil {
+			return err
+		}
+
+		key := keyOf(row)
+		val, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("insert returned a key matching no inserted row: %s", key)
+		}
+		delete(byKey, key)
+
+		for _, f := range primaryKeyFields {
+			val.Elem().FieldByName(f).Set(row.Elem().FieldByName(f))
+		}
+		matched++
+		return nil
+	}, query, values)
+	if err != nil {
+		return fmt.Errorf("executing insert: %w", err)
+	}
+
+	if matched != len(models) {
+		return fmt.Errorf("insert returned %d generated keys for %d rows", matched, len(models))
+	}
+
+	return nil
+}
+
+// updateBatch updates existing rows identified by keyFields, writing only the
+// fields each changed. Rows that changed the same fields share statements.
+func (r *queryer) updateBatch(ctx context.Context, mapping Mapping, keyFields []string, models []reflect.Value, fields zorm.Fields) error {
+	if len(models) == 0 {
+		return nil
+	}
+
+	// Models loaded by the repository only write the fields they changed,
+	// and clean models aren't written at all
+	var dirty []reflect.Value
+	var dirtyFields [][]string
+	for _, val := range models {
+		changed := mapping.changedFields(val, fields)
+		if len(changed) == 0 {
+			continue
+		}
+		dirty = append(dirty, val)
+		dirtyFields = append(dirtyFields, changed)
+	}
+	if len(dirty) == 0 {
+		return nil
+	}
+
+	now := r.now()
+	for _, val := range dirty {
+		if err := mapping.stampTimes(val, now, false, true); err != nil {
+			return err
+		}
+	}
+
+	// Versioned rows each need their own version check, so they can't share
+	// a statement
+	if _, versioned := mapping.versionColumn(); versioned || len(dirty) == 1 {
+		for i, val := range dirty {
+			if _, err := r.update(ctx, mapping, keyFields, val, dirtyFields[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// Rows share the statement's columns, so only rows that changed the same
+	// fields are written together
+	groups := map[string][]reflect.Value{}
+	groupFields := map[string][]string{}
+	var groupOrder []string
+	for i, val := range dirty {
+		key := strings.Join(slices.Sorted(slices.Values(dirtyFields[i])), ",")
+		if _, ok := groups[key]; !ok {
+			groupOrder = append(groupOrder, key)
+			groupFields[key] = dirtyFields[i]
+		}
+		groups[key] = append(groups[key], val)
+	}
+
+	for _, key := range groupOrder {
+		group := groups[key]
+		if len(group) == 1 {
+			if _, err := r.update(ctx, mapping, keyFields, group[0], groupFields[key]); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := r.updateGroup(ctx, mapping, keyFields, group, groupFields[key]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateGroup updates rows that changed the same fields in a single
+// statement per chunk, selecting each row's values with CASE expressions:
+//
+//	UPDATE t SET a = CASE WHEN k = ? THEN ? WHEN k = ? THEN ? ELSE a END WHERE (k) IN ((?),(?))
+func (r *queryer) updateGroup(ctx context.Context, mapping Mapping, keyFields []string, models []reflect.Value, changed zorm.Fields) error {
+	driver := r.conn.Driver()
+	tbl := table{name: mapping.Table}
+
+	updateFields := mapping.updateFields(changed)
+	if len(updateFields) == 0 {
+		return nil
+	}
+
+	mapColumn := func(f string) (column, error) {
+		c, _, err := mapping.mapField(tbl, "", f)
+		return c, err
+	}
+	updateColumns, err := zfunc.MapE(updateFields, mapColumn)
+	if err != nil {
+		return fmt.Errorf("mapping update columns: %w", err)
+	}
+	keyColumns, err := zfunc.MapE(keyFields, mapColumn)
+	if err != nil {
+		return fmt.Errorf("mapping key columns: %w", err)
+	}
+
+	keyMatch := strings.Join(zfunc.Map(keyColumns, func(c column) string {
+		return c.escaped(driver) + "=?"
+	}), " AND ")
+	keyRow := "(" + strings.Join(zfunc.MakeSlice("?", len(keyColumns)), ",") + ")"
+
+	paramsPerRow := len(updateColumns)*(len(keyColumns)+1) + len(keyColumns)
+	for chunk := range slices.Chunk(models, chunkSize(driver, paramsPerRow)) {
+		values := make([]interface{}, 0, len(chunk)*paramsPerRow)
+
+		assignments := make([]string, 0, len(updateColumns))
+		for i, col := range updateColumns {
+			var sb strings.Builder
+			fmt.Fprintf(&sb, "%s=CASE", col.escaped(driver))
+			for _, val := range chunk {
+				fmt.Fprintf(&sb, " WHEN %s THEN ?", keyMatch)
+				values = append(values, extractFields(keyFields, val)...)
+				values = append(values, val.Elem().FieldByName(updateFields[i]).Interface())
+			}
+			fmt.Fprintf(&sb, " ELSE %s END", col.escaped(driver))
+			assignments = append(assignments, sb.String())
+		}
+
+		for _, val := range chunk {
+			values = append(values, extractFields(keyFields, val)...)
+		}
+
+		query := fmt.Sprintf(
+			`
+			UPDATE
+			%s
+			SET
+			%s
+			WHERE
+			(%s) IN (%s)
+			`,
+			tbl.escaped(driver),
+			strings.Join(assignments, ", "),
+			strings.Join(zfunc.Map(keyColumns, func(c column) string { return c.escaped(driver) }), ","),
+			strings.Join(zfunc.MakeSlice(keyRow, len(chunk)), ","),
+		)
+
+		if _, _, err := zsql.Exec(ctx, r.conn, query, values); err != nil {
+			return fmt.Errorf("executing update: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// upsertModels writes models with atomic INSERT statements that resolve
+// conflicts on the OnConflict key natively, then reads back the primary keys
+// of models identified by another key.
+func (r *queryer) upsertModels(ctx context.Context, mapping Mapping, primaryKeyFields []string, models []reflect.Value, fields zorm.Fields, onConflict zorm.OnConflict) error {
+	driver := r.conn.Driver()
+	tbl := table{name: mapping.Table}
+
+	keyFields := onConflict.Key
+	if len(keyFields) == 0 {
+		keyFields = primaryKeyFields
+	}
+
+	keyColumns, err := zfunc.MapE(keyFields, func(f string) (string, error) {
+		c, _, err := mapping.mapField(tbl, "", f)
+		return c.name, err
+	})
+	if err != nil {
+		return fmt.Errorf("mapping conflict key: %w", err)
+	}
+
+	for i, val := range models {
+		if !mapping.hasValues(val, keyFields) {
+			return fmt.Errorf("conflict key %v is not populated for object at index %d", keyFields, i)
+		}
+	}
+
+	now := r.now()
+	for _, val := range models {
+		mapping.initVersion(val)
+		if err := mapping.stampTimes(val, now, true, true); err != nil {
+			return err
+		}
+	}
+
+	// The proposed row carries the conflict key even when it's generated on
+	// insert, such as the primary key, for it to conflict at all
+	insertFields, columns := mapping.insertFields(fields)
+	for i, f := range keyFields {
+		if !slices.Contains(insertFields, f) {
+			insertFields = append(insertFields, f)
+			columns = append(columns, column{table: tbl, name: keyColumns[i]})
+		}
+	}
+	for _, c := range mapping.Columns {
+		if c.AutoUpdateTime && !slices.Contains(insertFields, c.Field) {
+			insertFields = append(insertFields, c.Field)
+			columns = append(columns, column{table: tbl, name: c.Name})
+		}
+	}
+
+	// Only values present in the proposed row can be copied onto a conflicting
+	// one. Upserts are unconditional, but still increment the version of rows
+	// they update so that puts of models loaded before them conflict; the get
+	// after the put reads the new version back.
+	version, versioned := mapping.versionColumn()
+	var updateColumns []string
+	var incrementColumns []string
+	if onConflict.Action == zorm.ConflictUpdate {
+		for _, f := range mapping.updateFields(onConflict.Fields) {
+			if slices.Contains(keyFields, f) || !slices.Contains(insertFields, f) || f == version.Field {
+				continue
+			}
+			c, _, err := mapping.mapField(tbl, "", f)
+			if err != nil {
+				return fmt.Errorf("mapping conflict update field: %w", err)
+			}
+			updateColumns = append(updateColumns, c.name)
+		}
+	}
+
+	if versioned && len(updateColumns) > 0 {
+		incrementColumns = append(incrementColumns, version.Name)
+	}
+
+	upsert := driver.UpsertClause(mapping.Table, keyColumns, updateColumns, incrementColumns)
+
+	for chunk := range slices.Chunk(models, chunkSize(driver, len(columns))) {
+		query, values := insertSQL(driver, mapping, columns, insertFields, chunk)
+
+		if _, _, err := zsql.Exec(ctx, r.conn, query+upsert, values); err != nil {
+			if driver.IsConflictError(err) {
+				err = zorm.ErrConflict
+			}
+			return fmt.Errorf("executing upsert: %w", err)
+		}
+	}
+
+	if slices.Equal(keyFields, primaryKeyFields) {
+		return nil
+	}
+
+	keys, err := zfunc.MapE(models, func(v reflect.Value) (lookupKey, error) {
+		return newLookupKey(keyColumns, keyFields, extractFields(keyFields, v), false)
+	})
+	if err != nil {
+		return fmt.Errorf("creating lookup keys after upsert: %w", err)
+	}
+
+	existing, err := r.findExisting(ctx, mapping, keyFields, keys)
+	if err != nil {
+		return fmt.Errorf("finding rows after upsert: %w", err)
+	}
+
+	for i, val := range models {
+		found, ok := existing[keys[i].ValuesKey]
+		if !ok {
+			return fmt.Errorf("upserted row for object at index %d not found", i)
+		}
+		for _, f := range primaryKeyFields {
+			val.Elem().FieldByName(f).Set(found.Elem().FieldByName(f))
+		}
+	}
+
+	return nil
+}
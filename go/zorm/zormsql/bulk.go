@@ -0,0 +1,204 @@
+package zormsql
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"4d63.com/collapsewhitespace"
+
+	"github.com/milagre/zote/go/zelement"
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zfunc"
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zsql"
+)
+
+// bulkWhere renders the WHERE clause of a DELETE or UPDATE against the
+// mapping's unaliased table. Clauses on relation paths can't be joined
+// directly into those statements, so they select the primary keys of the
+// matching rows through a subquery instead. The extra derived table keeps
+// MySQL from rejecting a subquery on the table being modified. Soft deleted
+// rows only match when includeDeleted is set.
+func bulkWhere(r *queryer, mapping Mapping, clause zclause.Clause, includeDeleted bool) (string, []interface{}, error) {
+	driver := r.conn.Driver()
+
+	if !slices.ContainsFunc(extractFieldPaths(clause), func(p string) bool { return !isSimpleField(p) }) {
+		f, err := buildFilterDeleted(r, mapping, table{name: mapping.Table}, clause, includeDeleted)
+		if err != nil {
+			return "", nil, err
+		}
+		return f.where, f.values, nil
+	}
+
+	matched := table{name: mapping.Table, alias: "matched"}
+	f, err := buildFilterDeleted(r, mapping, matched, clause, includeDeleted)
+	if err != nil {
+		return "", nil, err
+	}
+
+	where := fmt.Sprintf(
+		"(%s) IN (SELECT %s FROM (SELECT DISTINCT %s %s) AS %s)",
+		strings.Join(zfunc.Map(mapping.PrimaryKey, driver.EscapeColumn), ", "),
+		strings.Join(zfunc.Map(mapping.PrimaryKey, driver.EscapeColumn), ", "),
+		strings.Join(zfunc.Map(mapping.PrimaryKey, func(c string) string {
+			return fmt.Sprintf("%s AS %s", driver.EscapeTableColumn(matched.alias, c), driver.EscapeColumn(c))
+		}), ", "),
+		f.from(driver),
+		driver.EscapeTable("matched_keys"),
+	)
+
+	return where, f.values, nil
+}
+
+// softDeleteSQL renders an UPDATE stamping the soft delete column of the rows
+// matching where with the value bound to its first placeholder, see
+// Mapping.softDeleteValue.
+func softDeleteSQL(driver zsql.Driver, mapping Mapping, where string) string {
+	return fmt.Sprintf(
+		"UPDATE %s SET %s=? WHERE %s",
+		driver.EscapeTable(mapping.Table),
+		driver.EscapeColumn(mapping.SoftDelete),
+		where,
+	)
+}
+
+func (r *queryer) deleteWhere(ctx context.Context, model any, where zclause.Clause, opts zorm.DeleteWhereOptions) (int, error) {
+	mapping, err := r.mappingForModel(model)
+	if err != nil {
+		return 0, fmt.Errorf("invalid argument to delete where: %w", err)
+	}
+
+	if where == nil {
+		return 0, fmt.Errorf("delete where requires a where clause")
+	}
+
+	w, values, err := bulkWhere(r, mapping, where, opts.HardDelete)
+	if err != nil {
+		return 0, fmt.Errorf("building where for delete: %w", err)
+	}
+
+	driver := r.conn.Driver()
+	query := collapsewhitespace.String(fmt.Sprintf(
+		"DELETE FROM %s WHERE %s",
+		driver.EscapeTable(mapping.Table),
+		w,
+	))
+	if mapping.SoftDelete != "" && !opts.HardDelete {
+		deleted, err := mapping.softDeleteValue(r.now())
+		if err != nil {
+			return 0, err
+		}
+
+		query = collapsewhitespace.String(softDeleteSQL(driver, mapping, w))
+		values = append([]interface{}{deleted}, values...)
+	}
+
+	count, _, err := zsql.Exec(ctx, r.conn, query, values)
+	if err != nil {
+		return 0, fmt.Errorf("executing delete where: %w", err)
+	}
+
+	return count, nil
+}
+
+func (r *queryer) updateWhere(ctx context.Context, model any, where zclause.Clause, set map[string]any) (int, error) {
+	mapping, err := r.mappingForModel(model)
+	if err != nil {
+		return 0, fmt.Errorf("invalid argument to update where: %w", err)
+	}
+
+	if where == nil {
+		return 0, fmt.Errorf("update where requires a where clause")
+	}
+
+	if len(set) == 0 {
+		return 0, fmt.Errorf("update where requires at least one field to set")
+	}
+
+	driver := r.conn.Driver()
+	tbl := table{name: mapping.Table}
+
+	// Sort fields so the statement is stable across calls
+	fields := make([]string, 0, len(set))
+	for f := range set {
+		fields = append(fields, f)
+	}
+	slices.Sort(fields)
+
+	assignments := make([]string, 0, len(fields))
+	values := make([]interface{}, 0, len(fields))
+	for _, f := range fields {
+		idx := slices.IndexFunc(mapping.Columns, func(c Column) bool { return c.Field == f })
+		if idx < 0 {
+			return 0, fmt.Errorf("update where field %s is not mapped", f)
+		}
+		if mapping.Columns[idx].NoUpdate {
+			return 0, fmt.Errorf("update where field %s is not updatable", f)
+		}
+
+		col := column{table: tbl, name: mapping.Columns[idx].Name}
+
+		elem, ok := set[f].(zelement.Element)
+		if !ok {
+			assignments = append(assignments, fmt.Sprintf("%s=?", col.escaped(driver)))
+			values = append(values, set[f])
+			continue
+		}
+
+		visitor := &whereVisitor{
+			driver:  driver,
+			table:   tbl,
+			mapping: mapping,
+			cfg:     r.cfg,
+		}
+		if err := elem.Accept(visitor); err != nil {
+			return 0, fmt.Errorf("visiting update where value for %s: %w", f, err)
+		}
+		assignments = append(assignments, fmt.Sprintf("%s=%s", col.escaped(driver), visitor.result))
+		values = append(values, visitor.values...)
+	}
+
+	// Rows changed in bulk move to a new version so that models read
+	// beforehand can't overwrite the change
+	if version, ok := mapping.versionColumn(); ok {
+		if _, set := set[version.Field]; !set {
+			col := column{table: tbl, name: version.Name}
+			assignments = append(assignments, fmt.Sprintf("%s=%s+1", col.escaped(driver), col.escaped(driver)))
+		}
+	}
+
+	now := r.now()
+	for _, c := range mapping.Columns {
+		if _, set := set[c.Field]; set || !c.AutoUpdateTime {
+			continue
+		}
+		stamp, err := mapping.timeValue(c.Field, now)
+		if err != nil {
+			return 0, err
+		}
+		col := column{table: tbl, name: c.Name}
+		assignments = append(assignments, fmt.Sprintf("%s=?", col.escaped(driver)))
+		values = append(values, stamp)
+	}
+
+	w, whereValues, err := bulkWhere(r, mapping, where, false)
+	if err != nil {
+		return 0, fmt.Errorf("building where for update: %w", err)
+	}
+
+	query := collapsewhitespace.String(fmt.Sprintf(
+		"UPDATE %s SET %s WHERE %s",
+		driver.EscapeTable(mapping.Table),
+		strings.Join(assignments, ", "),
+		w,
+	))
+
+	count, _, err := zsql.Exec(ctx, r.conn, query, append(values, whereValues...))
+	if err != nil {
+		return 0, fmt.Errorf("executing update where: %w", err)
+	}
+
+	return count, nil
+}
@@ -0,0 +1,20 @@
+package zormsql
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/milagre/zote/go/zelement/zsort"
+	"github.com/milagre/zote/go/zorm/internal/zmodel"
+)
+
+// newKeyset returns the keyset paginating finds of the mapping's model by
+// cursor.
+func newKeyset(mapping Mapping, sorts []zsort.Sort) (*zmodel.Keyset, error) {
+	pkFields, err := mapping.primaryKeyFields()
+	if err != nil {
+		return nil, fmt.Errorf("mapping primary key for keyset: %w", err)
+	}
+
+	return zmodel.NewKeyset(reflect.TypeOf(mapping.PtrType).Elem(), pkFields, sorts)
+}
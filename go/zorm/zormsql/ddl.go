@@ -0,0 +1,398 @@
+package zormsql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/milagre/zote/go/zsql"
+	"github.com/milagre/zote/go/ztime"
+)
+
+type ddlTable struct {
+	name        string
+	columns     []ddlColumn
+	primaryKey  []string
+	uniqueKeys  [][]string
+	foreignKeys []ddlForeignKey
+}
+
+type ddlColumn struct {
+	name          string
+	typ           zsql.ColumnType
+	nullable      bool
+	autoIncrement bool
+	def           string
+
+	// currentTime defaults the column to the current time, in the driver's
+	// own expression for it
+	currentTime bool
+}
+
+type ddlForeignKey struct {
+	columns    []string
+	table      string
+	references []string
+}
+
+// DDL returns the statements creating the tables of mappings in the dialect
+// of driver, ordered so that tables are created before the tables referencing
+// them.
+//
+// Column types are inferred from field types unless Column.Type is set, and
+// pointer and sql.Null fields, as well as soft delete columns, are nullable.
+// A single integer primary key column that isn't inserted is generated by the
+// database. Time columns that are not nullable default to the current time
+// when the repository doesn't always insert them, and version columns default
+// to 1.
+//
+// Unique keys become unique indexes. Relations become foreign keys on the
+// side whose columns are not its primary key, and many-to-many relations
+// create their join table, keyed by all of its columns.
+func DDL(driver zsql.Driver, mappings ...Mapping) ([]string, error) {
+	tables, err := ddlTables(mappings)
+	if err != nil {
+		return nil, err
+	}
+
+	var statements []string
+	for _, t := range tables {
+		statements = append(statements, t.create(driver))
+		for _, uk := range t.uniqueKeys {
+			statements = append(statements, fmt.Sprintf(
+				"CREATE UNIQUE INDEX %s ON %s (%s)",
+				driver.EscapeTable("unq_"+t.name+"_"+strings.Join(uk, "_")),
+				driver.EscapeTable(t.name),
+				escapeColumns(driver, uk),
+			))
+		}
+	}
+
+	return statements, nil
+}
+
+// DDL returns the statements creating the tables of the registered mappings.
+// See DDL.
+func (r *Repository) DDL() ([]string, error) {
+	mappings := slices.SortedFunc(maps.Values(r.cfg.mappings), func(a, b Mapping) int {
+		return strings.Compare(a.Table, b.Table)
+	})
+	return DDL(r.ts.Driver(), mappings...)
+}
+
+// CreateTables creates the tables of the registered mappings. See DDL.
+func (r *Repository) CreateTables(ctx context.Context) error {
+	statements, err := r.DDL()
+	if err != nil {
+		return fmt.Errorf("generating ddl: %w", err)
+	}
+
+	for _, s := range statements {
+		if _, _, err := zsql.Exec(ctx, r.ts, s, nil); err != nil {
+			return fmt.Errorf("creating tables: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func ddlTables(mappings []Mapping) ([]*ddlTable, error) {
+	var order []string
+	tables := map[string]*ddlTable{}
+	mappingsByTable := map[string]Mapping{}
+
+	for _, m := range mappings {
+		if err := m.Validate(); err != nil {
+			return nil, fmt.Errorf("mapping for type %T: %w", m.PtrType, err)
+		}
+		if _, ok := tables[m.Table]; ok {
+			return nil, fmt.Errorf("table %s mapped more than once", m.Table)
+		}
+
+		t, err := mappingTable(m)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %w", m.Table, err)
+		}
+
+		order = append(order, m.Table)
+		tables[m.Table] = t
+		mappingsByTable[m.Table] = m
+	}
+
+	for _, m := range mappings {
+		for _, rel := range m.Relations {
+			related, mapped := mappingsByTable[rel.Table]
+			local, remote := relationColumns(rel.Columns)
+
+			if rel.Through != nil {
+				if !mapped {
+					return nil, fmt.Errorf("table %s: relation %s references unmapped table %s", m.Table, rel.Field, rel.Table)
+				}
+				if _, ok := tables[rel.Through.Table]; ok {
+					continue
+				}
+
+				t := joinTable(rel, tables[m.Table], tables[rel.Table])
+				order = append(order, t.name)
+				tables[t.name] = t
+				continue
+			}
+
+			localIsKey := sameColumns(local, m.PrimaryKey)
+			remoteIsKey := mapped && sameColumns(remote, related.PrimaryKey)
+
+			f, _ := reflect.TypeOf(m.PtrType).Elem().FieldByName(rel.Field)
+			fkLocal := f.Type.Kind() != reflect.Slice
+			if localIsKey != remoteIsKey {
+				fkLocal = remoteIsKey
+			}
+
+			if fkLocal {
+				tables[m.Table].addForeignKey(ddlForeignKey{columns: local, table: rel.Table, references: remote})
+			} else if mapped {
+				tables[rel.Table].addForeignKey(ddlForeignKey{columns: remote, table: m.Table, references: local})
+			}
+		}
+	}
+
+	return sortTables(order, tables)
+}
+
+func mappingTable(m Mapping) (*ddlTable, error) {
+	structType := reflect.TypeOf(m.PtrType).Elem()
+	t := &ddlTable{
+		name:       m.Table,
+		primaryKey: m.PrimaryKey,
+		uniqueKeys: m.UniqueKeys,
+	}
+
+	for _, c := range m.Columns {
+		f, _ := structType.FieldByName(c.Field)
+		typ, nullable, ok := columnType(f.Type)
+		if c.Type != "" {
+			typ, ok = c.Type, true
+		}
+		if !ok {
+			return nil, fmt.Errorf("column %s: cannot infer the type of field %s %s, set Column.Type", c.Name, c.Field, f.Type)
+		}
+
+		col := ddlColumn{
+			name:     c.Name,
+			typ:      typ,
+			nullable: nullable || c.Name == m.SoftDelete,
+			autoIncrement: len(m.PrimaryKey) == 1 && m.PrimaryKey[0] == c.Name &&
+				c.NoInsert && typ == zsql.ColumnTypeInteger,
+		}
+
+		switch {
+		case c.Version:
+			col.def = "1"
+		case typ == zsql.ColumnTypeTime && !col.nullable && (c.NoInsert || c.AutoCreateTime):
+			col.currentTime = true
+		}
+
+		t.columns = append(t.columns, col)
+	}
+
+	return t, nil
+}
+
+// joinTable builds the join table of a many-to-many relation from the local
+// table to the related table, with column types taken from the columns they
+// reference.
+func joinTable(rel Relation, localTable *ddlTable, relatedTable *ddlTable) *ddlTable {
+	t := &ddlTable{name: rel.Through.Table}
+
+	add := func(pairs map[string]string, joinIsKey bool, referenced *ddlTable) {
+		fk := ddlForeignKey{table: referenced.name}
+		for _, key := range slices.Sorted(maps.Keys(pairs)) {
+			joinCol, refCol := pairs[key], key
+			if joinIsKey {
+				joinCol, refCol = key, pairs[key]
+			}
+
+			col := ddlColumn{name: joinCol, typ: zsql.ColumnTypeInteger}
+			if ref, ok := referenced.column(refCol); ok {
+				col.typ = ref.typ
+			}
+
+			t.columns = append(t.columns, col)
+			t.primaryKey = append(t.primaryKey, joinCol)
+			fk.columns = append(fk.columns, joinCol)
+			fk.references = append(fk.references, refCol)
+		}
+		t.addForeignKey(fk)
+	}
+
+	add(rel.Columns, false, localTable)
+	add(rel.Through.Columns, true, relatedTable)
+
+	return t
+}
+
+// sortTables orders tables so that each follows the tables its foreign keys
+// reference, repeatedly taking the tables that are ready in the given order.
+func sortTables(order []string, tables map[string]*ddlTable) ([]*ddlTable, error) {
+	result := make([]*ddlTable, 0, len(order))
+	created := map[string]bool{}
+
+	for len(result) < len(order) {
+		progressed := false
+		for _, name := range order {
+			if created[name] {
+				continue
+			}
+
+			ready := true
+			for _, fk := range tables[name].foreignKeys {
+				if _, ok := tables[fk.table]; ok && fk.table != name && !created[fk.table] {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				continue
+			}
+
+			created[name] = true
+			result = append(result, tables[name])
+			progressed = true
+		}
+
+		if !progressed {
+			var cycle []string
+			for _, name := range order {
+				if !created[name] {
+					cycle = append(cycle, name)
+				}
+			}
+			return nil, fmt.Errorf("foreign keys between tables %s form a cycle", strings.Join(cycle, ", "))
+		}
+	}
+
+	return result, nil
+}
+
+func (t *ddlTable) column(name string) (ddlColumn, bool) {
+	for _, c := range t.columns {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return ddlColumn{}, false
+}
+
+func (t *ddlTable) addForeignKey(fk ddlForeignKey) {
+	for _, existing := range t.foreignKeys {
+		if reflect.DeepEqual(existing, fk) {
+			return
+		}
+	}
+	t.foreignKeys = append(t.foreignKeys, fk)
+}
+
+func (t *ddlTable) create(driver zsql.Driver) string {
+	var defs []string
+	autoIncrement := false
+	for _, c := range t.columns {
+		def := driver.EscapeColumn(c.name) + " " + driver.ColumnDefinition(c.typ, c.autoIncrement)
+		if c.autoIncrement {
+			autoIncrement = true
+		} else if !c.nullable {
+			def += " NOT NULL"
+		}
+		switch {
+		case c.currentTime:
+			def += " DEFAULT " + driver.CurrentTimeDefault()
+		case c.def != "":
+			def += " DEFAULT " + c.def
+		}
+		defs = append(defs, def)
+	}
+
+	if !autoIncrement {
+		defs = append(defs, fmt.Sprintf("PRIMARY KEY (%s)", escapeColumns(driver, t.primaryKey)))
+	}
+
+	for _, fk := range t.foreignKeys {
+		defs = append(defs, fmt.Sprintf(
+			"FOREIGN KEY (%s) REFERENCES %s (%s)",
+			escapeColumns(driver, fk.columns),
+			driver.EscapeTable(fk.table),
+			escapeColumns(driver, fk.references),
+		))
+	}
+
+	return fmt.Sprintf("CREATE TABLE %s (\n\t%s\n)", driver.EscapeTable(t.name), strings.Join(defs, ",\n\t"))
+}
+
+// columnType infers the column type of a field type, and whether it is
+// nullable.
+func columnType(t reflect.Type) (typ zsql.ColumnType, nullable bool, ok bool) {
+	switch t {
+	case reflect.TypeFor[time.Time]():
+		return zsql.ColumnTypeTime, false, true
+	case reflect.TypeFor[ztime.Date]():
+		return zsql.ColumnTypeDate, false, true
+	case reflect.TypeFor[json.RawMessage]():
+		return zsql.ColumnTypeJSON, true, true
+	case reflect.TypeFor[[]byte]():
+		return zsql.ColumnTypeBytes, true, true
+	case reflect.TypeFor[sql.NullString]():
+		return zsql.ColumnTypeText, true, true
+	case reflect.TypeFor[sql.NullInt64](), reflect.TypeFor[sql.NullInt32](),
+		reflect.TypeFor[sql.NullInt16](), reflect.TypeFor[sql.NullByte]():
+		return zsql.ColumnTypeInteger, true, true
+	case reflect.TypeFor[sql.NullFloat64]():
+		return zsql.ColumnTypeFloat, true, true
+	case reflect.TypeFor[sql.NullBool]():
+		return zsql.ColumnTypeBoolean, true, true
+	case reflect.TypeFor[sql.NullTime]():
+		return zsql.ColumnTypeTime, true, true
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		typ, _, ok := columnType(t.Elem())
+		return typ, true, ok
+	case reflect.String:
+		return zsql.ColumnTypeText, false, true
+	case reflect.Bool:
+		return zsql.ColumnTypeBoolean, false, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return zsql.ColumnTypeInteger, false, true
+	case reflect.Float32, reflect.Float64:
+		return zsql.ColumnTypeFloat, false, true
+	}
+
+	return "", false, false
+}
+
+// relationColumns returns the local and remote columns of a relation's
+// column pairs, ordered by local column.
+func relationColumns(pairs map[string]string) (local []string, remote []string) {
+	for _, l := range slices.Sorted(maps.Keys(pairs)) {
+		local = append(local, l)
+		remote = append(remote, pairs[l])
+	}
+	return local, remote
+}
+
+func sameColumns(a []string, b []string) bool {
+	return len(a) == len(b) && !slices.ContainsFunc(a, func(c string) bool { return !slices.Contains(b, c) })
+}
+
+func escapeColumns(driver zsql.Driver, columns []string) string {
+	escaped := make([]string, 0, len(columns))
+	for _, c := range columns {
+		escaped = append(escaped, driver.EscapeColumn(c))
+	}
+	return strings.Join(escaped, ", ")
+}
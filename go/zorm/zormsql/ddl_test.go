@@ -0,0 +1,89 @@
+package zormsql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milagre/zote/go/zsql/zmysql"
+	"github.com/milagre/zote/go/zsql/zpostgres"
+	"github.com/milagre/zote/go/zsql/zsqlite3"
+)
+
+func TestDDL(t *testing.T) {
+	mappings := func(t *testing.T) []Mapping {
+		var result []Mapping
+		for _, model := range []any{&taggedUser{}, &taggedAccount{}, &taggedGroup{}} {
+			m, err := MappingFromStruct(model)
+			require.NoError(t, err)
+			result = append(result, m)
+		}
+		return result
+	}
+
+	t.Run("SQLite", func(t *testing.T) {
+		statements, err := DDL(zsqlite3.Driver, mappings(t)...)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"CREATE TABLE \"accounts\" (\n" +
+				"\t\"id\" TEXT NOT NULL,\n" +
+				"\tPRIMARY KEY (\"id\")\n" +
+				")",
+			"CREATE TABLE \"groups\" (\n" +
+				"\t\"id\" TEXT NOT NULL,\n" +
+				"\tPRIMARY KEY (\"id\")\n" +
+				")",
+			"CREATE TABLE \"users\" (\n" +
+				"\t\"id\" TEXT NOT NULL,\n" +
+				"\t\"account_id\" TEXT NOT NULL,\n" +
+				"\t\"email\" TEXT NOT NULL,\n" +
+				"\t\"version\" INTEGER NOT NULL DEFAULT 1,\n" +
+				"\t\"created\" DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,\n" +
+				"\t\"deleted\" DATETIME,\n" +
+				"\tPRIMARY KEY (\"id\"),\n" +
+				"\tFOREIGN KEY (\"account_id\") REFERENCES \"accounts\" (\"id\")\n" +
+				")",
+			`CREATE UNIQUE INDEX "unq_users_account_id_email" ON "users" ("account_id", "email")`,
+			"CREATE TABLE \"memberships\" (\n" +
+				"\t\"user_id\" TEXT NOT NULL,\n" +
+				"\t\"group_id\" TEXT NOT NULL,\n" +
+				"\tPRIMARY KEY (\"user_id\", \"group_id\"),\n" +
+				"\tFOREIGN KEY (\"user_id\") REFERENCES \"users\" (\"id\"),\n" +
+				"\tFOREIGN KEY (\"group_id\") REFERENCES \"groups\" (\"id\")\n" +
+				")",
+		}, statements)
+	})
+
+	t.Run("MySQLTimeDefault", func(t *testing.T) {
+		statements, err := DDL(zmysql.Driver, mappings(t)...)
+		require.NoError(t, err)
+		assert.Contains(t, statements[2], "`created` DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),\n",
+			"defaults match the precision of the column")
+	})
+
+	t.Run("TypeHints", func(t *testing.T) {
+		m := stampedMapping
+		m.Columns = append([]Column(nil), m.Columns...)
+		m.Columns[0].NoInsert = true
+		m.Columns[0].Type = "integer"
+
+		statements, err := DDL(zpostgres.Driver, m)
+		require.NoError(t, err)
+		assert.Equal(t, []string{
+			"CREATE TABLE \"stamped\" (\n" +
+				"\t\"id\" BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,\n" +
+				"\t\"created\" DATE NOT NULL,\n" +
+				"\t\"modified\" TIMESTAMP WITH TIME ZONE\n" +
+				")",
+		}, statements)
+	})
+
+	t.Run("UnmappedJoinTarget", func(t *testing.T) {
+		m, err := MappingFromStruct(&taggedUser{})
+		require.NoError(t, err)
+
+		_, err = DDL(zsqlite3.Driver, m)
+		assert.ErrorContains(t, err, "relation Groups references unmapped table groups")
+	})
+}
@@ -0,0 +1,144 @@
+--
+-- shared
+--
+-- Foreign keys are intentionally not declared so the shared zormtest suites,
+-- which delete parents without their children, behave as they do on sqlite.
+
+CREATE FUNCTION set_modified_timestamp() RETURNS TRIGGER AS $$
+BEGIN
+	NEW.modified = now();
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+--
+-- accounts
+--
+
+CREATE TABLE accounts (
+	id BIGSERIAL PRIMARY KEY,
+	created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	modified TIMESTAMP DEFAULT NULL,
+	company TEXT NOT NULL,
+	contact_email TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX unq_accounts_company ON accounts (company);
+
+CREATE TRIGGER accounts_modified_timestamp
+BEFORE UPDATE ON accounts
+FOR EACH ROW EXECUTE FUNCTION set_modified_timestamp();
+
+INSERT INTO accounts (company, contact_email) VALUES
+('Acme', 'contact@acme.example'),
+('Dunder Mifflin', 'contact@dundermifflin.example'),
+('Explorers, LLC', 'dora@explorers.test');
+
+UPDATE accounts SET company='Acme, Inc.' where company='Acme';
+
+--
+-- user addresses
+--
+
+CREATE TABLE user_addresses (
+	id BIGSERIAL PRIMARY KEY,
+	created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	modified TIMESTAMP DEFAULT NULL,
+	street TEXT NOT NULL,
+	city TEXT NOT NULL,
+	state TEXT NOT NULL,
+	version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE TRIGGER user_addresses_modified_timestamp
+BEFORE UPDATE ON user_addresses
+FOR EACH ROW EXECUTE FUNCTION set_modified_timestamp();
+
+INSERT INTO user_addresses (street, city, state) VALUES ('123 Loony Lane', 'Acmeton', 'RI');
+INSERT INTO user_addresses (street, city, state) VALUES ('1725 Slough Avenue', 'Scranton', 'PA');
+
+--
+-- users
+--
+
+CREATE TABLE users (
+	id BIGSERIAL PRIMARY KEY,
+	created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	modified TIMESTAMP DEFAULT NULL,
+	account_id BIGINT NOT NULL,
+	user_address_id BIGINT NULL,
+	first_name TEXT NOT NULL
+);
+
+CREATE TRIGGER users_modified_timestamp
+BEFORE UPDATE ON users
+FOR EACH ROW EXECUTE FUNCTION set_modified_timestamp();
+
+INSERT INTO users (account_id, user_address_id, first_name) VALUES (
+	(SELECT id FROM accounts WHERE company='Acme, Inc.'),
+	(SELECT id FROM user_addresses WHERE street='123 Loony Lane'),
+	'Daffy'
+);
+INSERT INTO users (account_id, user_address_id, first_name) VALUES (
+	(SELECT id FROM accounts WHERE company='Dunder Mifflin'),
+	(SELECT id FROM user_addresses WHERE street='1725 Slough Avenue'),
+	'Dwight'
+);
+INSERT INTO users (account_id, first_name) VALUES (
+	(SELECT id FROM accounts WHERE company='Explorers, LLC'),
+	'Dora'
+);
+
+--
+-- user auths
+--
+
+CREATE TABLE user_auths (
+	id BIGSERIAL PRIMARY KEY,
+	created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	modified TIMESTAMP DEFAULT NULL,
+	deleted TIMESTAMP DEFAULT NULL,
+	user_id BIGINT NOT NULL,
+	provider TEXT NOT NULL,
+	data TEXT NOT NULL
+);
+
+CREATE TRIGGER user_auths_modified_timestamp
+BEFORE UPDATE ON user_auths
+FOR EACH ROW EXECUTE FUNCTION set_modified_timestamp();
+
+INSERT INTO user_auths (user_id, provider, data) SELECT id, 'password', 'P@ssw0rd!' FROM users WHERE first_name='Daffy';
+INSERT INTO user_auths (user_id, provider, data) SELECT id, 'oauth2', '{"token":"1234"}' FROM users WHERE first_name='Daffy';
+
+INSERT INTO user_auths (user_id, provider, data) SELECT id, 'password', 't0tally_S3CURE!' FROM users WHERE first_name='Dwight';
+INSERT INTO user_auths (user_id, provider, data) SELECT id, 'passkey', '{"secret":"5678"}' FROM users WHERE first_name='Dwight';
+
+INSERT INTO user_auths (user_id, provider, data, deleted) SELECT id, 'password', 'r3voked', CURRENT_TIMESTAMP FROM users WHERE first_name='Dora';
+
+--
+-- user_groups
+--
+
+CREATE TABLE user_groups (
+	id BIGSERIAL PRIMARY KEY,
+	created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	modified TIMESTAMP DEFAULT NULL,
+	name TEXT NOT NULL UNIQUE
+);
+
+INSERT INTO user_groups (name) VALUES ('Admins');
+INSERT INTO user_groups (name) VALUES ('Staff');
+
+--
+-- user_group_memberships
+--
+
+CREATE TABLE user_group_memberships (
+	user_id BIGINT NOT NULL,
+	user_group_id BIGINT NOT NULL,
+
+	PRIMARY KEY (user_id, user_group_id)
+);
+
+INSERT INTO user_group_memberships (user_id, user_group_id) SELECT u.id, g.id FROM users u, user_groups g WHERE u.first_name='Daffy';
+INSERT INTO user_group_memberships (user_id, user_group_id) SELECT u.id, g.id FROM users u, user_groups g WHERE u.first_name='Dwight' AND g.name='Staff';
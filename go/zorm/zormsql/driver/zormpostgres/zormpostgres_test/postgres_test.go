@@ -0,0 +1,80 @@
+package zormpostgres_test
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/zormsql"
+	"github.com/milagre/zote/go/zorm/zormtest"
+	"github.com/milagre/zote/go/zsql"
+	"github.com/milagre/zote/go/zsql/zpostgres"
+)
+
+// dsnEnv names the environment variable holding a connection string for a
+// disposable postgres database. The tests are skipped when it is unset.
+const dsnEnv = "ZOTE_TEST_POSTGRES_DSN"
+
+func setup(t *testing.T, cb func(context.Context, zorm.Repository)) {
+	t.Helper()
+
+	dsn := os.Getenv(dsnEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", dsnEnv)
+	}
+
+	populate, err := os.ReadFile("populate.sql")
+	require.NoError(t, err, "reading populate file")
+
+	ctx := context.Background()
+
+	admin, err := zpostgres.Open(dsn, 1)
+	require.NoError(t, err, "opening admin connection")
+	defer admin.Close()
+
+	// Each test runs in its own schema so tests can't observe each other
+	schema := fmt.Sprintf("zote_test_%d", time.Now().UnixNano())
+	_, _, err = zsql.Exec(ctx, admin, "CREATE SCHEMA "+zpostgres.Driver.EscapeTable(schema), nil)
+	require.NoError(t, err, "creating schema")
+	defer zsql.Exec(ctx, admin, "DROP SCHEMA "+zpostgres.Driver.EscapeTable(schema)+" CASCADE", nil)
+
+	uri, err := url.Parse(dsn)
+	require.NoError(t, err, "parsing dsn")
+	q := uri.Query()
+	q.Set("search_path", schema)
+	uri.RawQuery = q.Encode()
+
+	conn, err := zpostgres.Open(uri.String(), 10)
+	require.NoError(t, err, "opening database")
+	defer conn.Close()
+
+	_, err = conn.Exec(ctx, string(populate))
+	require.NoError(t, err, "populating database")
+
+	repoConn := zsql.LoggingTransactor{Transactor: conn}
+
+	repo := zormsql.NewRepository("postgres", repoConn)
+	repo.AddMapping(AccountMapping)
+	repo.AddMapping(UserMapping)
+	repo.AddMapping(UserAuthMapping)
+	repo.AddMapping(UserAddressMapping)
+	repo.AddMapping(&zormtest.UserGroup{})
+
+	cb(ctx, repo)
+}
+
+func TestORM(t *testing.T) {
+	t.Helper()
+
+	zormtest.RunFindTests(t, setup)
+	zormtest.RunGetTests(t, setup)
+	zormtest.RunPutTests(t, setup)
+	zormtest.RunDeleteTests(t, setup)
+	zormtest.RunAggregateTests(t, setup)
+}
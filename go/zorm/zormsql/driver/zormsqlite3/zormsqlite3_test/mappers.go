@@ -3,6 +3,7 @@ package zormsqlite3_test
 import (
 	"github.com/milagre/zote/go/zorm/zormsql"
 	"github.com/milagre/zote/go/zorm/zormtest"
+	"github.com/milagre/zote/go/zsql"
 )
 
 var AccountMapping = zormsql.Mapping{
@@ -22,6 +23,7 @@ var AccountMapping = zormsql.Mapping{
 			Field:    "ID",
 			NoInsert: true,
 			NoUpdate: true,
+			Type:     zsql.ColumnTypeInteger,
 		},
 		{
 			Name:     "created",
@@ -67,6 +69,7 @@ var UserAddressMapping = zormsql.Mapping{
 			Field:    "ID",
 			NoInsert: true,
 			NoUpdate: true,
+			Type:     zsql.ColumnTypeInteger,
 		},
 		{
 			Name:     "created",
@@ -92,6 +95,11 @@ var UserAddressMapping = zormsql.Mapping{
 			Name:  "state",
 			Field: "State",
 		},
+		{
+			Name:    "version",
+			Field:   "Version",
+			Version: true,
+		},
 	},
 	Relations: []zormsql.Relation{},
 }
@@ -108,6 +116,7 @@ var UserMapping = zormsql.Mapping{
 			Field:    "ID",
 			NoInsert: true,
 			NoUpdate: true,
+			Type:     zsql.ColumnTypeInteger,
 		},
 		{
 			Name:     "created",
@@ -124,10 +133,12 @@ var UserMapping = zormsql.Mapping{
 		{
 			Name:  "account_id",
 			Field: "AccountID",
+			Type:  zsql.ColumnTypeInteger,
 		},
 		{
 			Name:  "user_address_id",
 			Field: "AddressID",
+			Type:  zsql.ColumnTypeInteger,
 		},
 		{
 			Name:  "first_name",
@@ -156,12 +167,26 @@ var UserMapping = zormsql.Mapping{
 			},
 			Field: "Address",
 		},
+		{
+			Table: "user_groups",
+			Columns: map[string]string{
+				"id": "user_id",
+			},
+			Through: &zormsql.Through{
+				Table: "user_group_memberships",
+				Columns: map[string]string{
+					"user_group_id": "id",
+				},
+			},
+			Field: "Groups",
+		},
 	},
 }
 
 var UserAuthMapping = zormsql.Mapping{
-	PtrType: &zormtest.UserAuth{},
-	Table:   "user_auths",
+	PtrType:    &zormtest.UserAuth{},
+	Table:      "user_auths",
+	SoftDelete: "deleted",
 	PrimaryKey: []string{
 		"id",
 	},
@@ -171,6 +196,7 @@ var UserAuthMapping = zormsql.Mapping{
 			Field:    "ID",
 			NoInsert: true,
 			NoUpdate: true,
+			Type:     zsql.ColumnTypeInteger,
 		},
 		{
 			Name:     "created",
@@ -184,9 +210,16 @@ var UserAuthMapping = zormsql.Mapping{
 			NoInsert: true,
 			NoUpdate: true,
 		},
+		{
+			Name:     "deleted",
+			Field:    "Deleted",
+			NoInsert: true,
+			NoUpdate: true,
+		},
 		{
 			Name:  "user_id",
 			Field: "UserID",
+			Type:  zsql.ColumnTypeInteger,
 		},
 		{
 			Name:  "provider",
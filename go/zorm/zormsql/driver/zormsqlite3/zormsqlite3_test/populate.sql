@@ -1,16 +1,10 @@
 --
--- accounts
+-- Fixture triggers and data for the tables created from the mappings in mappers.go
 --
 
-CREATE TABLE accounts (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-	modified DATETIME DEFAULT NULL,
-	company TEXT NOT NULL,
-	contact_email TEXT NOT NULL
-);
-
-CREATE UNIQUE INDEX `unq_accounts_company` ON accounts (company);
+--
+-- accounts
+--
 
 CREATE TRIGGER accounts_modified_timestamp
 AFTER UPDATE ON accounts
@@ -29,15 +23,6 @@ UPDATE accounts SET company="Acme, Inc." where company="Acme";
 -- user addresses
 --
 
-CREATE TABLE user_addresses (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-	modified DATETIME DEFAULT NULL,
-    street TEXT NOT NULL,
-	city TEXT NOT NULL,
-	state TEXT NOT NULL
-);
-
 CREATE TRIGGER user_addresses_modified_timestamp
 AFTER UPDATE ON user_addresses
 BEGIN
@@ -51,18 +36,6 @@ INSERT INTO user_addresses (street, city, state) VALUES ('1725 Slough Avenue', '
 -- users
 --
 
-CREATE TABLE users (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-	modified DATETIME DEFAULT NULL,
-    account_id INTEGER NOT NULL,
-	user_address_id INTEGER NULL,
-    first_name TEXT NOT NULL,
-
-    FOREIGN KEY (account_id) REFERENCES accounts(id),
-	FOREIGN KEY (user_address_id) REFERENCES user_addresses(id)
-);
-
 CREATE TRIGGER users_modified_timestamp
 AFTER UPDATE ON users
 BEGIN
@@ -88,17 +61,6 @@ INSERT INTO users (account_id, first_name) VALUES (
 -- user auths
 --
 
-CREATE TABLE user_auths (
-	id INTEGER PRIMARY KEY AUTOINCREMENT,
-	created DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-	modified DATETIME DEFAULT NULL,
-    user_id INTEGER NOT NULL,
-    provider TEXT NOT NULL,
-	data TEXT NOT NULL,
-
-    FOREIGN KEY (user_id) REFERENCES users(id)
-);
-
 CREATE TRIGGER user_auths_modified_timestamp
 AFTER UPDATE ON user_auths
 BEGIN
@@ -110,3 +72,19 @@ INSERT INTO user_auths (user_id, provider, data) SELECT id, 'oauth2', '{"token":
 
 INSERT INTO user_auths (user_id, provider, data) SELECT id, 'password', 't0tally_S3CURE!' FROM users WHERE first_name='Dwight';
 INSERT INTO user_auths (user_id, provider, data) SELECT id, 'passkey', '{"secret":"5678"}' FROM users WHERE first_name='Dwight';
+
+INSERT INTO user_auths (user_id, provider, data, deleted) SELECT id, 'password', 'r3voked', CURRENT_TIMESTAMP FROM users WHERE first_name='Dora';
+
+--
+-- user_groups
+--
+
+INSERT INTO user_groups (name) VALUES ('Admins');
+INSERT INTO user_groups (name) VALUES ('Staff');
+
+--
+-- user_group_memberships
+--
+
+INSERT INTO user_group_memberships (user_id, user_group_id) SELECT u.id, g.id FROM users u, user_groups g WHERE u.first_name='Daffy';
+INSERT INTO user_group_memberships (user_id, user_group_id) SELECT u.id, g.id FROM users u, user_groups g WHERE u.first_name='Dwight' AND g.name='Staff';
@@ -2,25 +2,102 @@ package zormsqlite3_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zelement/zelem"
+	"github.com/milagre/zote/go/zlog"
 	"github.com/milagre/zote/go/zorm"
 	"github.com/milagre/zote/go/zorm/zormsql"
+	"github.com/milagre/zote/go/zorm/zormsql/zormsqltest"
+	"github.com/milagre/zote/go/zorm/zormstats"
+	"github.com/milagre/zote/go/zorm/zormtenant"
 	"github.com/milagre/zote/go/zorm/zormtest"
 	"github.com/milagre/zote/go/zsql"
 	"github.com/milagre/zote/go/zsql/zsqlite3"
+	"github.com/milagre/zote/go/zstats"
 )
 
+// fixture builds the test database once, creating its tables from the
+// mappings and populating them, and returns its contents for each test to
+// start from.
+var fixture = sync.OnceValues(func() ([]byte, error) {
+	dir, err := os.MkdirTemp("", "zote_sqlite3_test-fixture")
+	if err != nil {
+		return nil, fmt.Errorf("fixture temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "test.db")
+	conn, err := zsqlite3.Open(zsqlite3.FileConnectionString(filename, zsqlite3.DefaultOptions()), 1)
+	if err != nil {
+		return nil, fmt.Errorf("opening fixture database: %w", err)
+	}
+
+	ctx := context.Background()
+	err = newRepository(conn).CreateTables(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	populate, err := os.ReadFile("populate.sql")
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading populate.sql: %w", err)
+	}
+
+	_, _, err = zsql.Exec(ctx, conn, string(populate), nil)
+	conn.Close()
+	if err != nil {
+		return nil, fmt.Errorf("populating fixture database: %w", err)
+	}
+
+	return os.ReadFile(filename)
+})
+
+func newRepository(conn zsql.Transactor) *zormsql.Repository {
+	return newRepositoryWithReplicas(conn)
+}
+
+func newRepositoryWithReplicas(primary zsql.Transactor, replicas ...zsql.QueryExecutor) *zormsql.Repository {
+	repo := zormsql.NewRepositoryWithReplicas("test.db", primary, replicas...)
+	repo.AddMapping(AccountMapping)
+	repo.AddMapping(UserMapping)
+	repo.AddMapping(UserAuthMapping)
+	repo.AddMapping(UserAddressMapping)
+	repo.AddMapping(&zormtest.UserGroup{})
+	return repo
+}
+
 func setup(t *testing.T, cb func(context.Context, zorm.Repository)) {
 	t.Helper()
 
-	sourcedb, err := os.ReadFile("test.db")
-	require.NoError(t, err, "reading test file")
+	conn := openDatabase(t)
+
+	//repoConn := conn
+	repoConn := zsql.LoggingTransactor{Transactor: conn}
+
+	cb(context.Background(), newRepository(repoConn))
+}
+
+// openDatabase copies the fixture database to a temp file and opens it for
+// the duration of the test.
+func openDatabase(t *testing.T) zsql.Connection {
+	t.Helper()
+
+	sourcedb, err := fixture()
+	require.NoError(t, err, "building test database")
 
 	dir := os.TempDir()
 	tempfileNameTemplate := fmt.Sprintf("zote_sqlite3_test-test.%s.*.db", strings.ReplaceAll(t.Name(), string(os.PathSeparator), "-"))
@@ -28,7 +105,7 @@ func setup(t *testing.T, cb func(context.Context, zorm.Repository)) {
 	require.NoError(t, err, "database temp file")
 
 	tempfilename := tempfile.Name()
-	defer os.Remove(tempfilename)
+	t.Cleanup(func() { os.Remove(tempfilename) })
 
 	_, err = tempfile.Write(sourcedb)
 	require.NoError(t, err)
@@ -36,18 +113,9 @@ func setup(t *testing.T, cb func(context.Context, zorm.Repository)) {
 
 	conn, err := zsqlite3.Open(zsqlite3.FileConnectionString(tempfilename, zsqlite3.DefaultOptions()), 10)
 	require.NoError(t, err, "opening database")
-	defer conn.Close()
-
-	//repoConn := conn
-	repoConn := zsql.LoggingTransactor{Transactor: conn}
-
-	repo := zormsql.NewRepository("test.db", repoConn)
-	repo.AddMapping(AccountMapping)
-	repo.AddMapping(UserMapping)
-	repo.AddMapping(UserAuthMapping)
-	repo.AddMapping(UserAddressMapping)
+	t.Cleanup(func() { conn.Close() })
 
-	cb(context.Background(), repo)
+	return conn
 }
 
 func TestORM(t *testing.T) {
@@ -57,8 +125,581 @@ func TestORM(t *testing.T) {
 	zormtest.RunGetTests(t, setup)
 	zormtest.RunPutTests(t, setup)
 	zormtest.RunDeleteTests(t, setup)
+	zormtest.RunAggregateTests(t, setup)
 }
 
 func TestORMNew(t *testing.T) {
 	t.Helper()
 }
+
+// countingGroup counts the accounts named Initech through the queryer its
+// AfterLoad hook is passed.
+type countingGroup struct {
+	zorm.Tracker
+
+	ID   string `zorm:"id,pk,noinsert,noupdate,type=integer"`
+	Name string `zorm:"name,unique=name"`
+
+	initechs int
+}
+
+func (g *countingGroup) TableName() string {
+	return "user_groups"
+}
+
+func (g *countingGroup) AfterLoad(ctx context.Context, q zorm.Queryer) error {
+	var err error
+	g.initechs, err = zorm.Count[zormtest.Account](ctx, q, zelem.Eq(zelem.Field("Company"), zelem.Value("Initech")))
+	return err
+}
+
+func TestReplicas(t *testing.T) {
+	ctx := zlog.Context(context.Background(), zlog.New(zlog.LevelWarn))
+
+	findCompany := func(t *testing.T, ctx context.Context, repo zorm.Queryer, company string) []*zormtest.Account {
+		t.Helper()
+		accounts := make([]*zormtest.Account, 0, 1)
+		err := zorm.Find(ctx, repo, &accounts, zorm.FindOptions{
+			Where: zelem.Eq(zelem.Field("Company"), zelem.Value(company)),
+		})
+		require.NoError(t, err)
+		return accounts
+	}
+
+	primary := openDatabase(t)
+	replica := openDatabase(t)
+	repo := newRepositoryWithReplicas(primary, replica)
+	repo.AddMapping(&countingGroup{})
+
+	initech := &zormtest.Account{Company: "Initech", ContactEmail: "contact@initech.example"}
+	require.NoError(t, zorm.Put(ctx, repo, []*zormtest.Account{initech}, zorm.PutOptions{}))
+
+	t.Run("ReadsGoToReplica", func(t *testing.T) {
+		assert.Empty(t, findCompany(t, ctx, repo, "Initech"), "the write went to the primary only")
+		assert.Len(t, findCompany(t, ctx, repo, "Dunder Mifflin"), 1)
+	})
+
+	t.Run("PrimaryReads", func(t *testing.T) {
+		assert.Len(t, findCompany(t, zormsql.WithPrimaryReads(ctx), repo, "Initech"), 1)
+	})
+
+	t.Run("TransactionsUsePrimary", func(t *testing.T) {
+		tx, err := repo.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		assert.Len(t, findCompany(t, ctx, tx, "Initech"), 1)
+	})
+
+	t.Run("GetFallsBackWhenReplicaLags", func(t *testing.T) {
+		accounts := []*zormtest.Account{{ID: initech.ID}}
+		require.NoError(t, zorm.Get(ctx, repo, accounts, zorm.GetOptions{}))
+		assert.Equal(t, "Initech", accounts[0].Company)
+	})
+
+	t.Run("AfterLoadHooksUsePrimary", func(t *testing.T) {
+		groups := []*countingGroup{{ID: "1"}}
+		require.NoError(t, zorm.Get(ctx, repo, groups, zorm.GetOptions{}))
+		assert.Equal(t, 1, groups[0].initechs)
+	})
+
+	t.Run("DoneContextDoesNotFallBack", func(t *testing.T) {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		canceled, statements := zormsql.RecordStatements(canceled)
+
+		_, err := zorm.Count[zormtest.Account](canceled, repo, nil)
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Len(t, statements(), 1, "not retried on the primary")
+	})
+
+	t.Run("FallsBackWhenReplicaFails", func(t *testing.T) {
+		require.NoError(t, replica.Close())
+
+		count, err := zorm.Count[zormtest.Account](ctx, repo, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 4, count)
+
+		var found []*zormtest.Account
+		for obj, err := range zorm.Iterate[zormtest.Account](ctx, repo, zorm.FindOptions{}) {
+			require.NoError(t, err)
+			found = append(found, obj)
+		}
+		assert.Len(t, found, 4)
+	})
+}
+
+func TestNestedTransactions(t *testing.T) {
+	ctx := context.Background()
+
+	company := func(name string) zclause.Clause {
+		return zelem.Eq(zelem.Field("Company"), zelem.Value(name))
+	}
+
+	t.Run("RollbackUndoesOnlyNestedWrites", func(t *testing.T) {
+		repo := newRepository(openDatabase(t))
+
+		tx, err := repo.Begin(ctx)
+		require.NoError(t, err)
+		require.NoError(t, zorm.Put(ctx, tx, []*zormtest.Account{{Company: "Initech"}}, zorm.PutOptions{}))
+
+		nested, err := tx.(zorm.Beginner).Begin(ctx)
+		require.NoError(t, err)
+		require.NoError(t, zorm.Put(ctx, nested, []*zormtest.Account{{Company: "Globex"}}, zorm.PutOptions{}))
+		require.NoError(t, nested.Rollback())
+		assert.Error(t, nested.Commit(), "a nested transaction ends once")
+
+		require.NoError(t, tx.Commit())
+
+		exists, err := zorm.Exists[zormtest.Account](ctx, repo, company("Initech"))
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		exists, err = zorm.Exists[zormtest.Account](ctx, repo, company("Globex"))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("CommitLeavesWritesToOuterTransaction", func(t *testing.T) {
+		repo := newRepository(openDatabase(t))
+
+		tx, err := repo.Begin(ctx)
+		require.NoError(t, err)
+
+		nested, err := tx.(zorm.Beginner).Begin(ctx)
+		require.NoError(t, err)
+		require.NoError(t, zorm.Put(ctx, nested, []*zormtest.Account{{Company: "Globex"}}, zorm.PutOptions{}))
+
+		deeper, err := nested.(zorm.Beginner).Begin(ctx)
+		require.NoError(t, err)
+		require.NoError(t, zorm.Put(ctx, deeper, []*zormtest.Account{{Company: "Initech"}}, zorm.PutOptions{}))
+		require.NoError(t, deeper.Commit())
+
+		require.NoError(t, nested.Commit())
+
+		exists, err := zorm.Exists[zormtest.Account](ctx, tx, company("Initech"))
+		require.NoError(t, err)
+		assert.True(t, exists)
+
+		require.NoError(t, tx.Rollback())
+
+		count, err := zorm.Count[zormtest.Account](ctx, repo, zelem.Or(company("Globex"), company("Initech")))
+		require.NoError(t, err)
+		assert.Zero(t, count, "released savepoints roll back with the outer transaction")
+	})
+
+	t.Run("EndsAfterContextIsDone", func(t *testing.T) {
+		repo := newRepository(openDatabase(t))
+
+		tx, err := repo.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		nestedCtx, cancel := context.WithCancel(ctx)
+		nested, err := tx.(zorm.Beginner).Begin(nestedCtx)
+		require.NoError(t, err)
+		require.NoError(t, zorm.Put(nestedCtx, nested, []*zormtest.Account{{Company: "Globex"}}, zorm.PutOptions{}))
+
+		cancel()
+		require.NoError(t, nested.Rollback())
+
+		exists, err := zorm.Exists[zormtest.Account](ctx, tx, company("Globex"))
+		require.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("ThroughDecorators", func(t *testing.T) {
+		decorators := map[string]func(zorm.Repository) zorm.Repository{
+			"zormstats": func(r zorm.Repository) zorm.Repository {
+				return zormstats.New("test", r, zormstats.Options{})
+			},
+			"zormtenant": func(r zorm.Repository) zorm.Repository {
+				repo := zormtenant.New(r)
+				repo.Unscoped(&zormtest.Account{})
+				return repo
+			},
+		}
+
+		for name, decorate := range decorators {
+			t.Run(name, func(t *testing.T) {
+				ctx := zormtenant.Context(ctx, "1")
+				repo := decorate(newRepository(openDatabase(t)))
+
+				tx, err := repo.Begin(ctx)
+				require.NoError(t, err)
+				require.NoError(t, zorm.Put(ctx, tx, []*zormtest.Account{{Company: "Initech"}}, zorm.PutOptions{}))
+
+				nested, err := tx.(zorm.Beginner).Begin(ctx)
+				require.NoError(t, err)
+				require.NoError(t, zorm.Put(ctx, nested, []*zormtest.Account{{Company: "Globex"}}, zorm.PutOptions{}))
+				require.NoError(t, nested.Rollback())
+
+				require.NoError(t, tx.Commit())
+
+				exists, err := zorm.Exists[zormtest.Account](ctx, repo, company("Initech"))
+				require.NoError(t, err)
+				assert.True(t, exists)
+
+				exists, err = zorm.Exists[zormtest.Account](ctx, repo, company("Globex"))
+				require.NoError(t, err)
+				assert.False(t, exists, "only the nested transaction was rolled back")
+			})
+		}
+	})
+
+	t.Run("BeginWithTransaction", func(t *testing.T) {
+		conn := openDatabase(t)
+
+		count := func(q zsql.Queryer) int {
+			var n int
+			_, err := zsql.Query(ctx, q, func(scan zsql.ScanFunc) error {
+				return scan(&n)
+			}, `SELECT COUNT(*) FROM "user_groups"`, nil)
+			require.NoError(t, err)
+			return n
+		}
+		before := count(conn)
+
+		err := zsql.Begin(ctx, conn, func(ctx context.Context, tx zsql.Transaction) error {
+			_, _, err := zsql.Exec(ctx, tx, `INSERT INTO "user_groups" ("name") VALUES (?)`, []any{"Outer"})
+			require.NoError(t, err)
+
+			err = zsql.Begin(ctx, tx, func(ctx context.Context, tx zsql.Transaction) error {
+				_, _, err := zsql.Exec(ctx, tx, `INSERT INTO "user_groups" ("name") VALUES (?)`, []any{"Inner"})
+				require.NoError(t, err)
+				return errors.New("inner failure")
+			})
+			assert.ErrorContains(t, err, "inner failure")
+			assert.Equal(t, before+1, count(tx))
+
+			return nil
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, before+1, count(conn))
+	})
+}
+
+// errDeadlock is treated as retryable by retryingConnection
+var errDeadlock = errors.New("deadlock")
+
+type retryingDriver struct {
+	zsql.Driver
+}
+
+func (d retryingDriver) IsRetryableError(err error) bool {
+	return errors.Is(err, errDeadlock)
+}
+
+type retryingConnection struct {
+	zsql.Connection
+}
+
+func (c retryingConnection) Driver() zsql.Driver {
+	return retryingDriver{c.Connection.Driver()}
+}
+
+// countingAdapter counts each stat it's given
+type countingAdapter struct {
+	mu     sync.Mutex
+	counts map[string]float64
+}
+
+func (a *countingAdapter) Count(name string, value float64, tags zstats.Tags) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.counts[name] += value
+}
+
+func (a *countingAdapter) Gauge(name string, value float64, tags zstats.Tags) {}
+
+func (a *countingAdapter) Timer(name string, cb func(), tags zstats.Tags) {
+	cb()
+}
+
+func TestRetry(t *testing.T) {
+	newContext := func() (context.Context, *countingAdapter) {
+		adapter := &countingAdapter{counts: map[string]float64{}}
+		return zstats.Context(context.Background(), zstats.NewStats(adapter)), adapter
+	}
+
+	opts := zsql.RetryOptions{Attempts: 3, Backoff: time.Millisecond}
+
+	t.Run("RetriesRetryableErrors", func(t *testing.T) {
+		ctx, stats := newContext()
+		conn := retryingConnection{openDatabase(t)}
+
+		attempts := 0
+		err := zsql.BeginWithRetry(ctx, conn, opts, func(ctx context.Context, tx zsql.Transaction) error {
+			attempts++
+			_, _, err := zsql.Exec(ctx, tx, `INSERT INTO "user_groups" ("name") VALUES (?)`, []any{"Retried"})
+			require.NoError(t, err)
+			if attempts < 3 {
+				return errDeadlock
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, 2.0, stats.counts["sql.transaction.retry"])
+
+		var count int
+		_, err = zsql.Query(ctx, conn, func(scan zsql.ScanFunc) error {
+			return scan(&count)
+		}, `SELECT COUNT(*) FROM "user_groups" WHERE "name" = ?`, []any{"Retried"})
+		require.NoError(t, err)
+		assert.Equal(t, 1, count, "failed attempts are rolled back")
+	})
+
+	t.Run("GivesUpAfterAttempts", func(t *testing.T) {
+		ctx, stats := newContext()
+		conn := retryingConnection{openDatabase(t)}
+
+		attempts := 0
+		err := zsql.BeginWithRetry(ctx, conn, opts, func(ctx context.Context, tx zsql.Transaction) error {
+			attempts++
+			return errDeadlock
+		})
+		assert.ErrorIs(t, err, errDeadlock)
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, 2.0, stats.counts["sql.transaction.retry"])
+		assert.Equal(t, 1.0, stats.counts["sql.transaction.retries_exhausted"])
+	})
+
+	t.Run("DoesNotRetryOtherErrors", func(t *testing.T) {
+		ctx, _ := newContext()
+		conn := retryingConnection{openDatabase(t)}
+
+		attempts := 0
+		err := zsql.BeginWithRetry(ctx, conn, opts, func(ctx context.Context, tx zsql.Transaction) error {
+			attempts++
+			return errors.New("invalid")
+		})
+		assert.ErrorContains(t, err, "invalid")
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("Repository", func(t *testing.T) {
+		ctx, stats := newContext()
+		repo := newRepository(retryingConnection{openDatabase(t)})
+
+		attempts := 0
+		err := zorm.BeginWithRetry(ctx, repo, zorm.RetryOptions{Attempts: 3, Backoff: time.Millisecond}, func(ctx context.Context, tx zorm.Transaction) error {
+			attempts++
+			err := zorm.Put(ctx, tx, []*zormtest.Account{{Company: "Initech"}}, zorm.PutOptions{})
+			require.NoError(t, err)
+			if attempts < 2 {
+				return errDeadlock
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, attempts)
+		assert.Equal(t, 1.0, stats.counts["orm.transaction.retry"])
+
+		count, err := zorm.Count[zormtest.Account](ctx, repo, zelem.Eq(zelem.Field("Company"), zelem.Value("Initech")))
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+}
+
+func TestBulkClock(t *testing.T) {
+	ctx := zlog.Context(context.Background(), zlog.New(zlog.LevelWarn))
+	repo := newRepository(openDatabase(t))
+
+	now := time.Date(2020, 2, 3, 4, 5, 6, 0, time.UTC)
+	repo.SetClock(func() time.Time { return now })
+
+	_, err := zorm.UpdateWhere[zormtest.UserGroup](ctx, repo, zelem.Eq(zelem.Field("ID"), zelem.Value("1")), map[string]any{
+		"Name": "Owners",
+	})
+	require.NoError(t, err)
+
+	group := &zormtest.UserGroup{ID: "1"}
+	require.NoError(t, zorm.Get(ctx, repo, []*zormtest.UserGroup{group}, zorm.GetOptions{}))
+	require.NotNil(t, group.Modified)
+	assert.True(t, now.Equal(*group.Modified), "update where stamps the repository's time")
+
+	_, err = zorm.DeleteWhere[zormtest.UserAuth](ctx, repo, zelem.Eq(zelem.Field("Provider"), zelem.Value("password")), zorm.DeleteWhereOptions{})
+	require.NoError(t, err)
+
+	auths := make([]*zormtest.UserAuth, 0, 5)
+	require.NoError(t, zorm.Find(ctx, repo, &auths, zorm.FindOptions{
+		Where:          zelem.Eq(zelem.Field("Provider"), zelem.Value("password")),
+		IncludeDeleted: true,
+	}))
+	require.NotEmpty(t, auths)
+	deletedNow := 0
+	for _, auth := range auths {
+		require.NotNil(t, auth.Deleted)
+		if now.Equal(*auth.Deleted) {
+			deletedNow++
+		}
+	}
+	assert.Equal(t, 2, deletedNow, "delete where stamps the repository's time")
+}
+
+func TestRecordStatements(t *testing.T) {
+	ctx := zlog.Context(context.Background(), zlog.New(zlog.LevelWarn))
+	repo := newRepository(openDatabase(t))
+
+	outer, outerStatements := zormsql.RecordStatements(ctx)
+	_, err := zorm.Count[zormtest.UserGroup](outer, repo, nil)
+	require.NoError(t, err)
+
+	inner, innerStatements := zormsql.RecordStatements(outer)
+	require.NoError(t, zorm.Put(inner, repo, []*zormtest.UserGroup{{Name: "Recorded"}}, zorm.PutOptions{}))
+
+	var insert *zormsql.Statement
+	for _, s := range innerStatements() {
+		if strings.Contains(s.Query, "INSERT INTO") {
+			insert = &s
+		}
+	}
+	require.NotNil(t, insert, "insert recorded")
+	assert.Contains(t, insert.Query, `"user_groups"`)
+	assert.Contains(t, insert.Args, "Recorded")
+
+	recorded := len(outerStatements())
+	assert.Equal(t, len(innerStatements())+1, recorded, "outer recorders record nested statements")
+	assert.Contains(t, outerStatements()[0].Query, "COUNT")
+
+	_, err = zorm.Count[zormtest.UserGroup](ctx, repo, nil)
+	require.NoError(t, err)
+	assert.Len(t, outerStatements(), recorded, "statements outside the context aren't recorded")
+}
+
+func TestConstraintErrors(t *testing.T) {
+	ctx := context.Background()
+	conn := openDatabase(t)
+
+	_, _, err := zsql.Exec(ctx, conn, `INSERT INTO accounts (id, company, contact_email) VALUES (1, 'Initech', 'contact@initech.example')`, nil)
+	require.Error(t, err)
+	assert.True(t, conn.Driver().IsConflictError(err), "primary key violations conflict")
+
+	_, _, err = zsql.Exec(ctx, conn, `INSERT INTO accounts (company) VALUES (NULL)`, nil)
+	require.Error(t, err)
+	assert.False(t, conn.Driver().IsConflictError(err), "not null violations don't conflict")
+}
+
+func TestBatchInsert(t *testing.T) {
+	ctx := zlog.Context(context.Background(), zlog.New(zlog.LevelWarn))
+	repo := newRepository(openDatabase(t))
+
+	inserts := func(statements []zormsql.Statement) int {
+		n := 0
+		for _, s := range statements {
+			if strings.Contains(s.Query, "INSERT INTO") {
+				n++
+			}
+		}
+		return n
+	}
+
+	t.Run("MatchesKeysOnUniqueKey", func(t *testing.T) {
+		ctx, statements := zormsql.RecordStatements(ctx)
+
+		accounts := []*zormtest.Account{{Company: "Initech"}, {Company: "Globex"}, {Company: "Hooli"}}
+		require.NoError(t, zorm.Put(ctx, repo, accounts, zorm.PutOptions{}))
+		assert.Equal(t, 1, inserts(statements()), "rows are inserted together")
+
+		for _, account := range accounts {
+			stored := &zormtest.Account{ID: account.ID}
+			require.NoError(t, zorm.Get(ctx, repo, []*zormtest.Account{stored}, zorm.GetOptions{}))
+			assert.Equal(t, account.Company, stored.Company)
+		}
+	})
+
+	t.Run("InsertsRowsWithoutUniqueKeyOneByOne", func(t *testing.T) {
+		ctx, statements := zormsql.RecordStatements(ctx)
+
+		users := []*zormtest.User{{AccountID: "1", FirstName: "Bugs"}, {AccountID: "1", FirstName: "Porky"}}
+		require.NoError(t, zorm.Put(ctx, repo, users, zorm.PutOptions{}))
+		assert.Equal(t, 2, inserts(statements()))
+
+		for _, user := range users {
+			stored := &zormtest.User{ID: user.ID}
+			require.NoError(t, zorm.Get(ctx, repo, []*zormtest.User{stored}, zorm.GetOptions{}))
+			assert.Equal(t, user.FirstName, stored.FirstName)
+		}
+	})
+}
+
+// capturingDestination is a zlog.Destination keeping the fields of the slow
+// operations logged to it
+type capturingDestination struct {
+	mu     sync.Mutex
+	fields []zlog.Fields
+}
+
+func (d *capturingDestination) Send(level zlog.Level, fields zlog.Fields, message string) {
+	if !strings.HasPrefix(message, "Slow ") {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.fields = append(d.fields, fields)
+}
+
+func (d *capturingDestination) Level() zlog.Level     { return zlog.LevelWarn }
+func (d *capturingDestination) SetLevel(l zlog.Level) {}
+
+func TestSlowOperationLogging(t *testing.T) {
+	for name, tc := range map[string]struct {
+		logArgs bool
+	}{
+		"WithoutArgs": {logArgs: false},
+		"WithArgs":    {logArgs: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			logs := &capturingDestination{}
+			ctx := zlog.Context(context.Background(), zlog.New(zlog.LevelWarn, logs))
+			repo := zormstats.New("test", newRepository(openDatabase(t)), zormstats.Options{
+				SlowThreshold: time.Nanosecond,
+				LogArgs:       tc.logArgs,
+			})
+
+			_, err := zorm.Count[zormtest.UserGroup](ctx, repo, zelem.Eq(zelem.Field("Name"), zelem.Value("Secret")))
+			require.NoError(t, err)
+
+			require.Len(t, logs.fields, 1)
+			sql, ok := logs.fields[0]["sql"].([]string)
+			require.True(t, ok)
+			require.Len(t, sql, 1)
+			assert.Contains(t, sql[0], "COUNT")
+			if tc.logArgs {
+				assert.Contains(t, sql[0], "Secret")
+			} else {
+				assert.NotContains(t, sql[0], "Secret", "bound values aren't logged")
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Matches", func(t *testing.T) {
+		zormsqltest.VerifySchema(t, ctx, newRepository(openDatabase(t)))
+	})
+
+	t.Run("Drift", func(t *testing.T) {
+		conn := openDatabase(t)
+		for _, s := range []string{
+			`DROP INDEX "unq_accounts_company"`,
+			`ALTER TABLE "user_auths" DROP COLUMN "provider"`,
+			`ALTER TABLE "user_addresses" RENAME TO "addresses"`,
+			`DROP TABLE "user_group_memberships"`,
+		} {
+			_, _, err := zsql.Exec(ctx, conn, s, nil)
+			require.NoError(t, err, s)
+		}
+
+		err := newRepository(conn).Verify(ctx)
+		require.Error(t, err)
+		assert.ErrorContains(t, err, "unique key accounts(company) has no unique index")
+		assert.ErrorContains(t, err, "column user_auths.provider does not exist")
+		assert.ErrorContains(t, err, "table user_addresses does not exist")
+		assert.ErrorContains(t, err, "join table user_group_memberships of relation users.Groups does not exist")
+	})
+}
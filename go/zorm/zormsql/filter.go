@@ -0,0 +1,103 @@
+package zormsql
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zfunc"
+	"github.com/milagre/zote/go/zreflect"
+	"github.com/milagre/zote/go/zsql"
+)
+
+// filter is the source of a query over the rows of a mapping's table that
+// match a where clause, including any joins needed by relation field paths.
+type filter struct {
+	table  table
+	joins  []join
+	where  string
+	values []interface{}
+}
+
+// buildFilter builds the filter for rows matching clause, which may be nil.
+// Soft deleted rows never match.
+func buildFilter(r *queryer, mapping Mapping, tbl table, clause zclause.Clause) (filter, error) {
+	return buildFilterDeleted(r, mapping, tbl, clause, false)
+}
+
+// buildFilterDeleted builds a filter like buildFilter, also matching soft
+// deleted rows when includeDeleted is set.
+func buildFilterDeleted(r *queryer, mapping Mapping, tbl table, clause zclause.Clause, includeDeleted bool) (filter, error) {
+	f := filter{table: tbl}
+	notDeleted := ""
+	if !includeDeleted {
+		notDeleted = mapping.notDeletedSQL(r.conn.Driver(), tbl)
+	}
+	if clause == nil {
+		f.where = notDeleted
+		return f, nil
+	}
+
+	joins, err := buildInnerJoinsForFieldPaths(r, mapping, tbl, extractFieldPaths(clause), false)
+	if err != nil {
+		return filter{}, fmt.Errorf("building joins for where clause: %w", err)
+	}
+	f.joins = joins
+
+	visitor := &whereVisitor{
+		driver:  r.conn.Driver(),
+		table:   tbl,
+		mapping: mapping,
+		cfg:     r.cfg,
+	}
+	f.where, f.values, err = visitor.Visit(clause)
+	if err != nil {
+		return filter{}, fmt.Errorf("visiting where: %w", err)
+	}
+
+	if notDeleted != "" {
+		if f.where != "" {
+			f.where += " AND " + notDeleted
+		} else {
+			f.where = notDeleted
+		}
+	}
+
+	return f, nil
+}
+
+// from renders the FROM, JOIN and WHERE portions of the filter.
+func (f filter) from(driver zsql.Driver) string {
+	result := fmt.Sprintf(
+		"FROM %s AS %s %s",
+		driver.EscapeTable(f.table.name),
+		driver.EscapeTable(f.table.alias),
+		innerJoinsSQL(driver, f.joins),
+	)
+	if f.where != "" {
+		result += " WHERE " + f.where
+	}
+	return result
+}
+
+func primaryKeySQL(driver zsql.Driver, mapping Mapping, tbl table) string {
+	return strings.Join(zfunc.Map(mapping.PrimaryKey, func(c string) string {
+		return driver.EscapeTableColumn(tbl.alias, c)
+	}), ", ")
+}
+
+func (r *queryer) mappingForModel(model any) (Mapping, error) {
+	modelPtrType := reflect.TypeOf(model)
+	if modelPtrType == nil || modelPtrType.Kind() != reflect.Ptr || modelPtrType.Elem().Kind() != reflect.Struct {
+		return Mapping{}, fmt.Errorf("model must be a pointer to a struct, got %T", model)
+	}
+
+	typeID := zreflect.TypeID(modelPtrType)
+	mapping, ok := r.cfg.mappings[typeID]
+	if !ok {
+		return Mapping{}, fmt.Errorf("mapping unavailable for type %s", typeID)
+	}
+
+	return mapping, nil
+}
@@ -0,0 +1,84 @@
+package zormsql
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/internal/zmodel"
+)
+
+func (r *queryer) beforePut(ctx context.Context, models []reflect.Value) error {
+	err := zmodel.RunHooks(models, func(h zorm.BeforePutHook) error { return h.BeforePut(ctx, r) })
+	if err != nil {
+		return fmt.Errorf("before put hook: %w", err)
+	}
+	return nil
+}
+
+func (r *queryer) afterPut(ctx context.Context, models []reflect.Value) error {
+	err := zmodel.RunHooks(models, func(h zorm.AfterPutHook) error { return h.AfterPut(ctx, r) })
+	if err != nil {
+		return fmt.Errorf("after put hook: %w", err)
+	}
+	return nil
+}
+
+func (r *queryer) beforeDelete(ctx context.Context, models []reflect.Value) error {
+	err := zmodel.RunHooks(models, func(h zorm.BeforeDeleteHook) error { return h.BeforeDelete(ctx, r) })
+	if err != nil {
+		return fmt.Errorf("before delete hook: %w", err)
+	}
+	return nil
+}
+
+func (r *queryer) afterDelete(ctx context.Context, models []reflect.Value) error {
+	err := zmodel.RunHooks(models, func(h zorm.AfterDeleteHook) error { return h.AfterDelete(ctx, r) })
+	if err != nil {
+		return fmt.Errorf("after delete hook: %w", err)
+	}
+	return nil
+}
+
+// loaded calls AfterLoad on a loaded model and the related models loaded
+// into it, as described by its structure, then tracks the fields each was
+// loaded with so that later puts only write what changed.
+func (r *queryer) loaded(ctx context.Context, model reflect.Value, s structure) error {
+	if model.IsNil() {
+		return nil
+	}
+
+	for _, f := range s.relations {
+		rel, ok := s.getRelation(f)
+		if !ok {
+			continue
+		}
+
+		fieldVal := model.Elem().FieldByName(f)
+		if fieldVal.Kind() == reflect.Slice {
+			for i := 0; i < fieldVal.Len(); i++ {
+				if err := r.loaded(ctx, fieldVal.Index(i), rel.structure); err != nil {
+					return err
+				}
+			}
+		} else if err := r.loaded(ctx, fieldVal, rel.structure); err != nil {
+			return err
+		}
+	}
+
+	q := r
+	if r.primary != nil {
+		q = r.primary
+	}
+
+	err := zmodel.RunHooks([]reflect.Value{model}, func(h zorm.AfterLoadHook) error { return h.AfterLoad(ctx, q) })
+	if err != nil {
+		return fmt.Errorf("after load hook: %w", err)
+	}
+
+	zorm.Track(model.Interface(), append(slices.Clone(s.primaryKeyFields), s.fields...))
+
+	return nil
+}
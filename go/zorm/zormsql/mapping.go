@@ -4,10 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"slices"
+	"time"
 
 	"github.com/milagre/zote/go/zfunc"
 	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/internal/zmodel"
 	"github.com/milagre/zote/go/zreflect"
+	"github.com/milagre/zote/go/zsql"
 )
 
 // Mapping defines how a Go struct maps to a database table.
@@ -48,6 +52,12 @@ type Mapping struct {
 	// Relations defines navigational relationships to other mapped models.
 	Relations []Relation
 
+	// SoftDelete names a nullable timestamp column that marks deleted rows.
+	// When set, Delete stamps the column instead of removing rows, and finds,
+	// counts and relation joins skip rows where it is not NULL unless asked
+	// to include them.
+	SoftDelete string
+
 	repo *Repository
 }
 
@@ -66,6 +76,27 @@ type Column struct {
 	// NoUpdate indicates this column should be excluded from UPDATE statements.
 	// Use for immutable columns like primary keys or creation timestamps.
 	NoUpdate bool
+
+	// Version marks an integer column used for optimistic locking. Updates only
+	// match rows still holding the model's version and increment it, failing
+	// with zorm.ErrConflict when another writer got there first. Inserts start
+	// unset versions at 1.
+	Version bool
+
+	// AutoCreateTime marks a column stamped with the repository's clock when
+	// a model is inserted without a value for it. It is never updated. The
+	// field may be a time.Time, ztime.Date, or a pointer to either.
+	AutoCreateTime bool
+
+	// AutoUpdateTime marks a column stamped with the repository's clock
+	// whenever a model is updated, whether or not it was among the fields
+	// requested. Upserts can't tell updates from inserts, so they stamp it on
+	// inserted rows as well.
+	AutoUpdateTime bool
+
+	// Type optionally overrides the column type DDL infers from the field,
+	// such as an integer column read into a string field.
+	Type zsql.ColumnType
 }
 
 // Relation defines a navigational relationship from this model to another.
@@ -89,18 +120,81 @@ type Column struct {
 //	    Columns: map[string]string{"id": "account_id"},  // accounts.id = users.account_id
 //	    Field:   "Users",
 //	}
+//
+// Example (many-to-many, through a join table):
+//
+//	Relation{
+//	    Table:   "groups",
+//	    Columns: map[string]string{"id": "user_id"},  // users.id = user_groups.user_id
+//	    Through: &zormsql.Through{
+//	        Table:   "user_groups",
+//	        Columns: map[string]string{"group_id": "id"},  // user_groups.group_id = groups.id
+//	    },
+//	    Field: "Groups",
+//	}
 type Relation struct {
 	// Table is the related table name.
 	Table string
 
 	// Columns maps this model's column names to the related model's column names.
-	// The map key is a column on this model's table; the value is a column on the related table.
+	// The map key is a column on this model's table; the value is a column on the related table,
+	// or on the join table when Through is set.
 	Columns map[string]string
 
+	// Through, when set, relates the models through rows of a join table.
+	Through *Through
+
 	// Field is the Go struct field name for the relation (pointer for to-one, slice for to-many).
 	Field string
 }
 
+// Through defines the join table of a many-to-many relation. Put inserts and
+// deletes join table rows so they match the related models provided, and
+// Delete removes the join table rows of deleted models, leaving the related
+// models in place.
+type Through struct {
+	// Table is the join table name.
+	Table string
+
+	// Columns maps join table column names to the related model's column names.
+	Columns map[string]string
+}
+
+// relationJoin returns the join conditions from the left table to the right
+// table of rel. When rel goes through a join table, through joins left to the
+// join table, and pairs join the join table to right.
+func relationJoin(rel Relation, left, right table) (through *join, pairs [][2]column) {
+	pairsOf := func(columns map[string]string, l, r table) [][2]column {
+		return zfunc.Map(zfunc.Pairs(columns), func(p zfunc.Pair[string, string]) [2]column {
+			return [2]column{
+				{
+					table: l,
+					name:  p.Key,
+				},
+				{
+					table: r,
+					name:  p.Value,
+				},
+			}
+		})
+	}
+
+	if rel.Through == nil {
+		return nil, pairsOf(rel.Columns, left, right)
+	}
+
+	throughTbl := table{
+		name:  rel.Through.Table,
+		alias: right.alias + "__through",
+	}
+	through = &join{
+		leftTable:  left,
+		rightTable: throughTbl,
+		onPairs:    pairsOf(rel.Columns, left, throughTbl),
+	}
+	return through, pairsOf(rel.Through.Columns, throughTbl, right)
+}
+
 func (m Mapping) relationByField(f string) (Relation, bool) {
 	for _, r := range m.Relations {
 		if r.Field == f {
@@ -137,6 +231,11 @@ func (m Mapping) columnsMatchPrimaryKey(columnNames []string) bool {
 //
 //	Account.Users where accounts.id ← users.account_id
 func (m Mapping) foreignKeyIsLocal(rel Relation) bool {
+	// Join table rows reference both models, so they follow this model
+	if rel.Through != nil {
+		return false
+	}
+
 	localCols := make([]string, 0, len(rel.Columns))
 	for localCol := range rel.Columns {
 		localCols = append(localCols, localCol)
@@ -208,6 +307,91 @@ func (m Mapping) hasValues(objPtr reflect.Value, fields []string) bool {
 	return true
 }
 
+// notDeletedSQL renders the condition excluding soft deleted rows of tbl, or
+// nothing when the mapping doesn't soft delete.
+func (m Mapping) notDeletedSQL(driver zsql.Driver, tbl table) string {
+	if m.SoftDelete == "" {
+		return ""
+	}
+	return column{table: tbl, name: m.SoftDelete}.escaped(driver) + " IS NULL"
+}
+
+// versionColumn returns the mapping's optimistic locking column, if any.
+func (m Mapping) versionColumn() (Column, bool) {
+	for _, c := range m.Columns {
+		if c.Version {
+			return c, true
+		}
+	}
+	return Column{}, false
+}
+
+// initVersion starts the version of a model about to be inserted at 1 when
+// it is unset.
+func (m Mapping) initVersion(objPtr reflect.Value) {
+	if vc, ok := m.versionColumn(); ok {
+		zmodel.InitVersion(objPtr.Elem().FieldByName(vc.Field))
+	}
+}
+
+// bumpVersion increments the version of a model after a successful update.
+func (m Mapping) bumpVersion(objPtr reflect.Value) {
+	if vc, ok := m.versionColumn(); ok {
+		zmodel.BumpVersion(objPtr.Elem().FieldByName(vc.Field))
+	}
+}
+
+// changedFields returns the requested updatable fields of a model that may
+// have changed since it was loaded, leaving out the columns the repository
+// maintains itself. It is empty when the model is clean.
+func (m Mapping) changedFields(objPtr reflect.Value, requestedFields zorm.Fields) zorm.Fields {
+	fields := slices.DeleteFunc(m.updateFields(requestedFields), func(f string) bool {
+		idx := slices.IndexFunc(m.Columns, func(c Column) bool { return c.Field == f })
+		return m.Columns[idx].AutoUpdateTime || m.Columns[idx].Version
+	})
+	return zmodel.ChangedFields(objPtr, fields)
+}
+
+// stampTimes sets the model's AutoCreateTime columns that are unset when
+// created, and its AutoUpdateTime columns when updated, to now.
+func (m Mapping) stampTimes(objPtr reflect.Value, now time.Time, created, updated bool) error {
+	var createdFields, updatedFields []string
+	for _, c := range m.Columns {
+		if created && c.AutoCreateTime {
+			createdFields = append(createdFields, c.Field)
+		}
+		if updated && c.AutoUpdateTime {
+			updatedFields = append(updatedFields, c.Field)
+		}
+	}
+	return zmodel.StampTimes(objPtr, now, createdFields, updatedFields)
+}
+
+// timeValue converts t to the type of the time.Time or ztime.Date field, as
+// stampTimes sets it on models.
+func (m Mapping) timeValue(field string, t time.Time) (any, error) {
+	structField, ok := reflect.TypeOf(m.PtrType).Elem().FieldByName(field)
+	if !ok {
+		return nil, fmt.Errorf("field %s not found on %T", field, m.PtrType)
+	}
+
+	v := reflect.New(structField.Type).Elem()
+	if err := zmodel.SetTime(v, t); err != nil {
+		return nil, fmt.Errorf("stamping %s: %w", field, err)
+	}
+	return v.Interface(), nil
+}
+
+// softDeleteValue is the value stamped into the soft delete column of rows
+// deleted at t.
+func (m Mapping) softDeleteValue(t time.Time) (any, error) {
+	idx := slices.IndexFunc(m.Columns, func(c Column) bool { return c.Name == m.SoftDelete })
+	if idx < 0 {
+		return nil, fmt.Errorf("soft delete column %s is not mapped", m.SoftDelete)
+	}
+	return m.timeValue(m.Columns[idx].Field, t)
+}
+
 func (m Mapping) allFields() []string {
 	result := make([]string, 0, len(m.Columns))
 	for _, c := range m.Columns {
@@ -220,20 +404,29 @@ func (m Mapping) insertFields(requestedFields zorm.Fields) ([]string, []column)
 	fields := make([]string, 0, len(m.Columns))
 	columns := make([]column, 0, len(m.Columns))
 
+	insertable := func(c Column) bool {
+		return !c.NoInsert || c.AutoCreateTime
+	}
+
 	// Get all insertable fields
 	allInsertableFields := make([]string, 0, len(m.Columns))
 	for _, c := range m.Columns {
-		if !c.NoInsert {
+		if insertable(c) {
 			allInsertableFields = append(allInsertableFields, c.Field)
 		}
 	}
 
-	// Resolve requested fields (handles negation)
+	// Resolve requested fields (handles negation), always stamping creation
 	resolvedFields := requestedFields.Resolve(allInsertableFields)
+	for _, c := range m.Columns {
+		if c.AutoCreateTime && !slices.Contains(resolvedFields, c.Field) {
+			resolvedFields = append(resolvedFields, c.Field)
+		}
+	}
 
 	for _, f := range resolvedFields {
 		for _, c := range m.Columns {
-			if f == c.Field && !c.NoInsert {
+			if f == c.Field && insertable(c) {
 				fields = append(fields, c.Field)
 				columns = append(columns, column{
 					table: table{
@@ -251,20 +444,29 @@ func (m Mapping) insertFields(requestedFields zorm.Fields) ([]string, []column)
 func (m Mapping) updateFields(requestedFields zorm.Fields) []string {
 	result := make([]string, 0, len(m.Columns))
 
+	updatable := func(c Column) bool {
+		return (!c.NoUpdate || c.AutoUpdateTime) && !c.AutoCreateTime
+	}
+
 	// Get all updatable fields
 	allUpdatableFields := make([]string, 0, len(m.Columns))
 	for _, c := range m.Columns {
-		if !c.NoUpdate {
+		if updatable(c) {
 			allUpdatableFields = append(allUpdatableFields, c.Field)
 		}
 	}
 
-	// Resolve requested fields (handles negation)
+	// Resolve requested fields (handles negation), always stamping updates
 	resolvedFields := requestedFields.Resolve(allUpdatableFields)
+	for _, c := range m.Columns {
+		if c.AutoUpdateTime && !slices.Contains(resolvedFields, c.Field) {
+			resolvedFields = append(resolvedFields, c.Field)
+		}
+	}
 
 	for _, f := range resolvedFields {
 		for _, c := range m.Columns {
-			if f == c.Field && !c.NoUpdate {
+			if f == c.Field && updatable(c) {
 				result = append(result, c.Field)
 			}
 		}
@@ -311,6 +513,25 @@ func (m Mapping) keyColumnsCanInsert(columnNames []string) bool {
 	return true
 }
 
+// insertedUniqueKey returns the columns and fields of the first unique key
+// that every model is inserted with a value of, by which the rows returned
+// from inserting them tell which model they belong to.
+func (m Mapping) insertedUniqueKey(insertFields []string, models []reflect.Value) ([]string, []string, bool) {
+	for _, ukCols := range m.UniqueKeys {
+		ukFields, err := m.columnNamesToFields(ukCols)
+		if err != nil {
+			continue
+		}
+
+		inserted := !slices.ContainsFunc(ukFields, func(f string) bool { return !slices.Contains(insertFields, f) })
+		if inserted && !slices.ContainsFunc(models, func(v reflect.Value) bool { return !m.hasValues(v, ukFields) }) {
+			return ukCols, ukFields, true
+		}
+	}
+
+	return nil, nil, false
+}
+
 // findPopulatedLookupKey finds the first populated key for a given object.
 // It first checks the primary key, then each unique key in order.
 // Returns the key info and whether a key was found.
@@ -481,20 +702,11 @@ func (m Mapping) mapStructure(tbl table, columnAliasPrefix string, requestedFiel
 			return structure{}, fmt.Errorf("mapping structure failed for field %s on %T: %w", f, m.PtrType, err)
 		}
 
+		through, onPairs := relationJoin(relMapping, tbl, rightTbl)
 		js := joinStructure{
-			structure: relStructure,
-			onPairs: zfunc.Map(zfunc.Pairs(relMapping.Columns), func(p zfunc.Pair[string, string]) [2]column {
-				return [2]column{
-					{
-						table: tbl,
-						name:  p.Key,
-					},
-					{
-						table: rightTbl,
-						name:  p.Value,
-					},
-				}
-			}),
+			structure:      relStructure,
+			through:        through,
+			onPairs:        onPairs,
 			onWhere:        rel.Where,
 			sort:           rel.Sort,
 			relatedMapping: &otherMapping,
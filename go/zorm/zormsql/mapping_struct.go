@@ -0,0 +1,294 @@
+package zormsql
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/milagre/zote/go/zorm/internal/zmodel"
+	"github.com/milagre/zote/go/zsql"
+)
+
+// TableNamer is implemented by models mapped with MappingFromStruct to name
+// their table.
+type TableNamer interface {
+	TableName() string
+}
+
+// MappingFromStruct builds the Mapping of a model, a pointer to a struct
+// implementing TableNamer, from the zorm tags of its fields. Fields without a
+// zorm tag, or tagged "-", are not mapped. The returned mapping has been
+// validated; see Mapping.Validate.
+//
+// Column tags start with the column name, followed by options:
+//
+//	ID      string     `zorm:"id,pk,noinsert,noupdate"`
+//	Email   string     `zorm:"email,unique=email"`
+//	Created time.Time  `zorm:"created,autocreatetime"`
+//	Deleted *time.Time `zorm:"deleted,noinsert,noupdate,softdelete"`
+//
+// Column options are pk, noinsert, noupdate, version, autocreatetime,
+// autoupdatetime, softdelete, type=columntype, and unique=group, where columns
+// sharing a group form one unique key. A column may belong to several groups.
+//
+// Relation tags name the related table with rel, and the column pairs joining
+// it with on, as local:remote pairs separated by semicolons. Many-to-many
+// relations name their join table with through, with on joining the join
+// table and via joining it to the related table:
+//
+//	Account *Account     `zorm:"rel=accounts,on=account_id:id"`
+//	Auths   []*UserAuth  `zorm:"rel=user_auths,on=id:user_id"`
+//	Groups  []*UserGroup `zorm:"rel=user_groups,on=id:user_id,through=user_group_memberships,via=user_group_id:id"`
+func MappingFromStruct(ptr any) (Mapping, error) {
+	t := reflect.TypeOf(ptr)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return Mapping{}, fmt.Errorf("mapping from struct requires a pointer to a struct, got %T", ptr)
+	}
+
+	m := Mapping{PtrType: ptr}
+	if namer, ok := ptr.(TableNamer); ok {
+		m.Table = namer.TableName()
+	}
+
+	var errs []error
+	uniqueGroups := map[string]int{}
+
+	for i := 0; i < t.Elem().NumField(); i++ {
+		f := t.Elem().Field(i)
+
+		tag, ok := f.Tag.Lookup("zorm")
+		if !ok || tag == "-" {
+			continue
+		}
+
+		opts := strings.Split(tag, ",")
+		if strings.Contains(opts[0], "=") {
+			rel, err := parseRelationTag(f.Name, opts)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("field %s: %w", f.Name, err))
+				continue
+			}
+			m.Relations = append(m.Relations, rel)
+			continue
+		}
+
+		col := Column{Name: opts[0], Field: f.Name}
+		if col.Name == "" {
+			errs = append(errs, fmt.Errorf("field %s: column name required", f.Name))
+			continue
+		}
+
+		for _, opt := range opts[1:] {
+			key, value, _ := strings.Cut(opt, "=")
+			switch key {
+			case "pk":
+				m.PrimaryKey = append(m.PrimaryKey, col.Name)
+			case "noinsert":
+				col.NoInsert = true
+			case "noupdate":
+				col.NoUpdate = true
+			case "version":
+				col.Version = true
+			case "autocreatetime":
+				col.AutoCreateTime = true
+			case "autoupdatetime":
+				col.AutoUpdateTime = true
+			case "softdelete":
+				if m.SoftDelete != "" {
+					errs = append(errs, fmt.Errorf("field %s: soft delete column already set to %s", f.Name, m.SoftDelete))
+				}
+				m.SoftDelete = col.Name
+			case "type":
+				col.Type = zsql.ColumnType(value)
+			case "unique":
+				if value == "" {
+					errs = append(errs, fmt.Errorf("field %s: unique requires a group name", f.Name))
+					continue
+				}
+				idx, ok := uniqueGroups[value]
+				if !ok {
+					idx = len(m.UniqueKeys)
+					uniqueGroups[value] = idx
+					m.UniqueKeys = append(m.UniqueKeys, nil)
+				}
+				m.UniqueKeys[idx] = append(m.UniqueKeys[idx], col.Name)
+			default:
+				errs = append(errs, fmt.Errorf("field %s: unknown column option %q", f.Name, opt))
+			}
+		}
+
+		m.Columns = append(m.Columns, col)
+	}
+
+	if err := m.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return Mapping{}, fmt.Errorf("mapping %T from struct: %w", ptr, errors.Join(errs...))
+	}
+
+	return m, nil
+}
+
+func parseRelationTag(field string, opts []string) (Relation, error) {
+	rel := Relation{Field: field}
+
+	var via map[string]string
+	for _, opt := range opts {
+		key, value, _ := strings.Cut(opt, "=")
+
+		var err error
+		switch key {
+		case "rel":
+			rel.Table = value
+		case "on":
+			rel.Columns, err = parseColumnPairs(value)
+		case "through":
+			if rel.Through == nil {
+				rel.Through = &Through{}
+			}
+			rel.Through.Table = value
+		case "via":
+			via, err = parseColumnPairs(value)
+		default:
+			return Relation{}, fmt.Errorf("unknown relation option %q", opt)
+		}
+		if err != nil {
+			return Relation{}, fmt.Errorf("relation option %s: %w", key, err)
+		}
+	}
+
+	if (rel.Through == nil) != (via == nil) {
+		return Relation{}, fmt.Errorf("relation options through and via must be used together")
+	}
+	if rel.Through != nil {
+		rel.Through.Columns = via
+	}
+
+	return rel, nil
+}
+
+// parseColumnPairs parses "a:b;c:d" into {"a": "b", "c": "d"}.
+func parseColumnPairs(s string) (map[string]string, error) {
+	result := map[string]string{}
+	for _, pair := range strings.Split(s, ";") {
+		local, remote, ok := strings.Cut(pair, ":")
+		if !ok || local == "" || remote == "" {
+			return nil, fmt.Errorf("invalid column pair %q, expected local:remote", pair)
+		}
+		result[local] = remote
+	}
+	return result, nil
+}
+
+// Validate checks that the mapping is consistent with itself and with the
+// struct it maps, reporting every problem found.
+func (m Mapping) Validate() error {
+	t := reflect.TypeOf(m.PtrType)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("model pointer type must be a pointer to a struct, got %T", m.PtrType)
+	}
+	structType := t.Elem()
+
+	var errs []error
+	if m.Table == "" {
+		errs = append(errs, fmt.Errorf("table not defined"))
+	}
+	if len(m.PrimaryKey) == 0 {
+		errs = append(errs, fmt.Errorf("primary key not defined"))
+	}
+	if len(m.Columns) == 0 {
+		errs = append(errs, fmt.Errorf("columns not defined"))
+	}
+
+	columnNames := map[string]bool{}
+	fieldNames := map[string]bool{}
+	versions := 0
+	for _, c := range m.Columns {
+		if columnNames[c.Name] {
+			errs = append(errs, fmt.Errorf("column %s mapped more than once", c.Name))
+		}
+		columnNames[c.Name] = true
+
+		if fieldNames[c.Field] {
+			errs = append(errs, fmt.Errorf("field %s mapped more than once", c.Field))
+		}
+		fieldNames[c.Field] = true
+
+		f, ok := structType.FieldByName(c.Field)
+		if !ok {
+			errs = append(errs, fmt.Errorf("column %s maps to unknown field %s", c.Name, c.Field))
+			continue
+		}
+
+		if c.Version {
+			versions++
+			if !reflect.Zero(f.Type).CanInt() && !reflect.Zero(f.Type).CanUint() {
+				errs = append(errs, fmt.Errorf("version column %s must map to an integer field", c.Name))
+			}
+		}
+
+		if c.Type != "" && !slices.Contains(zsql.ColumnTypes, c.Type) {
+			errs = append(errs, fmt.Errorf("column %s has unknown type %q", c.Name, c.Type))
+		}
+
+		if c.AutoCreateTime || c.AutoUpdateTime {
+			if err := zmodel.SetTime(reflect.New(f.Type).Elem(), time.Time{}); err != nil {
+				errs = append(errs, fmt.Errorf("time column %s: %w", c.Name, err))
+			}
+		}
+	}
+	if versions > 1 {
+		errs = append(errs, fmt.Errorf("only one version column allowed"))
+	}
+
+	checkColumns := func(what string, cols []string) {
+		for _, c := range cols {
+			if !columnNames[c] {
+				errs = append(errs, fmt.Errorf("%s column %s is not mapped", what, c))
+			}
+		}
+	}
+	checkColumns("primary key", m.PrimaryKey)
+	for _, uk := range m.UniqueKeys {
+		checkColumns("unique key", uk)
+	}
+	if m.SoftDelete != "" {
+		checkColumns("soft delete", []string{m.SoftDelete})
+	}
+
+	for _, rel := range m.Relations {
+		f, ok := structType.FieldByName(rel.Field)
+		if !ok {
+			errs = append(errs, fmt.Errorf("relation maps to unknown field %s", rel.Field))
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Slice {
+			ft = ft.Elem()
+		}
+		if ft.Kind() != reflect.Ptr || ft.Elem().Kind() != reflect.Struct {
+			errs = append(errs, fmt.Errorf("relation field %s must be a struct pointer or a slice of them", rel.Field))
+		}
+
+		if rel.Table == "" {
+			errs = append(errs, fmt.Errorf("relation %s table not defined", rel.Field))
+		}
+		if len(rel.Columns) == 0 {
+			errs = append(errs, fmt.Errorf("relation %s columns not defined", rel.Field))
+		}
+		checkColumns("relation "+rel.Field, slices.Sorted(maps.Keys(rel.Columns)))
+
+		if rel.Through != nil && (rel.Through.Table == "" || len(rel.Through.Columns) == 0) {
+			errs = append(errs, fmt.Errorf("relation %s join table not fully defined", rel.Field))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,157 @@
+package zormsql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milagre/zote/go/zorm/internal/zmodel"
+	"github.com/milagre/zote/go/ztime"
+)
+
+type stampedObject struct {
+	ID       string
+	Created  ztime.Date
+	Modified *time.Time
+}
+
+var stampedMapping = Mapping{
+	PtrType:    &stampedObject{},
+	Table:      "stamped",
+	PrimaryKey: []string{"id"},
+	Columns: []Column{
+		{Name: "id", Field: "ID"},
+		{Name: "created", Field: "Created", AutoCreateTime: true},
+		{Name: "modified", Field: "Modified", NoInsert: true, AutoUpdateTime: true},
+	},
+}
+
+func TestMappingStampTimes(t *testing.T) {
+	now := time.Date(2024, 3, 20, 12, 30, 0, 0, time.UTC)
+
+	t.Run("Created", func(t *testing.T) {
+		obj := &stampedObject{}
+		err := stampedMapping.stampTimes(reflect.ValueOf(obj), now, true, false)
+		require.NoError(t, err)
+		assert.Equal(t, ztime.NewDate(now), obj.Created)
+		assert.Nil(t, obj.Modified)
+	})
+
+	t.Run("CreatedKeepsExisting", func(t *testing.T) {
+		existing := ztime.NewDateFromValues(2020, 1, 1)
+		obj := &stampedObject{Created: existing}
+		err := stampedMapping.stampTimes(reflect.ValueOf(obj), now, true, false)
+		require.NoError(t, err)
+		assert.Equal(t, existing, obj.Created)
+	})
+
+	t.Run("Updated", func(t *testing.T) {
+		obj := &stampedObject{}
+		err := stampedMapping.stampTimes(reflect.ValueOf(obj), now, false, true)
+		require.NoError(t, err)
+		assert.True(t, obj.Created.IsZero())
+		require.NotNil(t, obj.Modified)
+		assert.Equal(t, now, *obj.Modified)
+	})
+
+	t.Run("Fields", func(t *testing.T) {
+		fields, _ := stampedMapping.insertFields(nil)
+		assert.Equal(t, []string{"ID", "Created"}, fields)
+		assert.Equal(t, []string{"Modified"}, stampedMapping.updateFields([]string{"Created"}))
+	})
+
+	t.Run("UnsupportedType", func(t *testing.T) {
+		err := zmodel.SetTime(reflect.ValueOf(&struct{ At string }{}).Elem().Field(0), now)
+		require.Error(t, err)
+	})
+}
+
+type taggedAccount struct {
+	ID string `zorm:"id,pk"`
+}
+
+func (a *taggedAccount) TableName() string { return "accounts" }
+
+type taggedGroup struct {
+	ID string `zorm:"id,pk"`
+}
+
+func (g *taggedGroup) TableName() string { return "groups" }
+
+type taggedUser struct {
+	ID        string     `zorm:"id,pk,noinsert,noupdate"`
+	AccountID string     `zorm:"account_id,unique=email"`
+	Email     string     `zorm:"email,unique=email"`
+	Version   int        `zorm:"version,version"`
+	Created   time.Time  `zorm:"created,autocreatetime"`
+	Deleted   *time.Time `zorm:"deleted,noinsert,softdelete"`
+	Ignored   string     `zorm:"-"`
+	Unmapped  string
+
+	Account *taggedAccount `zorm:"rel=accounts,on=account_id:id"`
+	Groups  []*taggedGroup `zorm:"rel=groups,on=id:user_id,through=memberships,via=group_id:id"`
+}
+
+func (u *taggedUser) TableName() string { return "users" }
+
+type untabledModel struct {
+	ID string `zorm:"id,pk"`
+}
+
+type badTagsModel struct {
+	ID      string         `zorm:"id,pk,primary"`
+	Version string         `zorm:"version,version"`
+	Account *taggedAccount `zorm:"rel=accounts,on=account_id:id"`
+}
+
+func (b *badTagsModel) TableName() string { return "bad" }
+
+func TestMappingFromStruct(t *testing.T) {
+	t.Run("Tags", func(t *testing.T) {
+		m, err := MappingFromStruct(&taggedUser{})
+		require.NoError(t, err)
+
+		assert.Equal(t, "users", m.Table)
+		assert.Equal(t, []string{"id"}, m.PrimaryKey)
+		assert.Equal(t, [][]string{{"account_id", "email"}}, m.UniqueKeys)
+		assert.Equal(t, "deleted", m.SoftDelete)
+		assert.Equal(t, []Column{
+			{Name: "id", Field: "ID", NoInsert: true, NoUpdate: true},
+			{Name: "account_id", Field: "AccountID"},
+			{Name: "email", Field: "Email"},
+			{Name: "version", Field: "Version", Version: true},
+			{Name: "created", Field: "Created", AutoCreateTime: true},
+			{Name: "deleted", Field: "Deleted", NoInsert: true},
+		}, m.Columns)
+		assert.Equal(t, []Relation{
+			{Table: "accounts", Field: "Account", Columns: map[string]string{"account_id": "id"}},
+			{
+				Table:   "groups",
+				Field:   "Groups",
+				Columns: map[string]string{"id": "user_id"},
+				Through: &Through{Table: "memberships", Columns: map[string]string{"group_id": "id"}},
+			},
+		}, m.Relations)
+	})
+
+	t.Run("NotAStruct", func(t *testing.T) {
+		_, err := MappingFromStruct(taggedUser{})
+		assert.Error(t, err)
+	})
+
+	t.Run("MissingTable", func(t *testing.T) {
+		_, err := MappingFromStruct(&untabledModel{})
+		assert.ErrorContains(t, err, "table not defined")
+	})
+
+	t.Run("ReportsEveryError", func(t *testing.T) {
+		_, err := MappingFromStruct(&badTagsModel{})
+		require.Error(t, err)
+		assert.ErrorContains(t, err, `unknown column option "primary"`)
+		assert.ErrorContains(t, err, "version column version must map to an integer field")
+		assert.ErrorContains(t, err, "relation Account column account_id is not mapped")
+	})
+}
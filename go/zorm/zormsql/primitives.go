@@ -66,7 +66,6 @@ type structure struct {
 	primaryKey       []column
 	primaryKeyFields []string
 	primaryKeyTarget []interface{}
-	prevPrimaryKey   string // Used during processing
 
 	relations       []string
 	toOneRelations  map[string]joinStructure
@@ -110,6 +109,7 @@ func (s structure) getRelation(name string) (joinStructure, bool) {
 }
 
 type joinStructure struct {
+	through        *join // Join to the join table of a many-to-many relation
 	onPairs        [][2]column
 	onWhere        zclause.Clause
 	sort           []zsort.Sort
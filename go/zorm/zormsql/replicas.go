@@ -0,0 +1,246 @@
+package zormsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"iter"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zlog"
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zsql"
+	"github.com/milagre/zote/go/zwarn"
+)
+
+type contextKeyType string
+
+const primaryReadsContextKey contextKeyType = "primary-reads"
+
+// WithPrimaryReads returns a context whose reads are made against the primary
+// rather than a replica, so that they see the writes made before them.
+func WithPrimaryReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryReadsContextKey, true)
+}
+
+func primaryReads(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryReadsContextKey).(bool)
+	return v
+}
+
+// replica is a read only connection, along with the number of reads in
+// flight on it.
+type replica struct {
+	*queryer
+	index    int
+	inFlight atomic.Int64
+}
+
+// NewRepositoryWithReplicas creates a repository writing to primary and
+// reading from replicas. Find, Iterate, Get, Count, Exists and Aggregate go to
+// the replica with the fewest reads in flight, taking turns between equally
+// loaded replicas. Writes, and everything done in a transaction, go to the
+// primary, as do reads made with a context from WithPrimaryReads.
+//
+// AfterLoad hooks of models read from a replica are passed a queryer for the
+// primary, keeping the replica to the reads themselves.
+//
+// A read that fails on a replica's connection is retried on the primary,
+// logging a warning. So is a Get not finding every model, which a replica
+// lagging behind the primary can cause. Other errors, such as invalid
+// arguments or a done context, are returned without retrying.
+func NewRepositoryWithReplicas(name string, primary zsql.Transactor, replicas ...zsql.QueryExecutor) *Repository {
+	repo := NewRepository(name, primary)
+	for i, conn := range replicas {
+		repo.replicas = append(repo.replicas, &replica{
+			queryer: &queryer{
+				cfg:     repo.cfg,
+				conn:    recordingExecutor{replicaExecutor{conn}},
+				primary: repo.queryer,
+			},
+			index: i,
+		})
+	}
+	return repo
+}
+
+// replica returns the least loaded replica to read from, or nil when reads
+// should go to the primary.
+func (r *Repository) replica(ctx context.Context) *replica {
+	if len(r.replicas) == 0 || primaryReads(ctx) {
+		return nil
+	}
+
+	start := int(r.next.Add(1) % uint64(len(r.replicas)))
+
+	var result *replica
+	for i := range r.replicas {
+		candidate := r.replicas[(start+i)%len(r.replicas)]
+		if result == nil || candidate.inFlight.Load() < result.inFlight.Load() {
+			result = candidate
+		}
+	}
+	return result
+}
+
+// replicaError is an error returned by the connection to a replica.
+type replicaError struct {
+	err error
+}
+
+func (e replicaError) Error() string {
+	return e.err.Error()
+}
+
+func (e replicaError) Unwrap() error {
+	return e.err
+}
+
+// replicaExecutor marks the errors returned by a replica's connection, which
+// reads fall back to the primary on.
+type replicaExecutor struct {
+	zsql.QueryExecutor
+}
+
+func (e replicaExecutor) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	rows, err := e.QueryExecutor.Query(ctx, query, args...)
+	if err != nil {
+		return nil, replicaError{err}
+	}
+	return rows, nil
+}
+
+func (e replicaExecutor) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	result, err := e.QueryExecutor.Exec(ctx, query, args...)
+	if err != nil {
+		return nil, replicaError{err}
+	}
+	return result, nil
+}
+
+// fallsBack reports whether a read that failed on a replica with err should
+// be retried on the primary.
+func fallsBack(ctx context.Context, op string, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.As(err, new(replicaError)) {
+		return true
+	}
+	return op == "get" && errors.Is(err, zorm.ErrNotFound)
+}
+
+// read runs fn against a replica, falling back to the primary when it fails
+// there as fallsBack describes.
+func (r *Repository) read(ctx context.Context, op string, fn func(q *queryer) error) error {
+	rep := r.replica(ctx)
+	if rep == nil {
+		return fn(r.queryer)
+	}
+
+	rep.inFlight.Add(1)
+	err := fn(rep.queryer)
+	rep.inFlight.Add(-1)
+
+	if err == nil || !fallsBack(ctx, op, err) {
+		return err
+	}
+
+	r.warnFallback(ctx, op, rep, err)
+
+	return fn(r.queryer)
+}
+
+func (r *Repository) warnFallback(ctx context.Context, op string, rep *replica, err error) {
+	w := zwarn.Warnf("%s failed on replica %d of %s, falling back to primary: %v", op, rep.index, r.cfg.name, err)
+	zlog.FromContext(ctx).Warn(w.Warning())
+}
+
+func (r *Repository) Find(ctx context.Context, ptrToListOfPtrs any, opts zorm.FindOptions) error {
+	return r.read(ctx, "find", func(q *queryer) error {
+		return q.Find(ctx, ptrToListOfPtrs, opts)
+	})
+}
+
+// Iterate reads from a replica like Find does, but only falls back to the
+// primary when the replica fails before yielding any model.
+func (r *Repository) Iterate(ctx context.Context, model any, opts zorm.FindOptions) iter.Seq2[any, error] {
+	rep := r.replica(ctx)
+	if rep == nil {
+		return r.queryer.Iterate(ctx, model, opts)
+	}
+
+	return func(yield func(any, error) bool) {
+		rep.inFlight.Add(1)
+		released := false
+		release := func() {
+			if !released {
+				released = true
+				rep.inFlight.Add(-1)
+			}
+		}
+		defer release()
+
+		yielded := false
+		for obj, err := range rep.queryer.Iterate(ctx, model, opts) {
+			if err != nil && !yielded && fallsBack(ctx, "iterate", err) {
+				release()
+				r.warnFallback(ctx, "iterate", rep, err)
+				for obj, err := range r.queryer.Iterate(ctx, model, opts) {
+					if !yield(obj, err) {
+						return
+					}
+				}
+				return
+			}
+
+			yielded = true
+			if !yield(obj, err) {
+				return
+			}
+		}
+	}
+}
+
+func (r *Repository) Get(ctx context.Context, listOfPtrs any, opts zorm.GetOptions) error {
+	return r.read(ctx, "get", func(q *queryer) error {
+		return q.Get(ctx, listOfPtrs, opts)
+	})
+}
+
+func (r *Repository) Count(ctx context.Context, model any, where zclause.Clause) (int, error) {
+	var count int
+	err := r.read(ctx, "count", func(q *queryer) error {
+		var err error
+		count, err = q.Count(ctx, model, where)
+		return err
+	})
+	return count, err
+}
+
+func (r *Repository) Exists(ctx context.Context, model any, where zclause.Clause) (bool, error) {
+	var exists bool
+	err := r.read(ctx, "exists", func(q *queryer) error {
+		var err error
+		exists, err = q.Exists(ctx, model, where)
+		return err
+	})
+	return exists, err
+}
+
+func (r *Repository) Aggregate(ctx context.Context, model any, ptrToListOfResults any, opts zorm.AggregateOptions) error {
+	// Results are appended, so a retry on the primary starts over from the
+	// results the list held before
+	reset := func() {}
+	if v := reflect.ValueOf(ptrToListOfResults); v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Slice {
+		n := v.Elem().Len()
+		reset = func() { v.Elem().SetLen(n) }
+	}
+
+	return r.read(ctx, "aggregate", func(q *queryer) error {
+		reset()
+		return q.Aggregate(ctx, model, ptrToListOfResults, opts)
+	})
+}
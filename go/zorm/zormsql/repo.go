@@ -4,15 +4,21 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"iter"
+	"maps"
 	"reflect"
 	"runtime/debug"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/milagre/zote/go/zelement"
 	"github.com/milagre/zote/go/zelement/zclause"
 	"github.com/milagre/zote/go/zelement/zelem"
 	"github.com/milagre/zote/go/zfunc"
 	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/internal/zmodel"
 	"github.com/milagre/zote/go/zreflect"
 	"github.com/milagre/zote/go/zsql"
 )
@@ -20,12 +26,18 @@ import (
 type Config struct {
 	name     string
 	mappings map[string]Mapping
+	clock    func() time.Time
 }
 
 // Repository
 type Repository struct {
 	*queryer
 	ts zsql.Transactor
+
+	// replicas serve reads outside of transactions, see
+	// NewRepositoryWithReplicas
+	replicas []*replica
+	next     atomic.Uint64
 }
 
 type Transaction struct {
@@ -36,6 +48,11 @@ type Transaction struct {
 type queryer struct {
 	cfg  *Config
 	conn zsql.QueryExecutor
+
+	// primary is passed to the hooks of models read from a replica, so that
+	// what they query or write goes to the primary rather than the replica;
+	// nil everywhere else
+	primary *queryer
 }
 
 func NewRepository(name string, conn zsql.Transactor) *Repository {
@@ -46,13 +63,27 @@ func NewRepository(name string, conn zsql.Transactor) *Repository {
 	return &Repository{
 		queryer: &queryer{
 			cfg:  cfg,
-			conn: conn,
+			conn: recordingExecutor{conn},
 		},
 		ts: conn,
 	}
 }
 
-func (r *Repository) AddMapping(m Mapping) {
+// AddMapping registers how a model is stored, given either a Mapping or a
+// pointer to a struct to build one from with MappingFromStruct. It panics if
+// the mapping is invalid or its model is already mapped.
+func (r *Repository) AddMapping(mappingOrModel any) {
+	m, ok := mappingOrModel.(Mapping)
+	if !ok {
+		var err error
+		m, err = MappingFromStruct(mappingOrModel)
+		if err != nil {
+			panic(err.Error())
+		}
+	} else if err := m.Validate(); err != nil {
+		panic(fmt.Sprintf("Invalid sql mapping for type %T: %v", m.PtrType, err))
+	}
+
 	if r.cfg.mappings == nil {
 		r.cfg.mappings = map[string]Mapping{}
 	}
@@ -66,6 +97,19 @@ func (r *Repository) AddMapping(m Mapping) {
 	r.cfg.mappings[key] = m
 }
 
+// SetClock sets the clock used to stamp AutoCreateTime and AutoUpdateTime
+// columns, which defaults to time.Now.
+func (r *Repository) SetClock(now func() time.Time) {
+	r.cfg.clock = now
+}
+
+func (r *queryer) now() time.Time {
+	if r.cfg.clock != nil {
+		return r.cfg.clock().UTC()
+	}
+	return time.Now().UTC()
+}
+
 func (r *Repository) Begin(ctx context.Context) (zorm.Transaction, error) {
 	tx, err := r.ts.Begin(ctx, nil)
 	if err != nil {
@@ -75,7 +119,32 @@ func (r *Repository) Begin(ctx context.Context) (zorm.Transaction, error) {
 	return &Transaction{
 		queryer: &queryer{
 			cfg:  r.cfg,
-			conn: tx,
+			conn: recordingExecutor{tx},
+		},
+		tx: tx,
+	}, nil
+}
+
+// IsRetryableError reports whether the driver considers err to have aborted a
+// transaction that may succeed when run again, see zorm.BeginWithRetry.
+func (r *Repository) IsRetryableError(err error) bool {
+	return r.ts.Driver().IsRetryableError(err)
+}
+
+// Begin begins a transaction nested in this one as a savepoint, so that code
+// running its own unit of work composes with a caller's transaction.
+// Committing it releases the savepoint, leaving its writes to be committed
+// with this transaction, and rolling it back undoes only its own writes.
+func (t *Transaction) Begin(ctx context.Context) (zorm.Transaction, error) {
+	tx, err := t.tx.Begin(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("starting nested transaction: %w", err)
+	}
+
+	return &Transaction{
+		queryer: &queryer{
+			cfg:  t.cfg,
+			conn: recordingExecutor{tx},
 		},
 		tx: tx,
 	}, nil
@@ -113,6 +182,34 @@ func (r *queryer) Find(ctx context.Context, ptrToListOfPtrs any, opts zorm.FindO
 	return r.find(ctx, ptrToListOfPtrs, opts)
 }
 
+func (r *queryer) Iterate(ctx context.Context, model any, opts zorm.FindOptions) iter.Seq2[any, error] {
+	return func(yield func(any, error) bool) {
+		// Panics raised by the loop body are not ours to recover
+		yielding := false
+		defer func() {
+			if e := recover(); e != nil {
+				if yielding {
+					panic(e)
+				}
+				if er, ok := e.(error); ok {
+					yield(nil, fmt.Errorf("panic in iterate: %w - %s", er, string(debug.Stack())))
+				} else {
+					yield(nil, fmt.Errorf("panic in iterate: %v - %s", e, string(debug.Stack())))
+				}
+			}
+		}()
+
+		err := r.iterate(ctx, model, opts, func(obj any) bool {
+			yielding = true
+			defer func() { yielding = false }()
+			return yield(obj, nil)
+		})
+		if err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
 func (r *queryer) Get(ctx context.Context, listOfPtrs any, opts zorm.GetOptions) (err error) {
 	defer func() {
 		if e := recover(); e != nil {
@@ -155,7 +252,90 @@ func (r *queryer) Delete(ctx context.Context, listOfPtrs any, opts zorm.DeleteOp
 	return r.delete(ctx, listOfPtrs, opts)
 }
 
+func (r *queryer) Count(ctx context.Context, model any, where zclause.Clause) (count int, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			if er, ok := e.(error); ok {
+				err = fmt.Errorf("panic in count: %w - %s", er, string(debug.Stack()))
+			} else {
+				err = fmt.Errorf("panic in count: %v - %s", e, string(debug.Stack()))
+			}
+		}
+	}()
+
+	return r.count(ctx, model, where)
+}
+
+func (r *queryer) Exists(ctx context.Context, model any, where zclause.Clause) (exists bool, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			if er, ok := e.(error); ok {
+				err = fmt.Errorf("panic in exists: %w - %s", er, string(debug.Stack()))
+			} else {
+				err = fmt.Errorf("panic in exists: %v - %s", e, string(debug.Stack()))
+			}
+		}
+	}()
+
+	return r.exists(ctx, model, where)
+}
+
+func (r *queryer) Aggregate(ctx context.Context, model any, ptrToListOfResults any, opts zorm.AggregateOptions) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			if er, ok := e.(error); ok {
+				err = fmt.Errorf("panic in aggregate: %w - %s", er, string(debug.Stack()))
+			} else {
+				err = fmt.Errorf("panic in aggregate: %v - %s", e, string(debug.Stack()))
+			}
+		}
+	}()
+
+	return r.aggregate(ctx, model, ptrToListOfResults, opts)
+}
+
+func (r *queryer) DeleteWhere(ctx context.Context, model any, where zclause.Clause, opts zorm.DeleteWhereOptions) (count int, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			if er, ok := e.(error); ok {
+				err = fmt.Errorf("panic in delete where: %w - %s", er, string(debug.Stack()))
+			} else {
+				err = fmt.Errorf("panic in delete where: %v - %s", e, string(debug.Stack()))
+			}
+		}
+	}()
+
+	return r.deleteWhere(ctx, model, where, opts)
+}
+
+func (r *queryer) UpdateWhere(ctx context.Context, model any, where zclause.Clause, set map[string]any) (count int, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			if er, ok := e.(error); ok {
+				err = fmt.Errorf("panic in update where: %w - %s", er, string(debug.Stack()))
+			} else {
+				err = fmt.Errorf("panic in update where: %v - %s", e, string(debug.Stack()))
+			}
+		}
+	}()
+
+	return r.updateWhere(ctx, model, where, set)
+}
+
 func (r *queryer) find(ctx context.Context, ptrToListOfPtrs any, opts zorm.FindOptions) error {
+	return r.findModels(ctx, ptrToListOfPtrs, opts, true)
+}
+
+// probe finds models for the repository's own use, such as looking up the
+// keys of existing rows. Probed models are often partially loaded, so they
+// aren't passed to AfterLoad hooks or tracked.
+func (r *queryer) probe(ctx context.Context, ptrToListOfPtrs any, opts zorm.FindOptions) error {
+	return r.findModels(ctx, ptrToListOfPtrs, opts, false)
+}
+
+// findModels finds models, calling AfterLoad hooks on them and tracking them
+// when load is set.
+func (r *queryer) findModels(ctx context.Context, ptrToListOfPtrs any, opts zorm.FindOptions, load bool) error {
 	targetList, modelPtrType, err := validatePtrToListOfPtr(ptrToListOfPtrs)
 	if err != nil {
 		return fmt.Errorf("invalid argument to find: %w", err)
@@ -167,7 +347,19 @@ func (r *queryer) find(ctx context.Context, ptrToListOfPtrs any, opts zorm.FindO
 		return fmt.Errorf("find mapping unavailable type %s", typeID)
 	}
 
-	plan, err := buildSelectQueryPlan(r, mapping, opts.Include.Fields, opts.Include.Relations, opts.Where, opts.Sort, targetList.Cap(), opts.Offset)
+	var ks *zmodel.Keyset
+	if opts.After != "" || opts.Next != nil {
+		if opts.Offset != 0 {
+			return fmt.Errorf("find cannot combine cursor pagination with an offset")
+		}
+
+		ks, err = newKeyset(mapping, opts.Sort)
+		if err != nil {
+			return fmt.Errorf("preparing cursor pagination for find: %w", err)
+		}
+	}
+
+	plan, err := buildSelectQueryPlan(r, mapping, opts.Include.Fields, opts.Include.Relations, opts.Where, opts.Sort, targetList.Cap(), opts.Offset, ks, opts.After, opts.IncludeDeleted)
 	if err != nil {
 		return fmt.Errorf("building query plan for find: %w", err)
 	}
@@ -189,6 +381,78 @@ func (r *queryer) find(ctx context.Context, ptrToListOfPtrs any, opts zorm.FindO
 		return fmt.Errorf("find rows error: %w", err)
 	}
 
+	// Hooks may query through the same connection, so release it first
+	rows.Close()
+
+	for i := 0; load && i < targetList.Len(); i++ {
+		if err := r.loaded(ctx, targetList.Index(i), plan.structure); err != nil {
+			return err
+		}
+	}
+
+	if opts.Next != nil {
+		*opts.Next, err = plan.nextCursor(targetList)
+		if err != nil {
+			return fmt.Errorf("building next cursor for find: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// iterate streams the models matching opts to yield as their rows are read,
+// stopping early when yield returns false.
+func (r *queryer) iterate(ctx context.Context, model any, opts zorm.FindOptions, yield func(any) bool) error {
+	mapping, err := r.mappingForModel(model)
+	if err != nil {
+		return fmt.Errorf("invalid argument to iterate: %w", err)
+	}
+
+	if opts.Offset != 0 || opts.Next != nil {
+		return fmt.Errorf("iterate does not support offset or next cursor")
+	}
+
+	var ks *zmodel.Keyset
+	if opts.After != "" {
+		ks, err = newKeyset(mapping, opts.Sort)
+		if err != nil {
+			return fmt.Errorf("preparing cursor for iterate: %w", err)
+		}
+	}
+
+	plan, err := buildSelectQueryPlan(r, mapping, opts.Include.Fields, opts.Include.Relations, opts.Where, opts.Sort, noLimit, 0, ks, opts.After, opts.IncludeDeleted)
+	if err != nil {
+		return fmt.Errorf("building query plan for iterate: %w", err)
+	}
+
+	query, values := plan.query(r.conn.Driver())
+
+	rows, err := r.conn.Query(ctx, query, values...)
+	if err != nil {
+		return fmt.Errorf("executing iterate query: %w", err)
+	}
+	defer rows.Close()
+
+	stopped := false
+	err = plan.stream(rows, reflect.TypeOf(mapping.PtrType).Elem(), func(obj reflect.Value) (bool, error) {
+		if err := r.loaded(ctx, obj.Addr(), plan.structure); err != nil {
+			return false, err
+		}
+		stopped = !yield(obj.Addr().Interface())
+		return !stopped, nil
+	})
+	if err != nil {
+		return fmt.Errorf("iterate read error: %w", err)
+	}
+
+	if stopped {
+		return nil
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate rows error: %w", err)
+	}
+
 	return nil
 }
 
@@ -225,7 +489,7 @@ func (r *queryer) get(ctx context.Context, listOfPtrs any, opts zorm.GetOptions)
 		}
 
 		if !hasKey {
-			return fmt.Errorf("no populated key found for object at index %d", i)
+			return fmt.Errorf("object at index %d: %w", i, zorm.ErrNoKey)
 		}
 
 		group, ok := groups[key.GroupKey]
@@ -261,8 +525,9 @@ func (r *queryer) get(ctx context.Context, listOfPtrs any, opts zorm.GetOptions)
 		}
 
 		findOpts := zorm.FindOptions{
-			Include: opts.Include,
-			Where:   where,
+			Include:        opts.Include,
+			Where:          where,
+			IncludeDeleted: opts.IncludeDeleted,
 		}
 		if len(findOpts.Include.Fields) > 0 {
 			findOpts.Include.Fields.Add(keyFields...)
@@ -293,11 +558,13 @@ func (r *queryer) get(ctx context.Context, listOfPtrs any, opts zorm.GetOptions)
 
 			// If specific fields were requested, only copy those fields
 			// Otherwise, replace the entire object
+			loadedFields := findOpts.Include.Fields.Resolve(mapping.allFields())
 			if len(findOpts.Include.Fields) > 0 {
-				copyFields(origObj, findVal, findOpts.Include.Fields)
+				copyFields(origObj, findVal, loadedFields)
 			} else {
 				origObj.Elem().Set(findVal.Elem())
 			}
+			zorm.Track(origObj.Interface(), loadedFields)
 		}
 	}
 
@@ -340,6 +607,17 @@ func (r *queryer) get(ctx context.Context, listOfPtrs any, opts zorm.GetOptions)
 //	Example: Account.Users where accounts.id ← users.account_id
 //	Put Account first, copy Account.ID to each User.AccountID, then Put Users
 //
+// # Batching
+//
+// Models of each mapping are written together: existing rows are found with
+// one query per lookup key type and updated with a single CASE-based UPDATE,
+// and new rows are inserted with multi-row INSERT statements, each chunked to
+// the driver's parameter limit. Rows whose primary key is generated are
+// inserted together only when the driver supports RETURNING and every row is
+// inserted with a unique key, on which the returned keys are matched back to
+// their rows, as RETURNING returns rows in no particular order. Otherwise
+// they're inserted one at a time, to read back each generated key.
+//
 // # Limitations
 //
 // Cascading Put does NOT support scenarios requiring two writes to a single record:
@@ -374,26 +652,36 @@ func (r *queryer) put(ctx context.Context, listOfPtrs any, opts zorm.PutOptions)
 		return fmt.Errorf("categorizing relations: %w", err)
 	}
 
+	models := make([]reflect.Value, targetVal.Len())
 	for i := 0; i < targetVal.Len(); i++ {
-		val := targetVal.Index(i)
+		models[i] = targetVal.Index(i)
+	}
 
-		// Step 1: Put "before" relations (FK on this model - related must exist first)
-		for _, rel := range beforeRelations {
-			if err := r.putRelatedModels(ctx, val, rel, primaryKeyFields); err != nil {
-				return fmt.Errorf("putting before-relation %s: %w", rel.fieldName, err)
-			}
-		}
+	if err := r.beforePut(ctx, models); err != nil {
+		return err
+	}
 
-		// Step 2: Put this model
-		if err := r.putSingleModel(ctx, mapping, primaryKeyFields, val, opts.Include.Fields); err != nil {
-			return err
+	// Step 1: Put "before" relations (FK on this model - related must exist first)
+	for _, rel := range beforeRelations {
+		if err := r.putRelatedModels(ctx, models, rel); err != nil {
+			return fmt.Errorf("putting before-relation %s: %w", rel.fieldName, err)
 		}
+	}
 
-		// Step 3: Put "after" relations (FK on related model - this model must exist first)
-		for _, rel := range afterRelations {
-			if err := r.putRelatedModels(ctx, val, rel, primaryKeyFields); err != nil {
-				return fmt.Errorf("putting after-relation %s: %w", rel.fieldName, err)
-			}
+	// Step 2: Put these models
+	if opts.OnConflict.Action != zorm.ConflictError {
+		err = r.upsertModels(ctx, mapping, primaryKeyFields, models, opts.Include.Fields, opts.OnConflict)
+	} else {
+		err = r.putModels(ctx, mapping, primaryKeyFields, models, opts.Include.Fields)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Step 3: Put "after" relations (FK on related model - these models must exist first)
+	for _, rel := range afterRelations {
+		if err := r.putRelatedModels(ctx, models, rel); err != nil {
+			return fmt.Errorf("putting after-relation %s: %w", rel.fieldName, err)
 		}
 	}
 
@@ -408,101 +696,90 @@ func (r *queryer) put(ctx context.Context, listOfPtrs any, opts zorm.PutOptions)
 		return fmt.Errorf("error in get after put: %w", err)
 	}
 
-	return nil
+	return r.afterPut(ctx, models)
 }
 
-// putSingleModel performs the upsert logic for a single model instance.
-func (r *queryer) putSingleModel(ctx context.Context, mapping Mapping, primaryKeyFields []string, val reflect.Value, fields zorm.Fields) error {
-	// Find the first populated lookup key (PK first, then unique keys)
-	key, hasKey, err := mapping.findPopulatedLookupKey(val)
+// putRelatedModels puts the related models for a given relation field of
+// each parent together.
+func (r *queryer) putRelatedModels(ctx context.Context, parents []reflect.Value, rel relInfo) error {
+	if rel.relation.Through != nil {
+		return r.putThroughRelation(ctx, parents, rel)
+	}
+
+	relatedPKFields, err := rel.relatedMapping.primaryKeyFields()
 	if err != nil {
-		return fmt.Errorf("finding lookup key: %w", err)
+		return fmt.Errorf("getting related PK fields: %w", err)
 	}
 
-	if hasKey {
-		// Try to update using the identified key
-		affected, err := r.update(ctx, mapping, key.FieldNames, val, fields)
-		if err != nil {
-			return fmt.Errorf("performing update: %w", err)
-		}
+	type pair struct {
+		parent  reflect.Value
+		related reflect.Value
+	}
+	var pairs []pair
+	var relatedModels []reflect.Value
+	seen := map[uintptr]bool{}
 
-		if affected == 0 {
-			// Update changed no rows - try insert if key columns allow it
-			if !key.CanInsert {
-				return fmt.Errorf("no rows affected for update and key columns are not insertable: %w", zorm.ErrNotFound)
-			}
+	for _, parentVal := range parents {
+		fieldVal := parentVal.Elem().FieldByName(rel.fieldName)
 
-			err := r.insert(ctx, mapping, primaryKeyFields, val, fields)
-			if err != nil {
-				if r.conn.Driver().IsConflictError(err) {
-					err = zorm.ErrConflict
+		// Handle both to-one (pointer) and to-many (slice) relations
+		var parentRelated []reflect.Value
+		isToMany := false
+		if fieldVal.Kind() == reflect.Ptr {
+			if fieldVal.IsValid() && !fieldVal.IsNil() {
+				parentRelated = []reflect.Value{fieldVal}
+			}
+		} else if fieldVal.Kind() == reflect.Slice {
+			isToMany = true
+			if fieldVal.IsValid() && !fieldVal.IsNil() {
+				for j := 0; j < fieldVal.Len(); j++ {
+					parentRelated = append(parentRelated, fieldVal.Index(j))
 				}
-				return fmt.Errorf("performing insert after zero-row update: %w", err)
 			}
 		}
-	} else {
-		// No key populated - perform insert
-		err := r.insert(ctx, mapping, primaryKeyFields, val, fields)
-		if err != nil {
-			if r.conn.Driver().IsConflictError(err) {
-				err = zorm.ErrConflict
+
+		// For to-many relations, handle orphan deletion
+		if isToMany {
+			if err := r.deleteOrphanedRelatedModels(ctx, parentVal, rel, relatedPKFields, parentRelated); err != nil {
+				return fmt.Errorf("deleting orphaned related models: %w", err)
 			}
-			return fmt.Errorf("performing insert: %w", err)
 		}
-	}
-
-	return nil
-}
 
-// putRelatedModels puts the related models for a given relation field.
-func (r *queryer) putRelatedModels(ctx context.Context, parentVal reflect.Value, rel relInfo, parentPKFields []string) error {
-	fieldVal := parentVal.Elem().FieldByName(rel.fieldName)
+		// Copy FK values between parent and related models based on FK location
+		for _, relatedVal := range parentRelated {
+			if err := rel.copyFKValues(parentVal, relatedVal); err != nil {
+				return fmt.Errorf("copying FK values: %w", err)
+			}
 
-	relatedPKFields, err := rel.relatedMapping.primaryKeyFields()
-	if err != nil {
-		return fmt.Errorf("getting related PK fields: %w", err)
-	}
+			pairs = append(pairs, pair{parent: parentVal, related: relatedVal})
 
-	// Handle both to-one (pointer) and to-many (slice) relations
-	var relatedModels []reflect.Value
-	isToMany := false
-	if fieldVal.Kind() == reflect.Ptr {
-		if fieldVal.IsValid() && !fieldVal.IsNil() {
-			relatedModels = []reflect.Value{fieldVal}
-		}
-	} else if fieldVal.Kind() == reflect.Slice {
-		isToMany = true
-		if fieldVal.IsValid() && !fieldVal.IsNil() {
-			for j := 0; j < fieldVal.Len(); j++ {
-				relatedModels = append(relatedModels, fieldVal.Index(j))
+			// A related model shared between parents is only put once
+			if !seen[relatedVal.Pointer()] {
+				seen[relatedVal.Pointer()] = true
+				relatedModels = append(relatedModels, relatedVal)
 			}
 		}
 	}
 
-	// For to-many relations, handle orphan deletion
-	if isToMany {
-		if err := r.deleteOrphanedRelatedModels(ctx, parentVal, rel, relatedPKFields, relatedModels); err != nil {
-			return fmt.Errorf("deleting orphaned related models: %w", err)
-		}
-	}
-
 	if len(relatedModels) == 0 {
 		return nil
 	}
 
-	// Copy FK values between parent and related models based on FK location
-	for _, relatedVal := range relatedModels {
-		if err := rel.copyFKValues(parentVal, relatedVal); err != nil {
-			return fmt.Errorf("copying FK values: %w", err)
-		}
+	if err := r.beforePut(ctx, relatedModels); err != nil {
+		return err
+	}
 
-		// Put the related model
-		if err := r.putSingleModel(ctx, rel.relatedMapping, relatedPKFields, relatedVal, rel.includeOpts.Include.Fields); err != nil {
-			return fmt.Errorf("putting related model: %w", err)
-		}
+	if err := r.putModels(ctx, rel.relatedMapping, relatedPKFields, relatedModels, rel.includeOpts.Include.Fields); err != nil {
+		return fmt.Errorf("putting related models: %w", err)
+	}
 
-		// After putting, copy back any generated values (e.g., auto-increment PKs)
-		if err := rel.copyFKValues(parentVal, relatedVal); err != nil {
+	if err := r.afterPut(ctx, relatedModels); err != nil {
+		return err
+	}
+
+	// After putting, copy back any generated values (e.g., auto-increment PKs)
+	for _, p := range pairs {
+		if err := rel.copyFKValues(p.parent, p.related); err != nil {
 			return fmt.Errorf("copying FK values after put: %w", err)
 		}
 	}
@@ -568,12 +845,20 @@ func (r *queryer) deleteOrphanedRelatedModels(
 		}
 	}
 
+	if len(orphans) == 0 {
+		return nil
+	}
+
 	// Delete orphans
-	if _, err := r.deleteByPK(ctx, rel.relatedMapping, relatedPKFields, orphans); err != nil {
+	if err := r.beforeDelete(ctx, orphans); err != nil {
+		return err
+	}
+
+	if _, err := r.deleteByPK(ctx, rel.relatedMapping, relatedPKFields, orphans, false); err != nil {
 		return fmt.Errorf("deleting orphaned models: %w", err)
 	}
 
-	return nil
+	return r.afterDelete(ctx, orphans)
 }
 
 // buildFKWhereClause builds a WHERE clause for the FK constraint.
@@ -611,7 +896,7 @@ func (r *queryer) findRelatedModels(ctx context.Context, mapping Mapping, where
 	resultPtr.Elem().Set(resultSlice)
 
 	// Find using the mapping's model type
-	err := r.find(ctx, resultPtr.Interface(), zorm.FindOptions{
+	err := r.probe(ctx, resultPtr.Interface(), zorm.FindOptions{
 		Where: where,
 	})
 	if err != nil {
@@ -648,8 +933,9 @@ func extractPKString(model reflect.Value, pkFields []string) string {
 	return strings.Join(parts, "|")
 }
 
-// deleteByPK deletes models by their primary keys. Returns the number of rows deleted.
-func (r *queryer) deleteByPK(ctx context.Context, mapping Mapping, pkFields []string, models []reflect.Value) (int, error) {
+// deleteByPK deletes models by their primary keys, soft deleting them when the
+// mapping supports it unless hard is set. Returns the number of rows deleted.
+func (r *queryer) deleteByPK(ctx context.Context, mapping Mapping, pkFields []string, models []reflect.Value, hard bool) (int, error) {
 	if len(models) == 0 {
 		return 0, nil
 	}
@@ -679,10 +965,8 @@ func (r *queryer) deleteByPK(ctx context.Context, mapping Mapping, pkFields []st
 		}
 	}
 
-	// Build DELETE query
-	query := fmt.Sprintf(
-		"DELETE FROM %s WHERE (%s) IN (%s)",
-		targetTable.escaped(driver),
+	where := fmt.Sprintf(
+		"(%s) IN (%s)",
 		strings.Join(whereCols, ","),
 		strings.Join(
 			zfunc.MakeSlice(
@@ -693,6 +977,21 @@ func (r *queryer) deleteByPK(ctx context.Context, mapping Mapping, pkFields []st
 		),
 	)
 
+	// Build DELETE query
+	query := fmt.Sprintf(
+		"DELETE FROM %s WHERE %s",
+		targetTable.escaped(driver),
+		where,
+	)
+	if mapping.SoftDelete != "" && !hard {
+		deleted, err := mapping.softDeleteValue(r.now())
+		if err != nil {
+			return 0, err
+		}
+		query = softDeleteSQL(driver, mapping, where+" AND "+mapping.notDeletedSQL(driver, targetTable))
+		values = append([]interface{}{deleted}, values...)
+	}
+
 	count, _, err := zsql.Exec(ctx, r.conn, query, values)
 	if err != nil {
 		return 0, fmt.Errorf("executing delete: %w", err)
@@ -701,6 +1000,93 @@ func (r *queryer) deleteByPK(ctx context.Context, mapping Mapping, pkFields []st
 	return count, nil
 }
 
+// deleteWithRelations deletes models by their primary keys along with the
+// loaded related models named in relations. Related models holding a foreign
+// key to these models are deleted first, and related models these models hold
+// a foreign key to are deleted last, so no deleted row is left referencing
+// another. Returns the number of models (not related models) deleted.
+func (r *queryer) deleteWithRelations(ctx context.Context, mapping Mapping, pkFields []string, models []reflect.Value, relations zorm.Relations, hard bool) (int, error) {
+	if len(models) == 0 {
+		return 0, nil
+	}
+
+	beforeRelations, afterRelations, err := mapping.categorizeRelationsForPut(relations)
+	if err != nil {
+		return 0, fmt.Errorf("categorizing relations for delete: %w", err)
+	}
+
+	if err := r.beforeDelete(ctx, models); err != nil {
+		return 0, err
+	}
+
+	// FK on related model: delete children before the rows they reference
+	for _, rel := range afterRelations {
+		if err := r.deleteRelatedModels(ctx, models, rel, hard); err != nil {
+			return 0, fmt.Errorf("deleting relation %s: %w", rel.fieldName, err)
+		}
+	}
+
+	count, err := r.deleteByPK(ctx, mapping, pkFields, models, hard)
+	if err != nil {
+		return 0, err
+	}
+
+	// FK on this model: delete referenced rows once nothing deleted points at them
+	for _, rel := range beforeRelations {
+		if err := r.deleteRelatedModels(ctx, models, rel, hard); err != nil {
+			return 0, fmt.Errorf("deleting relation %s: %w", rel.fieldName, err)
+		}
+	}
+
+	if err := r.afterDelete(ctx, models); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// deleteRelatedModels deletes the distinct models loaded into the relation
+// field of each parent, recursing into the relation's own included relations.
+// Many-to-many relations only have their join table rows deleted.
+func (r *queryer) deleteRelatedModels(ctx context.Context, parents []reflect.Value, rel relInfo, hard bool) error {
+	if rel.relation.Through != nil {
+		return r.deleteThroughRelation(ctx, parents, rel)
+	}
+
+	relatedPKFields, err := rel.relatedMapping.primaryKeyFields()
+	if err != nil {
+		return fmt.Errorf("mapping related primary key: %w", err)
+	}
+
+	seen := map[string]bool{}
+	var related []reflect.Value
+	add := func(v reflect.Value) {
+		if v.IsNil() {
+			return
+		}
+		pk := extractPKString(v, relatedPKFields)
+		if pk == "" || seen[pk] {
+			return
+		}
+		seen[pk] = true
+		related = append(related, v)
+	}
+
+	for _, parent := range parents {
+		fieldVal := parent.Elem().FieldByName(rel.fieldName)
+		if fieldVal.Kind() == reflect.Slice {
+			for i := 0; i < fieldVal.Len(); i++ {
+				add(fieldVal.Index(i))
+			}
+		} else {
+			add(fieldVal)
+		}
+	}
+
+	_, err = r.deleteWithRelations(ctx, rel.relatedMapping, relatedPKFields, related, rel.includeOpts.Include.Relations, hard)
+	return err
+}
+
 func (r *queryer) delete(ctx context.Context, listOfPtrs any, opts zorm.DeleteOptions) error {
 	targetVal, modelPtrType, err := validateListOfPtr(listOfPtrs)
 	if err != nil {
@@ -722,7 +1108,21 @@ func (r *queryer) delete(ctx context.Context, listOfPtrs any, opts zorm.DeleteOp
 		return fmt.Errorf("mapping primary key for delete: %w", err)
 	}
 
-	err = r.Get(ctx, listOfPtrs, opts.GetOptions)
+	// Load the related models that are being deleted along with these
+	getOpts := opts.GetOptions
+	if len(opts.Include.Relations) > 0 {
+		relations := zorm.Relations{}
+		maps.Copy(relations, getOpts.Include.Relations)
+		maps.Copy(relations, opts.Include.Relations)
+		getOpts.Include.Relations = relations
+	}
+
+	// Hard deletes also purge rows that were already soft deleted
+	if opts.HardDelete {
+		getOpts.IncludeDeleted = true
+	}
+
+	err = r.Get(ctx, listOfPtrs, getOpts)
 	if err != nil {
 		return fmt.Errorf("error in get before delete: %w", err)
 	}
@@ -733,7 +1133,7 @@ func (r *queryer) delete(ctx context.Context, listOfPtrs any, opts zorm.DeleteOp
 		models[i] = targetVal.Index(i)
 	}
 
-	count, err := r.deleteByPK(ctx, mapping, primaryKeyFields, models)
+	count, err := r.deleteWithRelations(ctx, mapping, primaryKeyFields, models, opts.Include.Relations, opts.HardDelete)
 	if err != nil {
 		return fmt.Errorf("deleting models: %w", err)
 	}
@@ -746,6 +1146,7 @@ func (r *queryer) delete(ctx context.Context, listOfPtrs any, opts zorm.DeleteOp
 }
 
 func (r *queryer) insert(ctx context.Context, mapping Mapping, primaryKeyFields []string, objPtr reflect.Value, fields zorm.Fields) error {
+	driver := r.conn.Driver()
 	targetTable := table{
 		name: mapping.Table,
 	}
@@ -753,7 +1154,7 @@ func (r *queryer) insert(ctx context.Context, mapping Mapping, primaryKeyFields
 	fields, columns := mapping.insertFields(fields)
 	queryColumns := make([]string, 0, len(columns))
 	for _, col := range columns {
-		queryColumns = append(queryColumns, col.escaped(r.conn.Driver()))
+		queryColumns = append(queryColumns, col.escaped(driver))
 	}
 
 	query := fmt.Sprintf(
@@ -764,7 +1165,7 @@ func (r *queryer) insert(ctx context.Context, mapping Mapping, primaryKeyFields
 		VALUES
 		(%s)
 		`,
-		targetTable.escaped(r.conn.Driver()),
+		targetTable.escaped(driver),
 		strings.Join(queryColumns, ","),
 		strings.Join(zfunc.MakeSlice("?", len(queryColumns)), ","),
 	)
@@ -774,7 +1175,11 @@ func (r *queryer) insert(ctx context.Context, mapping Mapping, primaryKeyFields
 		values = append(values, objPtr.Elem().FieldByName(f).Interface())
 	}
 
-	// fmt.Printf("Q: %s\nV: %s", query, plan.values)
+	// Drivers without LastInsertId support (e.g. postgres) read generated keys
+	// back through RETURNING instead
+	if driver.SupportsReturning() {
+		return r.insertReturning(ctx, mapping, primaryKeyFields, objPtr, query, values)
+	}
 
 	_, id, err := zsql.Exec(ctx, r.conn, query, values)
 	if err != nil {
@@ -799,6 +1204,32 @@ func (r *queryer) insert(ctx context.Context, mapping Mapping, primaryKeyFields
 	return nil
 }
 
+// insertReturning executes an insert query with a RETURNING clause for the
+// primary key columns, scanning the generated values directly into the model.
+func (r *queryer) insertReturning(ctx context.Context, mapping Mapping, primaryKeyFields []string, objPtr reflect.Value, query string, values []interface{}) error {
+	driver := r.conn.Driver()
+
+	query += "RETURNING " + strings.Join(zfunc.Map(mapping.PrimaryKey, driver.EscapeColumn), ",")
+
+	targets := make([]any, 0, len(primaryKeyFields))
+	for _, f := range primaryKeyFields {
+		targets = append(targets, objPtr.Elem().FieldByName(f).Addr().Interface())
+	}
+
+	found, err := zsql.Query(ctx, r.conn, func(scan zsql.ScanFunc) error {
+		return scan(targets...)
+	}, query, values)
+	if err != nil {
+		return fmt.Errorf("executing insert: %w", err)
+	}
+
+	if !found {
+		return fmt.Errorf("insert returned no generated keys")
+	}
+
+	return nil
+}
+
 func (r *queryer) update(ctx context.Context, mapping Mapping, keyFields []string, objPtr reflect.Value, fields zorm.Fields) (int, error) {
 	driver := r.conn.Driver()
 	targetTable := table{
@@ -806,6 +1237,13 @@ func (r *queryer) update(ctx context.Context, mapping Mapping, keyFields []strin
 	}
 
 	fields = mapping.updateFields(fields)
+
+	// The version column is only ever incremented, never set from the model
+	version, versioned := mapping.versionColumn()
+	if versioned {
+		fields = slices.DeleteFunc(slices.Clone(fields), func(f string) bool { return f == version.Field })
+	}
+
 	structure, err := mapping.mapStructure(targetTable, "", fields, zorm.Relations{})
 	if err != nil {
 		return 0, fmt.Errorf("mapping update columns: %w", err)
@@ -829,6 +1267,32 @@ func (r *queryer) update(ctx context.Context, mapping Mapping, keyFields []strin
 		return 0, fmt.Errorf("could not map all key fields to columns")
 	}
 
+	assignments := zfunc.Map(structure.columns, func(c column) string {
+		return fmt.Sprintf(
+			"%s=?",
+			c.escaped(driver),
+		)
+	})
+	conditions := zfunc.Map(keyColumns, func(c column) string {
+		return fmt.Sprintf(
+			"%s %s ?",
+			c.escaped(driver),
+			driver.NullSafeEqualityOperator(),
+		)
+	})
+
+	values := make([]any, 0, len(fields)+len(keyFields)+1)
+	for _, f := range append(fields, keyFields...) {
+		values = append(values, objPtr.Elem().FieldByName(f).Interface())
+	}
+
+	if versioned {
+		versionColumn := column{table: targetTable, name: version.Name}
+		assignments = append(assignments, fmt.Sprintf("%s=%s+1", versionColumn.escaped(driver), versionColumn.escaped(driver)))
+		conditions = append(conditions, fmt.Sprintf("%s=?", versionColumn.escaped(driver)))
+		values = append(values, objPtr.Elem().FieldByName(version.Field).Interface())
+	}
+
 	query := fmt.Sprintf(
 		`
 		UPDATE
@@ -839,26 +1303,10 @@ func (r *queryer) update(ctx context.Context, mapping Mapping, keyFields []strin
 		%s
 		`,
 		targetTable.escaped(driver),
-		strings.Join(zfunc.Map(structure.columns, func(c column) string {
-			return fmt.Sprintf(
-				"%s=?",
-				c.escaped(driver),
-			)
-		}), ", "),
-		strings.Join(zfunc.Map(keyColumns, func(c column) string {
-			return fmt.Sprintf(
-				"%s %s ?",
-				c.escaped(driver),
-				driver.NullSafeEqualityOperator(),
-			)
-		}), " AND "),
+		strings.Join(assignments, ", "),
+		strings.Join(conditions, " AND "),
 	)
 
-	values := make([]any, 0, len(fields)+len(keyFields))
-	for _, f := range append(fields, keyFields...) {
-		values = append(values, objPtr.Elem().FieldByName(f).Interface())
-	}
-
 	affected, _, err := zsql.Exec(ctx, r.conn, query, values)
 	if err != nil {
 		return 0, fmt.Errorf("executing update: %w", err)
@@ -868,5 +1316,12 @@ func (r *queryer) update(ctx context.Context, mapping Mapping, keyFields []strin
 		return affected, fmt.Errorf("more than one row (%d) affected by model update query (!!!)", affected)
 	}
 
+	if versioned {
+		if affected == 0 {
+			return 0, fmt.Errorf("row is no longer at version %v: %w", values[len(values)-1], zorm.ErrConflict)
+		}
+		mapping.bumpVersion(objPtr)
+	}
+
 	return affected, nil
 }
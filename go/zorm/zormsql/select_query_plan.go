@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 
 	"4d63.com/collapsewhitespace"
@@ -13,12 +14,14 @@ import (
 	"github.com/milagre/zote/go/zelement/zsort"
 	"github.com/milagre/zote/go/zfunc"
 	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/internal/zmodel"
 	"github.com/milagre/zote/go/zreflect"
 	"github.com/milagre/zote/go/zsql"
 )
 
-// buildInnerJoinsForFieldPaths builds the joins needed in the inner query for WHERE clause field paths
-func buildInnerJoinsForFieldPaths(r *queryer, mapping Mapping, startTable table, fieldPaths []string) ([]join, error) {
+// buildInnerJoinsForFieldPaths builds the joins needed in the inner query for WHERE clause field paths.
+// Soft deleted related rows are left out of the joins unless includeDeleted is set.
+func buildInnerJoinsForFieldPaths(r *queryer, mapping Mapping, startTable table, fieldPaths []string, includeDeleted bool) ([]join, error) {
 	joins := []join{}
 	seenJoins := map[string]bool{} // Track which joins we've already added (leftTable.alias -> rightTable.alias)
 
@@ -33,24 +36,23 @@ func buildInnerJoinsForFieldPaths(r *queryer, mapping Mapping, startTable table,
 			if !seenJoins[joinKey] {
 				seenJoins[joinKey] = true
 
-				onPairs := zfunc.Map(zfunc.Pairs(step.relMapping.Columns), func(p zfunc.Pair[string, string]) [2]column {
-					return [2]column{
-						{
-							table: step.leftTable,
-							name:  p.Key,
-						},
-						{
-							table: step.rightTable,
-							name:  p.Value,
-						},
-					}
-				})
-
-				joins = append(joins, join{
-					leftTable:  step.leftTable,
+				leftTable := step.leftTable
+				through, onPairs := relationJoin(step.relMapping, step.leftTable, step.rightTable)
+				if through != nil {
+					joins = append(joins, *through)
+					leftTable = through.rightTable
+				}
+
+				j := join{
+					leftTable:  leftTable,
 					rightTable: step.rightTable,
 					onPairs:    onPairs,
-				})
+				}
+				if !includeDeleted {
+					j.onWhereSQL = step.relationMapping.notDeletedSQL(r.conn.Driver(), step.rightTable)
+				}
+
+				joins = append(joins, j)
 			}
 			return nil
 		})
@@ -95,7 +97,7 @@ func ensureRelationsForFieldPaths(r *queryer, mapping Mapping, relations zorm.Re
 	return relations, nil
 }
 
-func buildSelectQueryPlan(r *queryer, mapping Mapping, fields []string, relations zorm.Relations, clause zclause.Clause, sorts []zsort.Sort, limit int, offset int) (*selectQueryPlan, error) {
+func buildSelectQueryPlan(r *queryer, mapping Mapping, fields []string, relations zorm.Relations, clause zclause.Clause, sorts []zsort.Sort, limit int, offset int, ks *zmodel.Keyset, after zorm.Cursor, includeDeleted bool) (*selectQueryPlan, error) {
 	innerPrimaryTable := table{
 		name:  mapping.Table,
 		alias: "target",
@@ -110,6 +112,24 @@ func buildSelectQueryPlan(r *queryer, mapping Mapping, fields []string, relation
 		alias: "$",
 	}
 
+	// Keyset pagination sorts on the keyset and seeks past the cursor position
+	if ks != nil {
+		sorts = ks.Sorts()
+
+		if after != "" {
+			seek, err := ks.Seek(after)
+			if err != nil {
+				return nil, fmt.Errorf("building cursor seek: %w", err)
+			}
+
+			if clause != nil {
+				clause = zclause.And{Clauses: []zclause.Clause{clause, seek}}
+			} else {
+				clause = seek
+			}
+		}
+	}
+
 	// Extract field paths from where clause and sort clauses, ensure necessary relations are included
 	var fieldPaths []string
 	if clause != nil {
@@ -153,7 +173,7 @@ func buildSelectQueryPlan(r *queryer, mapping Mapping, fields []string, relation
 	// Inner joins - needed for WHERE clause and sort clauses that reference relations
 	innerJoins := []join{}
 	if len(fieldPaths) > 0 {
-		innerJoins, err = buildInnerJoinsForFieldPaths(r, mapping, innerPrimaryTable, fieldPaths)
+		innerJoins, err = buildInnerJoinsForFieldPaths(r, mapping, innerPrimaryTable, fieldPaths, includeDeleted)
 		if err != nil {
 			return nil, fmt.Errorf("building inner joins for where/sort clauses: %w", err)
 		}
@@ -187,8 +207,14 @@ func buildSelectQueryPlan(r *queryer, mapping Mapping, fields []string, relation
 				return fmt.Errorf("%s", f)
 			}
 
+			leftTable := tbl
+			if rel.through != nil {
+				outerJoins = append(outerJoins, *rel.through)
+				leftTable = rel.through.rightTable
+			}
+
 			j := join{
-				leftTable:  tbl,
+				leftTable:  leftTable,
 				rightTable: rel.structure.table,
 				onPairs:    rel.onPairs,
 				onWhere:    rel.onWhere,
@@ -210,6 +236,15 @@ func buildSelectQueryPlan(r *queryer, mapping Mapping, fields []string, relation
 				j.onWhereValues = v
 			}
 
+			// Soft deleted related rows are never loaded without IncludeDeleted
+			if notDeleted := rel.relatedMapping.notDeletedSQL(r.conn.Driver(), rel.structure.table); notDeleted != "" && !includeDeleted {
+				if j.onWhereSQL != "" {
+					j.onWhereSQL = fmt.Sprintf("(%s) AND %s", j.onWhereSQL, notDeleted)
+				} else {
+					j.onWhereSQL = notDeleted
+				}
+			}
+
 			outerJoins = append(outerJoins, j)
 
 			err := visit(rel.structure.table, rel.structure)
@@ -226,8 +261,7 @@ func buildSelectQueryPlan(r *queryer, mapping Mapping, fields []string, relation
 	}
 
 	// Order
-	var order string
-	var orders []string
+	var orders []planSort
 	var orderValues []interface{}
 	for _, s := range sorts {
 		sv := sortVisitor{
@@ -237,20 +271,17 @@ func buildSelectQueryPlan(r *queryer, mapping Mapping, fields []string, relation
 			cfg:     r.cfg,
 		}
 
-		order, vals, err := sv.Visit(s)
+		elem, direction, vals, err := sv.visitParts(s)
 		if err != nil {
 			return nil, fmt.Errorf("visiting sort: %w", err)
 		}
 
-		orders = append(orders, order)
+		orders = append(orders, planSort{elem: elem, direction: direction})
 		orderValues = append(orderValues, vals...)
 	}
-	if len(orders) > 0 {
-		order = "ORDER BY " + strings.Join(orders, ", ")
-	}
 
 	// Where
-	var where string
+	var conditions []string
 	var whereValues []interface{}
 	if clause != nil {
 		visitor := &whereVisitor{
@@ -264,10 +295,18 @@ func buildSelectQueryPlan(r *queryer, mapping Mapping, fields []string, relation
 			return nil, fmt.Errorf("visiting select where: %w", err)
 		}
 		if w != "" {
-			where = "WHERE " + w
+			conditions = append(conditions, w)
 			whereValues = v
 		}
 	}
+	if notDeleted := mapping.notDeletedSQL(r.conn.Driver(), innerPrimaryTable); notDeleted != "" && !includeDeleted {
+		conditions = append(conditions, notDeleted)
+	}
+
+	var where string
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
 
 	return &selectQueryPlan{
 		innerPrimaryTable: innerPrimaryTable,
@@ -282,17 +321,33 @@ func buildSelectQueryPlan(r *queryer, mapping Mapping, fields []string, relation
 
 		structure: str,
 
-		order:       order,
+		orders:      orders,
 		orderValues: orderValues,
 		where:       where,
 		whereValues: whereValues,
 		limit:       limit,
 		offset:      offset,
+		keyset:      ks,
 
 		target: str.fullTarget(),
 	}, nil
 }
 
+// planSort is a sort of a select query plan: the element of the inner query
+// it orders by, and its direction.
+type planSort struct {
+	elem      string
+	direction string
+}
+
+// sortAlias names the inner query column holding the element of the i-th sort.
+func sortAlias(i int) string {
+	return fmt.Sprintf("__sort%d", i)
+}
+
+// noLimit is the limit of a select query plan that reads every matching row.
+const noLimit = -1
+
 type selectQueryPlan struct {
 	innerPrimaryTable table
 	outerPrimaryTable table
@@ -306,7 +361,7 @@ type selectQueryPlan struct {
 
 	structure structure
 
-	order       string
+	orders      []planSort
 	orderValues []interface{}
 
 	where       string
@@ -314,49 +369,78 @@ type selectQueryPlan struct {
 
 	limit  int
 	offset int
+	keyset *zmodel.Keyset
 
 	target []interface{}
 }
 
+// nextCursor returns the cursor for the page following the processed results,
+// or an empty cursor when the page was not full.
+func (plan selectQueryPlan) nextCursor(targetList reflect.Value) (zorm.Cursor, error) {
+	if plan.keyset == nil || targetList.Len() == 0 || targetList.Len() < plan.limit {
+		return "", nil
+	}
+
+	return plan.keyset.Cursor(targetList.Index(targetList.Len() - 1))
+}
+
 func (plan selectQueryPlan) process(targetList reflect.Value, rows *sql.Rows) error {
 	modelPtrType := targetList.Type().Elem()
 
-	var obj reflect.Value
 	var count int
+	return plan.stream(rows, modelPtrType.Elem(), func(obj reflect.Value) (bool, error) {
+		count++
+		targetList.SetLen(count)
+		targetList.Index(count - 1).Set(obj.Addr())
+		return true, nil
+	})
+}
+
+// stream reads rows into models of modelType, calling cb with each model
+// once all of its rows have been read and its to-many relations sorted. Rows
+// of a model are adjacent, so only one model is held at a time. Reading stops
+// early when cb returns false.
+func (plan selectQueryPlan) stream(rows *sql.Rows, modelType reflect.Type, cb func(obj reflect.Value) (bool, error)) error {
+	var obj reflect.Value
+	var loaded loadedElements
 	var currentPrimaryKey string
 
+	emit := func() (bool, error) {
+		// Post-process: sort to-many relations in memory
+		if err := sortRelations(obj, plan.structure); err != nil {
+			return false, fmt.Errorf("sorting relations: %w", err)
+		}
+		return cb(obj)
+	}
+
 	for rows.Next() {
 		err := rows.Scan(plan.target...)
 		if err != nil {
 			return fmt.Errorf("scanning find result row: %w", err)
 		}
 
-		isNew := false
 		newPrimaryKey, err := json.Marshal(plan.structure.primaryKeyTarget)
 		if err != nil {
 			return fmt.Errorf("creating find primary slug: %w", err)
 		}
 
-		if count == 0 || string(newPrimaryKey) != currentPrimaryKey {
-			isNew = true
-			obj = reflect.New(modelPtrType.Elem()).Elem()
+		if !obj.IsValid() || string(newPrimaryKey) != currentPrimaryKey {
+			if obj.IsValid() {
+				if more, err := emit(); err != nil || !more {
+					return err
+				}
+			}
+			obj = reflect.New(modelType).Elem()
+			loaded = loadedElements{}
 		}
 		currentPrimaryKey = string(newPrimaryKey)
 
-		plan.load(obj)
-
-		if isNew {
-			count++
-			targetList.SetLen(count)
-			targetList.Index(count - 1).Set(obj.Addr())
-		}
+		plan.load(obj, loaded)
 	}
 
-	// Post-process: sort to-many relations in memory
-	for i := 0; i < targetList.Len(); i++ {
-		obj := targetList.Index(i).Elem()
-		if err := sortRelations(obj, plan.structure); err != nil {
-			return fmt.Errorf("sorting relations: %w", err)
+	if obj.IsValid() {
+		if _, err := emit(); err != nil {
+			return err
 		}
 	}
 
@@ -506,7 +590,18 @@ func isPrimaryKeyNull(primaryKeyTarget []interface{}) bool {
 	return true
 }
 
-func (plan selectQueryPlan) loadStructure(structure structure, offset int, v reflect.Value) (int, error) {
+// loadedElements indexes the elements of the to-many relations of a model
+// loaded so far by their primary key, so that each row finds the element it
+// belongs to without searching the relation's slice.
+type loadedElements map[loadedSlice]map[string]reflect.Value
+
+// loadedSlice identifies the slice of a to-many relation of a loaded model.
+type loadedSlice struct {
+	parent   uintptr
+	relation string
+}
+
+func (plan selectQueryPlan) loadStructure(structure structure, offset int, v reflect.Value, loaded loadedElements) (int, error) {
 	var err error
 
 	for i, f := range append(structure.primaryKeyFields, structure.fields...) {
@@ -545,7 +640,7 @@ func (plan selectQueryPlan) loadStructure(structure structure, offset int, v ref
 				f.Set(empty)
 			}
 
-			offset, err = plan.loadStructure(rel.structure, offset, f.Elem())
+			offset, err = plan.loadStructure(rel.structure, offset, f.Elem(), loaded)
 			if err != nil {
 				return 0, fmt.Errorf("loading relation %s data: %w", f, err)
 			}
@@ -570,28 +665,27 @@ func (plan selectQueryPlan) loadStructure(structure structure, offset int, v ref
 				f.Set(zreflect.MakeAddressableSliceOf(t.Type.Elem(), 0, 1))
 			}
 
-			var elem reflect.Value
-
-			newPrimaryKeyBytes, err := json.Marshal(rel.structure.primaryKeyTarget)
+			// Several to-many relations multiply the rows of a model, so a
+			// related model's rows need not be adjacent
+			key, err := json.Marshal(relPrimaryKeyTarget)
 			if err != nil {
-				return 0, fmt.Errorf("creating relation primary slug: %w", err)
+				return 0, fmt.Errorf("creating relation %s primary slug: %w", name, err)
+			}
+			slice := loadedSlice{parent: v.Addr().Pointer(), relation: name}
+			if loaded[slice] == nil {
+				loaded[slice] = map[string]reflect.Value{}
 			}
-			newPrimaryKey := string(newPrimaryKeyBytes)
-			currentPrimaryKey := string(rel.structure.prevPrimaryKey)
-			if f.Len() == 0 || newPrimaryKey != currentPrimaryKey {
+			elem, ok := loaded[slice][string(key)]
+			if !ok {
 				elem = reflect.New(f.Type().Elem().Elem())
 				f.Set(reflect.Append(f, elem))
-			} else {
-				elem = f.Index(f.Len() - 1)
+				loaded[slice][string(key)] = elem
 			}
 
-			offset, err = plan.loadStructure(rel.structure, offset, elem.Elem())
+			offset, err = plan.loadStructure(rel.structure, offset, elem.Elem(), loaded)
 			if err != nil {
 				return 0, fmt.Errorf("loading relation %s data: %w", f, err)
 			}
-
-			rel.structure.prevPrimaryKey = newPrimaryKey
-			structure.toManyRelations[name] = rel
 		}
 
 	}
@@ -599,8 +693,8 @@ func (plan selectQueryPlan) loadStructure(structure structure, offset int, v ref
 	return offset, nil
 }
 
-func (plan selectQueryPlan) load(v reflect.Value) {
-	plan.loadStructure(plan.structure, 0, v)
+func (plan selectQueryPlan) load(v reflect.Value, loaded loadedElements) {
+	plan.loadStructure(plan.structure, 0, v, loaded)
 }
 
 func (plan selectQueryPlan) query(driver zsql.Driver) (string, []interface{}) {
@@ -628,32 +722,27 @@ func (plan selectQueryPlan) query(driver zsql.Driver) (string, []interface{}) {
 		", ",
 	)
 
-	innerJoinsStr := strings.Join(zfunc.Map(
-		plan.innerJoins,
-		func(j join) string {
-			return fmt.Sprintf(
-				`LEFT OUTER JOIN %s AS %s ON (%s)`,
-				driver.EscapeTable(j.rightTable.name),
-				driver.EscapeTable(j.rightTable.alias),
-				strings.Join(
-					zfunc.Map(j.onPairs, func(cols [2]column) string {
-						return fmt.Sprintf(
-							"%s=%s",
-							driver.EscapeTableColumn(
-								cols[0].table.alias,
-								cols[0].name,
-							),
-							driver.EscapeTableColumn(
-								cols[1].table.alias,
-								cols[1].name,
-							),
-						)
-					}),
-					" AND ",
-				),
-			)
-		},
-	), " ")
+	// The joins of the outer query may reorder rows, so the inner query
+	// selects what it sorts by for the outer query to sort by again, then by
+	// primary key. This keeps the rows of each model adjacent and the models
+	// in order.
+	var innerOrders, outerOrders []string
+	for i, s := range plan.orders {
+		alias := sortAlias(i)
+		innerColumns += fmt.Sprintf(", %s AS %s", s.elem, driver.EscapeColumn(alias))
+		innerOrders = append(innerOrders, driver.EscapeColumn(alias)+" "+s.direction)
+		outerOrders = append(outerOrders, driver.EscapeTableColumn(plan.outerTable.alias, alias)+" "+s.direction)
+	}
+	for _, c := range plan.outerPrimaryKey {
+		outerOrders = append(outerOrders, driver.EscapeTableColumn(c.table.alias, c.name)+" ASC")
+	}
+
+	var order string
+	if len(innerOrders) > 0 {
+		order = "ORDER BY " + strings.Join(innerOrders, ", ")
+	}
+
+	innerJoinsStr := innerJoinsSQL(driver, plan.innerJoins)
 
 	var outerJoinWhereValues []interface{}
 	outerJoins := strings.Join(zfunc.Map(
@@ -689,9 +778,11 @@ func (plan selectQueryPlan) query(driver zsql.Driver) (string, []interface{}) {
 	), " ")
 
 	where := plan.where
-	order := plan.order
 
-	limit := fmt.Sprintf("LIMIT %d OFFSET %d", plan.limit, plan.offset)
+	var limit string
+	if plan.limit != noLimit {
+		limit = fmt.Sprintf("LIMIT %d OFFSET %d", plan.limit, plan.offset)
+	}
 
 	target := driver.EscapeTable(plan.innerPrimaryTable.name)
 	targetAlias := driver.EscapeTable(plan.innerPrimaryTable.alias)
@@ -711,6 +802,7 @@ func (plan selectQueryPlan) query(driver zsql.Driver) (string, []interface{}) {
 			/*limit*/ %s
 		) AS %s
 		%s
+		ORDER BY %s
 	`,
 		outerColumns,
 		innerColumns,
@@ -722,10 +814,44 @@ func (plan selectQueryPlan) query(driver zsql.Driver) (string, []interface{}) {
 		limit,
 		outerAlias,
 		outerJoins,
+		strings.Join(outerOrders, ", "),
 	))
 
-	values := append(plan.whereValues, plan.orderValues...)
+	values := append(slices.Clone(plan.orderValues), plan.whereValues...)
 	values = append(values, outerJoinWhereValues...)
 
 	return result, values
 }
+
+// innerJoinsSQL renders the joins used to filter and sort on relation field paths.
+// Their onWhereSQL only excludes soft deleted rows, so it binds no values.
+func innerJoinsSQL(driver zsql.Driver, joins []join) string {
+	return strings.Join(zfunc.Map(
+		joins,
+		func(j join) string {
+			onConditions := zfunc.Map(j.onPairs, func(cols [2]column) string {
+				return fmt.Sprintf(
+					"%s=%s",
+					driver.EscapeTableColumn(
+						cols[0].table.alias,
+						cols[0].name,
+					),
+					driver.EscapeTableColumn(
+						cols[1].table.alias,
+						cols[1].name,
+					),
+				)
+			})
+			if j.onWhereSQL != "" {
+				onConditions = append(onConditions, j.onWhereSQL)
+			}
+
+			return fmt.Sprintf(
+				`LEFT OUTER JOIN %s AS %s ON (%s)`,
+				driver.EscapeTable(j.rightTable.name),
+				driver.EscapeTable(j.rightTable.alias),
+				strings.Join(onConditions, " AND "),
+			)
+		},
+	), " ")
+}
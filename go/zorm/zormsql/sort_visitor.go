@@ -16,6 +16,16 @@ type sortVisitor struct {
 }
 
 func (v *sortVisitor) Visit(s zsort.Sort) (string, []interface{}, error) {
+	elem, direction, vals, err := v.visitParts(s)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return elem + " " + direction, vals, nil
+}
+
+// visitParts renders the element a sort orders by and its direction apart.
+func (v *sortVisitor) visitParts(s zsort.Sort) (string, string, []interface{}, error) {
 	ev := elemVisitor{
 		driver:            v.driver,
 		table:             v.table,
@@ -24,24 +34,17 @@ func (v *sortVisitor) Visit(s zsort.Sort) (string, []interface{}, error) {
 		cfg:               v.cfg,
 	}
 
-	result := ""
-
 	elem, vals, err := ev.Visit(s.Element)
 	if err != nil {
-		return "", nil, fmt.Errorf("visiting sort element %v: %w", s.Element, err)
+		return "", "", nil, fmt.Errorf("visiting sort element %v: %w", s.Element, err)
 	}
 
-	result += elem
-	result += " "
-
 	switch s.Direction {
 	case zsort.Asc:
-		result += "ASC"
+		return elem, "ASC", vals, nil
 	case zsort.Desc:
-		result += "DESC"
+		return elem, "DESC", vals, nil
 	default:
-		return "", nil, fmt.Errorf("invalid sort: %v", s.Direction)
+		return "", "", nil, fmt.Errorf("invalid sort: %v", s.Direction)
 	}
-
-	return result, vals, nil
 }
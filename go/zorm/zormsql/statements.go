@@ -0,0 +1,69 @@
+package zormsql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/milagre/zote/go/zsql"
+)
+
+const statementsContextKey contextKeyType = "statements"
+
+// Statement is a SQL statement executed by a repository, along with the
+// values bound to its placeholders.
+type Statement struct {
+	Query string
+	Args  []any
+}
+
+func (s Statement) String() string {
+	return fmt.Sprintf("%s | %v", s.Query, s.Args)
+}
+
+type statementRecorder struct {
+	mu         sync.Mutex
+	statements []Statement
+}
+
+// RecordStatements returns a context whose statements are recorded as
+// repositories execute them, and a function returning the statements recorded
+// so far. Nested recording contexts each record the statements executed with
+// them.
+func RecordStatements(ctx context.Context) (context.Context, func() []Statement) {
+	rec := &statementRecorder{}
+	parent, _ := ctx.Value(statementsContextKey).([]*statementRecorder)
+	recorders := append(parent[:len(parent):len(parent)], rec)
+
+	return context.WithValue(ctx, statementsContextKey, recorders), func() []Statement {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		return append([]Statement(nil), rec.statements...)
+	}
+}
+
+func record(ctx context.Context, query string, args []any) {
+	recorders, _ := ctx.Value(statementsContextKey).([]*statementRecorder)
+	for _, rec := range recorders {
+		rec.mu.Lock()
+		rec.statements = append(rec.statements, Statement{Query: query, Args: args})
+		rec.mu.Unlock()
+	}
+}
+
+// recordingExecutor records the statements it executes with contexts from
+// RecordStatements.
+type recordingExecutor struct {
+	zsql.QueryExecutor
+}
+
+func (e recordingExecutor) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	record(ctx, query, args)
+	return e.QueryExecutor.Query(ctx, query, args...)
+}
+
+func (e recordingExecutor) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	record(ctx, query, args)
+	return e.QueryExecutor.Exec(ctx, query, args...)
+}
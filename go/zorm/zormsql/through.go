@@ -0,0 +1,347 @@
+package zormsql
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"4d63.com/collapsewhitespace"
+
+	"github.com/milagre/zote/go/zfunc"
+	"github.com/milagre/zote/go/zsql"
+)
+
+// throughRow is a row of a many-to-many relation's join table.
+type throughRow struct {
+	values []interface{}
+}
+
+// key identifies the row for comparison, independent of the Go types its
+// values were read or copied as.
+func (t throughRow) key() string {
+	return strings.Join(zfunc.Map(t.values, func(v interface{}) string {
+		if b, ok := v.([]byte); ok {
+			return string(b)
+		}
+		return fmt.Sprintf("%v", v)
+	}), "|")
+}
+
+// throughLayout resolves the join table columns of a many-to-many relation,
+// in a stable order, along with the model fields providing their values.
+type throughLayout struct {
+	rel Relation
+
+	parentColumns []string // join table columns referencing the parent
+	parentFields  []string
+
+	relatedColumns []string // join table columns referencing the related model
+	relatedFields  []string
+}
+
+func newThroughLayout(rel relInfo) (throughLayout, error) {
+	l := throughLayout{rel: rel.relation}
+
+	for _, c := range slices.Sorted(maps.Keys(rel.relation.Columns)) {
+		fields, err := rel.parentMapping.columnNamesToFields([]string{c})
+		if err != nil {
+			return throughLayout{}, fmt.Errorf("mapping local column %s: %w", c, err)
+		}
+		l.parentColumns = append(l.parentColumns, rel.relation.Columns[c])
+		l.parentFields = append(l.parentFields, fields[0])
+	}
+
+	for _, c := range slices.Sorted(maps.Keys(rel.relation.Through.Columns)) {
+		fields, err := rel.relatedMapping.columnNamesToFields([]string{rel.relation.Through.Columns[c]})
+		if err != nil {
+			return throughLayout{}, fmt.Errorf("mapping remote column %s: %w", rel.relation.Through.Columns[c], err)
+		}
+		l.relatedColumns = append(l.relatedColumns, c)
+		l.relatedFields = append(l.relatedFields, fields[0])
+	}
+
+	return l, nil
+}
+
+func (l throughLayout) columns() []string {
+	return append(slices.Clone(l.parentColumns), l.relatedColumns...)
+}
+
+func (l throughLayout) row(parent, related reflect.Value) throughRow {
+	return throughRow{
+		values: append(extractFields(l.parentFields, parent), extractFields(l.relatedFields, related)...),
+	}
+}
+
+// tuples renders a parenthesized list of n placeholder tuples of width columns.
+func tuples(width, n int) string {
+	return strings.Join(
+		zfunc.MakeSlice("("+strings.Join(zfunc.MakeSlice("?", width), ",")+")", n),
+		",",
+	)
+}
+
+// putThroughRelation puts the related models of a many-to-many relation, then
+// inserts and deletes join table rows so each parent is related to exactly
+// the models provided. Join table rows of related models excluded by the
+// relation's Where, or soft deleted, are left untouched.
+func (r *queryer) putThroughRelation(ctx context.Context, parents []reflect.Value, rel relInfo) error {
+	relatedPKFields, err := rel.relatedMapping.primaryKeyFields()
+	if err != nil {
+		return fmt.Errorf("getting related PK fields: %w", err)
+	}
+
+	layout, err := newThroughLayout(rel)
+	if err != nil {
+		return fmt.Errorf("resolving join table columns: %w", err)
+	}
+
+	type pair struct {
+		parent  reflect.Value
+		related reflect.Value
+	}
+	var pairs []pair
+	var relatedModels []reflect.Value
+	var syncedParents []reflect.Value
+	seen := map[uintptr]bool{}
+
+	for _, parentVal := range parents {
+		fieldVal := parentVal.Elem().FieldByName(rel.fieldName)
+
+		var parentRelated []reflect.Value
+		if fieldVal.Kind() == reflect.Ptr {
+			if !fieldVal.IsNil() {
+				parentRelated = []reflect.Value{fieldVal}
+			}
+		} else if fieldVal.Kind() == reflect.Slice {
+			// A nil slice leaves the parent's memberships alone
+			if fieldVal.IsNil() {
+				continue
+			}
+			for j := 0; j < fieldVal.Len(); j++ {
+				parentRelated = append(parentRelated, fieldVal.Index(j))
+			}
+		}
+		syncedParents = append(syncedParents, parentVal)
+
+		for _, relatedVal := range parentRelated {
+			pairs = append(pairs, pair{parent: parentVal, related: relatedVal})
+
+			if !seen[relatedVal.Pointer()] {
+				seen[relatedVal.Pointer()] = true
+				relatedModels = append(relatedModels, relatedVal)
+			}
+		}
+	}
+
+	if len(relatedModels) > 0 {
+		if err := r.beforePut(ctx, relatedModels); err != nil {
+			return err
+		}
+		if err := r.putModels(ctx, rel.relatedMapping, relatedPKFields, relatedModels, rel.includeOpts.Include.Fields); err != nil {
+			return fmt.Errorf("putting related models: %w", err)
+		}
+		if err := r.afterPut(ctx, relatedModels); err != nil {
+			return err
+		}
+	}
+
+	if len(syncedParents) == 0 {
+		return nil
+	}
+
+	existing, err := r.findThroughRows(ctx, rel, layout, syncedParents)
+	if err != nil {
+		return fmt.Errorf("finding join table rows: %w", err)
+	}
+
+	wanted := map[string]bool{}
+	var inserts []throughRow
+	for _, p := range pairs {
+		row := layout.row(p.parent, p.related)
+		if wanted[row.key()] {
+			continue
+		}
+		wanted[row.key()] = true
+
+		if !slices.ContainsFunc(existing, func(e throughRow) bool { return e.key() == row.key() }) {
+			inserts = append(inserts, row)
+		}
+	}
+
+	var deletes []throughRow
+	for _, e := range existing {
+		if !wanted[e.key()] {
+			deletes = append(deletes, e)
+		}
+	}
+
+	if err := r.deleteThroughRows(ctx, layout, deletes); err != nil {
+		return fmt.Errorf("deleting join table rows: %w", err)
+	}
+
+	if err := r.insertThroughRows(ctx, layout, inserts); err != nil {
+		return fmt.Errorf("inserting join table rows: %w", err)
+	}
+
+	return nil
+}
+
+// findThroughRows finds the join table rows of the given parents that relate
+// them to related models matching the relation's Where.
+func (r *queryer) findThroughRows(ctx context.Context, rel relInfo, layout throughLayout, parents []reflect.Value) ([]throughRow, error) {
+	driver := r.conn.Driver()
+
+	relatedTbl := table{name: rel.relatedMapping.Table, alias: "related"}
+	through, onPairs := relationJoin(rel.relation, table{}, relatedTbl)
+	throughTbl := through.rightTable
+
+	onConditions := zfunc.Map(onPairs, func(cols [2]column) string {
+		return fmt.Sprintf("%s=%s", cols[0].escaped(driver), cols[1].escaped(driver))
+	})
+	if notDeleted := rel.relatedMapping.notDeletedSQL(driver, relatedTbl); notDeleted != "" {
+		onConditions = append(onConditions, notDeleted)
+	}
+
+	columns := zfunc.Map(layout.columns(), func(c string) string {
+		return column{table: throughTbl, name: c}.escaped(driver)
+	})
+	parentColumns := zfunc.Map(layout.parentColumns, func(c string) string {
+		return column{table: throughTbl, name: c}.escaped(driver)
+	})
+
+	var relWhere string
+	var relWhereValues []interface{}
+	if rel.includeOpts.Where != nil {
+		visitor := &whereVisitor{
+			driver:  driver,
+			table:   relatedTbl,
+			mapping: rel.relatedMapping,
+			cfg:     r.cfg,
+		}
+		w, v, err := visitor.Visit(rel.includeOpts.Where)
+		if err != nil {
+			return nil, fmt.Errorf("visiting relation where: %w", err)
+		}
+		if w != "" {
+			relWhere = " AND " + w
+			relWhereValues = v
+		}
+	}
+
+	var result []throughRow
+	for chunk := range slices.Chunk(parents, chunkSize(driver, len(layout.parentFields))) {
+		query := collapsewhitespace.String(fmt.Sprintf(
+			"SELECT %s FROM %s AS %s INNER JOIN %s AS %s ON (%s) WHERE (%s) IN (%s)%s",
+			strings.Join(columns, ", "),
+			driver.EscapeTable(throughTbl.name),
+			driver.EscapeTable(throughTbl.alias),
+			driver.EscapeTable(relatedTbl.name),
+			driver.EscapeTable(relatedTbl.alias),
+			strings.Join(onConditions, " AND "),
+			strings.Join(parentColumns, ", "),
+			tuples(len(parentColumns), len(chunk)),
+			relWhere,
+		))
+
+		values := make([]interface{}, 0, len(chunk)*len(layout.parentFields)+len(relWhereValues))
+		for _, p := range chunk {
+			values = append(values, extractFields(layout.parentFields, p)...)
+		}
+		values = append(values, relWhereValues...)
+
+		_, err := zsql.Query(ctx, r.conn, func(scan zsql.ScanFunc) error {
+			row := throughRow{values: make([]interface{}, len(columns))}
+			targets := zfunc.Map(row.values, func(interface{}) interface{} { return new(interface{}) })
+			if err := scan(targets...); err != nil {
+				return err
+			}
+			for i, t := range targets {
+				row.values[i] = *(t.(*interface{}))
+			}
+			result = append(result, row)
+			return nil
+		}, query, values)
+		if err != nil {
+			return nil, fmt.Errorf("executing join table query: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+func (r *queryer) insertThroughRows(ctx context.Context, layout throughLayout, rows []throughRow) error {
+	driver := r.conn.Driver()
+	columns := layout.columns()
+
+	for chunk := range slices.Chunk(rows, chunkSize(driver, len(columns))) {
+		query := collapsewhitespace.String(fmt.Sprintf(
+			"INSERT INTO %s (%s) VALUES %s",
+			driver.EscapeTable(layout.rel.Through.Table),
+			strings.Join(zfunc.Map(columns, driver.EscapeColumn), ","),
+			tuples(len(columns), len(chunk)),
+		))
+
+		values := make([]interface{}, 0, len(chunk)*len(columns))
+		for _, row := range chunk {
+			values = append(values, row.values...)
+		}
+
+		if _, _, err := zsql.Exec(ctx, r.conn, query, values); err != nil {
+			return fmt.Errorf("executing insert: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *queryer) deleteThroughRows(ctx context.Context, layout throughLayout, rows []throughRow) error {
+	driver := r.conn.Driver()
+	columns := layout.columns()
+
+	for chunk := range slices.Chunk(rows, chunkSize(driver, len(columns))) {
+		query := collapsewhitespace.String(fmt.Sprintf(
+			"DELETE FROM %s WHERE (%s) IN (%s)",
+			driver.EscapeTable(layout.rel.Through.Table),
+			strings.Join(zfunc.Map(columns, driver.EscapeColumn), ","),
+			tuples(len(columns), len(chunk)),
+		))
+
+		values := make([]interface{}, 0, len(chunk)*len(columns))
+		for _, row := range chunk {
+			values = append(values, row.values...)
+		}
+
+		if _, _, err := zsql.Exec(ctx, r.conn, query, values); err != nil {
+			return fmt.Errorf("executing delete: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// deleteThroughRelation deletes the join table rows relating each parent to
+// the related models loaded into its relation field.
+func (r *queryer) deleteThroughRelation(ctx context.Context, parents []reflect.Value, rel relInfo) error {
+	layout, err := newThroughLayout(rel)
+	if err != nil {
+		return fmt.Errorf("resolving join table columns: %w", err)
+	}
+
+	var rows []throughRow
+	for _, parent := range parents {
+		fieldVal := parent.Elem().FieldByName(rel.fieldName)
+		if fieldVal.Kind() == reflect.Slice {
+			for i := 0; i < fieldVal.Len(); i++ {
+				rows = append(rows, layout.row(parent, fieldVal.Index(i)))
+			}
+		} else if !fieldVal.IsNil() {
+			rows = append(rows, layout.row(parent, fieldVal))
+		}
+	}
+
+	return r.deleteThroughRows(ctx, layout, rows)
+}
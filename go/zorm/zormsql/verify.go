@@ -0,0 +1,101 @@
+package zormsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/milagre/zote/go/zsql"
+)
+
+// Verify compares the registered mappings with the schema of the connected
+// database, reporting every table or column missing, nullable column read
+// into a field that can't hold NULL, and unique key without a unique index.
+// Join tables of many-to-many relations are checked for their columns.
+//
+// Mistakes in a mapping otherwise only surface when a query using them runs,
+// so services should Verify their repository at startup.
+func (r *Repository) Verify(ctx context.Context) error {
+	driver := r.ts.Driver()
+	mappings := slices.SortedFunc(maps.Values(r.cfg.mappings), func(a, b Mapping) int {
+		return strings.Compare(a.Table, b.Table)
+	})
+
+	schemas := map[string]*zsql.TableSchema{}
+	describe := func(table string) (*zsql.TableSchema, error) {
+		if s, ok := schemas[table]; ok {
+			return s, nil
+		}
+		s, err := driver.DescribeTable(ctx, r.ts, table)
+		if err != nil {
+			return nil, fmt.Errorf("describing table %s: %w", table, err)
+		}
+		schemas[table] = s
+		return s, nil
+	}
+
+	var errs []error
+	for _, m := range mappings {
+		schema, err := describe(m.Table)
+		if err != nil {
+			return err
+		}
+		if schema == nil {
+			errs = append(errs, fmt.Errorf("table %s does not exist", m.Table))
+			continue
+		}
+
+		structType := reflect.TypeOf(m.PtrType).Elem()
+		for _, c := range m.Columns {
+			col, ok := schema.Column(c.Name)
+			if !ok {
+				errs = append(errs, fmt.Errorf("column %s.%s does not exist", m.Table, c.Name))
+				continue
+			}
+
+			f, _ := structType.FieldByName(c.Field)
+			if _, nullable, known := columnType(f.Type); col.Nullable && known && !nullable {
+				errs = append(errs, fmt.Errorf("column %s.%s is nullable but field %s %s can't hold NULL", m.Table, c.Name, c.Field, f.Type))
+			}
+		}
+
+		for _, uk := range m.UniqueKeys {
+			if !slices.ContainsFunc(schema.UniqueIndexes, func(idx []string) bool { return sameColumns(idx, uk) }) {
+				errs = append(errs, fmt.Errorf("unique key %s(%s) has no unique index", m.Table, strings.Join(uk, ", ")))
+			}
+		}
+
+		for _, rel := range m.Relations {
+			if rel.Through == nil {
+				continue
+			}
+
+			through, err := describe(rel.Through.Table)
+			if err != nil {
+				return err
+			}
+			if through == nil {
+				errs = append(errs, fmt.Errorf("join table %s of relation %s.%s does not exist", rel.Through.Table, m.Table, rel.Field))
+				continue
+			}
+
+			joinColumns := slices.Concat(slices.Collect(maps.Values(rel.Columns)), slices.Collect(maps.Keys(rel.Through.Columns)))
+			slices.Sort(joinColumns)
+			for _, c := range slices.Compact(joinColumns) {
+				if _, ok := through.Column(c); !ok {
+					errs = append(errs, fmt.Errorf("column %s.%s does not exist", rel.Through.Table, c))
+				}
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("schema differs from mappings: %w", errors.Join(errs...))
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package zormsqltest
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,4 +16,11 @@ func ValidateMapping(t *testing.T, m zormsql.Mapping) {
 	assert.Greater(t, len(m.PrimaryKey), 0, "sql mapper validation failed for type %T: primary key not defined (no length)", m.PtrType)
 	assert.NotZero(t, m.Columns, "sql mapper validation failed for type %T: columns not defined", m.PtrType)
 	assert.Greater(t, len(m.Columns), 0, "sql mapper validation failed for type %T: columns not defined (no length)", m.PtrType)
+	assert.NoError(t, m.Validate(), "sql mapper validation failed for type %T", m.PtrType)
+}
+
+// VerifySchema fails the test when the database repo is connected to differs
+// from its mappings. See zormsql.Repository.Verify.
+func VerifySchema(t *testing.T, ctx context.Context, repo *zormsql.Repository) {
+	assert.NoError(t, repo.Verify(ctx), "sql schema verification failed for repository")
 }
@@ -0,0 +1,378 @@
+// Package zormstats instruments a zorm.Repository, recording stats of every
+// operation made through it and logging slow ones.
+//
+// Each operation is timed in the "orm.duration" stat, the models it read or
+// wrote are counted in "orm.rows", and its failures in "orm.errors", through
+// zstats.FromContext. Stats are tagged with the name of the repository, the
+// model type and the operation: find, iterate, get, put, delete, count, exists,
+// aggregate, delete_where or update_where.
+//
+//	repo := zormstats.New("accounts", sqlRepo, zormstats.Options{
+//		SlowThreshold: 200 * time.Millisecond,
+//	})
+//
+// When Options.SlowThreshold is set, operations taking longer than it are
+// logged as warnings through zlog.FromContext, along with the SQL statements
+// zormsql executed for them. Every statement of every operation is then
+// recorded, at the cost of an allocation per statement, to be logged should
+// the operation turn out slow. The values bound to statements are only logged
+// with Options.LogArgs, as they may be sensitive.
+package zormstats
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"reflect"
+	"time"
+
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zlog"
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/zormsql"
+	"github.com/milagre/zote/go/zstats"
+)
+
+var (
+	_ zorm.Repository  = &Repository{}
+	_ zorm.Transaction = &Transaction{}
+	_ zorm.Beginner    = &Transaction{}
+)
+
+// maxLoggedStatements bounds the statements logged with a slow operation, as
+// puts of many models execute many statements.
+const maxLoggedStatements = 20
+
+// Options configures an instrumented repository.
+type Options struct {
+	// SlowThreshold is how long an operation may take before it's logged as
+	// slow. Slow operations aren't logged unless it's positive.
+	SlowThreshold time.Duration
+
+	// LogArgs logs the values bound to the statements of slow operations
+	// along with the statements.
+	LogArgs bool
+}
+
+type config struct {
+	name string
+	opts Options
+}
+
+// Repository decorates a zorm.Repository, instrumenting its operations.
+type Repository struct {
+	*queryer
+	repo zorm.Repository
+}
+
+type Transaction struct {
+	*queryer
+	tx zorm.Transaction
+}
+
+type queryer struct {
+	cfg   *config
+	inner zorm.Queryer
+}
+
+func New(name string, repo zorm.Repository, opts Options) *Repository {
+	return &Repository{
+		queryer: &queryer{
+			cfg: &config{
+				name: name,
+				opts: opts,
+			},
+			inner: repo,
+		},
+		repo: repo,
+	}
+}
+
+func (r *Repository) Begin(ctx context.Context) (zorm.Transaction, error) {
+	tx, err := r.repo.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transaction{
+		queryer: &queryer{
+			cfg:   r.cfg,
+			inner: tx,
+		},
+		tx: tx,
+	}, nil
+}
+
+// IsRetryableError reports whether the decorated repository considers err to
+// have aborted a transaction that may succeed when run again, see
+// zorm.BeginWithRetry.
+func (r *Repository) IsRetryableError(err error) bool {
+	checker, ok := r.repo.(zorm.RetryChecker)
+	return ok && checker.IsRetryableError(err)
+}
+
+// Begin begins a transaction nested in this one, when the decorated
+// transaction supports nesting; see zorm.Beginner.
+func (t *Transaction) Begin(ctx context.Context) (zorm.Transaction, error) {
+	beginner, ok := t.tx.(zorm.Beginner)
+	if !ok {
+		return nil, fmt.Errorf("nested transactions unsupported by %T", t.tx)
+	}
+
+	tx, err := beginner.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transaction{
+		queryer: &queryer{
+			cfg:   t.cfg,
+			inner: tx,
+		},
+		tx: tx,
+	}, nil
+}
+
+func (t *Transaction) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *Transaction) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// modelName names the model type of a model, a list of models, or a pointer to
+// a list of models.
+func modelName(v any) string {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return "unknown"
+	}
+	if t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.String()
+}
+
+// op is an operation being instrumented.
+type op struct {
+	cfg   *config
+	name  string
+	model string
+	stats zstats.Stats
+	start time.Time
+
+	// statements returns the statements executed for the operation, when it
+	// may be logged as slow
+	statements func() []zormsql.Statement
+}
+
+func (q *queryer) begin(ctx context.Context, name string, model any) (context.Context, *op) {
+	o := &op{
+		cfg:   q.cfg,
+		name:  name,
+		model: modelName(model),
+	}
+	o.stats = zstats.FromContext(ctx).WithPrefix("orm").WithTags(zstats.Tags{
+		"repo":  q.cfg.name,
+		"model": o.model,
+		"op":    name,
+	})
+
+	if q.cfg.opts.SlowThreshold > 0 {
+		ctx, o.statements = zormsql.RecordStatements(ctx)
+	}
+
+	return ctx, o
+}
+
+// run runs fn, which returns the number of models the operation read or
+// wrote, recording its stats and logging it when slow.
+func (o *op) run(ctx context.Context, fn func() (int, error)) error {
+	var rows int
+	var err error
+
+	o.start = time.Now()
+	o.stats.Timer("duration", func() {
+		rows, err = fn()
+	})
+	o.end(ctx, rows, err)
+
+	return err
+}
+
+func (o *op) end(ctx context.Context, rows int, err error) {
+	elapsed := time.Since(o.start)
+
+	o.stats.Count("rows", float64(rows))
+	if err != nil {
+		o.stats.Count("errors", 1)
+	}
+
+	if o.statements == nil || elapsed < o.cfg.opts.SlowThreshold {
+		return
+	}
+
+	statements := o.statements()
+	sql := make([]string, 0, min(len(statements), maxLoggedStatements))
+	for _, s := range statements[:min(len(statements), maxLoggedStatements)] {
+		if o.cfg.opts.LogArgs {
+			sql = append(sql, s.String())
+		} else {
+			sql = append(sql, s.Query)
+		}
+	}
+
+	fields := zlog.Fields{
+		"repo":       o.cfg.name,
+		"model":      o.model,
+		"op":         o.name,
+		"duration":   elapsed.String(),
+		"rows":       rows,
+		"statements": len(statements),
+		"sql":        sql,
+	}
+	if err != nil {
+		fields["error"] = err.Error()
+	}
+
+	zlog.FromContext(ctx).WithFields(fields).Warnf("Slow %s of %s took %s", o.name, o.model, elapsed)
+}
+
+func listLen(list any) int {
+	v := reflect.ValueOf(list)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return 0
+	}
+	return v.Len()
+}
+
+func (q *queryer) Find(ctx context.Context, ptrToListOfPtrs any, opts zorm.FindOptions) error {
+	ctx, o := q.begin(ctx, "find", ptrToListOfPtrs)
+	return o.run(ctx, func() (int, error) {
+		err := q.inner.Find(ctx, ptrToListOfPtrs, opts)
+		return listLen(ptrToListOfPtrs), err
+	})
+}
+
+// Iterate is timed from when iteration starts until it stops.
+func (q *queryer) Iterate(ctx context.Context, model any, opts zorm.FindOptions) iter.Seq2[any, error] {
+	return func(yield func(any, error) bool) {
+		ctx, o := q.begin(ctx, "iterate", model)
+
+		rows := 0
+		var failure error
+		o.start = time.Now()
+		o.stats.Timer("duration", func() {
+			for obj, err := range q.inner.Iterate(ctx, model, opts) {
+				if err != nil {
+					failure = err
+				} else {
+					rows++
+				}
+				if !yield(obj, err) {
+					return
+				}
+			}
+		})
+		o.end(ctx, rows, failure)
+	}
+}
+
+func (q *queryer) Get(ctx context.Context, listOfPtrs any, opts zorm.GetOptions) error {
+	ctx, o := q.begin(ctx, "get", listOfPtrs)
+	return o.run(ctx, func() (int, error) {
+		err := q.inner.Get(ctx, listOfPtrs, opts)
+		if err != nil {
+			return 0, err
+		}
+		return listLen(listOfPtrs), nil
+	})
+}
+
+func (q *queryer) Put(ctx context.Context, listOfPtrs any, opts zorm.PutOptions) error {
+	ctx, o := q.begin(ctx, "put", listOfPtrs)
+	return o.run(ctx, func() (int, error) {
+		err := q.inner.Put(ctx, listOfPtrs, opts)
+		if err != nil {
+			return 0, err
+		}
+		return listLen(listOfPtrs), nil
+	})
+}
+
+func (q *queryer) Delete(ctx context.Context, listOfPtrs any, opts zorm.DeleteOptions) error {
+	ctx, o := q.begin(ctx, "delete", listOfPtrs)
+	return o.run(ctx, func() (int, error) {
+		err := q.inner.Delete(ctx, listOfPtrs, opts)
+		if err != nil {
+			return 0, err
+		}
+		return listLen(listOfPtrs), nil
+	})
+}
+
+func (q *queryer) Count(ctx context.Context, model any, where zclause.Clause) (int, error) {
+	var count int
+	ctx, o := q.begin(ctx, "count", model)
+	err := o.run(ctx, func() (int, error) {
+		var err error
+		count, err = q.inner.Count(ctx, model, where)
+		return count, err
+	})
+	return count, err
+}
+
+func (q *queryer) Exists(ctx context.Context, model any, where zclause.Clause) (bool, error) {
+	var exists bool
+	ctx, o := q.begin(ctx, "exists", model)
+	err := o.run(ctx, func() (int, error) {
+		var err error
+		exists, err = q.inner.Exists(ctx, model, where)
+		if exists {
+			return 1, err
+		}
+		return 0, err
+	})
+	return exists, err
+}
+
+func (q *queryer) Aggregate(ctx context.Context, model any, ptrToListOfResults any, opts zorm.AggregateOptions) error {
+	ctx, o := q.begin(ctx, "aggregate", model)
+	return o.run(ctx, func() (int, error) {
+		before := listLen(ptrToListOfResults)
+		err := q.inner.Aggregate(ctx, model, ptrToListOfResults, opts)
+		return listLen(ptrToListOfResults) - before, err
+	})
+}
+
+func (q *queryer) DeleteWhere(ctx context.Context, model any, where zclause.Clause, opts zorm.DeleteWhereOptions) (int, error) {
+	var count int
+	ctx, o := q.begin(ctx, "delete_where", model)
+	err := o.run(ctx, func() (int, error) {
+		var err error
+		count, err = q.inner.DeleteWhere(ctx, model, where, opts)
+		return count, err
+	})
+	return count, err
+}
+
+func (q *queryer) UpdateWhere(ctx context.Context, model any, where zclause.Clause, set map[string]any) (int, error) {
+	var count int
+	ctx, o := q.begin(ctx, "update_where", model)
+	err := o.run(ctx, func() (int, error) {
+		var err error
+		count, err = q.inner.UpdateWhere(ctx, model, where, set)
+		return count, err
+	})
+	return count, err
+}
@@ -0,0 +1,205 @@
+package zormstats_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milagre/zote/go/zelement/zelem"
+	"github.com/milagre/zote/go/zlog"
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/zormmem/zormmemtest"
+	"github.com/milagre/zote/go/zorm/zormstats"
+	"github.com/milagre/zote/go/zorm/zormtest"
+	"github.com/milagre/zote/go/zstats"
+)
+
+type stat struct {
+	name  string
+	op    string
+	value float64
+}
+
+// recordingAdapter records each stat it's given, and the tags of the last
+type recordingAdapter struct {
+	mu    sync.Mutex
+	stats []stat
+	tags  zstats.Tags
+}
+
+func (a *recordingAdapter) Count(name string, value float64, tags zstats.Tags) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stats = append(a.stats, stat{name: name, op: tags["op"], value: value})
+	a.tags = tags
+}
+
+func (a *recordingAdapter) Gauge(name string, value float64, tags zstats.Tags) {}
+
+func (a *recordingAdapter) Timer(name string, cb func(), tags zstats.Tags) {
+	cb()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stats = append(a.stats, stat{name: name, op: tags["op"], value: 1})
+}
+
+// total sums the values of a stat recorded for an operation
+func (a *recordingAdapter) total(name string, op string) float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	total := 0.0
+	for _, s := range a.stats {
+		if s.name == name && s.op == op {
+			total += s.value
+		}
+	}
+	return total
+}
+
+// capture is a zlog.Destination keeping the messages sent to it
+type capture struct {
+	mu       sync.Mutex
+	messages []string
+	fields   []zlog.Fields
+}
+
+func (c *capture) Send(level zlog.Level, fields zlog.Fields, message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, message)
+	c.fields = append(c.fields, fields)
+}
+
+func (c *capture) Level() zlog.Level     { return zlog.LevelWarn }
+func (c *capture) SetLevel(l zlog.Level) {}
+
+func setup(t *testing.T, cb func(context.Context, zorm.Repository)) {
+	t.Helper()
+
+	setupStats(t, zormstats.Options{}, func(ctx context.Context, r zorm.Repository, adapter *recordingAdapter, logs *capture) {
+		cb(ctx, r)
+	})
+}
+
+// setupStats is setup with the given options, also giving cb the stats and
+// logs recorded through the context.
+func setupStats(t *testing.T, opts zormstats.Options, cb func(ctx context.Context, r zorm.Repository, adapter *recordingAdapter, logs *capture)) {
+	t.Helper()
+
+	ctx := context.Background()
+	inner := zormmemtest.NewRepository()
+	zormmemtest.Populate(t, ctx, inner)
+
+	adapter := &recordingAdapter{}
+	logs := &capture{}
+
+	ctx = zstats.Context(ctx, zstats.NewStats(adapter))
+	ctx = zlog.Context(ctx, zlog.New(zlog.LevelWarn, logs))
+
+	cb(ctx, zormstats.New("test", inner, opts), adapter, logs)
+}
+
+func TestORM(t *testing.T) {
+	zormtest.RunFindTests(t, setup)
+	zormtest.RunGetTests(t, setup)
+	zormtest.RunPutTests(t, setup)
+	zormtest.RunDeleteTests(t, setup)
+	zormtest.RunAggregateTests(t, setup)
+}
+
+func TestStats(t *testing.T) {
+	setupStats(t, zormstats.Options{}, func(ctx context.Context, r zorm.Repository, adapter *recordingAdapter, logs *capture) {
+		accounts := make([]*zormtest.Account, 0, 10)
+		require.NoError(t, zorm.Find(ctx, r, &accounts, zorm.FindOptions{}))
+		require.Len(t, accounts, 3)
+		assert.Equal(t, 1.0, adapter.total("orm.duration", "find"))
+		assert.Equal(t, 3.0, adapter.total("orm.rows", "find"))
+		assert.Equal(t, 0.0, adapter.total("orm.errors", "find"))
+		assert.Equal(t, zstats.Tags{"repo": "test", "model": "zormtest.Account", "op": "find"}, adapter.tags)
+
+		require.NoError(t, zorm.Get(ctx, r, []*zormtest.Account{{ID: "1"}}, zorm.GetOptions{}))
+		assert.Equal(t, 1.0, adapter.total("orm.rows", "get"))
+
+		err := zorm.Get(ctx, r, []*zormtest.Account{{ID: "404"}}, zorm.GetOptions{})
+		require.ErrorIs(t, err, zorm.ErrNotFound)
+		assert.Equal(t, 1.0, adapter.total("orm.errors", "get"))
+
+		require.NoError(t, zorm.Put(ctx, r, []*zormtest.Account{{Company: "Initech"}}, zorm.PutOptions{}))
+		assert.Equal(t, 1.0, adapter.total("orm.rows", "put"))
+
+		require.NoError(t, zorm.Delete(ctx, r, []*zormtest.Account{{ID: "3"}}, zorm.DeleteOptions{}))
+		assert.Equal(t, 1.0, adapter.total("orm.rows", "delete"))
+
+		count, err := zorm.Count[zormtest.Account](ctx, r, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+		assert.Equal(t, 3.0, adapter.total("orm.rows", "count"))
+
+		n := 0
+		for _, err := range zorm.Iterate[zormtest.Account](ctx, r, zorm.FindOptions{}) {
+			require.NoError(t, err)
+			n++
+			break
+		}
+		assert.Equal(t, 1, n)
+		assert.Equal(t, 1.0, adapter.total("orm.duration", "iterate"))
+		assert.Equal(t, 1.0, adapter.total("orm.rows", "iterate"), "iterations stopped early count what was yielded")
+
+		updated, err := zorm.UpdateWhere[zormtest.Account](ctx, r, zelem.Eq(zelem.Field("Company"), zelem.Value("Initech")), map[string]any{
+			"Company": "Initrode",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, updated)
+		assert.Equal(t, 1.0, adapter.total("orm.rows", "update_where"))
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	setupStats(t, zormstats.Options{}, func(ctx context.Context, r zorm.Repository, adapter *recordingAdapter, logs *capture) {
+		tx, err := r.Begin(ctx)
+		require.NoError(t, err)
+		require.NoError(t, zorm.Put(ctx, tx, []*zormtest.Account{{Company: "Initech"}}, zorm.PutOptions{}))
+		require.NoError(t, tx.Commit())
+
+		assert.Equal(t, 1.0, adapter.total("orm.rows", "put"))
+
+		count, err := zorm.Count[zormtest.Account](ctx, r, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 4, count)
+	})
+}
+
+func TestSlowOperations(t *testing.T) {
+	t.Run("Logged", func(t *testing.T) {
+		setupStats(t, zormstats.Options{SlowThreshold: time.Nanosecond}, func(ctx context.Context, r zorm.Repository, adapter *recordingAdapter, logs *capture) {
+			_, err := zorm.Count[zormtest.Account](ctx, r, nil)
+			require.NoError(t, err)
+
+			require.Len(t, logs.messages, 1)
+			assert.Contains(t, logs.messages[0], "Slow count of zormtest.Account")
+			assert.Equal(t, "test", logs.fields[0]["repo"])
+			assert.Equal(t, 3, logs.fields[0]["rows"])
+			assert.Contains(t, logs.fields[0], "sql")
+		})
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		setupStats(t, zormstats.Options{}, func(ctx context.Context, r zorm.Repository, adapter *recordingAdapter, logs *capture) {
+			_, err := zorm.Count[zormtest.Account](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Empty(t, logs.messages)
+		})
+	})
+
+	t.Run("FastOperationsNotLogged", func(t *testing.T) {
+		setupStats(t, zormstats.Options{SlowThreshold: time.Hour}, func(ctx context.Context, r zorm.Repository, adapter *recordingAdapter, logs *capture) {
+			_, err := zorm.Count[zormtest.Account](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Empty(t, logs.messages)
+		})
+	})
+}
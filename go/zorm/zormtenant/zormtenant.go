@@ -0,0 +1,791 @@
+// Package zormtenant scopes a zorm.Repository to a tenant, so that no query
+// made through it reads or writes the models of another tenant.
+//
+// Each model type is registered with the field path holding its tenant, or as
+// shared between tenants, and the tenant is taken from the context of each
+// call:
+//
+//	repo := zormtenant.New(sqlRepo)
+//	repo.Scope(&Account{}, "ID")
+//	repo.Scope(&User{}, "AccountID")
+//	repo.Scope(&UserAuth{}, "User.AccountID")
+//	repo.Unscoped(&Plan{})
+//
+//	ctx = zormtenant.Context(ctx, accountID)
+//	zorm.Find(ctx, repo, &users, zorm.FindOptions{})
+//
+// Finds, counts, aggregates and bulk updates and deletes only match models of
+// the tenant, and included relations only load related models of the tenant.
+// Get and Delete report models of other tenants as not found. Put stamps the
+// tenant on new models and fails with ErrCrossTenant, writing nothing, for
+// models that belong to, or would end up belonging to, another tenant.
+//
+// Calls fail with ErrNoTenant when the context has no tenant, and for model
+// types that weren't registered.
+//
+// Model hooks are called by the decorated repository, and are given its
+// unscoped queryer; queries made from hooks aren't scoped to the tenant.
+package zormtenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/milagre/zote/go/zelement/zclause"
+	"github.com/milagre/zote/go/zelement/zelem"
+	"github.com/milagre/zote/go/zorm"
+)
+
+var (
+	ErrNoTenant    = fmt.Errorf("no tenant in context")
+	ErrCrossTenant = fmt.Errorf("model belongs to another tenant")
+)
+
+var (
+	_ zorm.Repository  = &Repository{}
+	_ zorm.Transaction = &Transaction{}
+	_ zorm.Beginner    = &Transaction{}
+)
+
+type contextKeyType string
+
+const contextKey contextKeyType = "tenant"
+
+// Context returns a context whose repository calls are scoped to tenant.
+func Context(ctx context.Context, tenant any) context.Context {
+	return context.WithValue(ctx, contextKey, tenant)
+}
+
+// FromContext returns the tenant calls made with ctx are scoped to.
+func FromContext(ctx context.Context) (any, bool) {
+	v := ctx.Value(contextKey)
+	return v, v != nil
+}
+
+// scope is how the models of a type are scoped to a tenant.
+type scope struct {
+	// path is the field path holding the tenant of a model, or empty when its
+	// models are shared between tenants
+	path string
+
+	// through reports whether the path reaches the tenant through relations,
+	// so the tenant can't be stamped on the model itself
+	through bool
+}
+
+func (s scope) where(tenant any, where zclause.Clause) zclause.Clause {
+	if s.path == "" {
+		return where
+	}
+	predicate := zelem.Eq(zelem.Field(s.path), zelem.Value(tenant))
+	if where == nil {
+		return predicate
+	}
+	return zelem.And(predicate, where)
+}
+
+// owns reports whether a model holds the tenant at the scope's path. Models
+// whose path passes through an unloaded relation don't.
+func (s scope) owns(tenant any, obj reflect.Value) bool {
+	v, ok := s.tenant(obj)
+	return ok && fmt.Sprint(v) == fmt.Sprint(tenant)
+}
+
+func (s scope) tenant(obj reflect.Value) (any, bool) {
+	v := obj
+	for _, name := range strings.Split(s.path, ".") {
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil, false
+			}
+			v = v.Elem()
+		}
+		v = v.FieldByName(name)
+	}
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	return v.Interface(), true
+}
+
+// lookupInclude returns what a model needs loaded to tell its tenant.
+func (s scope) lookupInclude() zorm.Include {
+	if !s.through {
+		return zorm.Include{Fields: zorm.Fields{s.path}}
+	}
+
+	// The models along the way are read in full, so their relations load
+	parts := strings.Split(s.path, ".")
+	include := zorm.Include{Fields: zorm.Fields{parts[len(parts)-1]}}
+	for i := len(parts) - 2; i >= 0; i-- {
+		include = zorm.Include{
+			Relations: zorm.Relations{parts[i]: {Include: include}},
+		}
+	}
+	return include
+}
+
+type config struct {
+	mu     sync.RWMutex
+	scopes map[reflect.Type]scope
+}
+
+// Repository decorates a zorm.Repository, scoping its queries to the tenant
+// of their context.
+type Repository struct {
+	*queryer
+	repo zorm.Repository
+}
+
+type Transaction struct {
+	*queryer
+	tx zorm.Transaction
+}
+
+type queryer struct {
+	cfg   *config
+	inner zorm.Queryer
+}
+
+func New(repo zorm.Repository) *Repository {
+	return &Repository{
+		queryer: &queryer{
+			cfg:   &config{scopes: map[reflect.Type]scope{}},
+			inner: repo,
+		},
+		repo: repo,
+	}
+}
+
+// Scope registers the field path holding the tenant of a model type, given
+// as a pointer to a struct. Paths may reach through to-one relations, such as
+// "User.AccountID", for models that don't hold their tenant themselves. It
+// panics if the path doesn't name a field.
+func (r *Repository) Scope(model any, fieldPath string) {
+	t := reflect.TypeOf(model)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("Tenant scope requires a pointer to a struct, got %T", model))
+	}
+
+	parts := strings.Split(fieldPath, ".")
+	st := t.Elem()
+	for i, name := range parts {
+		f, ok := st.FieldByName(name)
+		if !ok {
+			panic(fmt.Sprintf("Tenant field %s not found on %s", fieldPath, t))
+		}
+		if i < len(parts)-1 {
+			if f.Type.Kind() != reflect.Ptr || f.Type.Elem().Kind() != reflect.Struct {
+				panic(fmt.Sprintf("Tenant field %s of %s must reach through to-one relations", fieldPath, t))
+			}
+			st = f.Type.Elem()
+		}
+	}
+
+	r.register(t, scope{path: fieldPath, through: len(parts) > 1})
+}
+
+// Unscoped registers a model type whose models are shared between tenants,
+// given as a pointer to a struct.
+func (r *Repository) Unscoped(model any) {
+	r.register(reflect.TypeOf(model), scope{})
+}
+
+func (r *Repository) register(t reflect.Type, s scope) {
+	r.cfg.mu.Lock()
+	defer r.cfg.mu.Unlock()
+
+	if _, ok := r.cfg.scopes[t]; ok {
+		panic(fmt.Sprintf("Duplicate tenant scope for type %s", t))
+	}
+	r.cfg.scopes[t] = s
+}
+
+func (r *Repository) Begin(ctx context.Context) (zorm.Transaction, error) {
+	tx, err := r.repo.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transaction{
+		queryer: &queryer{
+			cfg:   r.cfg,
+			inner: tx,
+		},
+		tx: tx,
+	}, nil
+}
+
+// IsRetryableError reports whether the decorated repository considers err to
+// have aborted a transaction that may succeed when run again, see
+// zorm.BeginWithRetry.
+func (r *Repository) IsRetryableError(err error) bool {
+	checker, ok := r.repo.(zorm.RetryChecker)
+	return ok && checker.IsRetryableError(err)
+}
+
+// Put puts the models in a transaction, so that models found to belong to
+// another tenant once written are never committed.
+func (r *Repository) Put(ctx context.Context, listOfPtrs any, opts zorm.PutOptions) error {
+	tx, err := r.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning transaction for put: %w", err)
+	}
+
+	if err := tx.Put(ctx, listOfPtrs, opts); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Begin begins a transaction nested in this one, when the decorated
+// transaction supports nesting; see zorm.Beginner.
+func (t *Transaction) Begin(ctx context.Context) (zorm.Transaction, error) {
+	beginner, ok := t.tx.(zorm.Beginner)
+	if !ok {
+		return nil, fmt.Errorf("nested transactions unsupported by %T", t.tx)
+	}
+
+	tx, err := beginner.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transaction{
+		queryer: &queryer{
+			cfg:   t.cfg,
+			inner: tx,
+		},
+		tx: tx,
+	}, nil
+}
+
+func (t *Transaction) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *Transaction) Rollback() error {
+	return t.tx.Rollback()
+}
+
+func tenantOf(ctx context.Context) (any, error) {
+	tenant, ok := FromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	return tenant, nil
+}
+
+// scope returns the scope of a model pointer type.
+func (q *queryer) scope(t reflect.Type) (scope, error) {
+	q.cfg.mu.RLock()
+	defer q.cfg.mu.RUnlock()
+
+	s, ok := q.cfg.scopes[t]
+	if !ok {
+		return scope{}, fmt.Errorf("model type %s has no tenant scope", t)
+	}
+	return s, nil
+}
+
+// modelScope returns the scope of a model given as a pointer.
+func (q *queryer) modelScope(model any) (scope, error) {
+	return q.scope(reflect.TypeOf(model))
+}
+
+// listScope returns a list of model pointers, or a pointer to one, along with
+// the scope of its models.
+func (q *queryer) listScope(list any) (reflect.Value, scope, error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Ptr {
+		return reflect.Value{}, scope{}, fmt.Errorf("list of pointers required, got %T", list)
+	}
+
+	s, err := q.scope(v.Type().Elem())
+	if err != nil {
+		return reflect.Value{}, scope{}, err
+	}
+	return v, s, nil
+}
+
+// modelsScope is listScope for the lists of models given to Get, Put and
+// Delete, which must not hold nil models.
+func (q *queryer) modelsScope(list any) (reflect.Value, scope, error) {
+	v, s, err := q.listScope(list)
+	if err != nil {
+		return reflect.Value{}, scope{}, err
+	}
+	for i := 0; i < v.Len(); i++ {
+		if v.Index(i).IsNil() {
+			return reflect.Value{}, scope{}, fmt.Errorf("nil model at index %d", i)
+		}
+	}
+	return v, s, nil
+}
+
+// include scopes the relations of an include to the tenant, recursively. The
+// relations of related models scoped through relations of their own aren't
+// filtered, as they're reached through their related model.
+func (q *queryer) include(tenant any, t reflect.Type, include zorm.Include) (zorm.Include, error) {
+	if len(include.Relations) == 0 {
+		return include, nil
+	}
+
+	relations := make(zorm.Relations, len(include.Relations))
+	for name, rel := range include.Relations {
+		f, ok := t.Elem().FieldByName(name)
+		if !ok {
+			// Left for the repository to report
+			relations[name] = rel
+			continue
+		}
+
+		relType := f.Type
+		if relType.Kind() == reflect.Slice {
+			relType = relType.Elem()
+		}
+
+		s, err := q.scope(relType)
+		if err != nil {
+			return zorm.Include{}, fmt.Errorf("relation %s: %w", name, err)
+		}
+
+		if !s.through {
+			rel.Where = s.where(tenant, rel.Where)
+		}
+
+		rel.Include, err = q.include(tenant, relType, rel.Include)
+		if err != nil {
+			return zorm.Include{}, fmt.Errorf("relation %s: %w", name, err)
+		}
+
+		relations[name] = rel
+	}
+
+	include.Relations = relations
+	return include, nil
+}
+
+func (q *queryer) findOptions(ctx context.Context, t reflect.Type, s scope, opts zorm.FindOptions) (zorm.FindOptions, error) {
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		return zorm.FindOptions{}, err
+	}
+
+	opts.Where = s.where(tenant, opts.Where)
+	opts.Include, err = q.include(tenant, t, opts.Include)
+	if err != nil {
+		return zorm.FindOptions{}, err
+	}
+
+	return opts, nil
+}
+
+func (q *queryer) Find(ctx context.Context, ptrToListOfPtrs any, opts zorm.FindOptions) error {
+	list, s, err := q.listScope(ptrToListOfPtrs)
+	if err != nil {
+		return fmt.Errorf("invalid argument to find: %w", err)
+	}
+
+	opts, err = q.findOptions(ctx, list.Type().Elem(), s, opts)
+	if err != nil {
+		return fmt.Errorf("scoping find: %w", err)
+	}
+
+	return q.inner.Find(ctx, ptrToListOfPtrs, opts)
+}
+
+func (q *queryer) Iterate(ctx context.Context, model any, opts zorm.FindOptions) iter.Seq2[any, error] {
+	s, err := q.modelScope(model)
+	if err == nil {
+		opts, err = q.findOptions(ctx, reflect.TypeOf(model), s, opts)
+	}
+	if err != nil {
+		return func(yield func(any, error) bool) {
+			yield(nil, fmt.Errorf("scoping iterate: %w", err))
+		}
+	}
+
+	return q.inner.Iterate(ctx, model, opts)
+}
+
+// lookup gets the stored version of each model from the repository, loading
+// what's needed to tell its tenant, without changing the models themselves.
+// Models that aren't stored, or that have no populated key, are left invalid.
+func (q *queryer) lookup(ctx context.Context, s scope, list reflect.Value, includeDeleted bool) ([]reflect.Value, error) {
+	opts := zorm.GetOptions{
+		Include:        s.lookupInclude(),
+		IncludeDeleted: includeDeleted,
+	}
+
+	clones := reflect.MakeSlice(list.Type(), list.Len(), list.Len())
+	for i := 0; i < list.Len(); i++ {
+		obj := list.Index(i)
+		clone := reflect.New(obj.Type().Elem())
+		clone.Elem().Set(obj.Elem())
+		clones.Index(i).Set(clone)
+	}
+
+	result := make([]reflect.Value, clones.Len())
+
+	err := q.inner.Get(ctx, clones.Interface(), opts)
+	if err == nil {
+		for i := range result {
+			result[i] = clones.Index(i)
+		}
+		return result, nil
+	}
+	if !errors.Is(err, zorm.ErrNotFound) && !errors.Is(err, zorm.ErrNoKey) {
+		return nil, err
+	}
+
+	// Some aren't stored, so find out which
+	for i := range result {
+		one := clones.Slice(i, i+1)
+		err := q.inner.Get(ctx, one.Interface(), opts)
+		if err == nil {
+			result[i] = one.Index(0)
+		} else if !errors.Is(err, zorm.ErrNotFound) && !errors.Is(err, zorm.ErrNoKey) {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// owned fails with zorm.ErrNotFound unless every model is stored and belongs
+// to the tenant.
+func (q *queryer) owned(ctx context.Context, tenant any, s scope, list reflect.Value, includeDeleted bool) error {
+	if s.path == "" {
+		return nil
+	}
+
+	stored, err := q.lookup(ctx, s, list, includeDeleted)
+	if err != nil {
+		return fmt.Errorf("looking up tenants: %w", err)
+	}
+
+	found := 0
+	for _, obj := range stored {
+		if obj.IsValid() && s.owns(tenant, obj) {
+			found++
+		}
+	}
+
+	if found != list.Len() {
+		return fmt.Errorf("expected %d rows found, but only got %d: %w", list.Len(), found, zorm.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (q *queryer) Get(ctx context.Context, listOfPtrs any, opts zorm.GetOptions) error {
+	list, s, err := q.modelsScope(listOfPtrs)
+	if err != nil {
+		return fmt.Errorf("invalid argument to get: %w", err)
+	}
+
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		return fmt.Errorf("scoping get: %w", err)
+	}
+
+	if err := q.owned(ctx, tenant, s, list, opts.IncludeDeleted); err != nil {
+		return err
+	}
+
+	opts.Include, err = q.include(tenant, list.Type().Elem(), opts.Include)
+	if err != nil {
+		return fmt.Errorf("scoping get: %w", err)
+	}
+
+	return q.inner.Get(ctx, listOfPtrs, opts)
+}
+
+func (q *queryer) Put(ctx context.Context, listOfPtrs any, opts zorm.PutOptions) error {
+	list, _, err := q.modelsScope(listOfPtrs)
+	if err != nil {
+		return fmt.Errorf("invalid argument to put: %w", err)
+	}
+
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		return fmt.Errorf("scoping put: %w", err)
+	}
+
+	if err := q.claim(ctx, tenant, list, opts.Include.Relations); err != nil {
+		return err
+	}
+
+	t := list.Type().Elem()
+	opts.Include, err = q.include(tenant, t, opts.Include)
+	if err != nil {
+		return fmt.Errorf("scoping put: %w", err)
+	}
+	opts.GetOptions.Include, err = q.include(tenant, t, opts.GetOptions.Include)
+	if err != nil {
+		return fmt.Errorf("scoping put: %w", err)
+	}
+
+	if err := q.inner.Put(ctx, listOfPtrs, opts); err != nil {
+		return err
+	}
+
+	return q.confirm(ctx, tenant, list, opts.Include.Relations)
+}
+
+// claim stamps the tenant on models about to be put, and on the related models
+// put with them, failing with ErrCrossTenant for models holding another
+// tenant, or whose stored version belongs to another tenant.
+func (q *queryer) claim(ctx context.Context, tenant any, list reflect.Value, relations zorm.Relations) error {
+	s, err := q.scope(list.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	if s.path != "" {
+		if !s.through {
+			for i := 0; i < list.Len(); i++ {
+				if err := s.stamp(tenant, list.Index(i)); err != nil {
+					return fmt.Errorf("putting %s at index %d: %w", list.Type().Elem(), i, err)
+				}
+			}
+		}
+
+		stored, err := q.lookup(ctx, s, list, true)
+		if err != nil {
+			return fmt.Errorf("looking up tenants: %w", err)
+		}
+		for i, obj := range stored {
+			if obj.IsValid() && !s.owns(tenant, obj) {
+				return fmt.Errorf("putting %s at index %d: %w", list.Type().Elem(), i, ErrCrossTenant)
+			}
+		}
+	}
+
+	return q.eachRelated(list, relations, func(related reflect.Value, rel zorm.Relation) error {
+		return q.claim(ctx, tenant, related, rel.Include.Relations)
+	})
+}
+
+// confirm fails with ErrCrossTenant when a model that was put, or a related
+// model put with it, belongs to another tenant once stored. Only models
+// holding their tenant through relations need confirming, as the tenant of
+// the others was stamped.
+func (q *queryer) confirm(ctx context.Context, tenant any, list reflect.Value, relations zorm.Relations) error {
+	s, err := q.scope(list.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	if s.through {
+		stored, err := q.lookup(ctx, s, list, true)
+		if err != nil {
+			return fmt.Errorf("looking up tenants: %w", err)
+		}
+		for i, obj := range stored {
+			if !obj.IsValid() || !s.owns(tenant, obj) {
+				return fmt.Errorf("putting %s at index %d: %w", list.Type().Elem(), i, ErrCrossTenant)
+			}
+		}
+	}
+
+	return q.eachRelated(list, relations, func(related reflect.Value, rel zorm.Relation) error {
+		return q.confirm(ctx, tenant, related, rel.Include.Relations)
+	})
+}
+
+// eachRelated calls fn with the list of non-nil models in each relation of
+// the models in list.
+func (q *queryer) eachRelated(list reflect.Value, relations zorm.Relations, fn func(reflect.Value, zorm.Relation) error) error {
+	for name, rel := range relations {
+		f, ok := list.Type().Elem().Elem().FieldByName(name)
+		if !ok {
+			continue
+		}
+
+		relType := f.Type
+		if relType.Kind() == reflect.Slice {
+			relType = relType.Elem()
+		}
+
+		related := reflect.MakeSlice(reflect.SliceOf(relType), 0, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			if list.Index(i).IsNil() {
+				continue
+			}
+			v := list.Index(i).Elem().FieldByName(name)
+			if v.Kind() == reflect.Slice {
+				for j := 0; j < v.Len(); j++ {
+					if !v.Index(j).IsNil() {
+						related = reflect.Append(related, v.Index(j))
+					}
+				}
+			} else if !v.IsNil() {
+				related = reflect.Append(related, v)
+			}
+		}
+
+		if related.Len() == 0 {
+			continue
+		}
+
+		if err := fn(related, rel); err != nil {
+			return fmt.Errorf("relation %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// stamp sets the tenant field of a model to the tenant when it's unset,
+// failing with ErrCrossTenant when it holds another tenant.
+func (s scope) stamp(tenant any, obj reflect.Value) error {
+	field := obj.Elem().FieldByName(s.path)
+	if !field.IsZero() {
+		if !s.owns(tenant, obj) {
+			return ErrCrossTenant
+		}
+		return nil
+	}
+
+	target := field
+	if field.Kind() == reflect.Ptr {
+		target = reflect.New(field.Type().Elem()).Elem()
+	}
+
+	v := reflect.ValueOf(tenant)
+	switch {
+	case v.Type().AssignableTo(target.Type()):
+		target.Set(v)
+	case target.Kind() == reflect.String:
+		target.SetString(fmt.Sprint(tenant))
+	case v.Kind() != reflect.String && v.Type().ConvertibleTo(target.Type()):
+		target.Set(v.Convert(target.Type()))
+	default:
+		return fmt.Errorf("cannot stamp tenant %T on field %s of type %s", tenant, s.path, field.Type())
+	}
+
+	if field.Kind() == reflect.Ptr {
+		field.Set(target.Addr())
+	}
+
+	return nil
+}
+
+func (q *queryer) Delete(ctx context.Context, listOfPtrs any, opts zorm.DeleteOptions) error {
+	list, s, err := q.modelsScope(listOfPtrs)
+	if err != nil {
+		return fmt.Errorf("invalid argument to delete: %w", err)
+	}
+
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		return fmt.Errorf("scoping delete: %w", err)
+	}
+
+	includeDeleted := opts.HardDelete || opts.GetOptions.IncludeDeleted
+	if err := q.owned(ctx, tenant, s, list, includeDeleted); err != nil {
+		return fmt.Errorf("error in get before delete: %w", err)
+	}
+
+	t := list.Type().Elem()
+	opts.Include, err = q.include(tenant, t, opts.Include)
+	if err != nil {
+		return fmt.Errorf("scoping delete: %w", err)
+	}
+	opts.GetOptions.Include, err = q.include(tenant, t, opts.GetOptions.Include)
+	if err != nil {
+		return fmt.Errorf("scoping delete: %w", err)
+	}
+
+	return q.inner.Delete(ctx, listOfPtrs, opts)
+}
+
+// where scopes a clause on a model to the tenant.
+func (q *queryer) where(ctx context.Context, model any, where zclause.Clause) (zclause.Clause, error) {
+	s, err := q.modelScope(model)
+	if err != nil {
+		return nil, err
+	}
+
+	tenant, err := tenantOf(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.where(tenant, where), nil
+}
+
+func (q *queryer) Count(ctx context.Context, model any, where zclause.Clause) (int, error) {
+	where, err := q.where(ctx, model, where)
+	if err != nil {
+		return 0, fmt.Errorf("scoping count: %w", err)
+	}
+	return q.inner.Count(ctx, model, where)
+}
+
+func (q *queryer) Exists(ctx context.Context, model any, where zclause.Clause) (bool, error) {
+	where, err := q.where(ctx, model, where)
+	if err != nil {
+		return false, fmt.Errorf("scoping exists: %w", err)
+	}
+	return q.inner.Exists(ctx, model, where)
+}
+
+func (q *queryer) Aggregate(ctx context.Context, model any, ptrToListOfResults any, opts zorm.AggregateOptions) error {
+	where, err := q.where(ctx, model, opts.Where)
+	if err != nil {
+		return fmt.Errorf("scoping aggregate: %w", err)
+	}
+	opts.Where = where
+	return q.inner.Aggregate(ctx, model, ptrToListOfResults, opts)
+}
+
+func (q *queryer) DeleteWhere(ctx context.Context, model any, where zclause.Clause, opts zorm.DeleteWhereOptions) (int, error) {
+	scoped, err := q.where(ctx, model, where)
+	if err != nil {
+		return 0, fmt.Errorf("scoping delete where: %w", err)
+	}
+
+	// The tenant alone doesn't make a where clause, or this would delete
+	// everything of the tenant
+	if where == nil {
+		return 0, fmt.Errorf("delete where requires a where clause")
+	}
+
+	return q.inner.DeleteWhere(ctx, model, scoped, opts)
+}
+
+func (q *queryer) UpdateWhere(ctx context.Context, model any, where zclause.Clause, set map[string]any) (int, error) {
+	scoped, err := q.where(ctx, model, where)
+	if err != nil {
+		return 0, fmt.Errorf("scoping update where: %w", err)
+	}
+
+	// Moving the models to another tenant isn't allowed either
+	s, _ := q.modelScope(model)
+	tenant, _ := tenantOf(ctx)
+	if v, ok := set[s.path]; ok && s.path != "" && fmt.Sprint(v) != fmt.Sprint(tenant) {
+		return 0, fmt.Errorf("update where setting %s: %w", s.path, ErrCrossTenant)
+	}
+
+	if where == nil {
+		return 0, fmt.Errorf("update where requires a where clause")
+	}
+
+	return q.inner.UpdateWhere(ctx, model, scoped, set)
+}
@@ -0,0 +1,330 @@
+package zormtenant_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milagre/zote/go/zelement/zelem"
+	"github.com/milagre/zote/go/zorm"
+	"github.com/milagre/zote/go/zorm/zormmem/zormmemtest"
+	"github.com/milagre/zote/go/zorm/zormtenant"
+	"github.com/milagre/zote/go/zorm/zormtest"
+)
+
+// The tenants are the populated accounts: Acme, with Daffy and their auths 1
+// and 2, and Dunder Mifflin, with Dwight and their auths 3 and 4.
+const (
+	acme   = "1"
+	dunder = "2"
+)
+
+// setup scopes accounts, users and auths of a populated repository to the
+// account they belong to, and shares groups between tenants. Addresses are
+// left unregistered.
+func setup(t *testing.T, cb func(context.Context, zorm.Repository)) {
+	t.Helper()
+
+	ctx := context.Background()
+	inner := zormmemtest.NewRepository()
+	zormmemtest.Populate(t, ctx, inner)
+
+	repo := zormtenant.New(inner)
+	repo.Scope(&zormtest.Account{}, "ID")
+	repo.Scope(&zormtest.User{}, "AccountID")
+	repo.Scope(&zormtest.UserAuth{}, "User.AccountID")
+	repo.Unscoped(&zormtest.UserGroup{})
+
+	cb(ctx, repo)
+}
+
+// setupUnscoped shares every model type of a populated repository between
+// tenants, and calls cb with a context holding a tenant, so that calls pass
+// straight through.
+func setupUnscoped(t *testing.T, cb func(context.Context, zorm.Repository)) {
+	t.Helper()
+
+	ctx := context.Background()
+	inner := zormmemtest.NewRepository()
+	zormmemtest.Populate(t, ctx, inner)
+
+	repo := zormtenant.New(inner)
+	repo.Unscoped(&zormtest.Account{})
+	repo.Unscoped(&zormtest.User{})
+	repo.Unscoped(&zormtest.UserAuth{})
+	repo.Unscoped(&zormtest.UserAddress{})
+	repo.Unscoped(&zormtest.UserGroup{})
+
+	cb(zormtenant.Context(ctx, acme), repo)
+}
+
+func TestORM(t *testing.T) {
+	zormtest.RunFindTests(t, setupUnscoped)
+	zormtest.RunGetTests(t, setupUnscoped)
+	zormtest.RunPutTests(t, setupUnscoped)
+	zormtest.RunDeleteTests(t, setupUnscoped)
+	zormtest.RunAggregateTests(t, setupUnscoped)
+}
+
+func TestFind(t *testing.T) {
+	setup(t, func(ctx context.Context, r zorm.Repository) {
+		accounts := make([]*zormtest.Account, 0, 10)
+		err := zorm.Find(zormtenant.Context(ctx, acme), r, &accounts, zorm.FindOptions{
+			Include: zorm.Include{
+				Relations: zorm.Relations{
+					"Users": {
+						Include: zorm.Include{
+							Relations: zorm.Relations{"Auths": {}},
+						},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+		require.Len(t, accounts, 1)
+		assert.Equal(t, "Acme, Inc.", accounts[0].Company)
+		require.Len(t, accounts[0].Users, 1)
+		assert.Equal(t, "Daffy", accounts[0].Users[0].FirstName)
+		assert.Len(t, accounts[0].Users[0].Auths, 2)
+
+		accounts = make([]*zormtest.Account, 0, 10)
+		err = zorm.Find(zormtenant.Context(ctx, dunder), r, &accounts, zorm.FindOptions{
+			Where: zelem.Eq(zelem.Field("Company"), zelem.Value("Acme, Inc.")),
+		})
+		require.NoError(t, err)
+		assert.Empty(t, accounts)
+
+		count, err := zorm.Count[zormtest.User](zormtenant.Context(ctx, acme), r, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+
+		exists, err := zorm.Exists[zormtest.User](zormtenant.Context(ctx, acme), r, zelem.Eq(zelem.Field("FirstName"), zelem.Value("Dwight")))
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		var providers []string
+		for auth, err := range zorm.Iterate[zormtest.UserAuth](zormtenant.Context(ctx, dunder), r, zorm.FindOptions{}) {
+			require.NoError(t, err)
+			providers = append(providers, auth.Provider)
+		}
+		assert.ElementsMatch(t, []string{"password", "passkey"}, providers)
+	})
+}
+
+func TestGet(t *testing.T) {
+	setup(t, func(ctx context.Context, r zorm.Repository) {
+		account := &zormtest.Account{ID: acme}
+		require.NoError(t, zorm.Get(zormtenant.Context(ctx, acme), r, []*zormtest.Account{account}, zorm.GetOptions{}))
+		assert.Equal(t, "Acme, Inc.", account.Company)
+
+		account = &zormtest.Account{ID: acme}
+		err := zorm.Get(zormtenant.Context(ctx, dunder), r, []*zormtest.Account{account}, zorm.GetOptions{})
+		assert.ErrorIs(t, err, zorm.ErrNotFound)
+		assert.Empty(t, account.Company, "models of other tenants are not loaded")
+
+		account = &zormtest.Account{Company: "Acme, Inc."}
+		err = zorm.Get(zormtenant.Context(ctx, dunder), r, []*zormtest.Account{account}, zorm.GetOptions{})
+		assert.ErrorIs(t, err, zorm.ErrNotFound, "models are not found by unique key either")
+
+		auth := &zormtest.UserAuth{ID: "3"}
+		err = zorm.Get(zormtenant.Context(ctx, acme), r, []*zormtest.UserAuth{auth}, zorm.GetOptions{})
+		assert.ErrorIs(t, err, zorm.ErrNotFound, "models scoped through relations are not found either")
+	})
+}
+
+func TestPut(t *testing.T) {
+	t.Run("StampsTenant", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = zormtenant.Context(ctx, acme)
+
+			user := &zormtest.User{
+				FirstName: "Bugs",
+				Auths:     []*zormtest.UserAuth{{Provider: "password", Data: "c@rr0ts"}},
+			}
+			err := zorm.Put(ctx, r, []*zormtest.User{user}, zorm.PutOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{"Auths": {}},
+				},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, acme, user.AccountID)
+
+			count, err := zorm.Count[zormtest.User](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+
+			count, err = zorm.Count[zormtest.UserAuth](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 3, count)
+		})
+	})
+
+	t.Run("RejectsOtherTenant", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			acmeCtx := zormtenant.Context(ctx, acme)
+
+			err := zorm.Put(acmeCtx, r, []*zormtest.User{{AccountID: dunder, FirstName: "Bugs"}}, zorm.PutOptions{})
+			assert.ErrorIs(t, err, zormtenant.ErrCrossTenant, "models holding another tenant")
+
+			err = zorm.Put(acmeCtx, r, []*zormtest.User{{ID: "2", FirstName: "Stolen"}}, zorm.PutOptions{})
+			assert.ErrorIs(t, err, zormtenant.ErrCrossTenant, "models stored for another tenant")
+
+			// Accounts are scoped by their ID, so this one is stamped as acme's own
+			err = zorm.Put(acmeCtx, r, []*zormtest.Account{{Company: "Dunder Mifflin"}}, zorm.PutOptions{})
+			assert.ErrorIs(t, err, zorm.ErrConflict, "models can't take the unique key of another tenant's")
+
+			err = zorm.Put(acmeCtx, r, []*zormtest.User{
+				{FirstName: "Bugs"},
+				{ID: "1", FirstName: "Daffy", Auths: []*zormtest.UserAuth{{ID: "3", Provider: "password", Data: "Stolen"}}},
+			}, zorm.PutOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{"Auths": {}},
+				},
+			})
+			assert.ErrorIs(t, err, zormtenant.ErrCrossTenant, "related models stored for another tenant")
+
+			count, err := zorm.Count[zormtest.User](acmeCtx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 1, count, "nothing is written")
+
+			user := &zormtest.User{ID: "2"}
+			require.NoError(t, zorm.Get(zormtenant.Context(ctx, dunder), r, []*zormtest.User{user}, zorm.GetOptions{}))
+			assert.Equal(t, "Dwight", user.FirstName)
+
+			auth := &zormtest.UserAuth{ID: "3"}
+			require.NoError(t, zorm.Get(zormtenant.Context(ctx, dunder), r, []*zormtest.UserAuth{auth}, zorm.GetOptions{}))
+			assert.Equal(t, "t0tally_S3CURE!", auth.Data)
+		})
+	})
+
+	t.Run("RejectsRelationToOtherTenant", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			acmeCtx := zormtenant.Context(ctx, acme)
+
+			auth := &zormtest.UserAuth{UserID: "1", Provider: "passkey", Data: `{"secret":"4321"}`}
+			require.NoError(t, zorm.Put(acmeCtx, r, []*zormtest.UserAuth{auth}, zorm.PutOptions{}))
+
+			err := zorm.Put(acmeCtx, r, []*zormtest.UserAuth{{UserID: "2", Provider: "oauth2", Data: "Planted"}}, zorm.PutOptions{})
+			assert.ErrorIs(t, err, zormtenant.ErrCrossTenant)
+
+			auth.UserID = "2"
+			err = zorm.Put(acmeCtx, r, []*zormtest.UserAuth{auth}, zorm.PutOptions{})
+			assert.ErrorIs(t, err, zormtenant.ErrCrossTenant)
+
+			count, err := zorm.Count[zormtest.UserAuth](zormtenant.Context(ctx, dunder), r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count, "nothing is written")
+		})
+	})
+}
+
+func TestRejectsNilModels(t *testing.T) {
+	setup(t, func(ctx context.Context, r zorm.Repository) {
+		ctx = zormtenant.Context(ctx, acme)
+
+		err := zorm.Get(ctx, r, []*zormtest.User{nil, {ID: "1"}}, zorm.GetOptions{})
+		require.ErrorContains(t, err, "nil model at index 0")
+		assert.NotErrorIs(t, err, zorm.ErrNotFound)
+
+		err = zorm.Put(ctx, r, []*zormtest.User{{FirstName: "Bugs"}, nil, {ID: "2", FirstName: "Stolen"}}, zorm.PutOptions{})
+		require.ErrorContains(t, err, "nil model at index 1")
+		assert.NotErrorIs(t, err, zormtenant.ErrCrossTenant)
+
+		err = zorm.Delete(ctx, r, []*zormtest.User{nil}, zorm.DeleteOptions{})
+		require.ErrorContains(t, err, "nil model at index 0")
+
+		count, err := zorm.Count[zormtest.User](ctx, r, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count, "nothing is written")
+	})
+}
+
+func TestDelete(t *testing.T) {
+	setup(t, func(ctx context.Context, r zorm.Repository) {
+		acmeCtx := zormtenant.Context(ctx, acme)
+
+		err := zorm.Delete(acmeCtx, r, []*zormtest.UserAuth{{ID: "3"}}, zorm.DeleteOptions{})
+		assert.ErrorIs(t, err, zorm.ErrNotFound)
+
+		deleted, err := zorm.DeleteWhere[zormtest.UserAuth](acmeCtx, r, zelem.Eq(zelem.Field("Provider"), zelem.Value("password")), zorm.DeleteWhereOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, deleted, "only models of the tenant are deleted")
+
+		count, err := zorm.Count[zormtest.UserAuth](zormtenant.Context(ctx, dunder), r, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		require.NoError(t, zorm.Delete(zormtenant.Context(ctx, dunder), r, []*zormtest.UserAuth{{ID: "3"}}, zorm.DeleteOptions{}))
+	})
+}
+
+func TestUpdateWhere(t *testing.T) {
+	setup(t, func(ctx context.Context, r zorm.Repository) {
+		acmeCtx := zormtenant.Context(ctx, acme)
+
+		updated, err := zorm.UpdateWhere[zormtest.UserAuth](acmeCtx, r, zelem.Eq(zelem.Field("Provider"), zelem.Value("password")), map[string]any{
+			"Data": "N3w P@ssw0rd!",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 1, updated, "only models of the tenant are updated")
+
+		_, err = zorm.UpdateWhere[zormtest.User](acmeCtx, r, zelem.Eq(zelem.Field("ID"), zelem.Value("1")), map[string]any{
+			"AccountID": dunder,
+		})
+		assert.ErrorIs(t, err, zormtenant.ErrCrossTenant)
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	setup(t, func(ctx context.Context, r zorm.Repository) {
+		ctx = zormtenant.Context(ctx, acme)
+
+		tx, err := r.Begin(ctx)
+		require.NoError(t, err)
+
+		require.NoError(t, zorm.Put(ctx, tx, []*zormtest.User{{FirstName: "Bugs"}}, zorm.PutOptions{}))
+
+		err = zorm.Put(ctx, tx, []*zormtest.User{{ID: "2", FirstName: "Stolen"}}, zorm.PutOptions{})
+		assert.ErrorIs(t, err, zormtenant.ErrCrossTenant)
+
+		require.NoError(t, tx.Commit())
+
+		count, err := zorm.Count[zormtest.User](ctx, r, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+}
+
+func TestRequiresTenant(t *testing.T) {
+	setup(t, func(ctx context.Context, r zorm.Repository) {
+		acmeCtx := zormtenant.Context(ctx, acme)
+
+		users := make([]*zormtest.User, 0, 10)
+		err := zorm.Find(ctx, r, &users, zorm.FindOptions{})
+		assert.ErrorIs(t, err, zormtenant.ErrNoTenant)
+
+		err = zorm.Put(ctx, r, []*zormtest.User{{FirstName: "Bugs"}}, zorm.PutOptions{})
+		assert.ErrorIs(t, err, zormtenant.ErrNoTenant)
+
+		_, err = zorm.DeleteWhere[zormtest.User](ctx, r, nil, zorm.DeleteWhereOptions{})
+		assert.ErrorIs(t, err, zormtenant.ErrNoTenant)
+
+		_, err = zorm.UpdateWhere[zormtest.User](ctx, r, nil, map[string]any{"FirstName": "Bugs"})
+		assert.ErrorIs(t, err, zormtenant.ErrNoTenant)
+
+		_, err = zorm.UpdateWhere[zormtest.User](acmeCtx, r, nil, map[string]any{"AccountID": dunder})
+		assert.ErrorIs(t, err, zormtenant.ErrCrossTenant)
+
+		_, err = zorm.DeleteWhere[zormtest.User](acmeCtx, r, nil, zorm.DeleteWhereOptions{})
+		assert.Error(t, err)
+
+		count, err := zorm.Count[zormtest.User](zormtenant.Context(ctx, dunder), r, nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count, "nothing was deleted")
+
+		_, err = zorm.Count[zormtest.UserAddress](acmeCtx, r, nil)
+		assert.ErrorContains(t, err, "has no tenant scope")
+	})
+}
@@ -0,0 +1,136 @@
+package zormtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milagre/zote/go/zelement/zelem"
+	"github.com/milagre/zote/go/zorm"
+)
+
+func RunAggregateTests(t *testing.T, setup SetupFunc) {
+	t.Helper()
+
+	t.Run("CountAccounts", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			count, err := zorm.Count[Account](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 3, count)
+		})
+	})
+
+	t.Run("CountUsersByRelationField", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			count, err := zorm.Count[User](ctx, r, zelem.Eq(zelem.Field("Account.Company"), zelem.Value("Acme, Inc.")))
+			require.NoError(t, err)
+			assert.Equal(t, 1, count)
+		})
+	})
+
+	t.Run("CountAccountsByToManyRelationField", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			// Dunder Mifflin matches through two auths, but is only counted once
+			count, err := zorm.Count[Account](ctx, r, zelem.Or(
+				zelem.Eq(zelem.Field("Users.Auths.Provider"), zelem.Value("password")),
+				zelem.Eq(zelem.Field("Users.Auths.Provider"), zelem.Value("passkey")),
+			))
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+		})
+	})
+
+	t.Run("ExistsUser", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			exists, err := zorm.Exists[User](ctx, r, zelem.Eq(zelem.Field("FirstName"), zelem.Value("Dora")))
+			require.NoError(t, err)
+			assert.True(t, exists)
+
+			exists, err = zorm.Exists[User](ctx, r, zelem.Eq(zelem.Field("FirstName"), zelem.Value("Bugs")))
+			require.NoError(t, err)
+			assert.False(t, exists)
+		})
+	})
+
+	t.Run("AggregateUsersGroupedIntoStruct", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			type result struct {
+				FirstName string
+				Auths     int
+			}
+
+			var results []result
+			err := zorm.Aggregate[User](ctx, r, &results, zorm.AggregateOptions{
+				GroupBy: []string{"FirstName"},
+				Aggregates: []zorm.Aggregation{
+					{Func: zorm.AggregateCount, Field: "Auths.ID", As: "Auths"},
+				},
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, []result{
+				{FirstName: "Daffy", Auths: 2},
+				{FirstName: "Dora", Auths: 0},
+				{FirstName: "Dwight", Auths: 2},
+			}, results)
+		})
+	})
+
+	t.Run("AggregateUsersByRelationPath", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			type result struct {
+				AccountCompany string
+				Users          int
+			}
+
+			var results []*result
+			err := zorm.Aggregate[User](ctx, r, &results, zorm.AggregateOptions{
+				Where:   zelem.Eq(zelem.Field("Auths.Provider"), zelem.Value("password")),
+				GroupBy: []string{"Account.Company"},
+				Aggregates: []zorm.Aggregation{
+					{Func: zorm.AggregateCount, As: "Users"},
+				},
+			})
+			require.NoError(t, err)
+
+			require.Len(t, results, 2)
+			assert.Equal(t, &result{AccountCompany: "Acme, Inc.", Users: 1}, results[0])
+			assert.Equal(t, &result{AccountCompany: "Dunder Mifflin", Users: 1}, results[1])
+		})
+	})
+
+	t.Run("AggregateAccountsIntoMap", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			var results []map[string]any
+			err := zorm.Aggregate[Account](ctx, r, &results, zorm.AggregateOptions{
+				Aggregates: []zorm.Aggregation{
+					{Func: zorm.AggregateCount, As: "Total"},
+					{Func: zorm.AggregateMin, Field: "Company", As: "First"},
+					{Func: zorm.AggregateMax, Field: "Company", As: "Last"},
+				},
+			})
+			require.NoError(t, err)
+
+			require.Len(t, results, 1)
+			assert.EqualValues(t, 3, results[0]["Total"])
+			assert.Equal(t, "Acme, Inc.", results[0]["First"])
+			assert.Equal(t, "Explorers, LLC", results[0]["Last"])
+		})
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/milagre/zote/go/zelement"
@@ -82,4 +83,284 @@ func RunDeleteTests(t *testing.T, setup SetupFunc) {
 		})
 	})
 
+	t.Run("DeleteAccountWithNestedRelations", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			obj := &Account{ID: "1"}
+			err := zorm.Delete(ctx, r, []*Account{obj}, zorm.DeleteOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{
+						"Users": zorm.Relation{
+							Include: zorm.Include{
+								Relations: zorm.Relations{
+									"Auths":   zorm.Relation{},
+									"Address": zorm.Relation{},
+								},
+							},
+						},
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			// The account's user, its auths and its address are gone
+			exists, err := zorm.Exists[User](ctx, r, zelem.Eq(zelem.Field("AccountID"), zelem.Value("1")))
+			require.NoError(t, err)
+			require.False(t, exists)
+
+			exists, err = zorm.Exists[UserAuth](ctx, r, zelem.Eq(zelem.Field("UserID"), zelem.Value("1")))
+			require.NoError(t, err)
+			require.False(t, exists)
+
+			exists, err = zorm.Exists[UserAddress](ctx, r, zelem.Eq(zelem.Field("ID"), zelem.Value("1")))
+			require.NoError(t, err)
+			require.False(t, exists)
+
+			// Everything belonging to other accounts is untouched
+			count, err := zorm.Count[User](ctx, r, nil)
+			require.NoError(t, err)
+			require.Equal(t, 2, count)
+
+			count, err = zorm.Count[UserAuth](ctx, r, nil)
+			require.NoError(t, err)
+			require.Equal(t, 2, count)
+
+			count, err = zorm.Count[UserAddress](ctx, r, nil)
+			require.NoError(t, err)
+			require.Equal(t, 1, count)
+		})
+	})
+
+	t.Run("DeleteUserWithFilteredRelation", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			obj := &User{ID: "2"}
+			err := zorm.Delete(ctx, r, []*User{obj}, zorm.DeleteOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{
+						"Auths": zorm.Relation{
+							Where: zelem.Eq(zelem.Field("Provider"), zelem.Value("password")),
+						},
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			// Only the auth matching the relation filter was deleted
+			auths := make([]*UserAuth, 0, 2)
+			err = zorm.Find(ctx, r, &auths, zorm.FindOptions{
+				Where: zelem.Eq(zelem.Field("UserID"), zelem.Value("2")),
+			})
+			require.NoError(t, err)
+			require.Len(t, auths, 1)
+			require.Equal(t, "passkey", auths[0].Provider)
+		})
+	})
+
+	t.Run("DeleteUsersWhere", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			count, err := zorm.DeleteWhere[User](ctx, r, zelem.Eq(zelem.Field("FirstName"), zelem.Value("Dora")), zorm.DeleteWhereOptions{})
+			require.NoError(t, err)
+			require.Equal(t, 1, count)
+
+			remaining, err := zorm.Count[User](ctx, r, nil)
+			require.NoError(t, err)
+			require.Equal(t, 2, remaining)
+		})
+	})
+
+	t.Run("DeleteUsersWhereRelationField", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			count, err := zorm.DeleteWhere[User](ctx, r, zelem.Eq(zelem.Field("Auths.Provider"), zelem.Value("password")), zorm.DeleteWhereOptions{})
+			require.NoError(t, err)
+			require.Equal(t, 2, count)
+
+			results := make([]*User, 0, 3)
+			err = zorm.Find(ctx, r, &results, zorm.FindOptions{})
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			require.Equal(t, "Dora", results[0].FirstName)
+		})
+	})
+
+	t.Run("DeleteWhereRequiresClause", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			_, err := zorm.DeleteWhere[User](ctx, r, nil, zorm.DeleteWhereOptions{})
+			require.Error(t, err)
+		})
+	})
+
+	// Soft delete tests
+
+	t.Run("DeleteUserAuthSoftDeletes", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			err := zorm.Delete(ctx, r, []*UserAuth{{ID: "1"}}, zorm.DeleteOptions{})
+			require.NoError(t, err)
+
+			err = zorm.Get(ctx, r, []*UserAuth{{ID: "1"}}, zorm.GetOptions{})
+			require.ErrorIs(t, err, zorm.ErrNotFound)
+
+			verify := &UserAuth{ID: "1"}
+			err = zorm.Get(ctx, r, []*UserAuth{verify}, zorm.GetOptions{IncludeDeleted: true})
+			require.NoError(t, err)
+			assert.NotNil(t, verify.Deleted)
+
+			count, err := zorm.Count[UserAuth](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 3, count)
+		})
+	})
+
+	t.Run("DeleteUserAuthAlreadyDeletedNotFound", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			err := zorm.Delete(ctx, r, []*UserAuth{{ID: "5"}}, zorm.DeleteOptions{})
+			require.ErrorIs(t, err, zorm.ErrNotFound)
+		})
+	})
+
+	t.Run("DeleteUserAuthHardDelete", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			// Hard deletes purge live and soft deleted rows alike
+			err := zorm.Delete(ctx, r, []*UserAuth{{ID: "1"}, {ID: "5"}}, zorm.DeleteOptions{HardDelete: true})
+			require.NoError(t, err)
+
+			err = zorm.Get(ctx, r, []*UserAuth{{ID: "1"}}, zorm.GetOptions{IncludeDeleted: true})
+			require.ErrorIs(t, err, zorm.ErrNotFound)
+			err = zorm.Get(ctx, r, []*UserAuth{{ID: "5"}}, zorm.GetOptions{IncludeDeleted: true})
+			require.ErrorIs(t, err, zorm.ErrNotFound)
+		})
+	})
+
+	t.Run("DeleteUserWithAuthsSoftDeletesAuths", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			err := zorm.Delete(ctx, r, []*User{{ID: "1"}}, zorm.DeleteOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{
+						"Auths": zorm.Relation{},
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			auths := make([]*UserAuth, 0, 2)
+			err = zorm.Find(ctx, r, &auths, zorm.FindOptions{
+				Where:          zelem.Eq(zelem.Field("UserID"), zelem.Value("1")),
+				IncludeDeleted: true,
+			})
+			require.NoError(t, err)
+			require.Len(t, auths, 2)
+			for _, auth := range auths {
+				assert.NotNil(t, auth.Deleted)
+			}
+		})
+	})
+
+	t.Run("DeleteUserAuthsWhereSoftDeletes", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			// Dora's password auth is already deleted, so it isn't counted
+			count, err := zorm.DeleteWhere[UserAuth](ctx, r, zelem.Eq(zelem.Field("Provider"), zelem.Value("password")), zorm.DeleteWhereOptions{})
+			require.NoError(t, err)
+			require.Equal(t, 2, count)
+
+			remaining, err := zorm.Count[UserAuth](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 2, remaining)
+
+			auths := make([]*UserAuth, 0, 5)
+			err = zorm.Find(ctx, r, &auths, zorm.FindOptions{IncludeDeleted: true})
+			require.NoError(t, err)
+			assert.Len(t, auths, 5)
+		})
+	})
+
+	t.Run("DeleteUserAuthsWhereHardDeletes", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			// Dora's already deleted password auth is removed too
+			count, err := zorm.DeleteWhere[UserAuth](ctx, r, zelem.Eq(zelem.Field("Provider"), zelem.Value("password")), zorm.DeleteWhereOptions{
+				HardDelete: true,
+			})
+			require.NoError(t, err)
+			require.Equal(t, 3, count)
+
+			auths := make([]*UserAuth, 0, 5)
+			err = zorm.Find(ctx, r, &auths, zorm.FindOptions{IncludeDeleted: true})
+			require.NoError(t, err)
+			assert.Len(t, auths, 2)
+		})
+	})
+
+	t.Run("DeleteUserGroupWithMembersAborts", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			err := zorm.Delete(ctx, r, []*UserGroup{{ID: "1"}}, zorm.DeleteOptions{})
+			require.ErrorIs(t, err, ErrGroupHasMembers)
+
+			count, err := zorm.Count[UserGroup](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+		})
+	})
+
+	t.Run("DeleteUserGroupWithoutMembers", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			obj := &UserGroup{Name: "Support"}
+			err := zorm.Put(ctx, r, []*UserGroup{obj}, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			err = zorm.Delete(ctx, r, []*UserGroup{{ID: obj.ID}}, zorm.DeleteOptions{})
+			require.NoError(t, err)
+
+			count, err := zorm.Count[UserGroup](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+		})
+	})
+
+	t.Run("DeleteUserWithGroupsKeepsGroups", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			err := zorm.Delete(ctx, r, []*User{{ID: "1"}}, zorm.DeleteOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{
+						"Auths":  zorm.Relation{},
+						"Groups": zorm.Relation{},
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			// Only the memberships were deleted along with the user
+			groups, err := zorm.Count[UserGroup](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 2, groups)
+
+			staff, err := zorm.Count[User](ctx, r, zelem.Eq(zelem.Field("Groups.Name"), zelem.Value("Staff")))
+			require.NoError(t, err)
+			assert.Equal(t, 1, staff)
+		})
+	})
 }
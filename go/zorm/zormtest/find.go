@@ -213,6 +213,188 @@ func RunFindTests(t *testing.T, setup SetupFunc) {
 		})
 	})
 
+	// Tests for cursor pagination
+
+	t.Run("FindAccountsByCursor", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			sorts := zelem.Sorts(zelem.Desc(zelem.Field("Company")))
+
+			var companies []string
+			var next zorm.Cursor
+			for page := 0; page < 5; page++ {
+				list := make([]*Account, 0, 2)
+				err := zorm.Find(ctx, r, &list, zorm.FindOptions{
+					Sort:  sorts,
+					After: next,
+					Next:  &next,
+				})
+				require.NoError(t, err)
+
+				for _, acc := range list {
+					companies = append(companies, acc.Company)
+				}
+
+				if next == "" {
+					break
+				}
+			}
+
+			assert.Equal(t, []string{"Explorers, LLC", "Dunder Mifflin", "Acme, Inc."}, companies)
+		})
+	})
+
+	t.Run("FindAccountsByCursorWithWhere", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			var next zorm.Cursor
+			list := make([]*Account, 0, 1)
+			err := zorm.Find(ctx, r, &list, zorm.FindOptions{
+				Where: zelem.Neq(zelem.Field("Company"), zelem.Value("Dunder Mifflin")),
+				Next:  &next,
+			})
+			require.NoError(t, err)
+			require.Len(t, list, 1)
+			assert.Equal(t, "1", list[0].ID)
+			require.NotEmpty(t, next)
+
+			list = make([]*Account, 0, 1)
+			err = zorm.Find(ctx, r, &list, zorm.FindOptions{
+				Where: zelem.Neq(zelem.Field("Company"), zelem.Value("Dunder Mifflin")),
+				After: next,
+				Next:  &next,
+			})
+			require.NoError(t, err)
+			require.Len(t, list, 1)
+			assert.Equal(t, "3", list[0].ID)
+		})
+	})
+
+	t.Run("FindAllAccounts", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			var ids []string
+			err := zorm.FindAll(ctx, r, 2, zorm.FindOptions{}, func(acc *Account) error {
+				ids = append(ids, acc.ID)
+				return nil
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, []string{"1", "2", "3"}, ids)
+		})
+	})
+
+	t.Run("FindAccountsByCursorRejectsNullableSorts", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			var next zorm.Cursor
+			list := make([]*Account, 0, 2)
+			err := zorm.Find(ctx, r, &list, zorm.FindOptions{
+				Sort: zelem.Sorts(zelem.Asc(zelem.Field("Modified"))),
+				Next: &next,
+			})
+			require.Error(t, err)
+			assert.ErrorContains(t, err, "nullable field Modified")
+		})
+	})
+
+	t.Run("FindAllUsersByOffset", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			var names []string
+			err := zorm.FindAll(ctx, r, 2, zorm.FindOptions{
+				Sort: zelem.Sorts(zelem.Asc(zelem.Field("Account.Company")), zelem.Asc(zelem.Field("ID"))),
+			}, func(u *User) error {
+				names = append(names, u.FirstName)
+				return nil
+			})
+			require.NoError(t, err, "relation sorts are paginated by offset")
+
+			var count int
+			count, err = zorm.Count[User](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Len(t, names, count)
+		})
+	})
+
+	t.Run("IterateUsersWithRelations", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			opts := zorm.FindOptions{
+				Sort: zelem.Sorts(zelem.Asc(zelem.Field("FirstName"))),
+				Include: zorm.Include{
+					Relations: zorm.Relations{
+						"Account": zorm.Relation{},
+						"Auths": zorm.Relation{
+							Sort: zelem.Sorts(zelem.Asc(zelem.Field("ID"))),
+						},
+						"Groups": zorm.Relation{
+							Sort: zelem.Sorts(zelem.Asc(zelem.Field("Name"))),
+						},
+					},
+				},
+			}
+
+			var users []*User
+			for user, err := range zorm.Iterate[User](ctx, r, opts) {
+				require.NoError(t, err)
+				users = append(users, user)
+			}
+
+			expected := make([]*User, 0, 10)
+			err := zorm.Find(ctx, r, &expected, opts)
+			require.NoError(t, err)
+
+			require.Len(t, users, 3)
+			assert.Equal(t, expected, users)
+			assert.Equal(t, "Daffy", users[0].FirstName)
+			assert.Len(t, users[0].Auths, 2)
+			assert.Equal(t, []string{"Admins", "Staff"}, groupNames(users[0].Groups))
+			assert.Empty(t, users[1].Groups)
+			assert.Equal(t, []string{"Staff"}, groupNames(users[2].Groups))
+		})
+	})
+
+	t.Run("IterateStopsEarly", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			var ids []string
+			for acc, err := range zorm.Iterate[Account](ctx, r, zorm.FindOptions{}) {
+				require.NoError(t, err)
+				ids = append(ids, acc.ID)
+				if len(ids) == 2 {
+					break
+				}
+			}
+			assert.Equal(t, []string{"1", "2"}, ids)
+
+			// The cursor was released
+			count, err := zorm.Count[Account](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 3, count)
+		})
+	})
+
+	t.Run("IterateRejectsOffset", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			var errs []error
+			for _, err := range zorm.Iterate[Account](ctx, r, zorm.FindOptions{Offset: 1}) {
+				errs = append(errs, err)
+			}
+			require.Len(t, errs, 1)
+			assert.Error(t, errs[0])
+		})
+	})
+
 	// Tests for relation-level Where and Sort
 
 	t.Run("FindUserFilteredRelation", func(t *testing.T) {
@@ -340,6 +522,24 @@ func RunFindTests(t *testing.T, setup SetupFunc) {
 			assert.True(t, foundUser2, "User 2 should be in results")
 		})
 	})
+
+	t.Run("FindUsersViaManyToManyRelation", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			list := make([]*User, 0, 3)
+			err := zorm.Find(ctx, r, &list, zorm.FindOptions{
+				Where: zelem.Eq(zelem.Field("Groups.Name"), zelem.Value("Admins")),
+			})
+			require.NoError(t, err)
+			require.Len(t, list, 1)
+			assert.Equal(t, "Daffy", list[0].FirstName)
+
+			count, err := zorm.Count[User](ctx, r, zelem.Eq(zelem.Field("Groups.Name"), zelem.Value("Staff")))
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+		})
+	})
 }
 
 // getMinUserAddressState returns the minimum (alphabetically first) State value
@@ -3,6 +3,7 @@ package zormtest
 import (
 	"context"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -253,4 +254,96 @@ func RunGetTests(t *testing.T, setup SetupFunc) {
 			}
 		})
 	})
+
+	t.Run("GetUserToManyRelationExcludesDeleted", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			opts := zorm.GetOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{
+						"Auths": zorm.Relation{},
+					},
+				},
+			}
+
+			// Dora's only auth was soft deleted
+			obj := &User{ID: "3"}
+			err := zorm.Get(ctx, r, []*User{obj}, opts)
+			require.NoError(t, err)
+			assert.Empty(t, obj.Auths)
+
+			opts.IncludeDeleted = true
+			err = zorm.Get(ctx, r, []*User{obj}, opts)
+			require.NoError(t, err)
+			require.Len(t, obj.Auths, 1)
+			assert.NotNil(t, obj.Auths[0].Deleted)
+		})
+	})
+
+	t.Run("GetDeletedUserAuthNotFound", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			auths := make([]*UserAuth, 0, 1)
+			err := zorm.Find(ctx, r, &auths, zorm.FindOptions{
+				Where:          zelem.Eq(zelem.Field("UserID"), zelem.Value("3")),
+				IncludeDeleted: true,
+			})
+			require.NoError(t, err)
+			require.Len(t, auths, 1)
+
+			obj := &UserAuth{ID: auths[0].ID}
+			err = zorm.Get(ctx, r, []*UserAuth{obj}, zorm.GetOptions{})
+			require.ErrorIs(t, err, zorm.ErrNotFound)
+
+			err = zorm.Get(ctx, r, []*UserAuth{obj}, zorm.GetOptions{IncludeDeleted: true})
+			require.NoError(t, err)
+			assert.Equal(t, "r3voked", obj.Data)
+		})
+	})
+
+	t.Run("GetUserManyToManyRelation", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			objs := []*User{{ID: "1"}, {ID: "3"}}
+			err := zorm.Get(ctx, r, objs, zorm.GetOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{
+						"Groups": zorm.Relation{},
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			assert.ElementsMatch(t, []string{"Admins", "Staff"}, groupNames(objs[0].Groups))
+			assert.Empty(t, objs[1].Groups)
+		})
+	})
+
+	t.Run("GetUserGroupsRunsAfterLoadHook", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			group := &UserGroup{ID: "1"}
+			err := zorm.Get(ctx, r, []*UserGroup{group}, zorm.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, "admins", group.Slug)
+
+			obj := &User{ID: "1"}
+			err = zorm.Get(ctx, r, []*User{obj}, zorm.GetOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{
+						"Groups": zorm.Relation{},
+					},
+				},
+			})
+			require.NoError(t, err)
+			require.Len(t, obj.Groups, 2)
+			for _, g := range obj.Groups {
+				assert.Equal(t, strings.ToLower(g.Name), g.Slug)
+			}
+		})
+	})
 }
@@ -1,10 +1,18 @@
 package zormtest
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"time"
+
+	"github.com/milagre/zote/go/zelement/zelem"
+	"github.com/milagre/zote/go/zorm"
 )
 
 type Account struct {
+	zorm.Tracker
+
 	ID       string
 	Created  time.Time
 	Modified *time.Time
@@ -16,6 +24,8 @@ type Account struct {
 }
 
 type User struct {
+	zorm.Tracker
+
 	ID       string
 	Created  time.Time
 	Modified *time.Time
@@ -28,22 +38,31 @@ type User struct {
 
 	Auths []*UserAuth
 
+	Groups []*UserGroup
+
 	FirstName string
 }
 
 type UserAuth struct {
+	zorm.Tracker
+
 	ID       string
 	Created  time.Time
 	Modified *time.Time
+	Deleted  *time.Time
 
 	UserID string
 	User   *User
 
 	Provider string
-	Data     string
+
+	// Data holds credentials, which are kept out of JSON
+	Data string `json:"-"`
 }
 
 type UserAddress struct {
+	zorm.Tracker
+
 	ID       string
 	Created  time.Time
 	Modified *time.Time
@@ -51,4 +70,53 @@ type UserAddress struct {
 	Street string
 	City   string
 	State  string
+
+	Version int
+}
+
+// UserGroup is mapped from its zorm tags rather than by hand
+type UserGroup struct {
+	zorm.Tracker
+
+	ID       string     `zorm:"id,pk,noinsert,noupdate,type=integer"`
+	Created  time.Time  `zorm:"created,autocreatetime"`
+	Modified *time.Time `zorm:"modified,noinsert,autoupdatetime"`
+
+	Name string `zorm:"name,unique=name"`
+
+	// Slug is derived from Name when loaded, and is not mapped
+	Slug string
+}
+
+func (g *UserGroup) TableName() string {
+	return "user_groups"
+}
+
+var (
+	ErrGroupNameRequired = errors.New("group name required")
+	ErrGroupHasMembers   = errors.New("group has members")
+)
+
+func (g *UserGroup) BeforePut(ctx context.Context, q zorm.Queryer) error {
+	g.Name = strings.TrimSpace(g.Name)
+	if g.Name == "" {
+		return ErrGroupNameRequired
+	}
+	return nil
+}
+
+func (g *UserGroup) BeforeDelete(ctx context.Context, q zorm.Queryer) error {
+	members, err := zorm.Count[User](ctx, q, zelem.Eq(zelem.Field("Groups.ID"), zelem.Value(g.ID)))
+	if err != nil {
+		return err
+	}
+	if members > 0 {
+		return ErrGroupHasMembers
+	}
+	return nil
+}
+
+func (g *UserGroup) AfterLoad(ctx context.Context, q zorm.Queryer) error {
+	g.Slug = strings.ReplaceAll(strings.ToLower(g.Name), " ", "-")
+	return nil
 }
@@ -2,7 +2,9 @@ package zormtest
 
 import (
 	"context"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -158,6 +160,561 @@ func RunPutTests(t *testing.T, setup SetupFunc) {
 		})
 	})
 
+	t.Run("PutAccountsMixedInsertAndUpdate", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			objs := []*Account{
+				{Company: "First New Co", ContactEmail: "first@new.example"},
+				{ID: "2", Company: "Dunder Mifflin Paper", ContactEmail: "michael@dundermifflin.example"},
+				{Company: "Second New Co", ContactEmail: "second@new.example"},
+				{Company: "Explorers, LLC", ContactEmail: "boots@explorers.test"},
+				{ID: "1", Company: "Acme Corp", ContactEmail: "wile@acme.example"},
+			}
+			err := zorm.Put(ctx, r, objs, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			// Generated keys are assigned to the matching models
+			assert.Equal(t, "First New Co", objs[0].Company)
+			assert.NotZero(t, objs[0].ID)
+			assert.Equal(t, "Second New Co", objs[2].Company)
+			assert.NotZero(t, objs[2].ID)
+			assert.NotEqual(t, objs[0].ID, objs[2].ID)
+
+			// Existing rows were updated in place, by primary and unique key
+			assert.Equal(t, "2", objs[1].ID)
+			assert.Equal(t, "Dunder Mifflin Paper", objs[1].Company)
+			assert.Equal(t, "3", objs[3].ID)
+			assert.Equal(t, "boots@explorers.test", objs[3].ContactEmail)
+			assert.Equal(t, "Acme Corp", objs[4].Company)
+			assert.Equal(t, "wile@acme.example", objs[4].ContactEmail)
+
+			verify := []*Account{{ID: objs[0].ID}, {ID: objs[2].ID}}
+			err = zorm.Get(ctx, r, verify, zorm.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, "first@new.example", verify[0].ContactEmail)
+			assert.Equal(t, "second@new.example", verify[1].ContactEmail)
+
+			count, err := zorm.Count[Account](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 5, count)
+		})
+	})
+
+	t.Run("PutAccountsWithNewUsers", func(t *testing.T) {
+		// Tests that related models of several parents are put together and
+		// each receives its own parent's key.
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			objs := []*Account{
+				{Company: "BatchCo A", Users: []*User{{FirstName: "A1"}, {FirstName: "A2"}}},
+				{Company: "BatchCo B", Users: []*User{{FirstName: "B1"}}},
+			}
+			err := zorm.Put(ctx, r, objs, zorm.PutOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{
+						"Users": zorm.Relation{},
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			for _, acc := range objs {
+				require.NotZero(t, acc.ID)
+				for _, user := range acc.Users {
+					assert.NotZero(t, user.ID)
+					assert.Equal(t, acc.ID, user.AccountID)
+				}
+			}
+
+			count, err := zorm.Count[User](ctx, r, zelem.Eq(zelem.Field("AccountID"), zelem.Value(objs[0].ID)))
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+		})
+	})
+
+	t.Run("PutAccountsOnConflictUpdate", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			objs := []*Account{
+				{Company: "Acme, Inc.", ContactEmail: "wile@acme.example"},
+				{Company: "Upsert Co", ContactEmail: "contact@upsert.example"},
+			}
+			err := zorm.Put(ctx, r, objs, zorm.PutOptions{
+				OnConflict: zorm.OnConflict{
+					Action: zorm.ConflictUpdate,
+					Key:    []string{"Company"},
+					Fields: zorm.Fields{"ContactEmail"},
+				},
+			})
+			require.NoError(t, err)
+
+			// The existing account kept its key and took the new email
+			assert.Equal(t, "1", objs[0].ID)
+			assert.Equal(t, "wile@acme.example", objs[0].ContactEmail)
+
+			assert.NotZero(t, objs[1].ID)
+			assert.Equal(t, "contact@upsert.example", objs[1].ContactEmail)
+
+			count, err := zorm.Count[Account](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 4, count)
+		})
+	})
+
+	t.Run("PutAccountsOnConflictIgnore", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			objs := []*Account{
+				{Company: "Dunder Mifflin", ContactEmail: "ignored@dundermifflin.example"},
+			}
+			err := zorm.Put(ctx, r, objs, zorm.PutOptions{
+				OnConflict: zorm.OnConflict{Action: zorm.ConflictIgnore, Key: []string{"Company"}},
+			})
+			require.NoError(t, err)
+
+			// The conflicting row is unchanged, and the model refreshed from it
+			assert.Equal(t, "2", objs[0].ID)
+			assert.Equal(t, "contact@dundermifflin.example", objs[0].ContactEmail)
+		})
+	})
+
+	t.Run("PutAccountsOnConflictRequiresKey", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			objs := []*Account{
+				{ContactEmail: "nobody@example.test"},
+			}
+			err := zorm.Put(ctx, r, objs, zorm.PutOptions{
+				OnConflict: zorm.OnConflict{Action: zorm.ConflictIgnore},
+			})
+			require.Error(t, err)
+		})
+	})
+
+	t.Run("PutAccountsOnConflictDefaultsToPrimaryKey", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			objs := []*Account{
+				{Company: "Dunder Mifflin", ContactEmail: "ignored@dundermifflin.example"},
+			}
+			err := zorm.Put(ctx, r, objs, zorm.PutOptions{
+				OnConflict: zorm.OnConflict{Action: zorm.ConflictIgnore},
+			})
+			require.Error(t, err, "the primary key isn't populated")
+		})
+	})
+
+	t.Run("PutAddressOnConflictUpdateIncrementsVersion", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			stale := &UserAddress{ID: "1"}
+			err := zorm.Get(ctx, r, []*UserAddress{stale}, zorm.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, 1, stale.Version)
+
+			upserted := &UserAddress{ID: "1", Street: "1 Upsert Way", City: "Looneyville", State: "AZ"}
+			err = zorm.Put(ctx, r, []*UserAddress{upserted}, zorm.PutOptions{
+				OnConflict: zorm.OnConflict{Action: zorm.ConflictUpdate},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, "Looneyville", upserted.City)
+			assert.Equal(t, 2, upserted.Version)
+
+			// stale was read before the upsert
+			stale.City = "Toontown"
+			err = zorm.Put(ctx, r, []*UserAddress{stale}, zorm.PutOptions{})
+			require.ErrorIs(t, err, zorm.ErrConflict)
+		})
+	})
+
+	// Optimistic locking tests
+
+	t.Run("PutAddressNewStartsAtVersionOne", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			obj := &UserAddress{
+				Street: "1 Infinite Loop",
+				City:   "Cupertino",
+				State:  "CA",
+			}
+			err := zorm.Put(ctx, r, []*UserAddress{obj}, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			assert.NotZero(t, obj.ID)
+			assert.Equal(t, 1, obj.Version)
+		})
+	})
+
+	t.Run("PutAddressIncrementsVersion", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			obj := &UserAddress{ID: "1"}
+			err := zorm.Get(ctx, r, []*UserAddress{obj}, zorm.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, 1, obj.Version)
+
+			obj.City = "Looneyville"
+			err = zorm.Put(ctx, r, []*UserAddress{obj}, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			assert.Equal(t, "Looneyville", obj.City)
+			assert.Equal(t, 2, obj.Version)
+		})
+	})
+
+	t.Run("PutAddressStaleVersionConflicts", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			first := &UserAddress{ID: "1"}
+			second := &UserAddress{ID: "1"}
+			err := zorm.Get(ctx, r, []*UserAddress{first}, zorm.GetOptions{})
+			require.NoError(t, err)
+			err = zorm.Get(ctx, r, []*UserAddress{second}, zorm.GetOptions{})
+			require.NoError(t, err)
+
+			first.City = "Looneyville"
+			err = zorm.Put(ctx, r, []*UserAddress{first}, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			// second was read before first was written
+			second.City = "Toontown"
+			err = zorm.Put(ctx, r, []*UserAddress{second}, zorm.PutOptions{})
+			require.ErrorIs(t, err, zorm.ErrConflict)
+
+			verify := &UserAddress{ID: "1"}
+			err = zorm.Get(ctx, r, []*UserAddress{verify}, zorm.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, "Looneyville", verify.City)
+			assert.Equal(t, 2, verify.Version)
+		})
+	})
+
+	t.Run("PutAddressesStaleVersionConflicts", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			objs := []*UserAddress{{ID: "1"}, {ID: "2"}}
+			err := zorm.Get(ctx, r, objs, zorm.GetOptions{})
+			require.NoError(t, err)
+
+			objs[0].City = "Looneyville"
+			objs[1].City = "Nashua"
+			objs[1].Version = 7
+			err = zorm.Put(ctx, r, objs, zorm.PutOptions{})
+			require.ErrorIs(t, err, zorm.ErrConflict)
+		})
+	})
+
+	t.Run("PutUserWithStaleAddressConflicts", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			opts := zorm.GetOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{
+						"Address": zorm.Relation{},
+					},
+				},
+			}
+
+			obj := &User{ID: "1"}
+			err := zorm.Get(ctx, r, []*User{obj}, opts)
+			require.NoError(t, err)
+			require.NotNil(t, obj.Address)
+
+			obj.Address.City = "Looneyville"
+			obj.Address.Version = 7
+			err = zorm.Put(ctx, r, []*User{obj}, zorm.PutOptions{
+				Include:    opts.Include,
+				GetOptions: opts,
+			})
+			require.ErrorIs(t, err, zorm.ErrConflict)
+		})
+	})
+
+	// Many-to-many tests
+
+	t.Run("PutUserGroupsSyncsMemberships", func(t *testing.T) {
+		// Daffy is in Admins and Staff. Putting Staff and a new group removes
+		// the Admins membership without deleting the group.
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			include := zorm.Include{
+				Relations: zorm.Relations{
+					"Groups": zorm.Relation{},
+				},
+			}
+
+			obj := &User{ID: "1"}
+			err := zorm.Get(ctx, r, []*User{obj}, zorm.GetOptions{Include: include})
+			require.NoError(t, err)
+
+			staff := obj.Groups[slices.IndexFunc(obj.Groups, func(g *UserGroup) bool { return g.Name == "Staff" })]
+			obj.Groups = []*UserGroup{staff, {Name: "Support"}}
+			err = zorm.Put(ctx, r, []*User{obj}, zorm.PutOptions{Include: include})
+			require.NoError(t, err)
+
+			assert.ElementsMatch(t, []string{"Staff", "Support"}, groupNames(obj.Groups))
+
+			groups, err := zorm.Count[UserGroup](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 3, groups)
+
+			admins, err := zorm.Count[User](ctx, r, zelem.Eq(zelem.Field("Groups.Name"), zelem.Value("Admins")))
+			require.NoError(t, err)
+			assert.Equal(t, 0, admins)
+		})
+	})
+
+	t.Run("PutUsersSharingNewGroup", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			shared := &UserGroup{Name: "Support"}
+			objs := []*User{
+				{ID: "2", AccountID: "2", FirstName: "Dwight", Groups: []*UserGroup{shared}},
+				{ID: "3", AccountID: "3", FirstName: "Dora", Groups: []*UserGroup{shared}},
+			}
+			err := zorm.Put(ctx, r, objs, zorm.PutOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{
+						"Groups": zorm.Relation{},
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			for _, obj := range objs {
+				assert.Equal(t, []string{"Support"}, groupNames(obj.Groups))
+			}
+
+			count, err := zorm.Count[User](ctx, r, zelem.Eq(zelem.Field("Groups.Name"), zelem.Value("Support")))
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+		})
+	})
+
+	// Lifecycle hook tests
+
+	t.Run("PutUserGroupRunsBeforePutHook", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			obj := &UserGroup{Name: "  Support "}
+			err := zorm.Put(ctx, r, []*UserGroup{obj}, zorm.PutOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, "Support", obj.Name)
+			assert.Equal(t, "support", obj.Slug)
+
+			err = zorm.Put(ctx, r, []*UserGroup{{Name: " "}}, zorm.PutOptions{})
+			require.ErrorIs(t, err, ErrGroupNameRequired)
+
+			count, err := zorm.Count[UserGroup](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 3, count)
+		})
+	})
+
+	t.Run("PutUserWithInvalidGroupAborts", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			obj := &User{ID: "3", AccountID: "3", FirstName: "Dora", Groups: []*UserGroup{{Name: "Support"}, {Name: ""}}}
+			err := zorm.Put(ctx, r, []*User{obj}, zorm.PutOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{
+						"Groups": zorm.Relation{},
+					},
+				},
+			})
+			require.ErrorIs(t, err, ErrGroupNameRequired)
+
+			count, err := zorm.Count[UserGroup](ctx, r, nil)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+		})
+	})
+
+	// Timestamp tests
+
+	t.Run("PutUserGroupStampsTimes", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			// Databases may round stamps to the second
+			before := time.Now().Add(-time.Second)
+
+			obj := &UserGroup{Name: "Support"}
+			err := zorm.Put(ctx, r, []*UserGroup{obj}, zorm.PutOptions{})
+			require.NoError(t, err)
+			assert.WithinRange(t, obj.Created, before, time.Now().Add(time.Second))
+			assert.Nil(t, obj.Modified)
+
+			created := obj.Created
+			obj.Name = "Helpdesk"
+			err = zorm.Put(ctx, r, []*UserGroup{obj}, zorm.PutOptions{
+				Include: zorm.Include{Fields: zorm.Fields{"Name"}},
+			})
+			require.NoError(t, err)
+			assert.True(t, created.Equal(obj.Created))
+			require.NotNil(t, obj.Modified)
+			assert.WithinRange(t, *obj.Modified, before, time.Now().Add(time.Second))
+		})
+	})
+
+	t.Run("PutUserGroupsBatchStampsModified", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			objs := []*UserGroup{{ID: "1"}, {ID: "2"}}
+			err := zorm.Get(ctx, r, objs, zorm.GetOptions{})
+			require.NoError(t, err)
+
+			for _, obj := range objs {
+				obj.Name += " Team"
+			}
+
+			before := time.Now().Add(-time.Second)
+			err = zorm.Put(ctx, r, objs, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			for _, obj := range objs {
+				require.NotNil(t, obj.Modified)
+				assert.WithinRange(t, *obj.Modified, before, time.Now().Add(time.Second))
+			}
+		})
+	})
+
+	// Change tracking tests
+
+	t.Run("PutUnchangedUserGroupSkipsUpdate", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			obj := &UserGroup{ID: "1"}
+			err := zorm.Get(ctx, r, []*UserGroup{obj}, zorm.GetOptions{})
+			require.NoError(t, err)
+
+			err = zorm.Put(ctx, r, []*UserGroup{obj}, zorm.PutOptions{})
+			require.NoError(t, err)
+			assert.Nil(t, obj.Modified)
+
+			obj.Name = "Owners"
+			err = zorm.Put(ctx, r, []*UserGroup{obj}, zorm.PutOptions{})
+			require.NoError(t, err)
+			assert.NotNil(t, obj.Modified)
+		})
+	})
+
+	t.Run("PutOnlyWritesChangedFields", func(t *testing.T) {
+		// Two copies of the same user each change a different field. Neither
+		// put overwrites the other's change with a stale value.
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			a := &User{ID: "1"}
+			b := &User{ID: "1"}
+			err := zorm.Get(ctx, r, []*User{a}, zorm.GetOptions{})
+			require.NoError(t, err)
+			err = zorm.Get(ctx, r, []*User{b}, zorm.GetOptions{})
+			require.NoError(t, err)
+
+			a.FirstName = "Duffy"
+			err = zorm.Put(ctx, r, []*User{a}, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			b.AccountID = "2"
+			err = zorm.Put(ctx, r, []*User{b}, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			assert.Equal(t, "Duffy", b.FirstName)
+			assert.Equal(t, "2", b.AccountID)
+		})
+	})
+
+	t.Run("PutBatchOnlyWritesEachRowsChangedFields", func(t *testing.T) {
+		// Rows batched into one put change different fields, and don't
+		// overwrite a concurrent change to a field they didn't change.
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			users := []*User{{ID: "1"}, {ID: "2"}}
+			err := zorm.Get(ctx, r, users, zorm.GetOptions{})
+			require.NoError(t, err)
+
+			concurrent := &User{ID: "1"}
+			err = zorm.Get(ctx, r, []*User{concurrent}, zorm.GetOptions{})
+			require.NoError(t, err)
+			concurrent.AccountID = "3"
+			err = zorm.Put(ctx, r, []*User{concurrent}, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			users[0].FirstName = "Duffy"
+			users[1].AccountID = "3"
+			err = zorm.Put(ctx, r, users, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			reloaded := []*User{{ID: "1"}, {ID: "2"}}
+			err = zorm.Get(ctx, r, reloaded, zorm.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, "Duffy", reloaded[0].FirstName)
+			assert.Equal(t, "3", reloaded[0].AccountID)
+			assert.Equal(t, "3", reloaded[1].AccountID)
+		})
+	})
+
+	t.Run("ChangesReportsModifiedFields", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			_, tracked := zorm.Changes(&User{ID: "1"})
+			assert.False(t, tracked)
+
+			obj := &User{ID: "1"}
+			err := zorm.Get(ctx, r, []*User{obj}, zorm.GetOptions{
+				Include: zorm.Include{
+					Relations: zorm.Relations{
+						"Auths": zorm.Relation{},
+					},
+				},
+			})
+			require.NoError(t, err)
+
+			changes, tracked := zorm.Changes(obj)
+			assert.True(t, tracked)
+			assert.Empty(t, changes)
+
+			obj.FirstName = "Duffy"
+			obj.Auths[0].Data = "changed"
+
+			changes, _ = zorm.Changes(obj)
+			assert.Equal(t, []zorm.Change{{Field: "FirstName", From: "Daffy", To: "Duffy"}}, changes)
+
+			changes, tracked = zorm.Changes(obj.Auths[0])
+			assert.True(t, tracked)
+			require.Len(t, changes, 1)
+			assert.Equal(t, "Data", changes[0].Field)
+
+			// Saving makes the model clean again
+			err = zorm.Put(ctx, r, []*User{obj}, zorm.PutOptions{})
+			require.NoError(t, err)
+
+			changes, _ = zorm.Changes(obj)
+			assert.Empty(t, changes)
+		})
+	})
+
 	// Orphan deletion tests for to-many relations
 
 	t.Run("PutToManyRelationSync", func(t *testing.T) {
@@ -204,6 +761,30 @@ func RunPutTests(t *testing.T, setup SetupFunc) {
 			})
 		})
 
+		t.Run("UserAuthsOrphansAreSoftDeleted", func(t *testing.T) {
+			// User 1 has auths: password (id=1), oauth2 (id=2)
+			// Orphaned auths are soft deleted, so they remain with Deleted set.
+			setup(t, func(ctx context.Context, r zorm.Repository) {
+				ctx = makeContext(ctx)
+
+				user := getUserWithAuths(ctx, t, r, "1")
+				user.Auths = []*UserAuth{}
+				err := zorm.Put(ctx, r, []*User{user}, zorm.PutOptions{Include: authsInclude(nil)})
+				require.NoError(t, err)
+
+				auths := make([]*UserAuth, 0, 2)
+				err = zorm.Find(ctx, r, &auths, zorm.FindOptions{
+					Where:          zelem.Eq(zelem.Field("UserID"), zelem.Value("1")),
+					IncludeDeleted: true,
+				})
+				require.NoError(t, err)
+				require.Len(t, auths, 2)
+				for _, auth := range auths {
+					assert.NotNil(t, auth.Deleted)
+				}
+			})
+		})
+
 		t.Run("UserAuthsUpdatesExistingAndDeletesOrphans", func(t *testing.T) {
 			// User 1 has auths: password (id=1), oauth2 (id=2)
 			// Put with updated password auth and new sso auth - oauth2 should be deleted.
@@ -293,6 +874,79 @@ func RunPutTests(t *testing.T, setup SetupFunc) {
 			})
 		})
 	})
+
+	t.Run("UpdateUsersWhereRelationField", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			count, err := zorm.UpdateWhere[User](ctx, r,
+				zelem.Eq(zelem.Field("Account.Company"), zelem.Value("Dunder Mifflin")),
+				map[string]any{"FirstName": "Jim"},
+			)
+			require.NoError(t, err)
+			require.Equal(t, 1, count)
+
+			user := &User{ID: "2"}
+			err = zorm.Get(ctx, r, []*User{user}, zorm.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, "Jim", user.FirstName)
+
+			unchanged := &User{ID: "1"}
+			err = zorm.Get(ctx, r, []*User{unchanged}, zorm.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, "Daffy", unchanged.FirstName)
+		})
+	})
+
+	t.Run("UpdateAccountsWhereFromField", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			count, err := zorm.UpdateWhere[Account](ctx, r,
+				zelem.Eq(zelem.Field("ID"), zelem.Value("3")),
+				map[string]any{"Company": zelem.Field("ContactEmail")},
+			)
+			require.NoError(t, err)
+			require.Equal(t, 1, count)
+
+			acc := &Account{ID: "3"}
+			err = zorm.Get(ctx, r, []*Account{acc}, zorm.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, "dora@explorers.test", acc.Company)
+		})
+	})
+
+	t.Run("UpdateUserGroupsWhereStampsModified", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			before := time.Now().Add(-time.Second)
+			count, err := zorm.UpdateWhere[UserGroup](ctx, r,
+				zelem.Eq(zelem.Field("Name"), zelem.Value("Staff")),
+				map[string]any{"Name": "Employees"},
+			)
+			require.NoError(t, err)
+			assert.Equal(t, 1, count)
+
+			obj := &UserGroup{ID: "2"}
+			err = zorm.Get(ctx, r, []*UserGroup{obj}, zorm.GetOptions{})
+			require.NoError(t, err)
+			require.NotNil(t, obj.Modified)
+			assert.WithinRange(t, *obj.Modified, before, time.Now().Add(time.Second))
+		})
+	})
+
+	t.Run("UpdateWhereRejectsUnmappedField", func(t *testing.T) {
+		setup(t, func(ctx context.Context, r zorm.Repository) {
+			ctx = makeContext(ctx)
+
+			_, err := zorm.UpdateWhere[Account](ctx, r,
+				zelem.Eq(zelem.Field("ID"), zelem.Value("3")),
+				map[string]any{"Users": nil},
+			)
+			require.Error(t, err)
+		})
+	})
 }
 
 // getUserWithAuths fetches user by ID with Auths relation included.
@@ -323,3 +977,12 @@ func authsByProvider(auths []*UserAuth) map[string]*UserAuth {
 	}
 	return result
 }
+
+// groupNames returns the names of the given groups.
+func groupNames(groups []*UserGroup) []string {
+	names := make([]string, 0, len(groups))
+	for _, g := range groups {
+		names = append(names, g.Name)
+	}
+	return names
+}
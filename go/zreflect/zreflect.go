@@ -50,3 +50,16 @@ func IsString(t reflect.Type) bool {
 	}
 	return false
 }
+
+// IsNullable reports whether values of t may be nil or, like sql.NullString,
+// hold no value.
+func IsNullable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Map:
+		return true
+	case reflect.Struct:
+		valid, ok := t.FieldByName("Valid")
+		return ok && valid.Type.Kind() == reflect.Bool
+	}
+	return false
+}
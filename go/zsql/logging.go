@@ -53,6 +53,12 @@ type LoggingTransaction struct {
 	logger zlog.Logger
 }
 
+func (q LoggingTransaction) Begin(ctx context.Context, opts *sql.TxOptions) (Transaction, error) {
+	tx, err := logBegin(ctx, opts, q.Transaction)
+
+	return LoggingTransaction{tx, zlog.FromContext(ctx)}, err
+}
+
 func (q LoggingTransaction) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
 	return logQuery(ctx, query, args, q.Transaction)
 }
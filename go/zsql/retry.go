@@ -0,0 +1,97 @@
+package zsql
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/milagre/zote/go/zstats"
+)
+
+// RetryOptions configures how BeginWithRetry retries transactions.
+type RetryOptions struct {
+	// Attempts is the most times the transaction is run, defaulting to 3.
+	Attempts int
+
+	// Backoff is the delay before the first retry, doubling before each retry
+	// after it, defaulting to 10ms. Each delay is jittered to between half and
+	// all of it, so that transactions that deadlocked each other don't collide
+	// again when retried.
+	Backoff time.Duration
+
+	// MaxBackoff caps the delay before a retry, defaulting to 1s.
+	MaxBackoff time.Duration
+}
+
+func (o RetryOptions) withDefaults() RetryOptions {
+	if o.Attempts <= 0 {
+		o.Attempts = 3
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 10 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = time.Second
+	}
+	return o
+}
+
+func (o RetryOptions) delay(retry int) time.Duration {
+	d := o.Backoff
+	for i := 1; i < retry && d < o.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, o.MaxBackoff)
+
+	return d/2 + rand.N(d/2+1)
+}
+
+// Retry runs a transaction by calling run until it succeeds, fails with an
+// error retryable doesn't report retryable, or has run opts.Attempts times,
+// backing off between attempts as opts describes. Each retry is counted in
+// the "retry" stat of stats, and transactions failing after every attempt in
+// "retries_exhausted". BeginWithRetry, and zorm's, retry through it.
+func Retry(ctx context.Context, opts RetryOptions, stats zstats.Stats, retryable func(error) bool, run func() error) error {
+	opts = opts.withDefaults()
+
+	for attempt := 1; ; attempt++ {
+		err := run()
+		if err == nil || !retryable(err) {
+			return err
+		}
+
+		if attempt >= opts.Attempts {
+			stats.Count("retries_exhausted", 1)
+			return fmt.Errorf("transaction failed after %d attempts: %w", attempt, err)
+		}
+
+		stats.Count("retry", 1)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting to retry transaction: %w: %w", ctx.Err(), err)
+		case <-time.After(opts.delay(attempt)):
+		}
+	}
+}
+
+// BeginWithRetry runs cb in a transaction like Begin, running it again in a
+// new transaction when it fails with an error the driver reports retryable,
+// such as a deadlock. cb must be safe to run more than once. Each retry is
+// counted in the "sql.transaction.retry" stat, and transactions failing after
+// every attempt in "sql.transaction.retries_exhausted".
+//
+// Transactions nested in another aren't retried, as the errors that abort them
+// abort the outer transaction; retry the outer transaction instead.
+func BeginWithRetry(ctx context.Context, db Transactor, opts RetryOptions, cb func(context.Context, Transaction) error) error {
+	if _, nested := db.(TransactionEnder); nested {
+		return Begin(ctx, db, cb)
+	}
+
+	stats := zstats.FromContext(ctx).WithPrefix("sql.transaction").WithTag("driver", db.Driver().Name())
+
+	return Retry(ctx, opts, stats, db.Driver().IsRetryableError, func() error {
+		return Begin(ctx, db, cb)
+	})
+}
@@ -0,0 +1,226 @@
+package zmigrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/stoewer/go-strcase"
+
+	"github.com/milagre/zote/go/zcmd"
+	"github.com/milagre/zote/go/zcmd/zaspect"
+	"github.com/milagre/zote/go/zlog"
+	"github.com/milagre/zote/go/zsql"
+)
+
+var _ zcmd.Aspect = Aspect{}
+
+// Connector is implemented by database aspects, such as zmysql.Aspect and
+// zpostgres.Aspect, opening the connection migrations run over.
+type Connector interface {
+	zcmd.Aspect
+	Connection(env zcmd.Env, options zsql.Options) (zsql.Connection, error)
+}
+
+type Aspect struct {
+	name    string
+	db      Connector
+	options zsql.Options
+}
+
+// NewAspect returns an aspect configuring migrations over the database
+// configured by db, connecting with options, or the driver's defaults when
+// nil. Its flags are prefixed with name, when set.
+//
+// MySQL migrations holding several statements need the multiStatements option:
+//
+//	zmigrate.NewAspect("", db, zmysql.DefaultOptions().Merge(zsql.Options{"multiStatements": true}))
+func NewAspect(name string, db Connector, options zsql.Options) Aspect {
+	return Aspect{
+		name:    name,
+		db:      db,
+		options: options,
+	}
+}
+
+func (a Aspect) Apply(c zcmd.Configurable) {
+	a.db.Apply(c)
+	c.AddString(a.table()).Default(DefaultTable)
+}
+
+// Migrator opens the configured database and returns a Migrator applying
+// migrations over it. The connection is closed by the returned func.
+func (a Aspect) Migrator(env zcmd.Env, migrations []Migration) (*Migrator, func() error, error) {
+	conn, err := a.db.Connection(env, a.options)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connecting to database: %w", err)
+	}
+
+	m, err := New(conn, env.String(a.table()), migrations)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	return m, conn.Close, nil
+}
+
+// Commands returns the migrate-up, migrate-down, migrate-status and
+// migrate-create commands over the migrations loaded from fsys and funcs,
+// connecting to db with options as NewAspect does. See Load.
+//
+// migrate-up applies pending migrations, all of them unless a number of
+// steps is given, and migrate-down reverts the latest, one unless a number of
+// steps is given. migrate-create writes empty up and down files for a new
+// migration to a directory, which should be the one embedded as fsys.
+func Commands(name string, db Connector, options zsql.Options, fsys fs.FS, funcs ...Migration) map[string]zcmd.Command {
+	a := NewAspect(name, db, options)
+
+	return map[string]zcmd.Command{
+		"migrate-up": {
+			Config: stepsAspect{Aspect: a, defaultSteps: 0},
+			Run: a.run(fsys, funcs, func(ctx context.Context, env zcmd.Env, m *Migrator) error {
+				applied, err := m.Up(ctx, env.Int(a.steps()))
+				if err != nil {
+					return err
+				}
+				zlog.FromContext(ctx).Infof("Applied %d migrations.", len(applied))
+				return nil
+			}),
+		},
+		"migrate-down": {
+			Config: stepsAspect{Aspect: a, defaultSteps: 1},
+			Run: a.run(fsys, funcs, func(ctx context.Context, env zcmd.Env, m *Migrator) error {
+				reverted, err := m.Down(ctx, env.Int(a.steps()))
+				if err != nil {
+					return err
+				}
+				zlog.FromContext(ctx).Infof("Reverted %d migrations.", len(reverted))
+				return nil
+			}),
+		},
+		"migrate-status": {
+			Config: a,
+			Run: a.run(fsys, funcs, func(ctx context.Context, env zcmd.Env, m *Migrator) error {
+				statuses, err := m.Status(ctx)
+				if err != nil {
+					return err
+				}
+				return printStatus(os.Stdout, statuses)
+			}),
+		},
+		"migrate-create": {
+			Config: createAspect{a},
+			Run:    a.create,
+		},
+	}
+}
+
+func (a Aspect) run(fsys fs.FS, funcs []Migration, cb func(context.Context, zcmd.Env, *Migrator) error) zcmd.RunFunc {
+	return func(ctx context.Context, env zcmd.Env) error {
+		migrations, err := Load(fsys, funcs...)
+		if err != nil {
+			return err
+		}
+
+		m, closeConn, err := a.Migrator(env, migrations)
+		if err != nil {
+			return err
+		}
+		defer closeConn()
+
+		return cb(ctx, env, m)
+	}
+}
+
+func (a Aspect) create(ctx context.Context, env zcmd.Env) error {
+	dir := env.String(a.dir())
+	base := time.Now().UTC().Format("20060102150405") + "_" + strcase.SnakeCase(env.String(a.migration()))
+
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return fmt.Errorf("creating migrations directory: %w", err)
+	}
+
+	for _, direction := range []string{"up", "down"} {
+		filename := filepath.Join(dir, base+"."+direction+".sql")
+
+		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return fmt.Errorf("creating migration file: %w", err)
+		}
+		f.Close()
+
+		zlog.FromContext(ctx).Infof("Created %s.", filename)
+	}
+
+	return nil
+}
+
+func printStatus(out io.Writer, statuses []Status) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED")
+
+	for _, s := range statuses {
+		state, applied := "pending", ""
+		if s.Applied != nil {
+			state, applied = "applied", s.Applied.Format(time.RFC3339)
+		}
+		switch {
+		case s.Unknown:
+			state = "unknown"
+		case s.Modified:
+			state = "modified"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Migration.Version, s.Migration.Name, state, applied)
+	}
+
+	return w.Flush()
+}
+
+// stepsAspect adds the number of migrations to apply or revert, defaulting to
+// defaultSteps.
+type stepsAspect struct {
+	Aspect
+	defaultSteps int
+}
+
+func (a stepsAspect) Apply(c zcmd.Configurable) {
+	a.Aspect.Apply(c)
+	c.AddInt(a.steps()).Default(a.defaultSteps)
+}
+
+// createAspect configures migrate-create, which doesn't connect to the
+// database.
+type createAspect struct {
+	Aspect
+}
+
+func (a createAspect) Apply(c zcmd.Configurable) {
+	c.AddString(a.dir()).Default("migrations")
+	c.AddString(a.migration())
+}
+
+// Option constructors
+
+func (a Aspect) table() string {
+	return zaspect.Prefix(a.name, "migrate-table")
+}
+
+func (a Aspect) steps() string {
+	return zaspect.Prefix(a.name, "migrate-steps")
+}
+
+func (a Aspect) dir() string {
+	return zaspect.Prefix(a.name, "migrate-dir")
+}
+
+func (a Aspect) migration() string {
+	return zaspect.Prefix(a.name, "migrate-name")
+}
@@ -0,0 +1,490 @@
+// Package zmigrate applies versioned schema migrations over a zsql.Connection.
+//
+// # Defining Migrations
+//
+// Migrations are loaded from SQL files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql, typically embedded in the binary, and may be
+// mixed with migrations written as Go functions:
+//
+//	//go:embed migrations/*.sql
+//	var files embed.FS
+//
+//	sub, _ := fs.Sub(files, "migrations")
+//	migrations, err := zmigrate.Load(sub, zmigrate.Migration{
+//		Version: 20261017120000,
+//		Name:    "backfill_emails",
+//		Up:      backfillEmails,
+//	})
+//
+// # Applying Migrations
+//
+//	m, err := zmigrate.New(conn, zmigrate.DefaultTable, migrations)
+//	if err != nil {
+//		return err
+//	}
+//
+//	applied, err := m.Up(ctx, 0)
+//
+// Each migration runs in its own transaction, together with the row recording
+// it in the migrations table. MySQL commits DDL statements implicitly, so a
+// failing MySQL migration may be partially applied. MySQL connections must
+// also enable the multiStatements option for files holding several
+// statements; see NewAspect.
+//
+// Applied migrations are recorded with a checksum of their SQL, and Up refuses
+// to run when an applied migration has since been modified. A lock row keeps
+// concurrent deploys from migrating at the same time; a lock left behind by a
+// crashed process is released with Unlock.
+//
+// # Commands
+//
+// Commands returns the migrate-up, migrate-down, migrate-status and
+// migrate-create zcmd commands, configured through a database aspect such as
+// zmysql.Aspect or zpostgres.Aspect.
+package zmigrate
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/milagre/zote/go/zlog"
+	"github.com/milagre/zote/go/zsql"
+)
+
+// DefaultTable is the conventional name of the table recording applied
+// migrations. Its lock is kept in a table of the same name suffixed _lock.
+const DefaultTable = "schema_migrations"
+
+var (
+	ErrLocked   = errors.New("migrations locked by another process")
+	ErrModified = errors.New("applied migration modified")
+)
+
+// Func applies or reverts a migration within its transaction.
+type Func func(ctx context.Context, tx zsql.Transaction) error
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      Func
+
+	// Down reverts Up. Migrations without one can't be rolled back.
+	Down Func
+
+	// Checksum identifies the contents of the migration. It is computed for
+	// migrations loaded from files; Go migrations may leave it empty, and
+	// are then never reported as modified.
+	Checksum string
+}
+
+// Status is the state of a migration in the database.
+type Status struct {
+	Migration Migration
+
+	// Applied is when the migration was applied, or nil when it is pending.
+	Applied *time.Time
+
+	// Modified reports an applied migration whose checksum no longer matches
+	// the one recorded when it was applied.
+	Modified bool
+
+	// Unknown reports an applied version with no migration defined, such as
+	// one applied by a newer release. Only its Version and Name are set.
+	Unknown bool
+}
+
+// Exec returns a Func executing query.
+func Exec(query string) Func {
+	return func(ctx context.Context, tx zsql.Transaction) error {
+		_, _, err := zsql.Exec(ctx, tx, query, nil)
+		return err
+	}
+}
+
+var filePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Load reads the SQL migrations in the root of fsys and adds funcs to them.
+// Files that aren't named as migrations are ignored.
+func Load(fsys fs.FS, funcs ...Migration) ([]Migration, error) {
+	var result []Migration
+
+	if fsys != nil {
+		entries, err := fs.ReadDir(fsys, ".")
+		if err != nil {
+			return nil, fmt.Errorf("reading migrations: %w", err)
+		}
+
+		type files struct {
+			name     string
+			up, down []byte
+		}
+		byVersion := map[int64]*files{}
+
+		for _, e := range entries {
+			match := filePattern.FindStringSubmatch(e.Name())
+			if e.IsDir() || match == nil {
+				continue
+			}
+
+			version, err := strconv.ParseInt(match[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("migration %s: parsing version: %w", e.Name(), err)
+			}
+
+			f, ok := byVersion[version]
+			if !ok {
+				f = &files{name: match[2]}
+				byVersion[version] = f
+			} else if f.name != match[2] {
+				return nil, fmt.Errorf("migration version %d named both %s and %s", version, f.name, match[2])
+			}
+
+			content, err := fs.ReadFile(fsys, path.Clean(e.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("reading migration %s: %w", e.Name(), err)
+			}
+
+			if match[3] == "up" {
+				f.up = content
+			} else {
+				f.down = content
+			}
+		}
+
+		for version, f := range byVersion {
+			if f.up == nil {
+				return nil, fmt.Errorf("migration %d_%s has no up file", version, f.name)
+			}
+
+			sum := sha256.New()
+			sum.Write(f.up)
+			sum.Write([]byte{0})
+			sum.Write(f.down)
+
+			m := Migration{
+				Version:  version,
+				Name:     f.name,
+				Up:       Exec(string(f.up)),
+				Checksum: hex.EncodeToString(sum.Sum(nil)),
+			}
+			if f.down != nil {
+				m.Down = Exec(string(f.down))
+			}
+
+			result = append(result, m)
+		}
+	}
+
+	result = append(result, funcs...)
+	slices.SortFunc(result, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return result, nil
+}
+
+type Migrator struct {
+	conn       zsql.Connection
+	table      string
+	migrations []Migration
+}
+
+// New returns a Migrator applying migrations over conn, recording them in
+// table.
+func New(conn zsql.Connection, table string, migrations []Migration) (*Migrator, error) {
+	migrations = slices.Clone(migrations)
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	var errs []error
+	for i, m := range migrations {
+		if i > 0 && migrations[i-1].Version == m.Version {
+			errs = append(errs, fmt.Errorf("migration version %d defined more than once", m.Version))
+		}
+		if m.Up == nil {
+			errs = append(errs, fmt.Errorf("migration %d_%s has no up", m.Version, m.Name))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid migrations: %w", errors.Join(errs...))
+	}
+
+	return &Migrator{
+		conn:       conn,
+		table:      table,
+		migrations: migrations,
+	}, nil
+}
+
+// Status returns the state of every migration, and of applied versions that
+// aren't defined, ordered by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	err := m.createTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.status(ctx)
+}
+
+// Up applies up to steps pending migrations in version order, including
+// pending migrations older than the latest applied one. A steps of zero or
+// less applies every pending migration. It returns the migrations applied,
+// which are partial when an error is returned.
+func (m *Migrator) Up(ctx context.Context, steps int) ([]Migration, error) {
+	var applied []Migration
+
+	err := m.locked(ctx, func(statuses []Status) error {
+		for _, s := range statuses {
+			if s.Modified {
+				return fmt.Errorf("migration %d_%s: %w", s.Migration.Version, s.Migration.Name, ErrModified)
+			}
+		}
+
+		for _, s := range statuses {
+			if s.Applied != nil || s.Unknown {
+				continue
+			}
+			if steps > 0 && len(applied) == steps {
+				break
+			}
+
+			mig := s.Migration
+			err := zsql.Begin(ctx, m.conn, func(ctx context.Context, tx zsql.Transaction) error {
+				if err := mig.Up(ctx, tx); err != nil {
+					return err
+				}
+
+				_, _, err := zsql.Exec(ctx, tx,
+					fmt.Sprintf(
+						"INSERT INTO %s (%s, %s, %s, %s) VALUES (?, ?, ?, ?)",
+						m.escapedTable(),
+						m.escapeColumn("version"), m.escapeColumn("name"), m.escapeColumn("checksum"), m.escapeColumn("applied"),
+					),
+					[]any{mig.Version, mig.Name, mig.Checksum, time.Now().UTC()},
+				)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("applying migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+
+			zlog.FromContext(ctx).Infof("Applied migration %d_%s.", mig.Version, mig.Name)
+			applied = append(applied, mig)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts up to steps applied migrations, latest version first. A steps
+// of zero or less reverts every applied migration. It returns the migrations
+// reverted, which are partial when an error is returned.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+
+	err := m.locked(ctx, func(statuses []Status) error {
+		for _, s := range slices.Backward(statuses) {
+			if s.Applied == nil {
+				continue
+			}
+			if steps > 0 && len(reverted) == steps {
+				break
+			}
+
+			mig := s.Migration
+			switch {
+			case s.Unknown:
+				return fmt.Errorf("reverting migration %d_%s: migration not defined", mig.Version, mig.Name)
+			case mig.Down == nil:
+				return fmt.Errorf("reverting migration %d_%s: migration has no down", mig.Version, mig.Name)
+			}
+
+			err := zsql.Begin(ctx, m.conn, func(ctx context.Context, tx zsql.Transaction) error {
+				if err := mig.Down(ctx, tx); err != nil {
+					return err
+				}
+
+				_, _, err := zsql.Exec(ctx, tx,
+					fmt.Sprintf("DELETE FROM %s WHERE %s = ?", m.escapedTable(), m.escapeColumn("version")),
+					[]any{mig.Version},
+				)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s: %w", mig.Version, mig.Name, err)
+			}
+
+			zlog.FromContext(ctx).Infof("Reverted migration %d_%s.", mig.Version, mig.Name)
+			reverted = append(reverted, mig)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Unlock releases the migration lock regardless of which process holds it.
+func (m *Migrator) Unlock(ctx context.Context) error {
+	err := m.createTables(ctx)
+	if err != nil {
+		return err
+	}
+
+	return m.unlock(ctx)
+}
+
+// locked runs cb with the current statuses while holding the migration lock.
+func (m *Migrator) locked(ctx context.Context, cb func([]Status) error) (err error) {
+	err = m.createTables(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = zsql.Exec(ctx, m.conn,
+		fmt.Sprintf(
+			"INSERT INTO %s (%s, %s) VALUES (?, ?)",
+			m.escapedLockTable(), m.escapeColumn("id"), m.escapeColumn("locked"),
+		),
+		[]any{1, time.Now().UTC()},
+	)
+	if err != nil {
+		if m.conn.Driver().IsConflictError(err) {
+			return ErrLocked
+		}
+		return fmt.Errorf("acquiring migration lock: %w", err)
+	}
+
+	defer func() {
+		if e := m.unlock(ctx); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	statuses, err := m.status(ctx)
+	if err != nil {
+		return err
+	}
+
+	return cb(statuses)
+}
+
+func (m *Migrator) unlock(ctx context.Context) error {
+	_, _, err := zsql.Exec(ctx, m.conn,
+		fmt.Sprintf("DELETE FROM %s", m.escapedLockTable()),
+		nil,
+	)
+	if err != nil {
+		return fmt.Errorf("releasing migration lock: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Migrator) createTables(ctx context.Context) error {
+	d := m.conn.Driver()
+
+	statements := []string{
+		fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s (\n\t%s %s NOT NULL,\n\t%s %s NOT NULL,\n\t%s %s NOT NULL,\n\t%s %s NOT NULL,\n\tPRIMARY KEY (%s)\n)",
+			m.escapedTable(),
+			m.escapeColumn("version"), d.ColumnDefinition(zsql.ColumnTypeInteger, false),
+			m.escapeColumn("name"), d.ColumnDefinition(zsql.ColumnTypeText, false),
+			m.escapeColumn("checksum"), d.ColumnDefinition(zsql.ColumnTypeText, false),
+			m.escapeColumn("applied"), d.ColumnDefinition(zsql.ColumnTypeTime, false),
+			m.escapeColumn("version"),
+		),
+		fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS %s (\n\t%s %s NOT NULL,\n\t%s %s NOT NULL,\n\tPRIMARY KEY (%s)\n)",
+			m.escapedLockTable(),
+			m.escapeColumn("id"), d.ColumnDefinition(zsql.ColumnTypeInteger, false),
+			m.escapeColumn("locked"), d.ColumnDefinition(zsql.ColumnTypeTime, false),
+			m.escapeColumn("id"),
+		),
+	}
+
+	for _, s := range statements {
+		if _, _, err := zsql.Exec(ctx, m.conn, s, nil); err != nil {
+			return fmt.Errorf("creating migration tables: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) status(ctx context.Context) ([]Status, error) {
+	type record struct {
+		name     string
+		checksum string
+		applied  time.Time
+	}
+	records := map[int64]record{}
+
+	_, err := zsql.Query(ctx, m.conn, func(scan zsql.ScanFunc) error {
+		var version int64
+		var r record
+		if err := scan(&version, &r.name, &r.checksum, &r.applied); err != nil {
+			return err
+		}
+		records[version] = r
+		return nil
+	}, fmt.Sprintf(
+		"SELECT %s, %s, %s, %s FROM %s",
+		m.escapeColumn("version"), m.escapeColumn("name"), m.escapeColumn("checksum"), m.escapeColumn("applied"),
+		m.escapedTable(),
+	), nil)
+	if err != nil {
+		return nil, fmt.Errorf("reading applied migrations: %w", err)
+	}
+
+	result := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Migration: mig}
+		if r, ok := records[mig.Version]; ok {
+			s.Applied = &r.applied
+			s.Modified = mig.Checksum != "" && r.checksum != "" && mig.Checksum != r.checksum
+			delete(records, mig.Version)
+		}
+		result = append(result, s)
+	}
+
+	for version, r := range records {
+		result = append(result, Status{
+			Migration: Migration{Version: version, Name: r.name},
+			Applied:   &r.applied,
+			Unknown:   true,
+		})
+	}
+
+	slices.SortFunc(result, func(a, b Status) int {
+		return cmp.Compare(a.Migration.Version, b.Migration.Version)
+	})
+
+	return result, nil
+}
+
+func (m *Migrator) escapedTable() string {
+	return m.conn.Driver().EscapeTable(m.table)
+}
+
+func (m *Migrator) escapedLockTable() string {
+	return m.conn.Driver().EscapeTable(m.table + "_lock")
+}
+
+func (m *Migrator) escapeColumn(c string) string {
+	return m.conn.Driver().EscapeColumn(c)
+}
@@ -0,0 +1,240 @@
+package zmigrate
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/milagre/zote/go/zlog"
+	"github.com/milagre/zote/go/zsql"
+	"github.com/milagre/zote/go/zsql/zsqlite3"
+)
+
+var files = fstest.MapFS{
+	"1_create_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT NOT NULL);")},
+	"1_create_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+	"2_add_color.up.sql":        {Data: []byte("ALTER TABLE widgets ADD COLUMN color TEXT;\nINSERT INTO widgets (name, color) VALUES ('gear', 'red');")},
+	"2_add_color.down.sql":      {Data: []byte("ALTER TABLE widgets DROP COLUMN color;")},
+	"README.md":                 {Data: []byte("not a migration")},
+}
+
+var seed = Migration{
+	Version: 3,
+	Name:    "seed_widgets",
+	Up:      Exec("INSERT INTO widgets (name) VALUES ('sprocket')"),
+	Down:    Exec("DELETE FROM widgets WHERE name = 'sprocket'"),
+}
+
+func setup(t *testing.T) (context.Context, zsql.Connection) {
+	t.Helper()
+
+	conn, err := zsqlite3.Open(zsqlite3.FileConnectionString(filepath.Join(t.TempDir(), "test.db"), zsqlite3.DefaultOptions()), 1)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return zlog.Context(context.Background(), zlog.New(zlog.LevelWarn)), conn
+}
+
+func newMigrator(t *testing.T, conn zsql.Connection, fsys fstest.MapFS) *Migrator {
+	t.Helper()
+
+	migrations, err := Load(fsys, seed)
+	require.NoError(t, err)
+
+	m, err := New(conn, DefaultTable, migrations)
+	require.NoError(t, err)
+
+	return m
+}
+
+func widgets(t *testing.T, ctx context.Context, conn zsql.Connection) int {
+	t.Helper()
+
+	var count int
+	_, err := zsql.Query(ctx, conn, func(scan zsql.ScanFunc) error {
+		return scan(&count)
+	}, "SELECT COUNT(*) FROM widgets", nil)
+	require.NoError(t, err)
+
+	return count
+}
+
+func versions(statuses []Status) map[int64]string {
+	result := map[int64]string{}
+	for _, s := range statuses {
+		switch {
+		case s.Unknown:
+			result[s.Migration.Version] = "unknown"
+		case s.Modified:
+			result[s.Migration.Version] = "modified"
+		case s.Applied != nil:
+			result[s.Migration.Version] = "applied"
+		default:
+			result[s.Migration.Version] = "pending"
+		}
+	}
+	return result
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(files, seed)
+	require.NoError(t, err)
+	require.Len(t, migrations, 3)
+
+	assert.Equal(t, int64(1), migrations[0].Version)
+	assert.Equal(t, "create_widgets", migrations[0].Name)
+	assert.NotEmpty(t, migrations[0].Checksum)
+	assert.NotNil(t, migrations[0].Down)
+	assert.Equal(t, "add_color", migrations[1].Name)
+	assert.Equal(t, "seed_widgets", migrations[2].Name)
+
+	t.Run("MissingUp", func(t *testing.T) {
+		_, err := Load(fstest.MapFS{"4_orphan.down.sql": {}})
+		assert.ErrorContains(t, err, "migration 4_orphan has no up file")
+	})
+
+	t.Run("DuplicateVersion", func(t *testing.T) {
+		_, err := New(nil, DefaultTable, append(migrations, Migration{Version: 1, Up: seed.Up}))
+		assert.ErrorContains(t, err, "migration version 1 defined more than once")
+	})
+}
+
+func TestUpDown(t *testing.T) {
+	ctx, conn := setup(t)
+	m := newMigrator(t, conn, files)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]string{1: "pending", 2: "pending", 3: "pending"}, versions(statuses))
+
+	applied, err := m.Up(ctx, 2)
+	require.NoError(t, err)
+	assert.Len(t, applied, 2)
+	assert.Equal(t, 1, widgets(t, ctx, conn))
+
+	applied, err = m.Up(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, applied, 1)
+	assert.Equal(t, int64(3), applied[0].Version)
+	assert.Equal(t, 2, widgets(t, ctx, conn))
+
+	statuses, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]string{1: "applied", 2: "applied", 3: "applied"}, versions(statuses))
+
+	reverted, err := m.Down(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	assert.Equal(t, int64(3), reverted[0].Version)
+	assert.Equal(t, 1, widgets(t, ctx, conn))
+
+	reverted, err = m.Down(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, reverted, 2)
+
+	statuses, err = m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]string{1: "pending", 2: "pending", 3: "pending"}, versions(statuses))
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	ctx, conn := setup(t)
+
+	broken := fstest.MapFS{
+		"1_create_widgets.up.sql": files["1_create_widgets.up.sql"],
+		"2_broken.up.sql":         {Data: []byte("INSERT INTO widgets (name) VALUES ('gear'); INSERT INTO missing (id) VALUES (1);")},
+	}
+
+	m := newMigrator(t, conn, broken)
+	applied, err := m.Up(ctx, 0)
+	assert.ErrorContains(t, err, "applying migration 2_broken")
+	assert.Len(t, applied, 1)
+	assert.Equal(t, 0, widgets(t, ctx, conn))
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]string{1: "applied", 2: "pending", 3: "pending"}, versions(statuses))
+}
+
+func TestModified(t *testing.T) {
+	ctx, conn := setup(t)
+
+	_, err := newMigrator(t, conn, files).Up(ctx, 1)
+	require.NoError(t, err)
+
+	modified := fstest.MapFS{}
+	for name, f := range files {
+		modified[name] = f
+	}
+	modified["1_create_widgets.up.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY);")}
+	delete(modified, "2_add_color.up.sql")
+	delete(modified, "2_add_color.down.sql")
+
+	m := newMigrator(t, conn, modified)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]string{1: "modified", 3: "pending"}, versions(statuses))
+
+	_, err = m.Up(ctx, 0)
+	assert.ErrorIs(t, err, ErrModified)
+}
+
+func TestUnknown(t *testing.T) {
+	ctx, conn := setup(t)
+
+	_, err := newMigrator(t, conn, files).Up(ctx, 0)
+	require.NoError(t, err)
+
+	m, err := New(conn, DefaultTable, nil)
+	require.NoError(t, err)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]string{1: "unknown", 2: "unknown", 3: "unknown"}, versions(statuses))
+
+	_, err = m.Down(ctx, 1)
+	assert.ErrorContains(t, err, "reverting migration 3_seed_widgets: migration not defined")
+}
+
+func TestLock(t *testing.T) {
+	ctx, conn := setup(t)
+	m := newMigrator(t, conn, files)
+
+	var inner error
+	err := m.locked(ctx, func([]Status) error {
+		_, inner = m.Up(ctx, 0)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.ErrorIs(t, inner, ErrLocked)
+
+	applied, err := m.Up(ctx, 0)
+	require.NoError(t, err)
+	assert.Len(t, applied, 3)
+}
+
+func TestPrintStatus(t *testing.T) {
+	ctx, conn := setup(t)
+	m := newMigrator(t, conn, files)
+
+	_, err := m.Up(ctx, 1)
+	require.NoError(t, err)
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, printStatus(&out, statuses))
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 4)
+	assert.Regexp(t, `^VERSION\s+NAME\s+STATUS\s+APPLIED$`, string(lines[0]))
+	assert.Regexp(t, `^1\s+create_widgets\s+applied\s+\d{4}-`, string(lines[1]))
+	assert.Regexp(t, `^2\s+add_color\s+pending\s*$`, string(lines[2]))
+}
@@ -1,6 +1,7 @@
 package zmysql
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -56,11 +57,129 @@ func (d driver) PrepareMethod(m string) *string {
 	return result
 }
 
+func (d driver) Rebind(query string) string {
+	return query
+}
+
+func (d driver) SupportsReturning() bool {
+	return false
+}
+
+func (d driver) MaxParameters() int {
+	return 65535
+}
+
+// UpsertClause ignores conflictColumns, as MySQL resolves a conflict on any
+// unique key. Skipped rows assign the first conflict column to itself, rather
+// than using INSERT IGNORE, which also discards unrelated errors.
+func (d driver) UpsertClause(table string, conflictColumns []string, updateColumns []string, incrementColumns []string) string {
+	if len(updateColumns) == 0 {
+		c := d.EscapeColumn(conflictColumns[0])
+		return "ON DUPLICATE KEY UPDATE " + c + "=" + c
+	}
+
+	assignments := make([]string, 0, len(updateColumns))
+	for _, c := range updateColumns {
+		assignments = append(assignments, fmt.Sprintf("%s=VALUES(%s)", d.EscapeColumn(c), d.EscapeColumn(c)))
+	}
+	for _, c := range incrementColumns {
+		assignments = append(assignments, fmt.Sprintf("%s=%s+1", d.EscapeColumn(c), d.EscapeColumn(c)))
+	}
+
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(assignments, ", ")
+}
+
 func (d driver) IsConflictError(err error) bool {
 	var mysqlErr *mysql.MySQLError
 	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1062
 }
 
+// Deadlocks (1213) and lock wait timeouts (1205) both fail the statement
+// waiting on a lock held by another transaction.
+func (d driver) IsRetryableError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && (mysqlErr.Number == 1213 || mysqlErr.Number == 1205)
+}
+
+// Text is rendered as VARCHAR(255) so that it may be indexed; use a Bytes
+// column, or write the DDL by hand, for longer text.
+func (d driver) ColumnDefinition(t zsql.ColumnType, autoIncrement bool) string {
+	if autoIncrement {
+		return "BIGINT AUTO_INCREMENT PRIMARY KEY"
+	}
+
+	switch t {
+	case zsql.ColumnTypeInteger:
+		return "BIGINT"
+	case zsql.ColumnTypeFloat:
+		return "DOUBLE"
+	case zsql.ColumnTypeBoolean:
+		return "BOOLEAN"
+	case zsql.ColumnTypeBytes:
+		return "BLOB"
+	case zsql.ColumnTypeTime:
+		return "DATETIME(6)"
+	case zsql.ColumnTypeDate:
+		return "DATE"
+	case zsql.ColumnTypeJSON:
+		return "JSON"
+	default:
+		return "VARCHAR(255)"
+	}
+}
+
+// Time columns hold microseconds, and MySQL requires their default to match
+// their precision.
+func (d driver) CurrentTimeDefault() string {
+	return "CURRENT_TIMESTAMP(6)"
+}
+
+// The primary key is listed among the unique indexes as PRIMARY.
+func (d driver) DescribeTable(ctx context.Context, q zsql.Queryer, table string) (*zsql.TableSchema, error) {
+	var schema zsql.TableSchema
+	found, err := zsql.Query(ctx, q, func(scan zsql.ScanFunc) error {
+		var c zsql.ColumnSchema
+		var nullable string
+		if err := scan(&c.Name, &nullable); err != nil {
+			return err
+		}
+		c.Nullable = nullable == "YES"
+		schema.Columns = append(schema.Columns, c)
+		return nil
+	}, "SELECT column_name, is_nullable FROM information_schema.columns "+
+		"WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ordinal_position", []any{table})
+	if err != nil {
+		return nil, fmt.Errorf("reading columns of %s: %w", table, err)
+	}
+	if !found {
+		return nil, nil
+	}
+
+	var names []string
+	indexes := map[string][]string{}
+	_, err = zsql.Query(ctx, q, func(scan zsql.ScanFunc) error {
+		var index, column string
+		if err := scan(&index, &column); err != nil {
+			return err
+		}
+		if _, ok := indexes[index]; !ok {
+			names = append(names, index)
+		}
+		indexes[index] = append(indexes[index], column)
+		return nil
+	}, "SELECT index_name, column_name FROM information_schema.statistics "+
+		"WHERE table_schema = DATABASE() AND table_name = ? AND non_unique = 0 ORDER BY index_name, seq_in_index", []any{table})
+	if err != nil {
+		return nil, fmt.Errorf("reading unique indexes of %s: %w", table, err)
+	}
+
+	for _, name := range names {
+		schema.UniqueIndexes = append(schema.UniqueIndexes, indexes[name])
+	}
+
+	return &schema, nil
+}
+
 func DefaultOptions() zsql.Options {
 	return zsql.Options{
 		"collation":       "utf8mb4_bin",
@@ -0,0 +1,258 @@
+package zpostgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/milagre/zote/go/zelement/zmethod"
+	"github.com/milagre/zote/go/zsql"
+)
+
+var Driver zsql.Driver = driver{}
+
+type driver struct{}
+
+func (d driver) Name() string {
+	return "postgres"
+}
+
+func (d driver) EscapeTable(t string) string {
+	return pq.QuoteIdentifier(t)
+}
+
+func (d driver) EscapeColumn(c string) string {
+	return pq.QuoteIdentifier(c)
+}
+
+func (d driver) EscapeTableColumn(t string, c string) string {
+	return d.EscapeTable(t) + "." + d.EscapeColumn(c)
+}
+
+func (d driver) NullSafeEqualityOperator() string {
+	return "IS NOT DISTINCT FROM"
+}
+
+func (d driver) EscapeFulltextSearch(search string) string {
+	return search
+}
+
+func (d driver) PrepareMethod(m string) *string {
+	var result *string
+
+	switch zmethod.Method(m) {
+	case zmethod.Match:
+		v := "to_tsvector(%s) @@ plainto_tsquery(%s)"
+		result = &v
+	case zmethod.Contains:
+		v := "strpos(%s, %s) > 0"
+		result = &v
+	}
+
+	return result
+}
+
+// Rebind replaces each ? placeholder outside of quoted strings and identifiers
+// with its positional $n equivalent.
+func (d driver) Rebind(query string) string {
+	var sb strings.Builder
+	sb.Grow(len(query) + 16)
+
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			sb.WriteByte('$')
+			sb.WriteString(strconv.Itoa(n))
+			continue
+		}
+		sb.WriteByte(c)
+	}
+
+	return sb.String()
+}
+
+func (d driver) SupportsReturning() bool {
+	return true
+}
+
+func (d driver) MaxParameters() int {
+	return 65535
+}
+
+func (d driver) UpsertClause(table string, conflictColumns []string, updateColumns []string, incrementColumns []string) string {
+	target := make([]string, 0, len(conflictColumns))
+	for _, c := range conflictColumns {
+		target = append(target, d.EscapeColumn(c))
+	}
+
+	if len(updateColumns) == 0 {
+		return "ON CONFLICT (" + strings.Join(target, ", ") + ") DO NOTHING"
+	}
+
+	assignments := make([]string, 0, len(updateColumns))
+	for _, c := range updateColumns {
+		assignments = append(assignments, fmt.Sprintf("%s=excluded.%s", d.EscapeColumn(c), d.EscapeColumn(c)))
+	}
+	for _, c := range incrementColumns {
+		assignments = append(assignments, fmt.Sprintf("%s=%s+1", d.EscapeColumn(c), d.EscapeTableColumn(table, c)))
+	}
+
+	return "ON CONFLICT (" + strings.Join(target, ", ") + ") DO UPDATE SET " + strings.Join(assignments, ", ")
+}
+
+func (d driver) IsConflictError(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// Serialization failures (40001), deadlocks (40P01) and lock timeouts
+// (55P03) abort transactions that may succeed once run again.
+func (d driver) IsRetryableError(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	switch pqErr.Code {
+	case "40001", "40P01", "55P03":
+		return true
+	}
+	return false
+}
+
+func (d driver) ColumnDefinition(t zsql.ColumnType, autoIncrement bool) string {
+	if autoIncrement {
+		return "BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY"
+	}
+
+	switch t {
+	case zsql.ColumnTypeInteger:
+		return "BIGINT"
+	case zsql.ColumnTypeFloat:
+		return "DOUBLE PRECISION"
+	case zsql.ColumnTypeBoolean:
+		return "BOOLEAN"
+	case zsql.ColumnTypeBytes:
+		return "BYTEA"
+	case zsql.ColumnTypeTime:
+		return "TIMESTAMP WITH TIME ZONE"
+	case zsql.ColumnTypeDate:
+		return "DATE"
+	case zsql.ColumnTypeJSON:
+		return "JSONB"
+	default:
+		return "TEXT"
+	}
+}
+
+func (d driver) CurrentTimeDefault() string {
+	return "CURRENT_TIMESTAMP"
+}
+
+// Tables are looked up in the current schema. information_schema doesn't
+// describe indexes, so unique indexes are read from pg_index.
+func (d driver) DescribeTable(ctx context.Context, q zsql.Queryer, table string) (*zsql.TableSchema, error) {
+	var schema zsql.TableSchema
+	found, err := zsql.Query(ctx, q, func(scan zsql.ScanFunc) error {
+		var c zsql.ColumnSchema
+		var nullable string
+		if err := scan(&c.Name, &nullable); err != nil {
+			return err
+		}
+		c.Nullable = nullable == "YES"
+		schema.Columns = append(schema.Columns, c)
+		return nil
+	}, "SELECT column_name, is_nullable FROM information_schema.columns "+
+		"WHERE table_schema = current_schema() AND table_name = ? ORDER BY ordinal_position", []any{table})
+	if err != nil {
+		return nil, fmt.Errorf("reading columns of %s: %w", table, err)
+	}
+	if !found {
+		return nil, nil
+	}
+
+	var names []string
+	indexes := map[string][]string{}
+	_, err = zsql.Query(ctx, q, func(scan zsql.ScanFunc) error {
+		var index, column string
+		if err := scan(&index, &column); err != nil {
+			return err
+		}
+		if _, ok := indexes[index]; !ok {
+			names = append(names, index)
+		}
+		indexes[index] = append(indexes[index], column)
+		return nil
+	}, "SELECT i.relname, a.attname FROM pg_index x "+
+		"JOIN pg_class t ON t.oid = x.indrelid "+
+		"JOIN pg_class i ON i.oid = x.indexrelid "+
+		"JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = ANY(x.indkey) "+
+		"WHERE x.indisunique AND t.relname = ? AND t.relnamespace = current_schema()::regnamespace "+
+		"ORDER BY i.relname, array_position(x.indkey::int2[], a.attnum)", []any{table})
+	if err != nil {
+		return nil, fmt.Errorf("reading unique indexes of %s: %w", table, err)
+	}
+
+	for _, name := range names {
+		schema.UniqueIndexes = append(schema.UniqueIndexes, indexes[name])
+	}
+
+	return &schema, nil
+}
+
+func DefaultOptions() zsql.Options {
+	return zsql.Options{
+		"sslmode":         "disable",
+		"connect_timeout": 5, // Connection timeout only, in seconds
+	}
+}
+
+func TCPConnectionString(user string, pass string, host string, port int, db string, opts zsql.Options) string {
+	if opts == nil {
+		opts = DefaultOptions()
+	}
+
+	params := url.Values{}
+	for k, v := range opts.ToStringMapString() {
+		params.Set(k, v)
+	}
+
+	uri := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(user, pass),
+		Host:     fmt.Sprintf("%s:%d", host, port),
+		Path:     "/" + db,
+		RawQuery: params.Encode(),
+	}
+
+	return uri.String()
+}
+
+func Open(dsn string, poolSize int) (zsql.Connection, error) {
+	pool, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening postgres connection: %w", err)
+	}
+
+	pool.SetConnMaxIdleTime(5 * time.Minute)
+	pool.SetMaxIdleConns((poolSize / 2) + 1)
+	pool.SetMaxOpenConns(poolSize)
+
+	return zsql.NewConnection(pool, Driver), nil
+}
@@ -0,0 +1,73 @@
+package zpostgres
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "no placeholders",
+			query: "SELECT 1",
+			want:  "SELECT 1",
+		},
+		{
+			name:  "sequential placeholders",
+			query: `SELECT "id" FROM "users" WHERE "a" = ? AND "b" IN (?, ?)`,
+			want:  `SELECT "id" FROM "users" WHERE "a" = $1 AND "b" IN ($2, $3)`,
+		},
+		{
+			name:  "placeholders in string literals are preserved",
+			query: `SELECT 'what?' FROM "t" WHERE "a" = ?`,
+			want:  `SELECT 'what?' FROM "t" WHERE "a" = $1`,
+		},
+		{
+			name:  "placeholders in identifiers are preserved",
+			query: `SELECT "odd?name" FROM "t" WHERE "a" = ?`,
+			want:  `SELECT "odd?name" FROM "t" WHERE "a" = $1`,
+		},
+		{
+			name:  "escaped quotes in literals",
+			query: `SELECT 'it''s?' WHERE "a" = ?`,
+			want:  `SELECT 'it''s?' WHERE "a" = $1`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Driver.Rebind(tt.query))
+		})
+	}
+}
+
+func TestUpsertClause(t *testing.T) {
+	assert.Equal(t,
+		`ON CONFLICT ("company") DO UPDATE SET "contact_email"=excluded."contact_email"`,
+		Driver.UpsertClause("accounts", []string{"company"}, []string{"contact_email"}, nil),
+	)
+	assert.Equal(t,
+		`ON CONFLICT ("id") DO UPDATE SET "street"=excluded."street", "version"="addresses"."version"+1`,
+		Driver.UpsertClause("addresses", []string{"id"}, []string{"street"}, []string{"version"}),
+	)
+	assert.Equal(t,
+		`ON CONFLICT ("a", "b") DO NOTHING`,
+		Driver.UpsertClause("t", []string{"a", "b"}, nil, []string{"version"}),
+	)
+}
+
+func TestIsRetryableError(t *testing.T) {
+	assert.True(t, Driver.IsRetryableError(&pq.Error{Code: "40001"}), "serialization failure")
+	assert.True(t, Driver.IsRetryableError(fmt.Errorf("committing: %w", &pq.Error{Code: "40P01"})), "deadlock")
+	assert.True(t, Driver.IsRetryableError(&pq.Error{Code: "55P03"}), "lock timeout")
+	assert.False(t, Driver.IsRetryableError(&pq.Error{Code: "23505"}), "unique violation")
+	assert.False(t, Driver.IsRetryableError(errors.New("connection refused")))
+}
@@ -10,7 +10,7 @@
 // zsql adds interfaces that database/sql is missing:
 //
 //   - Connection implements Transactor, QueryExecutor, Queryer, Executor
-//   - Transaction implements QueryExecutor, Queryer, Executor
+//   - Transaction implements Transactor, QueryExecutor, Queryer, Executor
 //
 // This enables helper functions like Query and Exec to work uniformly
 // with either connections or transactions.
@@ -34,7 +34,8 @@
 // # Transactions
 //
 // The Begin helper manages transaction lifecycle, committing on success
-// and rolling back on error:
+// and rolling back on error. It may be given a transaction, beginning a
+// nested transaction as a savepoint within it:
 //
 //	err := zsql.Begin(ctx, db, func(ctx context.Context, tx zsql.Transaction) error {
 //		_, _, err := zsql.Exec(ctx, tx, "INSERT INTO users (name) VALUES (?)", []any{"Alice"})
@@ -44,6 +45,13 @@
 //		return nil // automatic commit
 //	})
 //
+// BeginWithRetry runs the callback again, in a new transaction, when it fails
+// with an error the driver reports retryable, such as a deadlock:
+//
+//	err := zsql.BeginWithRetry(ctx, db, zsql.RetryOptions{Attempts: 5}, func(ctx context.Context, tx zsql.Transaction) error {
+//		...
+//	})
+//
 // # Querying
 //
 // Query handles result iteration and error checking, calling the callback
@@ -61,7 +69,9 @@
 //
 // # Executing
 //
-// Exec returns affected row count and last insert ID:
+// Exec returns affected row count and last insert ID. Executors whose driver
+// supports RETURNING read generated keys back through it instead, and report
+// the last insert ID as 0 when their database doesn't support it:
 //
 //	rowsAffected, lastInsertID, err := zsql.Exec(ctx, db,
 //		"UPDATE users SET active = ? WHERE id = ?", []any{false, 123})
@@ -71,6 +81,7 @@
 // Use database-specific drivers for proper escaping and dialect handling. See zorm
 //
 //   - zmysql.Driver - MySQL with backtick escaping
+//   - zpostgres.Driver - PostgreSQL with double-quote escaping and $n placeholders
 //   - zsqlite3.Driver - SQLite3 with double-quote escaping
 package zsql
 
@@ -90,7 +101,93 @@ type Driver interface {
 
 	PrepareMethod(m string) *string
 
+	// Rebind rewrites the ? placeholders used throughout zote into the
+	// driver's native placeholder syntax.
+	Rebind(query string) string
+
+	// SupportsReturning reports whether INSERT statements may use a RETURNING
+	// clause to read back generated values.
+	SupportsReturning() bool
+
+	// MaxParameters is the most placeholders a single statement may bind.
+	MaxParameters() int
+
+	// UpsertClause renders the clause appended to an INSERT into table so
+	// that rows conflicting on conflictColumns instead update updateColumns
+	// from the proposed row and increment incrementColumns, or are skipped
+	// when updateColumns is empty.
+	UpsertClause(table string, conflictColumns []string, updateColumns []string, incrementColumns []string) string
+
 	IsConflictError(error) bool
+
+	// IsRetryableError reports whether an error aborted a transaction that
+	// may succeed when run again from the start, such as a deadlock, lock
+	// wait timeout or serialization failure.
+	IsRetryableError(error) bool
+
+	// ColumnDefinition renders the type of a column in a CREATE TABLE
+	// statement. An autoIncrement column is the table's integer primary key,
+	// generated on insert, and its definition declares it the primary key.
+	ColumnDefinition(t ColumnType, autoIncrement bool) string
+
+	// CurrentTimeDefault renders the DEFAULT expression of a time column,
+	// as ColumnDefinition renders it, that defaults to the current time.
+	CurrentTimeDefault() string
+
+	// DescribeTable reads the columns and unique indexes of table from the
+	// database's catalog, returning nil when the table doesn't exist.
+	DescribeTable(ctx context.Context, q Queryer, table string) (*TableSchema, error)
+}
+
+// TableSchema describes a table as it exists in the database.
+type TableSchema struct {
+	Columns []ColumnSchema
+
+	// UniqueIndexes lists the columns of each unique index or constraint,
+	// including the primary key.
+	UniqueIndexes [][]string
+}
+
+type ColumnSchema struct {
+	Name     string
+	Nullable bool
+}
+
+// Column returns the column named name.
+func (s TableSchema) Column(name string) (ColumnSchema, bool) {
+	for _, c := range s.Columns {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return ColumnSchema{}, false
+}
+
+// ColumnType is a portable column type, rendered by each Driver in its own
+// dialect.
+type ColumnType string
+
+const (
+	ColumnTypeInteger ColumnType = "integer"
+	ColumnTypeFloat   ColumnType = "float"
+	ColumnTypeBoolean ColumnType = "boolean"
+	ColumnTypeText    ColumnType = "text"
+	ColumnTypeBytes   ColumnType = "bytes"
+	ColumnTypeTime    ColumnType = "time"
+	ColumnTypeDate    ColumnType = "date"
+	ColumnTypeJSON    ColumnType = "json"
+)
+
+// ColumnTypes lists every ColumnType.
+var ColumnTypes = []ColumnType{
+	ColumnTypeInteger,
+	ColumnTypeFloat,
+	ColumnTypeBoolean,
+	ColumnTypeText,
+	ColumnTypeBytes,
+	ColumnTypeTime,
+	ColumnTypeDate,
+	ColumnTypeJSON,
 }
 
 type HasDriver interface {
@@ -116,8 +213,11 @@ type Transactor interface {
 	TransactionBeginner
 }
 
+// Transaction is a database transaction. Transactions begun within it are
+// nested in it as savepoints.
 type Transaction interface {
 	QueryExecutor
+	TransactionBeginner
 	TransactionEnder
 }
 
@@ -154,17 +254,18 @@ func (c connection) Driver() Driver {
 func (c connection) Begin(ctx context.Context, opts *sql.TxOptions) (Transaction, error) {
 	tx, err := c.db.BeginTx(ctx, opts)
 	return transaction{
-		source: c,
-		tx:     tx,
+		source:     c,
+		tx:         tx,
+		savepoints: new(int),
 	}, err
 }
 
 func (c connection) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
-	return c.db.QueryContext(ctx, query, args...)
+	return c.db.QueryContext(ctx, c.driver.Rebind(query), args...)
 }
 
 func (c connection) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
-	return c.db.ExecContext(ctx, query, args...)
+	return c.db.ExecContext(ctx, c.driver.Rebind(query), args...)
 }
 
 func (c connection) Close() error {
@@ -174,12 +275,22 @@ func (c connection) Close() error {
 type transaction struct {
 	source connection
 	tx     *sql.Tx
+
+	// savepoints counts the savepoints created in the transaction, naming
+	// each uniquely
+	savepoints *int
 }
 
 func (t transaction) Driver() Driver {
 	return t.source.Driver()
 }
 
+// Begin begins a nested transaction by creating a savepoint. Options aren't
+// supported, as they can only be set on the outer transaction.
+func (t transaction) Begin(ctx context.Context, opts *sql.TxOptions) (Transaction, error) {
+	return beginSavepoint(ctx, t, t.savepoints, opts)
+}
+
 func (t transaction) Commit() error {
 	return t.tx.Commit()
 }
@@ -189,11 +300,83 @@ func (t transaction) Rollback() error {
 }
 
 func (t transaction) Query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
-	return t.tx.QueryContext(ctx, query, args...)
+	return t.tx.QueryContext(ctx, t.Driver().Rebind(query), args...)
 }
 
 func (t transaction) Exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
-	return t.tx.ExecContext(ctx, query, args...)
+	return t.tx.ExecContext(ctx, t.Driver().Rebind(query), args...)
+}
+
+// savepoint is a transaction nested in another, committed by releasing its
+// savepoint and rolled back by rolling back to it. Savepoint statements are
+// the same in every supported database.
+type savepoint struct {
+	QueryExecutor
+
+	// ctx carries the values of the context the savepoint was begun with, but
+	// not its cancellation, so that it can still be released or rolled back
+	// once that context is done
+	ctx        context.Context
+	name       string
+	savepoints *int
+	done       bool
+}
+
+func beginSavepoint(ctx context.Context, parent QueryExecutor, savepoints *int, opts *sql.TxOptions) (Transaction, error) {
+	if opts != nil && (opts.Isolation != sql.LevelDefault || opts.ReadOnly) {
+		return nil, fmt.Errorf("nested transactions do not support options")
+	}
+
+	*savepoints++
+	sp := &savepoint{
+		QueryExecutor: parent,
+		ctx:           context.WithoutCancel(ctx),
+		name:          fmt.Sprintf("zsql_savepoint_%d", *savepoints),
+		savepoints:    savepoints,
+	}
+
+	if _, err := parent.Exec(ctx, "SAVEPOINT "+sp.name); err != nil {
+		return nil, fmt.Errorf("creating savepoint: %w", err)
+	}
+
+	return sp, nil
+}
+
+func (s *savepoint) Begin(ctx context.Context, opts *sql.TxOptions) (Transaction, error) {
+	if s.done {
+		return nil, sql.ErrTxDone
+	}
+	return beginSavepoint(ctx, s, s.savepoints, opts)
+}
+
+func (s *savepoint) Commit() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+
+	if _, err := s.QueryExecutor.Exec(s.ctx, "RELEASE SAVEPOINT "+s.name); err != nil {
+		return fmt.Errorf("releasing savepoint: %w", err)
+	}
+	return nil
+}
+
+func (s *savepoint) Rollback() error {
+	if s.done {
+		return sql.ErrTxDone
+	}
+	s.done = true
+
+	if _, err := s.QueryExecutor.Exec(s.ctx, "ROLLBACK TO SAVEPOINT "+s.name); err != nil {
+		return fmt.Errorf("rolling back to savepoint: %w", err)
+	}
+
+	// Rolling back keeps the savepoint, so it's released to leave the
+	// enclosing transaction as it was before it
+	if _, err := s.QueryExecutor.Exec(s.ctx, "RELEASE SAVEPOINT "+s.name); err != nil {
+		return fmt.Errorf("releasing savepoint: %w", err)
+	}
+	return nil
 }
 
 type Options map[string]interface{}
@@ -217,6 +400,9 @@ func (o Options) ToStringMapString() map[string]string {
 	return res
 }
 
+// Begin runs cb in a transaction begun on db, committing it when cb succeeds
+// and rolling it back when cb fails. db may be a Connection, or a Transaction
+// to run cb in a nested transaction.
 func Begin(ctx context.Context, db Transactor, cb func(context.Context, Transaction) error) error {
 	tx, err := db.Begin(ctx, nil)
 	if err != nil {
@@ -286,7 +472,13 @@ func Exec(ctx context.Context, db Executor, query string, args []any) (int, int6
 
 	id, err := res.LastInsertId()
 	if err != nil {
-		return 0, 0, fmt.Errorf("getting last insert id: %w", err)
+		// Drivers that return generated keys through RETURNING, such as
+		// postgres, may not support LastInsertId; the id is reported as 0
+		// for them.
+		if d, ok := db.(HasDriver); !ok || !d.Driver().SupportsReturning() {
+			return 0, 0, fmt.Errorf("getting last insert id: %w", err)
+		}
+		id = 0
 	}
 
 	return int(count), id, nil
@@ -1,6 +1,7 @@
 package zsqlite3
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -55,9 +56,144 @@ func (d driver) PrepareMethod(m string) *string {
 	return result
 }
 
+func (d driver) Rebind(query string) string {
+	return query
+}
+
+// SQLite has supported RETURNING since 3.35.
+func (d driver) SupportsReturning() bool {
+	return true
+}
+
+func (d driver) MaxParameters() int {
+	// SQLITE_MAX_VARIABLE_NUMBER defaults to 32766 since 3.32.
+	return 32766
+}
+
+func (d driver) UpsertClause(table string, conflictColumns []string, updateColumns []string, incrementColumns []string) string {
+	target := make([]string, 0, len(conflictColumns))
+	for _, c := range conflictColumns {
+		target = append(target, d.EscapeColumn(c))
+	}
+
+	if len(updateColumns) == 0 {
+		return "ON CONFLICT (" + strings.Join(target, ", ") + ") DO NOTHING"
+	}
+
+	assignments := make([]string, 0, len(updateColumns))
+	for _, c := range updateColumns {
+		assignments = append(assignments, fmt.Sprintf("%s=excluded.%s", d.EscapeColumn(c), d.EscapeColumn(c)))
+	}
+	for _, c := range incrementColumns {
+		assignments = append(assignments, fmt.Sprintf("%s=%s+1", d.EscapeColumn(c), d.EscapeTableColumn(table, c)))
+	}
+
+	return "ON CONFLICT (" + strings.Join(target, ", ") + ") DO UPDATE SET " + strings.Join(assignments, ", ")
+}
+
+// Constraint errors carry extended result codes; only unique and primary key
+// violations are conflicts, not NOT NULL, FOREIGN KEY or CHECK violations.
 func (d driver) IsConflictError(err error) bool {
 	var sqliteErr *sqlite.Error
-	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// The database is busy or a table is locked while another connection
+// writes to it, beyond the busy timeout of the connection.
+func (d driver) IsRetryableError(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
+
+// SQLite only generates keys for INTEGER PRIMARY KEY columns, and types are
+// affinities, so JSON is stored as TEXT.
+func (d driver) ColumnDefinition(t zsql.ColumnType, autoIncrement bool) string {
+	if autoIncrement {
+		return "INTEGER PRIMARY KEY AUTOINCREMENT"
+	}
+
+	switch t {
+	case zsql.ColumnTypeInteger:
+		return "INTEGER"
+	case zsql.ColumnTypeFloat:
+		return "REAL"
+	case zsql.ColumnTypeBoolean:
+		return "BOOLEAN"
+	case zsql.ColumnTypeBytes:
+		return "BLOB"
+	case zsql.ColumnTypeTime:
+		return "DATETIME"
+	case zsql.ColumnTypeDate:
+		return "DATE"
+	default:
+		return "TEXT"
+	}
+}
+
+func (d driver) CurrentTimeDefault() string {
+	return "CURRENT_TIMESTAMP"
+}
+
+// INTEGER PRIMARY KEY columns alias the rowid, which has no index and is
+// never NULL, so the primary key is read from the table's columns.
+func (d driver) DescribeTable(ctx context.Context, q zsql.Queryer, table string) (*zsql.TableSchema, error) {
+	var schema zsql.TableSchema
+	var primaryKey []string
+	found, err := zsql.Query(ctx, q, func(scan zsql.ScanFunc) error {
+		var c zsql.ColumnSchema
+		var notNull, pk int
+		if err := scan(&c.Name, &notNull, &pk); err != nil {
+			return err
+		}
+		c.Nullable = notNull == 0 && pk == 0
+		schema.Columns = append(schema.Columns, c)
+		if pk > 0 {
+			primaryKey = append(primaryKey, c.Name)
+		}
+		return nil
+	}, `SELECT name, "notnull", pk FROM pragma_table_info(?) ORDER BY cid`, []any{table})
+	if err != nil {
+		return nil, fmt.Errorf("reading columns of %s: %w", table, err)
+	}
+	if !found {
+		return nil, nil
+	}
+
+	var names []string
+	indexes := map[string][]string{}
+	_, err = zsql.Query(ctx, q, func(scan zsql.ScanFunc) error {
+		var index, column string
+		if err := scan(&index, &column); err != nil {
+			return err
+		}
+		if _, ok := indexes[index]; !ok {
+			names = append(names, index)
+		}
+		indexes[index] = append(indexes[index], column)
+		return nil
+	}, `SELECT il.name, ii.name FROM pragma_index_list(?) il JOIN pragma_index_info(il.name) ii `+
+		`WHERE il."unique" = 1 ORDER BY il.name, ii.seqno`, []any{table})
+	if err != nil {
+		return nil, fmt.Errorf("reading unique indexes of %s: %w", table, err)
+	}
+
+	for _, name := range names {
+		schema.UniqueIndexes = append(schema.UniqueIndexes, indexes[name])
+	}
+
+	if len(primaryKey) > 0 {
+		schema.UniqueIndexes = append(schema.UniqueIndexes, primaryKey)
+	}
+
+	return &schema, nil
 }
 
 func DefaultOptions() zsql.Options {